@@ -2,6 +2,7 @@ package logsql
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"math"
 	"net/http"
@@ -25,6 +26,11 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
 )
 
+var statsMaxStateSizePercent = flag.Float64("search.statsMaxStateSizePercent", 0, "The maximum share of the allowed memory in percent, "+
+	"which can be used by every 'stats' pipe in a query. The default limit is 40% of the allowed memory. The limit cannot exceed 80%. "+
+	"Bigger limits allow calculating stats over bigger number of groups, while increasing the risk of OOM for concurrently executed queries. "+
+	"See https://docs.victoriametrics.com/victorialogs/logsql/#stats-pipe")
+
 // ProcessFacetsRequest handles /select/logsql/facets request.
 //
 // See https://docs.victoriametrics.com/victorialogs/querying/#querying-facets
@@ -525,7 +531,13 @@ func ProcessLiveTailRequest(ctx context.Context, w http.ResponseWriter, r *http.
 		case <-doneCh:
 			return
 		case <-ticker.C:
-			start = end - tailOffsetNsecs
+			if windowStart, ok := qOrig.GetStatsWindowStart(end); ok {
+				// 'stats window ...' returns only complete windows, so continue from the first incomplete window.
+				// This guarantees that every window is returned exactly once.
+				start = windowStart
+			} else {
+				start = end - tailOffsetNsecs
+			}
 			end = time.Now().UnixNano() - offset
 		}
 	}
@@ -1110,6 +1122,12 @@ func parseCommonArgs(r *http.Request) (*logstorage.Query, []logstorage.TenantID,
 	}
 	q.AddExtraFilters(extraStreamFilters)
 
+	if *statsMaxStateSizePercent > 0 {
+		if err := q.SetStatsMaxStateSizePercent(*statsMaxStateSizePercent); err != nil {
+			return nil, nil, fmt.Errorf("unexpected -search.statsMaxStateSizePercent: %w", err)
+		}
+	}
+
 	return q, tenantIDs, nil
 }
 
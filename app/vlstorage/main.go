@@ -37,6 +37,10 @@ var (
 		"see https://docs.victoriametrics.com/victorialogs/data-ingestion/ ; see also -logNewStreams")
 	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which "+
 		"the storage stops accepting new data")
+	statsResultCacheTTL = flag.Duration("search.statsResultCacheTTL", 0, "The lifetime for the cached results of 'stats' pipes. "+
+		"The cache speeds up repeated queries with identical 'stats' pipes and identical time ranges such as dashboard refreshes. "+
+		"The cached results are invalidated when new logs are ingested into the queried time range. "+
+		"The cache is disabled by default; see https://docs.victoriametrics.com/victorialogs/logsql/#stats-pipe")
 
 	forceMergeAuthKey = flagutil.NewPassword("forceMergeAuthKey", "authKey, which must be passed in query string to /internal/force_merge pages. It overrides -httpAuth.*")
 )
@@ -60,6 +64,7 @@ func Init() {
 		LogNewStreams:          *logNewStreams,
 		LogIngestedRows:        *logIngestedRows,
 		MinFreeDiskSpaceBytes:  minFreeDiskSpaceBytes.N,
+		StatsResultCacheTTL:    *statsResultCacheTTL,
 	}
 	logger.Infof("opening storage at -storageDataPath=%s", *storageDataPath)
 	startTime := time.Now()
@@ -228,6 +233,9 @@ func writeStorageMetrics(w io.Writer, strg *logstorage.Storage) {
 
 	metrics.WriteCounterUint64(w, `vl_rows_dropped_total{reason="too_big_timestamp"}`, ss.RowsDroppedTooBigTimestamp)
 	metrics.WriteCounterUint64(w, `vl_rows_dropped_total{reason="too_small_timestamp"}`, ss.RowsDroppedTooSmallTimestamp)
+
+	metrics.WriteCounterUint64(w, `vl_cache_requests_total{type="stats_result"}`, ss.StatsResultCacheRequests)
+	metrics.WriteCounterUint64(w, `vl_cache_misses_total{type="stats_result"}`, ss.StatsResultCacheMisses)
 }
 
 var activeForceMerges = metrics.NewCounter("vl_active_force_merges")
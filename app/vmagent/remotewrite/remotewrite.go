@@ -15,6 +15,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bloomfilter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
@@ -174,6 +175,13 @@ func Init() {
 		})
 	}
 
+	if !zstd.ValidLevel(*vmProtoCompressLevel) {
+		level := zstd.ClampLevel(*vmProtoCompressLevel)
+		logger.Warnf("-remoteWrite.vmProtoCompressLevel=%d is out of the supported range [%d ... %d]; using %d instead",
+			*vmProtoCompressLevel, zstd.MinLevel, zstd.MaxLevel, level)
+		*vmProtoCompressLevel = level
+	}
+
 	if *queues > maxQueues {
 		*queues = maxQueues
 	}
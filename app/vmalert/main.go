@@ -104,7 +104,7 @@ func main() {
 		logger.Fatalf("failed to init external.url %q: %s", *externalURL, err)
 	}
 
-	err = templates.Load(*ruleTemplatesPath, *extURL)
+	err = templates.Load(*ruleTemplatesPath, *extURL, nil)
 	if err != nil {
 		logger.Fatalf("failed to load template %q: %s", *ruleTemplatesPath, err)
 	}
@@ -363,20 +363,25 @@ func configReload(ctx context.Context, m *manager, groupsCfg []config.Group, sig
 			logger.Errorf("failed to reload notifier config: %s", err)
 			continue
 		}
-		err := templates.Load(*ruleTemplatesPath, *extURL)
+		// Prevent from concurrent templates reload until the loaded templates are either promoted or abandoned.
+		templates.LockReload()
+		err := templates.Load(*ruleTemplatesPath, *extURL, nil)
 		if err != nil {
+			templates.UnlockReload()
 			setConfigError(err)
 			logger.Errorf("failed to load new templates: %s", err)
 			continue
 		}
 		newGroupsCfg, err := parseFn(*rulePath, validateTplFn, *validateExpressions)
 		if err != nil {
+			templates.UnlockReload()
 			setConfigError(err)
 			logger.Errorf("cannot parse configuration file: %s", err)
 			continue
 		}
 		if configsEqual(newGroupsCfg, groupsCfg) {
 			templates.Reload()
+			templates.UnlockReload()
 			// set success to 1 since previous reload could have been unsuccessful
 			// do not update configTimestamp as config version remains old.
 			configSuccess.Set(1)
@@ -386,11 +391,13 @@ func configReload(ctx context.Context, m *manager, groupsCfg []config.Group, sig
 			continue
 		}
 		if err := m.update(ctx, newGroupsCfg, false); err != nil {
+			templates.UnlockReload()
 			setConfigError(err)
 			logger.Errorf("error while reloading rules: %s", err)
 			continue
 		}
 		templates.Reload()
+		templates.UnlockReload()
 		groupsCfg = newGroupsCfg
 		setConfigSuccessAt(fasttime.UnixTimestamp())
 		logger.Infof("Rules reloaded successfully from %q", *rulePath)
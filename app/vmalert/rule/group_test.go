@@ -28,7 +28,7 @@ func init() {
 }
 
 func TestMain(m *testing.M) {
-	if err := templates.Load([]string{}, url.URL{}); err != nil {
+	if err := templates.Load([]string{}, url.URL{}, nil); err != nil {
 		fmt.Println("failed to load template for test")
 		os.Exit(1)
 	}
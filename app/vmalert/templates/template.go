@@ -14,6 +14,7 @@
 package templates
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	htmlTpl "html/template"
@@ -21,6 +22,8 @@ import (
 	"math"
 	"net"
 	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -28,11 +31,15 @@ import (
 	"sync"
 	textTpl "text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bmatcuk/doublestar/v4"
+	"github.com/cespare/xxhash/v2"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/formatutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promutils"
 )
 
@@ -48,22 +55,58 @@ type textTemplate struct {
 
 var masterTmpl textTemplate
 
-func newTemplate() *textTpl.Template {
-	tmpl := textTpl.New("").Option("missingkey=zero").Funcs(templateFuncs())
+func newTemplate(funcs textTpl.FuncMap) *textTpl.Template {
+	tmpl := textTpl.New("").Option("missingkey=zero").Funcs(funcs)
 	return textTpl.Must(tmpl.Parse(defaultTemplate))
 }
 
+// mergeCustomFuncs returns built-in template functions merged with customFuncs.
+//
+// An error is returned if customFuncs contain functions with the names of built-in functions,
+// since silently overriding or ignoring them would result in unexpected templating results.
+func mergeCustomFuncs(customFuncs textTpl.FuncMap) (textTpl.FuncMap, error) {
+	funcs := templateFuncs()
+	var names []string
+	for name := range customFuncs {
+		if _, ok := funcs[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return nil, fmt.Errorf("custom template functions %q conflict with built-in template functions", names)
+	}
+	for name, f := range customFuncs {
+		funcs[name] = f
+	}
+	return funcs, nil
+}
+
 // Load func loads templates from multiple globs specified in pathPatterns and either
 // sets them directly to current template if it's the first init;
 // or sets replacement templates and wait for Reload() to replace current template with replacement.
-func Load(pathPatterns []string, externalURL url.URL) error {
-	tmpl := newTemplate()
+//
+// Load returns an error if the same template is defined in multiple files,
+// since otherwise the last loaded definition would silently override the previous ones.
+//
+// customFuncs are optional functions, which are added to the built-in template functions.
+// Load returns an error if customFuncs contain functions with the names of built-in functions.
+func Load(pathPatterns []string, externalURL url.URL, customFuncs textTpl.FuncMap) error {
+	funcs, err := mergeCustomFuncs(customFuncs)
+	if err != nil {
+		return err
+	}
+	tmpl := newTemplate(funcs)
+	definedIn := make(map[string]string)
 	for _, tp := range pathPatterns {
 		p, err := doublestar.FilepathGlob(tp)
 		if err != nil {
 			return fmt.Errorf("failed to retrieve a template glob %q: %w", tp, err)
 		}
 		if len(p) > 0 {
+			if err := checkDuplicateDefines(definedIn, p, funcs); err != nil {
+				return fmt.Errorf("failed to parse template glob %q: %w", tp, err)
+			}
 			tmpl, err = tmpl.ParseFiles(p...)
 			if err != nil {
 				return fmt.Errorf("failed to parse template glob %q: %w", tp, err)
@@ -88,6 +131,61 @@ func Load(pathPatterns []string, externalURL url.URL) error {
 	return nil
 }
 
+// checkDuplicateDefines verifies that templates defined in the given files
+// aren't defined in other files registered in definedIn.
+//
+// definedIn maps template names to the files they are defined in.
+// It is updated with templates defined in files.
+func checkDuplicateDefines(definedIn map[string]string, files []string, funcs textTpl.FuncMap) error {
+	var conflicts []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fileName := filepath.Base(file)
+		tmpl, err := textTpl.New(fileName).Funcs(funcs).Parse(string(data))
+		if err != nil {
+			return err
+		}
+		var names []string
+		for _, t := range tmpl.Templates() {
+			if name := t.Name(); name != fileName {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prevFile, ok := definedIn[name]
+			if ok && prevFile != file {
+				conflicts = append(conflicts, fmt.Sprintf("template %q is defined in multiple files: %q and %q", name, prevFile, file))
+				continue
+			}
+			definedIn[name] = file
+		}
+	}
+	if len(conflicts) > 0 {
+		return errors.New(strings.Join(conflicts, "; "))
+	}
+	return nil
+}
+
+// reloadMu serializes template reloads made by WatchTemplateFiles with the reloads made via LockReload.
+var reloadMu sync.Mutex
+
+// LockReload must be called before Load if the loaded replacement template is promoted via Reload only after additional checks.
+//
+// This prevents WatchTemplateFiles from overriding or promoting the staged replacement template in the meantime.
+// UnlockReload must be called after the Reload call or after the replacement template is abandoned.
+func LockReload() {
+	reloadMu.Lock()
+}
+
+// UnlockReload unlocks reloads locked via LockReload.
+func UnlockReload() {
+	reloadMu.Unlock()
+}
+
 // Reload func replaces current template with a replacement template
 // which was set by Load with override=false
 func Reload() {
@@ -99,6 +197,91 @@ func Reload() {
 	}
 }
 
+// WatchTemplateFiles periodically checks templates matching pathPatterns
+// for changes with the given interval and reloads them via Load and Reload
+// when their contents change. customFuncs are passed to Load.
+//
+// Reloads are serialized with the reloads made under LockReload.
+//
+// Templates are left unchanged if the updated files cannot be loaded.
+// The returned stop func must be called for stopping the watcher.
+func WatchTemplateFiles(pathPatterns []string, externalURL url.URL, customFuncs textTpl.FuncMap, interval time.Duration) (stop func()) {
+	prevHash, err := templateFilesHash(pathPatterns)
+	if err != nil {
+		logger.Errorf("cannot read templates from %q: %s", pathPatterns, err)
+	}
+
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			h, err := templateFilesHash(pathPatterns)
+			if err != nil {
+				logger.Errorf("cannot read templates from %q: %s", pathPatterns, err)
+				continue
+			}
+			if h == prevHash {
+				continue
+			}
+			// Update prevHash before loading, so broken templates are reported only once per change.
+			prevHash = h
+			if err := reloadTemplates(pathPatterns, externalURL, customFuncs); err != nil {
+				logger.Errorf("cannot reload templates from %q; continue using the previously loaded templates: %s", pathPatterns, err)
+				continue
+			}
+			logger.Infof("successfully reloaded templates from %q", pathPatterns)
+		}
+	}()
+
+	return func() {
+		close(stopCh)
+		wg.Wait()
+	}
+}
+
+func reloadTemplates(pathPatterns []string, externalURL url.URL, customFuncs textTpl.FuncMap) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := Load(pathPatterns, externalURL, customFuncs); err != nil {
+		return err
+	}
+	Reload()
+	return nil
+}
+
+// templateFilesHash returns a hash over paths and contents of files matching pathPatterns.
+func templateFilesHash(pathPatterns []string) (uint64, error) {
+	d := xxhash.New()
+	for _, tp := range pathPatterns {
+		p, err := doublestar.FilepathGlob(tp)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve a template glob %q: %w", tp, err)
+		}
+		for _, file := range p {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return 0, err
+			}
+			_, _ = d.WriteString(file)
+			_, _ = d.Write([]byte{0})
+			_, _ = d.Write(data)
+			_, _ = d.Write([]byte{0})
+		}
+	}
+	return d.Sum64(), nil
+}
+
 // metric is private copy of datasource.Metric,
 // it is used for templating annotations,
 // Labels as map simplifies templates evaluation.
@@ -169,7 +352,56 @@ func funcsWithExternalURL(externalURL url.URL) textTpl.FuncMap {
 		"pathPrefix": func() string {
 			return externalURL.Path
 		},
+
+		"externalURLJoin": func(path string) string {
+			return externalURLJoin(externalURL, path)
+		},
+	}
+}
+
+// externalURLJoin joins externalURL with the given path, which may contain query args after '?'.
+//
+// Duplicate slashes between externalURL path and the given path are removed.
+// The path and query args are escaped, while already escaped chars are left as is.
+func externalURLJoin(externalURL url.URL, path string) string {
+	path, query, hasQuery := strings.Cut(path, "?")
+	if s, err := url.PathUnescape(path); err == nil {
+		path = s
+	}
+
+	u := externalURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	if !hasQuery {
+		return u.String()
+	}
+
+	var a []string
+	if u.RawQuery != "" {
+		a = append(a, u.RawQuery)
+	}
+	for _, arg := range strings.Split(query, "&") {
+		if arg == "" {
+			continue
+		}
+		k, v, hasValue := strings.Cut(arg, "=")
+		arg = escapeQueryArgPart(k)
+		if hasValue {
+			arg += "=" + escapeQueryArgPart(v)
+		}
+		a = append(a, arg)
+	}
+	u.RawQuery = strings.Join(a, "&")
+	return u.String()
+}
+
+func escapeQueryArgPart(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		s = unescaped
 	}
+	return url.QueryEscape(s)
 }
 
 // templateFuncs initiates template helper functions
@@ -192,6 +424,32 @@ func templateFuncs() textTpl.FuncMap {
 		// alias for https://golang.org/pkg/strings/#ToLower
 		"toLower": strings.ToLower,
 
+		// toSentenceCase returns s with the first Unicode letter mapped to its upper case
+		// and all the remaining Unicode letters mapped to their lower case.
+		"toSentenceCase": func(s string) string {
+			s = strings.ToLower(s)
+			r, size := utf8.DecodeRuneInString(s)
+			if r == utf8.RuneError {
+				return s
+			}
+			return string(unicode.ToUpper(r)) + s[size:]
+		},
+
+		// truncate returns the first n Unicode chars from s followed by "…"
+		// if s contains more than n chars. Otherwise s is returned as is.
+		"truncate": func(n int, s string) string {
+			if n < 0 {
+				n = 0
+			}
+			for i := range s {
+				if n == 0 {
+					return s[:i] + "…"
+				}
+				n--
+			}
+			return s
+		},
+
 		// crlfEscape replaces '\n' and '\r' chars with `\\n` and `\\r`.
 		// This function is deprecated.
 		//
@@ -212,6 +470,30 @@ func templateFuncs() textTpl.FuncMap {
 		// See also quotesEscape.
 		"jsonEscape": jsonEscape,
 
+		// toJSON serializes v to JSON string.
+		// Map keys are sorted, so the result is stable across template executions.
+		//
+		// See also parseJSON.
+		"toJSON": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return "", fmt.Errorf("cannot marshal %v to JSON: %w", v, err)
+			}
+			return string(data), nil
+		},
+
+		// parseJSON parses JSON string s into the corresponding value,
+		// which can be further accessed in templates via index, range, etc.
+		//
+		// See also toJSON.
+		"parseJSON": func(s string) (any, error) {
+			var v any
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, fmt.Errorf("cannot parse JSON %q: %w", s, err)
+			}
+			return v, nil
+		},
+
 		// htmlEscape applies html-escaping to q, so it can be safely embedded as plaintext into html.
 		//
 		// See also safeHtml.
@@ -226,6 +508,12 @@ func templateFuncs() textTpl.FuncMap {
 			return host
 		},
 
+		// splitHostPort splits hostPort into host and port parts.
+		// The port is empty if hostPort doesn't contain it.
+		// Brackets are removed from IPv6 hosts, e.g. "[::1]:80" is split into "::1" and "80".
+		// Use .Host and .Port fields of the returned value for accessing the parts.
+		"splitHostPort": splitHostPort,
+
 		// stripDomain removes the domain part of a FQDN. Leaves port untouched.
 		"stripDomain": func(hostPort string) string {
 			host, port, err := net.SplitHostPort(hostPort)
@@ -321,6 +609,53 @@ func templateFuncs() textTpl.FuncMap {
 			return formatutil.HumanizeBytes(v), nil
 		},
 
+		// humanizeBytes converts given number of bytes to a human readable format
+		// with the given base, which must be either 1000 or 1024.
+		// The unit is chosen automatically and is always suffixed with B,
+		// e.g. 1536 is converted to 1.5KiB with base 1024, while 1500000
+		// is converted to 1.5MB with base 1000.
+		"humanizeBytes": func(base int, i any) (string, error) {
+			var prefixes []string
+			switch base {
+			case 1000:
+				prefixes = []string{"k", "M", "G", "T", "P", "E", "Z", "Y"}
+			case 1024:
+				prefixes = []string{"Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"}
+			default:
+				return "", fmt.Errorf("unsupported base %d; supported values: 1000, 1024", base)
+			}
+			v, err := toFloat64(i)
+			if err != nil {
+				return "", err
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Sprintf("%.4g", v), nil
+			}
+			prefix := ""
+			for _, p := range prefixes {
+				if math.Abs(v) < float64(base) {
+					break
+				}
+				prefix = p
+				v /= float64(base)
+			}
+			return fmt.Sprintf("%.4g%sB", v, prefix), nil
+		},
+
+		// humanizeExact converts given number to a string with the given number of decimals
+		// and with thousands separators without rounding to a few significant digits,
+		// e.g. 1234567 is converted to 1,234,567, while -1234.5678 with 2 decimals is converted to -1,234.57.
+		"humanizeExact": func(decimals int, i any) (string, error) {
+			if decimals < 0 {
+				return "", fmt.Errorf("decimals cannot be negative; got %d", decimals)
+			}
+			v, err := toFloat64(i)
+			if err != nil {
+				return "", err
+			}
+			return humanizeExact(decimals, v), nil
+		},
+
 		// humanizeDuration converts given seconds to a human-readable duration
 		"humanizeDuration": func(i any) (string, error) {
 			v, err := toFloat64(i)
@@ -402,6 +737,26 @@ func templateFuncs() textTpl.FuncMap {
 			return t, nil
 		},
 
+		// formatTime converts given timestamp to a string formatted
+		// according to the given layout in the given tz timezone.
+		// See https://pkg.go.dev/time#pkg-constants for layout examples.
+		// tz must be a valid IANA Time Zone name, e.g. "UTC" or "Europe/Berlin".
+		"formatTime": func(i any, layout, tz string) (string, error) {
+			v, err := toFloat64(i)
+			if err != nil {
+				return "", err
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return "", fmt.Errorf("cannot convert %v to time.Time", v)
+			}
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return "", fmt.Errorf("cannot load timezone %q: %w", tz, err)
+			}
+			t := timeFromUnixTimestamp(v).Time().In(loc)
+			return t.Format(layout), nil
+		},
+
 		/* URLs */
 
 		// externalURL returns value of `external.url` flag
@@ -424,6 +779,15 @@ func templateFuncs() textTpl.FuncMap {
 			return ""
 		},
 
+		// externalURLJoin joins the value of `external.url` flag with the given path,
+		// which may contain query args, e.g. `{{ externalURLJoin "/vmalert/groups" }}`.
+		"externalURLJoin": func(path string) string {
+			// externalURLJoin function supposed to be substituted at FuncsWithExteralURL().
+			// it is present here only for validation purposes, when there is no
+			// provided datasource.
+			return path
+		},
+
 		// pathEscape escapes the string so it can be safely placed inside a URL path segment.
 		//
 		// See also queryEscape.
@@ -483,6 +847,19 @@ func templateFuncs() textTpl.FuncMap {
 			return metrics
 		},
 
+		// sortByValue sorts the given metrics by their values in ascending order.
+		// NaN values are put first.
+		"sortByValue": func(metrics []metric) []metric {
+			sort.SliceStable(metrics, func(i, j int) bool {
+				a, b := metrics[i].Value, metrics[j].Value
+				if math.IsNaN(a) {
+					return !math.IsNaN(b)
+				}
+				return a < b
+			})
+			return metrics
+		},
+
 		/* Helpers */
 
 		// Converts a list of objects to a map with keys arg0, arg1 etc.
@@ -504,6 +881,54 @@ func templateFuncs() textTpl.FuncMap {
 	}
 }
 
+func humanizeExact(decimals int, v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprintf("%.4g", v)
+	}
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		// Do not add the sign to numbers rounded to zero.
+		b.WriteByte('-')
+	}
+	for i := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte(intPart[i])
+	}
+	if fracPart != "" {
+		b.WriteByte('.')
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
+
+// hostPort holds host and port parts returned by splitHostPort template func.
+type hostPort struct {
+	Host string
+	Port string
+}
+
+func splitHostPort(s string) hostPort {
+	host, port, err := net.SplitHostPort(s)
+	if err == nil {
+		return hostPort{
+			Host: host,
+			Port: port,
+		}
+	}
+	// s has no port
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	return hostPort{
+		Host: s,
+	}
+}
+
 // Time is the number of milliseconds since the epoch
 // (1970-01-01 00:00 UTC) excluding leap seconds.
 type Time int64
@@ -3,9 +3,12 @@ package templates
 import (
 	"math"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	textTpl "text/template"
+	"time"
 )
 
 func TestTemplateFuncs_StringConversion(t *testing.T) {
@@ -24,6 +27,10 @@ func TestTemplateFuncs_StringConversion(t *testing.T) {
 	f("title", "foo bar", "Foo Bar")
 	f("toUpper", "foo", "FOO")
 	f("toLower", "FOO", "foo")
+	f("toSentenceCase", "", "")
+	f("toSentenceCase", "foo BAR baz", "Foo bar baz")
+	f("toSentenceCase", "привет МИР", "Привет мир")
+	f("toSentenceCase", "123 FOO", "123 foo")
 	f("pathEscape", "foo/bar\n+baz", "foo%2Fbar%0A+baz")
 	f("queryEscape", "foo+bar\n+baz", "foo%2Bbar%0A%2Bbaz")
 	f("jsonEscape", `foo{bar="baz"}`+"\n + 1", `"foo{bar=\"baz\"}\n + 1"`)
@@ -32,10 +39,62 @@ func TestTemplateFuncs_StringConversion(t *testing.T) {
 	f("crlfEscape", "foo\nbar\rx", `foo\nbar\rx`)
 	f("stripPort", "foo", "foo")
 	f("stripPort", "foo:1234", "foo")
+	f("stripPort", "[::1]:1234", "::1")
+	f("stripPort", "[::1]", "[::1]")
 	f("stripDomain", "foo.bar.baz", "foo")
 	f("stripDomain", "foo.bar:123", "foo:123")
 }
 
+func TestTemplateFuncs_SplitHostPort(t *testing.T) {
+	f := func(s, hostExpected, portExpected string) {
+		t.Helper()
+
+		tmpl := textTpl.Must(newTemplate(templateFuncs()).Parse(`{{ with splitHostPort . }}{{ .Host }}|{{ .Port }}{{ end }}`))
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, s); err != nil {
+			t.Fatalf("unexpected error for splitHostPort(%q): %s", s, err)
+		}
+		resultExpected := hostExpected + "|" + portExpected
+		if result := sb.String(); result != resultExpected {
+			t.Fatalf("unexpected result for splitHostPort(%q); got\n%s\nwant\n%s", s, result, resultExpected)
+		}
+	}
+
+	f("", "", "")
+	f("foo", "foo", "")
+	f("foo:1234", "foo", "1234")
+	f("foo.bar.baz:1234", "foo.bar.baz", "1234")
+	f(":1234", "", "1234")
+	f("127.0.0.1:1234", "127.0.0.1", "1234")
+	f("127.0.0.1", "127.0.0.1", "")
+	f("[::1]:1234", "::1", "1234")
+	f("[::1]", "::1", "")
+	f("::1", "::1", "")
+	f("[2001:db8::1]:9090", "2001:db8::1", "9090")
+}
+
+func TestTemplateFuncs_Truncate(t *testing.T) {
+	f := func(n int, s, resultExpected string) {
+		t.Helper()
+
+		truncate := templateFuncs()["truncate"].(func(n int, s string) string)
+		result := truncate(n, s)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for truncate(%d, %q); got\n%s\nwant\n%s", n, s, result, resultExpected)
+		}
+	}
+
+	f(3, "", "")
+	f(3, "foo", "foo")
+	f(10, "foo", "foo")
+	f(2, "foo", "fo…")
+	f(0, "foo", "…")
+	f(-1, "foo", "…")
+	f(4, "привет мир", "прив…")
+	f(1, "日本語", "日…")
+	f(3, "日本語", "日本語")
+}
+
 func TestTemplateFuncs_Match(t *testing.T) {
 	funcs := templateFuncs()
 	// check "match" func
@@ -103,18 +162,384 @@ func TestTemplateFuncs_Formatting(t *testing.T) {
 	f("humanizeTimestamp", 1679055557, "2023-03-17 12:19:17 +0000 UTC")
 }
 
+func TestTemplateFuncs_HumanizeBytes(t *testing.T) {
+	f := func(base int, p any, resultExpected string) {
+		t.Helper()
+
+		funcs := templateFuncs()
+		fLocal := funcs["humanizeBytes"].(func(base int, i any) (string, error))
+		result, err := fLocal(base, p)
+		if err != nil {
+			t.Fatalf("unexpected error for humanizeBytes(%d, %v): %s", base, p, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for humanizeBytes(%d, %v); got\n%s\nwant\n%s", base, p, result, resultExpected)
+		}
+	}
+
+	f(1024, float64(0), "0B")
+	f(1024, math.Inf(0), "+Inf")
+	f(1024, math.Inf(-1), "-Inf")
+	f(1024, math.NaN(), "NaN")
+	f(1024, 512, "512B")
+	f(1024, 1536, "1.5KiB")
+	f(1024, float64(130137088), "124.1MiB")
+	f(1024, -1536, "-1.5KiB")
+	f(1024, "1536", "1.5KiB")
+
+	f(1000, float64(0), "0B")
+	f(1000, math.NaN(), "NaN")
+	f(1000, 999, "999B")
+	f(1000, 1500, "1.5kB")
+	f(1000, 1500000, "1.5MB")
+	f(1000, float64(136458627186688), "136.5TB")
+
+	// unsupported base
+	fLocal := templateFuncs()["humanizeBytes"].(func(base int, i any) (string, error))
+	if _, err := fLocal(10, 100); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported base")
+	}
+}
+
+func TestTemplateFuncs_HumanizeExact(t *testing.T) {
+	f := func(decimals int, p any, resultExpected string) {
+		t.Helper()
+
+		fLocal := templateFuncs()["humanizeExact"].(func(decimals int, i any) (string, error))
+		result, err := fLocal(decimals, p)
+		if err != nil {
+			t.Fatalf("unexpected error for humanizeExact(%d, %v): %s", decimals, p, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for humanizeExact(%d, %v); got\n%s\nwant\n%s", decimals, p, result, resultExpected)
+		}
+	}
+
+	f(0, 0, "0")
+	f(0, 1, "1")
+	f(0, 999, "999")
+	f(0, 1000, "1,000")
+	f(0, 1234567, "1,234,567")
+	f(0, uint64(1234567890123), "1,234,567,890,123")
+	f(0, "1234567", "1,234,567")
+	f(2, 1234567, "1,234,567.00")
+	f(0, math.Inf(0), "+Inf")
+	f(0, math.Inf(-1), "-Inf")
+	f(0, math.NaN(), "NaN")
+
+	// negative numbers
+	f(0, -1, "-1")
+	f(0, -123456, "-123,456")
+	f(0, -1234567, "-1,234,567")
+	f(3, -1234.5, "-1,234.500")
+
+	// fractional numbers
+	f(0, 1234.5678, "1,235")
+	f(2, 1234.5678, "1,234.57")
+	f(2, -1234.5678, "-1,234.57")
+	f(4, 0.125, "0.1250")
+	f(1, -0.25, "-0.2")
+	f(0, -0.4, "0")
+
+	// negative decimals
+	fLocal := templateFuncs()["humanizeExact"].(func(decimals int, i any) (string, error))
+	if _, err := fLocal(-1, 100); err == nil {
+		t.Fatalf("expecting non-nil error for negative decimals")
+	}
+}
+
+func TestTemplateFuncs_QueryResults(t *testing.T) {
+	funcs := templateFuncs()
+	label := funcs["label"].(func(label string, m metric) string)
+	value := funcs["value"].(func(m metric) float64)
+	sortByValue := funcs["sortByValue"].(func(metrics []metric) []metric)
+
+	newMetric := func(instance string, v float64) metric {
+		return metric{
+			Labels: map[string]string{
+				"__name__": "up",
+				"instance": instance,
+			},
+			Value: v,
+		}
+	}
+
+	m := newMetric("foo", 12.5)
+	if got := label("instance", m); got != "foo" {
+		t.Fatalf("unexpected label value; got %q; want %q", got, "foo")
+	}
+	if got := label("missing", m); got != "" {
+		t.Fatalf("unexpected value for missing label; got %q; want empty string", got)
+	}
+	if got := value(m); got != 12.5 {
+		t.Fatalf("unexpected value; got %v; want %v", got, 12.5)
+	}
+
+	f := func(metrics []metric, instancesExpected string) {
+		t.Helper()
+
+		var instances []string
+		for _, m := range sortByValue(metrics) {
+			instances = append(instances, label("instance", m))
+		}
+		result := strings.Join(instances, ",")
+		if result != instancesExpected {
+			t.Fatalf("unexpected order after sortByValue; got %q; want %q", result, instancesExpected)
+		}
+	}
+
+	f(nil, "")
+	f([]metric{
+		newMetric("a", 1),
+	}, "a")
+	f([]metric{
+		newMetric("a", 3),
+		newMetric("b", -1),
+		newMetric("c", 2),
+	}, "b,c,a")
+
+	// NaN values are put first, while equal values preserve their order
+	f([]metric{
+		newMetric("a", 2),
+		newMetric("b", math.NaN()),
+		newMetric("c", 1),
+		newMetric("d", 2),
+		newMetric("e", math.Inf(-1)),
+	}, "b,e,c,a,d")
+}
+
+func TestTemplateFuncs_ExternalURLJoin(t *testing.T) {
+	f := func(externalURL, path, resultExpected string) {
+		t.Helper()
+
+		u, err := url.Parse(externalURL)
+		if err != nil {
+			t.Fatalf("cannot parse external URL %q: %s", externalURL, err)
+		}
+		fLocal := funcsWithExternalURL(*u)["externalURLJoin"].(func(path string) string)
+		result := fLocal(path)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for externalURLJoin(%q) with external URL %q; got\n%s\nwant\n%s", path, externalURL, result, resultExpected)
+		}
+	}
+
+	// external URL without base path
+	f("http://vmalert:8880", "", "http://vmalert:8880/")
+	f("http://vmalert:8880", "/", "http://vmalert:8880/")
+	f("http://vmalert:8880", "vmalert/groups", "http://vmalert:8880/vmalert/groups")
+	f("http://vmalert:8880", "/vmalert/groups", "http://vmalert:8880/vmalert/groups")
+	f("http://vmalert:8880/", "/vmalert/groups", "http://vmalert:8880/vmalert/groups")
+
+	// external URL with base path
+	f("https://example.com/monitoring", "/vmalert/groups", "https://example.com/monitoring/vmalert/groups")
+	f("https://example.com/monitoring/", "/vmalert/groups", "https://example.com/monitoring/vmalert/groups")
+	f("https://example.com/monitoring/", "vmalert/groups/", "https://example.com/monitoring/vmalert/groups/")
+	f("https://example.com/monitoring/", "", "https://example.com/monitoring/")
+
+	// path escaping
+	f("https://example.com/monitoring", "/foo bar", "https://example.com/monitoring/foo%20bar")
+	f("https://example.com/monitoring", "/foo%20bar", "https://example.com/monitoring/foo%20bar")
+
+	// query args escaping
+	f("https://example.com/monitoring", `/vmui/?g0.expr=up{job="foo"}&g0.range_input=1h`,
+		"https://example.com/monitoring/vmui/?g0.expr=up%7Bjob%3D%22foo%22%7D&g0.range_input=1h")
+	f("https://example.com", "/vmui/?g0.expr=up%7Bjob%3D%22foo%22%7D", "https://example.com/vmui/?g0.expr=up%7Bjob%3D%22foo%22%7D")
+	f("https://example.com", "/vmui/?a=b c&&d", "https://example.com/vmui/?a=b+c&d")
+	f("https://example.com?org=1", "/vmui/?a=b", "https://example.com/vmui/?org=1&a=b")
+	f("https://example.com", "/vmui/?", "https://example.com/vmui/")
+}
+
+func TestTemplateFuncs_FormatTime(t *testing.T) {
+	formatTime := templateFuncs()["formatTime"].(func(i any, layout, tz string) (string, error))
+
+	f := func(ts any, layout, tz, resultExpected string) {
+		t.Helper()
+
+		result, err := formatTime(ts, layout, tz)
+		if err != nil {
+			t.Fatalf("unexpected error for formatTime(%v, %q, %q): %s", ts, layout, tz, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for formatTime(%v, %q, %q); got\n%s\nwant\n%s", ts, layout, tz, result, resultExpected)
+		}
+	}
+
+	f(1679055557, time.RFC3339, "UTC", "2023-03-17T12:19:17Z")
+	f(1679055557, time.RFC3339, "Europe/Berlin", "2023-03-17T13:19:17+01:00")
+	f(1679055557.123, "2006-01-02 15:04:05.000 MST", "America/New_York", "2023-03-17 08:19:17.123 EDT")
+	f("1679055557", time.Kitchen, "Asia/Tokyo", "9:19PM")
+
+	fFailure := func(ts any, layout, tz string) {
+		t.Helper()
+
+		if _, err := formatTime(ts, layout, tz); err == nil {
+			t.Fatalf("expecting non-nil error for formatTime(%v, %q, %q)", ts, layout, tz)
+		}
+	}
+
+	fFailure(1679055557, time.RFC3339, "Unknown/Zone")
+	fFailure(math.NaN(), time.RFC3339, "UTC")
+	fFailure(math.Inf(1), time.RFC3339, "UTC")
+	fFailure("foo", time.RFC3339, "UTC")
+}
+
+func TestTemplateFuncs_JSON(t *testing.T) {
+	funcs := templateFuncs()
+	toJSON := funcs["toJSON"].(func(v any) (string, error))
+	parseJSON := funcs["parseJSON"].(func(s string) (any, error))
+
+	f := func(v any, resultExpected string) {
+		t.Helper()
+
+		result, err := toJSON(v)
+		if err != nil {
+			t.Fatalf("unexpected error in toJSON(%v): %s", v, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected toJSON(%v) result; got\n%s\nwant\n%s", v, result, resultExpected)
+		}
+
+		// verify the round-trip
+		parsed, err := parseJSON(result)
+		if err != nil {
+			t.Fatalf("unexpected error in parseJSON(%q): %s", result, err)
+		}
+		result, err = toJSON(parsed)
+		if err != nil {
+			t.Fatalf("unexpected error in toJSON(%v): %s", parsed, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected toJSON(parseJSON(%v)) result; got\n%s\nwant\n%s", v, result, resultExpected)
+		}
+	}
+
+	f(nil, `null`)
+	f("foo", `"foo"`)
+	f(1.5, `1.5`)
+	f([]any{1, "a", true}, `[1,"a",true]`)
+	f(map[string]any{
+		"z": 1,
+		"a": map[string]any{
+			"y":   []string{"b", "c"},
+			"b":   "d",
+			"foo": nil,
+		},
+		"m": map[string]string{"job": "vmalert", "instance": "localhost"},
+	}, `{"a":{"b":"d","foo":null,"y":["b","c"]},"m":{"instance":"localhost","job":"vmalert"},"z":1}`)
+
+	// invalid values
+	if _, err := toJSON(math.NaN()); err == nil {
+		t.Fatalf("expecting non-nil error for toJSON(NaN)")
+	}
+	if _, err := parseJSON(`{"foo":`); err == nil {
+		t.Fatalf("expecting non-nil error for parseJSON on invalid JSON")
+	}
+}
+
+func TestWatchTemplateFiles(t *testing.T) {
+	masterTmplOrig := masterTmpl
+	defer func() {
+		masterTmpl = masterTmplOrig
+	}()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.tpl")
+	writeFile := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("cannot write %q: %s", path, err)
+		}
+	}
+	execTemplate := func() string {
+		t.Helper()
+		tmpl, err := GetWithFuncs(nil)
+		if err != nil {
+			t.Fatalf("cannot get template: %s", err)
+		}
+		var sb strings.Builder
+		if err := tmpl.ExecuteTemplate(&sb, "test.0", nil); err != nil {
+			t.Fatalf("cannot execute template: %s", err)
+		}
+		return sb.String()
+	}
+	waitFor := func(expected string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			result := execTemplate()
+			if result == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("unexpected template result; got %q; want %q", result, expected)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	pathPatterns := []string{filepath.Join(dir, "*.tpl")}
+	writeFile(`{{ define "test.0" }}foo{{ end }}`)
+	masterTmpl = textTemplate{}
+	if err := Load(pathPatterns, url.URL{}, nil); err != nil {
+		t.Fatalf("cannot load templates: %s", err)
+	}
+
+	stop := WatchTemplateFiles(pathPatterns, url.URL{}, nil, 10*time.Millisecond)
+	defer stop()
+	waitFor("foo")
+
+	// the updated template must be loaded
+	writeFile(`{{ define "test.0" }}bar{{ end }}`)
+	waitFor("bar")
+
+	// invalid template must be ignored
+	writeFile(`{{ define "test.0" }}baz{{ end`)
+	time.Sleep(100 * time.Millisecond)
+	waitFor("bar")
+
+	// the fixed template must be loaded
+	writeFile(`{{ define "test.0" }}baz{{ end }}`)
+	waitFor("baz")
+
+	// the replacement template staged under LockReload mustn't be overridden or promoted by the watcher
+	LockReload()
+	writeFile(`{{ define "test.0" }}qux{{ end }}`)
+	if err := Load(pathPatterns, url.URL{}, nil); err != nil {
+		t.Fatalf("cannot load templates: %s", err)
+	}
+	writeFile(`{{ define "test.0" }}quux{{ end }}`)
+	time.Sleep(100 * time.Millisecond)
+	waitFor("baz")
+	tplMu.RLock()
+	var sb strings.Builder
+	err := masterTmpl.replacement.ExecuteTemplate(&sb, "test.0", nil)
+	tplMu.RUnlock()
+	if err != nil {
+		t.Fatalf("cannot execute replacement template: %s", err)
+	}
+	if result := sb.String(); result != "qux" {
+		t.Fatalf("unexpected replacement template result; got %q; want %q", result, "qux")
+	}
+	Reload()
+	waitFor("qux")
+	UnlockReload()
+
+	// the changes made while reloads were locked must be loaded after the unlock
+	waitFor("quux")
+}
+
 func mkTemplate(current, replacement any) textTemplate {
 	tmpl := textTemplate{}
 	if current != nil {
 		switch val := current.(type) {
 		case string:
-			tmpl.current = textTpl.Must(newTemplate().Parse(val))
+			tmpl.current = textTpl.Must(newTemplate(templateFuncs()).Parse(val))
 		}
 	}
 	if replacement != nil {
 		switch val := replacement.(type) {
 		case string:
-			tmpl.replacement = textTpl.Must(newTemplate().Parse(val))
+			tmpl.replacement = textTpl.Must(newTemplate(templateFuncs()).Parse(val))
 		}
 	}
 	return tmpl
@@ -153,7 +578,7 @@ func TestTemplatesLoad_Failure(t *testing.T) {
 	f := func(pathPatterns []string, expectedErrStr string) {
 		t.Helper()
 
-		err := Load(pathPatterns, url.URL{})
+		err := Load(pathPatterns, url.URL{}, nil)
 		if err == nil {
 			t.Fatalf("expecting non-nil error")
 		}
@@ -169,6 +594,66 @@ func TestTemplatesLoad_Failure(t *testing.T) {
 		"templates/other/nested/bad0-*.tpl",
 		"templates/test/good0-*.tpl",
 	}, "failed to parse template glob")
+
+	// the same templates are defined in multiple files
+	f([]string{
+		"templates/test/good0-*.tpl",
+		"templates/other/nested/good0-*.tpl",
+	}, `template "test.0" is defined in multiple files: "templates/test/good0-test.tpl" and "templates/other/nested/good0-test.tpl"`)
+}
+
+func TestTemplatesLoad_CustomFuncs(t *testing.T) {
+	masterTmplOrig := masterTmpl
+	defer func() {
+		masterTmpl = masterTmplOrig
+	}()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "custom.tpl")
+	if err := os.WriteFile(path, []byte(`{{ define "test.custom" }}{{ siteName | toUpper }}{{ end }}`), 0o644); err != nil {
+		t.Fatalf("cannot write template file: %s", err)
+	}
+	pathPatterns := []string{filepath.Join(dir, "*.tpl")}
+	customFuncs := textTpl.FuncMap{
+		"siteName": func() string {
+			return "dc1"
+		},
+	}
+
+	// the template with custom func cannot be loaded without the custom func
+	if err := Load(pathPatterns, url.URL{}, nil); err == nil {
+		t.Fatalf("expecting non-nil error when loading templates without custom funcs")
+	}
+
+	// custom funcs cannot override built-in funcs
+	err := Load(pathPatterns, url.URL{}, textTpl.FuncMap{
+		"siteName": customFuncs["siteName"],
+		"humanize": func(any) (string, error) {
+			return "", nil
+		},
+	})
+	if err == nil {
+		t.Fatalf("expecting non-nil error for custom func conflicting with built-in func")
+	}
+	if !strings.Contains(err.Error(), `["humanize"]`) {
+		t.Fatalf("the error %q must contain the name of the conflicting func", err)
+	}
+
+	masterTmpl = textTemplate{}
+	if err := Load(pathPatterns, url.URL{}, customFuncs); err != nil {
+		t.Fatalf("cannot load templates: %s", err)
+	}
+	tmpl, err := GetWithFuncs(nil)
+	if err != nil {
+		t.Fatalf("cannot get template: %s", err)
+	}
+	var sb strings.Builder
+	if err := tmpl.ExecuteTemplate(&sb, "test.custom", nil); err != nil {
+		t.Fatalf("cannot execute template: %s", err)
+	}
+	if result := sb.String(); result != "DC1" {
+		t.Fatalf("unexpected template result; got %q; want %q", result, "DC1")
+	}
 }
 
 func TestTemplatesLoad_Success(t *testing.T) {
@@ -180,7 +665,7 @@ func TestTemplatesLoad_Success(t *testing.T) {
 			masterTmpl = masterTmplOrig
 		}()
 
-		if err := Load(pathPatterns, url.URL{}); err != nil {
+		if err := Load(pathPatterns, url.URL{}, nil); err != nil {
 			t.Fatalf("cannot load templates: %s", err)
 		}
 		Reload()
@@ -236,4 +721,23 @@ func TestTemplatesLoad_Success(t *testing.T) {
 		{{- end -}}
 	`, nil)
 	f(pathPatterns, expectedTmpl)
+
+	// the same file matched by multiple globs
+	pathPatterns = []string{
+		"templates/test/good0-*.tpl",
+		"templates/test/*.tpl",
+	}
+	expectedTmpl = mkTemplate(`
+		{{- define "good0-test.tpl" -}}{{- end -}}
+		{{- define "test.0" -}}
+			{{ printf "Hello %s!" externalURL }}
+		{{- end -}}
+		{{- define "test.2" -}}
+			{{ printf "Hello %s!" externalURL }}
+		{{- end -}}
+		{{- define "test.3" -}}
+			{{ printf "Hello %s!" externalURL }}
+		{{- end -}}
+	`, nil)
+	f(pathPatterns, expectedTmpl)
 }
@@ -1002,6 +1002,7 @@ func ExportBlocks(qt *querytracer.Tracer, sq *storage.SearchQuery, deadline sear
 	sr := getStorageSearch()
 	defer putStorageSearch(sr)
 	sr.Init(qt, vmstorage.Storage, tfss, tr, sq.MaxMetrics, deadline.Deadline())
+	sr.SetMaxSeries(sq.MaxSeries)
 
 	// Start workers that call f in parallel on available CPU cores.
 	workCh := make(chan *exportWork, gomaxprocs*8)
@@ -1140,6 +1141,7 @@ func ProcessSearchQuery(qt *querytracer.Tracer, sq *storage.SearchQuery, deadlin
 
 	sr := getStorageSearch()
 	maxSeriesCount := sr.Init(qt, vmstorage.Storage, tfss, tr, sq.MaxMetrics, deadline.Deadline())
+	sr.SetMaxSeries(sq.MaxSeries)
 	type blockRefs struct {
 		brs []blockRef
 	}
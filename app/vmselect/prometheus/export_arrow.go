@@ -0,0 +1,58 @@
+package prometheus
+
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/arrowipc"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+)
+
+// exportArrowFields contains the schema for the data exported via /api/v1/export?format=arrow
+//
+// Every exported sample is represented as a row with the metric name in JSON format, the timestamp and the value.
+var exportArrowFields = []arrowipc.Field{
+	{
+		Name: "metric",
+		Type: arrowipc.FieldTypeUtf8,
+	},
+	{
+		Name: "timestamp",
+		Type: arrowipc.FieldTypeTimestampMillis,
+	},
+	{
+		Name: "value",
+		Type: arrowipc.FieldTypeFloat64,
+	},
+}
+
+// WriteExportArrowHeader writes Arrow IPC stream schema for the exported data to bb.
+func WriteExportArrowHeader(bb *bytesutil.ByteBuffer) {
+	bb.B = arrowipc.MarshalSchema(bb.B, exportArrowFields)
+}
+
+// WriteExportArrowRecordBatch writes Arrow record batch with samples from xb to bb.
+func WriteExportArrowRecordBatch(bb *bytesutil.ByteBuffer, xb *exportBlock) {
+	if len(xb.timestamps) == 0 {
+		return
+	}
+	metricName := metricNameObject(xb.mn)
+	metricNames := make([]string, len(xb.timestamps))
+	for i := range metricNames {
+		metricNames[i] = metricName
+	}
+	columns := []arrowipc.Column{
+		{
+			Strings: metricNames,
+		},
+		{
+			Int64s: xb.timestamps,
+		},
+		{
+			Float64s: xb.values,
+		},
+	}
+	bb.B = arrowipc.MarshalRecordBatch(bb.B, len(xb.timestamps), exportArrowFields, columns)
+}
+
+// WriteExportArrowFooter writes Arrow IPC end of stream marker to bb.
+func WriteExportArrowFooter(bb *bytesutil.ByteBuffer) {
+	bb.B = arrowipc.MarshalEndOfStream(bb.B)
+}
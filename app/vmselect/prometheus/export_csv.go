@@ -0,0 +1,97 @@
+package prometheus
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/valyala/quicktemplate"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// exportCSVHeader is the header line for the data exported via /api/v1/export?format=csv
+const exportCSVHeader = "metric,timestamp,value,labels\n"
+
+// WriteExportCSVHeader writes CSV header for the data exported via /api/v1/export?format=csv to bb.
+func WriteExportCSVHeader(bb *bytesutil.ByteBuffer) {
+	bb.B = append(bb.B, exportCSVHeader...)
+}
+
+// WriteExportCSVRows writes samples from xb to bb as CSV rows with metric,timestamp,value,labels columns.
+//
+// metric contains the metric name, timestamp contains unix timestamp in milliseconds,
+// while labels contains the remaining labels as JSON object.
+// Fields containing commas, double quotes or newlines are quoted according to RFC 4180.
+func WriteExportCSVRows(bb *bytesutil.ByteBuffer, xb *exportBlock) {
+	if len(xb.timestamps) == 0 {
+		return
+	}
+
+	// Prepare the metric and labels columns, since they are shared among all the rows for xb.
+	prefix := bbPool.Get()
+	prefix.B = appendCSVField(prefix.B, bytesutil.ToUnsafeString(xb.mn.MetricGroup))
+	prefix.B = append(prefix.B, ',')
+	labels := bbPool.Get()
+	labels.B = appendCSVLabels(labels.B, xb.mn)
+
+	dst := bb.B
+	for i, timestamp := range xb.timestamps {
+		dst = append(dst, prefix.B...)
+		dst = strconv.AppendInt(dst, timestamp, 10)
+		dst = append(dst, ',')
+		dst = appendCSVValue(dst, xb.values[i])
+		dst = append(dst, ',')
+		dst = append(dst, labels.B...)
+		dst = append(dst, '\n')
+	}
+	bb.B = dst
+
+	bbPool.Put(labels)
+	bbPool.Put(prefix)
+}
+
+func appendCSVLabels(dst []byte, mn *storage.MetricName) []byte {
+	bb := bbPool.Get()
+	bb.B = append(bb.B, '{')
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		if i > 0 {
+			bb.B = append(bb.B, ',')
+		}
+		bb.B = quicktemplate.AppendJSONString(bb.B, bytesutil.ToUnsafeString(tag.Key), true)
+		bb.B = append(bb.B, ':')
+		bb.B = quicktemplate.AppendJSONString(bb.B, bytesutil.ToUnsafeString(tag.Value), true)
+	}
+	bb.B = append(bb.B, '}')
+	dst = appendCSVField(dst, bytesutil.ToUnsafeString(bb.B))
+	bbPool.Put(bb)
+	return dst
+}
+
+func appendCSVValue(dst []byte, v float64) []byte {
+	n := int64(v)
+	if float64(n) == v {
+		return strconv.AppendInt(dst, n, 10)
+	}
+	return strconv.AppendFloat(dst, v, 'f', -1, 64)
+}
+
+// appendCSVField appends s to dst and quotes it according to RFC 4180 if needed.
+func appendCSVField(dst []byte, s string) []byte {
+	if !strings.ContainsAny(s, "\",\r\n") {
+		return append(dst, s...)
+	}
+	dst = append(dst, '"')
+	for {
+		n := strings.IndexByte(s, '"')
+		if n < 0 {
+			break
+		}
+		dst = append(dst, s[:n+1]...)
+		dst = append(dst, '"')
+		s = s[n+1:]
+	}
+	dst = append(dst, s...)
+	return append(dst, '"')
+}
@@ -0,0 +1,73 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestAppendCSVField(t *testing.T) {
+	f := func(s, resultExpected string) {
+		t.Helper()
+
+		result := appendCSVField(nil, s)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result for appendCSVField(%q); got %s; want %s", s, result, resultExpected)
+		}
+	}
+
+	f("", "")
+	f("foo", "foo")
+	f("foo bar", "foo bar")
+	f("foo,bar", `"foo,bar"`)
+	f(`foo"bar`, `"foo""bar"`)
+	f(`"`, `""""`)
+	f("foo\nbar", "\"foo\nbar\"")
+	f("foo\r\nbar", "\"foo\r\nbar\"")
+}
+
+func TestWriteExportCSVRows(t *testing.T) {
+	f := func(mn *storage.MetricName, timestamps []int64, values []float64, resultExpected string) {
+		t.Helper()
+
+		xb := &exportBlock{
+			mn:         mn,
+			timestamps: timestamps,
+			values:     values,
+		}
+		var bb bytesutil.ByteBuffer
+		WriteExportCSVRows(&bb, xb)
+		if string(bb.B) != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", bb.B, resultExpected)
+		}
+	}
+
+	mn := &storage.MetricName{
+		MetricGroup: []byte("foo"),
+	}
+
+	// empty block
+	f(mn, nil, nil, "")
+
+	// metric without labels
+	f(mn, []int64{1000, 2000}, []float64{1, -2.5}, "foo,1000,1,{}\nfoo,2000,-2.5,{}\n")
+
+	// special values
+	f(mn, []int64{1000, 2000}, []float64{math.NaN(), math.Inf(1)}, "foo,1000,NaN,{}\nfoo,2000,+Inf,{}\n")
+
+	// single label
+	mn.AddTag("job", "bar")
+	f(mn, []int64{1000}, []float64{3}, `foo,1000,3,"{""job"":""bar""}"`+"\n")
+
+	// labels with commas and quotes
+	mn.AddTag("instance", `a,"b"`)
+	f(mn, []int64{1000}, []float64{0.5}, `foo,1000,0.5,"{""job"":""bar"",""instance"":""a,\""b\""""}"`+"\n")
+
+	// metric name with comma
+	mn = &storage.MetricName{
+		MetricGroup: []byte("foo,bar"),
+	}
+	f(mn, []int64{1000}, []float64{3}, `"foo,bar",1000,3,{}`+"\n")
+}
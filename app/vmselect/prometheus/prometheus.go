@@ -20,6 +20,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/querystats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/arrowipc"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bufferedwriter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
@@ -361,6 +362,28 @@ func exportHandler(qt *querytracer.Tracer, w http.ResponseWriter, cp *commonPara
 			WriteExportPromAPILine(bb, xb)
 			return sw.maybeFlushBuffer(bb)
 		}
+	} else if format == "csv" {
+		contentType = "text/csv; charset=utf-8"
+		bb := bbPool.Get()
+		WriteExportCSVHeader(bb)
+		_, _ = bw.Write(bb.B)
+		bbPool.Put(bb)
+		writeLineFunc = func(xb *exportBlock, workerID uint) error {
+			bb := sw.getBuffer(workerID)
+			WriteExportCSVRows(bb, xb)
+			return sw.maybeFlushBuffer(bb)
+		}
+	} else if format == "arrow" {
+		contentType = arrowipc.ContentType
+		bb := bbPool.Get()
+		WriteExportArrowHeader(bb)
+		_, _ = bw.Write(bb.B)
+		bbPool.Put(bb)
+		writeLineFunc = func(xb *exportBlock, workerID uint) error {
+			bb := sw.getBuffer(workerID)
+			WriteExportArrowRecordBatch(bb, xb)
+			return sw.maybeFlushBuffer(bb)
+		}
 	}
 	if maxRowsPerLine > 0 {
 		writeLineFuncOrig := writeLineFunc
@@ -455,9 +478,17 @@ func exportHandler(qt *querytracer.Tracer, w http.ResponseWriter, cp *commonPara
 		err = sw.flush()
 	}
 	if err == nil {
-		if format == "promapi" {
+		switch format {
+		case "promapi":
 			WriteExportPromAPIFooter(bw, qt)
+		case "arrow":
+			bb := bbPool.Get()
+			WriteExportArrowFooter(bb)
+			_, err = bw.Write(bb.B)
+			bbPool.Put(bb)
 		}
+	}
+	if err == nil {
 		err = bw.Flush()
 	}
 	if err != nil && !netutil.IsTrivialNetworkError(err) {
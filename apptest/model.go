@@ -1,6 +1,7 @@
 package apptest
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -11,12 +12,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/arrowipc"
 	pb "github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 )
 
 // PrometheusQuerier contains methods available to Prometheus-like HTTP API for Querying
 type PrometheusQuerier interface {
 	PrometheusAPIV1Export(t *testing.T, query string, opts QueryOpts) *PrometheusAPIV1QueryResponse
+	PrometheusAPIV1ExportArrow(t *testing.T, query string, opts QueryOpts) *arrowipc.Stream
+	PrometheusAPIV1ExportCSV(t *testing.T, query string, opts QueryOpts) []*ExportCSVRow
 	PrometheusAPIV1Query(t *testing.T, query string, opts QueryOpts) *PrometheusAPIV1QueryResponse
 	PrometheusAPIV1QueryRange(t *testing.T, query string, opts QueryOpts) *PrometheusAPIV1QueryResponse
 	PrometheusAPIV1Series(t *testing.T, matchQuery string, opts QueryOpts) *PrometheusAPIV1SeriesResponse
@@ -106,6 +110,63 @@ func NewPrometheusAPIV1QueryResponse(t *testing.T, s string) *PrometheusAPIV1Que
 	return res
 }
 
+// NewPrometheusAPIV1ExportArrowResponse is a test helper function that creates
+// a new instance of arrowipc.Stream by parsing Arrow IPC stream returned by
+// /api/v1/export?format=arrow.
+func NewPrometheusAPIV1ExportArrowResponse(t *testing.T, s string) *arrowipc.Stream {
+	t.Helper()
+
+	stream, err := arrowipc.ParseStream([]byte(s))
+	if err != nil {
+		t.Fatalf("could not parse arrow export response: %v", err)
+	}
+	return stream
+}
+
+// ExportCSVRow is a single row returned by /api/v1/export?format=csv.
+type ExportCSVRow struct {
+	Metric    string
+	Timestamp int64
+	Value     float64
+	Labels    map[string]string
+}
+
+// NewPrometheusAPIV1ExportCSVResponse is a test helper function that parses
+// rows returned by /api/v1/export?format=csv.
+func NewPrometheusAPIV1ExportCSVResponse(t *testing.T, s string) []*ExportCSVRow {
+	t.Helper()
+
+	records, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		t.Fatalf("could not parse csv export response data=\n%s\n: %v", s, err)
+	}
+	if len(records) == 0 || !slices.Equal(records[0], []string{"metric", "timestamp", "value", "labels"}) {
+		t.Fatalf("missing csv header in export response data=\n%s", s)
+	}
+	rows := make([]*ExportCSVRow, 0, len(records)-1)
+	for _, record := range records[1:] {
+		timestamp, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			t.Fatalf("could not parse timestamp %q: %v", record[1], err)
+		}
+		value, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			t.Fatalf("could not parse value %q: %v", record[2], err)
+		}
+		var labels map[string]string
+		if err := json.Unmarshal([]byte(record[3]), &labels); err != nil {
+			t.Fatalf("could not parse labels %q: %v", record[3], err)
+		}
+		rows = append(rows, &ExportCSVRow{
+			Metric:    record[0],
+			Timestamp: timestamp,
+			Value:     value,
+			Labels:    labels,
+		})
+	}
+	return rows
+}
+
 // Sort performs data.Result sort by metric labels
 func (pqr *PrometheusAPIV1QueryResponse) Sort() {
 	sort.Slice(pqr.Data.Result, func(i, j int) bool {
@@ -180,6 +241,126 @@ func (s *Sample) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// PrometheusAPIV1QueryExemplarsResponse is an inmemory representation of the
+// /prometheus/api/v1/query_exemplars response.
+type PrometheusAPIV1QueryExemplarsResponse struct {
+	Status    string
+	Data      []*ExemplarsData
+	ErrorType string
+	Error     string
+}
+
+// NewPrometheusAPIV1QueryExemplarsResponse is a test helper function that
+// creates a new instance of PrometheusAPIV1QueryExemplarsResponse by
+// unmarshalling a json string.
+func NewPrometheusAPIV1QueryExemplarsResponse(t *testing.T, s string) *PrometheusAPIV1QueryExemplarsResponse {
+	t.Helper()
+
+	res := &PrometheusAPIV1QueryExemplarsResponse{}
+	if err := json.Unmarshal([]byte(s), res); err != nil {
+		t.Fatalf("could not unmarshal query exemplars response data=\n%s\n: %v", string(s), err)
+	}
+	return res
+}
+
+// ExemplarsData holds the exemplars for a single time series.
+type ExemplarsData struct {
+	SeriesLabels map[string]string `json:"seriesLabels"`
+	Exemplars    []*Exemplar
+}
+
+// Exemplar is an exemplar value with its labels at a given timestamp.
+type Exemplar struct {
+	Labels    map[string]string
+	Value     float64
+	Timestamp int64
+}
+
+// UnmarshalJSON populates the exemplar fields from a JSON string.
+func (e *Exemplar) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Labels    map[string]string
+		Value     string
+		Timestamp float64
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	e.Labels = raw.Labels
+	e.Timestamp = int64(raw.Timestamp * 1000)
+	var err error
+	e.Value, err = strconv.ParseFloat(raw.Value, 64)
+	if err != nil {
+		return fmt.Errorf("could not parse exemplar value %q: %w", raw.Value, err)
+	}
+	return nil
+}
+
+// PrometheusAPIV1StatusTSDBResponse is an inmemory representation of the
+// /prometheus/api/v1/status/tsdb response.
+type PrometheusAPIV1StatusTSDBResponse struct {
+	Status    string
+	Data      *TSDBStatusData
+	ErrorType string
+	Error     string
+}
+
+// NewPrometheusAPIV1StatusTSDBResponse is a test helper function that creates
+// a new instance of PrometheusAPIV1StatusTSDBResponse by unmarshalling a json
+// string.
+func NewPrometheusAPIV1StatusTSDBResponse(t *testing.T, s string) *PrometheusAPIV1StatusTSDBResponse {
+	t.Helper()
+
+	res := &PrometheusAPIV1StatusTSDBResponse{}
+	if err := json.Unmarshal([]byte(s), res); err != nil {
+		t.Fatalf("could not unmarshal status tsdb response data=\n%s\n: %v", string(s), err)
+	}
+	return res
+}
+
+// TSDBStatusData holds the cardinality stats returned by
+// /prometheus/api/v1/status/tsdb.
+type TSDBStatusData struct {
+	TotalSeries                  uint64            `json:"totalSeries"`
+	TotalLabelValuePairs         uint64            `json:"totalLabelValuePairs"`
+	SeriesCountByMetricName      []TSDBStatusEntry `json:"seriesCountByMetricName"`
+	SeriesCountByLabelName       []TSDBStatusEntry `json:"seriesCountByLabelName"`
+	SeriesCountByFocusLabelValue []TSDBStatusEntry `json:"seriesCountByFocusLabelValue"`
+	SeriesCountByLabelValuePair  []TSDBStatusEntry `json:"seriesCountByLabelValuePair"`
+	LabelValueCountByLabelName   []TSDBStatusEntry `json:"labelValueCountByLabelName"`
+}
+
+// TSDBStatusEntry is a single name-count entry of the TSDB status top lists.
+type TSDBStatusEntry struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// LogsQLQueryResponse is an inmemory representation of the
+// /select/logsql/query response.
+type LogsQLQueryResponse struct {
+	LogLines []map[string]string
+}
+
+// NewLogsQLQueryResponse is a test helper function that creates a new
+// instance of LogsQLQueryResponse by unmarshalling JSON lines from s.
+func NewLogsQLQueryResponse(t *testing.T, s string) *LogsQLQueryResponse {
+	t.Helper()
+
+	res := &LogsQLQueryResponse{}
+	for _, line := range strings.Split(s, "\n") {
+		if line == "" {
+			continue
+		}
+		var logLine map[string]string
+		if err := json.Unmarshal([]byte(line), &logLine); err != nil {
+			t.Fatalf("could not unmarshal logsql query response line=\n%s\n: %v", line, err)
+		}
+		res.LogLines = append(res.LogLines, logLine)
+	}
+	return res
+}
+
 // PrometheusAPIV1SeriesResponse is an inmemory representation of the
 // /prometheus/api/v1/series response.
 type PrometheusAPIV1SeriesResponse struct {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,6 +112,25 @@ func (tc *TestCase) MustStartVmselect(instance string, flags []string) *Vmselect
 	return app
 }
 
+// MustStartChainedVmselect is a test helper function that starts an instance
+// of vmselect that reads data from the given upstream vmselect instances via
+// the clusternative protocol. It fails the test if the app fails to start.
+//
+// See https://docs.victoriametrics.com/cluster-victoriametrics/#multi-level-cluster-setup
+func (tc *TestCase) MustStartChainedVmselect(instance string, upstreams []*Vmselect, flags []string) *Vmselect {
+	tc.t.Helper()
+
+	if len(upstreams) == 0 {
+		tc.t.Fatalf("Could not start %s: at least one upstream vmselect must be provided", instance)
+	}
+	addrs := make([]string, len(upstreams))
+	for i, upstream := range upstreams {
+		addrs[i] = upstream.ClusternativeListenAddr()
+	}
+	flags = append([]string{"-storageNode=" + strings.Join(addrs, ",")}, flags...)
+	return tc.MustStartVmselect(instance, flags)
+}
+
 // MustStartVminsert is a test helper function that starts an instance of
 // vminsert and fails the test if the app fails to start.
 func (tc *TestCase) MustStartVminsert(instance string, flags []string) *Vminsert {
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/apptest"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/arrowipc"
+	pb "github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSingleExport(t *testing.T) {
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	sut := tc.MustStartDefaultVmsingle()
+
+	testExportArrow(t, sut)
+	testExportCSV(t, sut)
+}
+
+func TestClusterExport(t *testing.T) {
+	tc := apptest.NewTestCase(t)
+	defer tc.Stop()
+
+	sut := tc.MustStartDefaultCluster()
+
+	testExportArrow(t, sut)
+	testExportCSV(t, sut)
+}
+
+func testExportArrow(t *testing.T, sut apptest.PrometheusWriteQuerier) {
+	data := []pb.TimeSeries{
+		{
+			Labels: []pb.Label{
+				{Name: "__name__", Value: "metric"},
+				{Name: "job", Value: "foo"},
+			},
+			Samples: []pb.Sample{
+				{Value: 1, Timestamp: millis("2024-01-01T00:01:00Z")},
+				{Value: 2.5, Timestamp: millis("2024-01-01T00:02:00Z")},
+			},
+		},
+	}
+
+	sut.PrometheusAPIV1Write(t, data, apptest.QueryOpts{})
+	sut.ForceFlush(t)
+
+	got := sut.PrometheusAPIV1ExportArrow(t, `{__name__="metric"}`, apptest.QueryOpts{
+		Start: "2024-01-01T00:00:00.000Z",
+		End:   "2024-01-01T00:03:00.000Z",
+	})
+	want := &arrowipc.Stream{
+		Fields: []arrowipc.Field{
+			{Name: "metric", Type: arrowipc.FieldTypeUtf8},
+			{Name: "timestamp", Type: arrowipc.FieldTypeTimestampMillis},
+			{Name: "value", Type: arrowipc.FieldTypeFloat64},
+		},
+		RecordBatches: []arrowipc.RecordBatch{
+			{
+				RowsCount: 2,
+				Columns: []arrowipc.Column{
+					{Strings: []string{`{"__name__":"metric","job":"foo"}`, `{"__name__":"metric","job":"foo"}`}},
+					{Int64s: []int64{millis("2024-01-01T00:01:00Z"), millis("2024-01-01T00:02:00Z")}},
+					{Float64s: []float64{1, 2.5}},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected response (-want, +got):\n%s", diff)
+	}
+}
+
+func testExportCSV(t *testing.T, sut apptest.PrometheusWriteQuerier) {
+	data := []pb.TimeSeries{
+		{
+			Labels: []pb.Label{
+				{Name: "__name__", Value: "csv_metric"},
+				{Name: "job", Value: "foo"},
+				{Name: "path", Value: `/a,"b"`},
+			},
+			Samples: []pb.Sample{
+				{Value: 1, Timestamp: millis("2024-01-01T00:01:00Z")},
+				{Value: 2.5, Timestamp: millis("2024-01-01T00:02:00Z")},
+			},
+		},
+	}
+
+	sut.PrometheusAPIV1Write(t, data, apptest.QueryOpts{})
+	sut.ForceFlush(t)
+
+	got := sut.PrometheusAPIV1ExportCSV(t, `{__name__="csv_metric"}`, apptest.QueryOpts{
+		Start: "2024-01-01T00:00:00.000Z",
+		End:   "2024-01-01T00:03:00.000Z",
+	})
+	labels := map[string]string{
+		"job":  "foo",
+		"path": `/a,"b"`,
+	}
+	want := []*apptest.ExportCSVRow{
+		{Metric: "csv_metric", Timestamp: millis("2024-01-01T00:01:00Z"), Value: 1, Labels: labels},
+		{Metric: "csv_metric", Timestamp: millis("2024-01-01T00:02:00Z"), Value: 2.5, Labels: labels},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected response (-want, +got):\n%s", diff)
+	}
+}
@@ -29,9 +29,7 @@ func TestClusterMultilevelSelect(t *testing.T) {
 	vmselectL1 := tc.MustStartVmselect("vmselect-level1", []string{
 		"-storageNode=" + vmstorage.VmselectAddr(),
 	})
-	vmselectL2 := tc.MustStartVmselect("vmselect-level2", []string{
-		"-storageNode=" + vmselectL1.ClusternativeListenAddr(),
-	})
+	vmselectL2 := tc.MustStartChainedVmselect("vmselect-level2", []*apptest.Vmselect{vmselectL1}, nil)
 
 	// Insert 1000 unique time series.
 
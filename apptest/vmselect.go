@@ -2,8 +2,11 @@ package apptest
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/arrowipc"
 )
 
 // Vmselect holds the state of a vmselect app and provides vmselect-specific
@@ -69,6 +72,38 @@ func (app *Vmselect) PrometheusAPIV1Export(t *testing.T, query string, opts Quer
 	return NewPrometheusAPIV1QueryResponse(t, res)
 }
 
+// PrometheusAPIV1ExportArrow is a test helper function that performs the export of
+// raw samples in Arrow IPC stream format by sending a HTTP POST request to
+// /prometheus/api/v1/export vmselect endpoint.
+//
+// See https://docs.victoriametrics.com/#how-to-export-data-in-arrow-format
+func (app *Vmselect) PrometheusAPIV1ExportArrow(t *testing.T, query string, opts QueryOpts) *arrowipc.Stream {
+	t.Helper()
+
+	exportURL := fmt.Sprintf("http://%s/select/%s/prometheus/api/v1/export", app.httpListenAddr, opts.getTenant())
+	values := opts.asURLValues()
+	values.Add("match[]", query)
+	values.Add("format", "arrow")
+	res, _ := app.cli.PostForm(t, exportURL, values)
+	return NewPrometheusAPIV1ExportArrowResponse(t, res)
+}
+
+// PrometheusAPIV1ExportCSV is a test helper function that performs the export of
+// raw samples in CSV format by sending a HTTP POST request to
+// /prometheus/api/v1/export vmselect endpoint.
+//
+// See https://docs.victoriametrics.com/#how-to-export-data-in-csv-line-format
+func (app *Vmselect) PrometheusAPIV1ExportCSV(t *testing.T, query string, opts QueryOpts) []*ExportCSVRow {
+	t.Helper()
+
+	exportURL := fmt.Sprintf("http://%s/select/%s/prometheus/api/v1/export", app.httpListenAddr, opts.getTenant())
+	values := opts.asURLValues()
+	values.Add("match[]", query)
+	values.Add("format", "csv")
+	res, _ := app.cli.PostForm(t, exportURL, values)
+	return NewPrometheusAPIV1ExportCSVResponse(t, res)
+}
+
 // PrometheusAPIV1Query is a test helper function that performs PromQL/MetricsQL
 // instant query by sending a HTTP POST request to /prometheus/api/v1/query
 // vmselect endpoint.
@@ -101,6 +136,89 @@ func (app *Vmselect) PrometheusAPIV1QueryRange(t *testing.T, query string, opts
 	return NewPrometheusAPIV1QueryResponse(t, res)
 }
 
+// PrometheusAPIV1QueryRangeExt is a test helper function that performs
+// PromQL/MetricsQL range query on the [start, end] time range with the given
+// step by sending a HTTP POST request to /prometheus/api/v1/query_range
+// vmselect endpoint.
+//
+// Unlike PrometheusAPIV1QueryRange, start, end and step are passed explicitly
+// and override the corresponding opts fields. The step must be non-empty.
+// The successful response is verified to contain the matrix result.
+//
+// See https://docs.victoriametrics.com/url-examples/#apiv1query_range
+func (app *Vmselect) PrometheusAPIV1QueryRangeExt(t *testing.T, query, start, end, step string, opts QueryOpts) *PrometheusAPIV1QueryResponse {
+	t.Helper()
+
+	if step == "" {
+		t.Fatalf("step must be non-empty for range query %q", query)
+	}
+	opts.Start = start
+	opts.End = end
+	opts.Step = step
+	res := app.PrometheusAPIV1QueryRange(t, query, opts)
+	if res.Status == "success" {
+		if res.Data == nil {
+			t.Fatalf("missing data in the range query %q response", query)
+		}
+		if res.Data.ResultType != "matrix" {
+			t.Fatalf("unexpected resultType in the range query %q response; got %q; want %q", query, res.Data.ResultType, "matrix")
+		}
+	}
+	return res
+}
+
+// PrometheusAPIV1QueryExemplars is a test helper function that queries
+// exemplars by sending a HTTP POST request to /prometheus/api/v1/query_exemplars
+// vmselect endpoint.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func (app *Vmselect) PrometheusAPIV1QueryExemplars(t *testing.T, query string, opts QueryOpts) *PrometheusAPIV1QueryExemplarsResponse {
+	t.Helper()
+
+	queryURL := fmt.Sprintf("http://%s/select/%s/prometheus/api/v1/query_exemplars", app.httpListenAddr, opts.getTenant())
+	values := opts.asURLValues()
+	values.Add("query", query)
+
+	res, _ := app.cli.PostForm(t, queryURL, values)
+	return NewPrometheusAPIV1QueryExemplarsResponse(t, res)
+}
+
+// PrometheusAPIV1StatusTSDB is a test helper function that retrieves TSDB
+// cardinality stats by sending a HTTP POST request to
+// /prometheus/api/v1/status/tsdb vmselect endpoint.
+//
+// See https://docs.victoriametrics.com/#tsdb-stats
+func (app *Vmselect) PrometheusAPIV1StatusTSDB(t *testing.T, opts QueryOpts) *PrometheusAPIV1StatusTSDBResponse {
+	t.Helper()
+
+	statusURL := fmt.Sprintf("http://%s/select/%s/prometheus/api/v1/status/tsdb", app.httpListenAddr, opts.getTenant())
+	values := opts.asURLValues()
+
+	res, _ := app.cli.PostForm(t, statusURL, values)
+	return NewPrometheusAPIV1StatusTSDBResponse(t, res)
+}
+
+// LogsQLQuery is a test helper function that performs LogsQL query by sending
+// a HTTP POST request to /select/logsql/query endpoint.
+//
+// The response is expected to have 200 status code and to contain log entries
+// in JSON line format.
+//
+// See https://docs.victoriametrics.com/victorialogs/querying/#querying-logs
+func (app *Vmselect) LogsQLQuery(t *testing.T, query string, opts QueryOpts) *LogsQLQueryResponse {
+	t.Helper()
+
+	queryURL := fmt.Sprintf("http://%s/select/logsql/query", app.httpListenAddr)
+	values := opts.asURLValues()
+	values.Add("query", query)
+
+	res, statusCode := app.cli.PostForm(t, queryURL, values)
+	if statusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: got %d, want %d; response body: %q", statusCode, http.StatusOK, res)
+	}
+	return NewLogsQLQueryResponse(t, res)
+}
+
 // PrometheusAPIV1Series sends a query to a /prometheus/api/v1/series endpoint
 // and returns the list of time series that match the query.
 //
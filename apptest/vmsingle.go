@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/arrowipc"
 	pb "github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/golang/snappy"
 )
@@ -145,6 +146,38 @@ func (app *Vmsingle) PrometheusAPIV1Export(t *testing.T, query string, opts Quer
 	return NewPrometheusAPIV1QueryResponse(t, res)
 }
 
+// PrometheusAPIV1ExportArrow is a test helper function that performs the export of
+// raw samples in Arrow IPC stream format by sending a HTTP POST request to
+// /prometheus/api/v1/export vmsingle endpoint.
+//
+// See https://docs.victoriametrics.com/#how-to-export-data-in-arrow-format
+func (app *Vmsingle) PrometheusAPIV1ExportArrow(t *testing.T, query string, opts QueryOpts) *arrowipc.Stream {
+	t.Helper()
+
+	values := opts.asURLValues()
+	values.Add("match[]", query)
+	values.Add("format", "arrow")
+
+	res, _ := app.cli.PostForm(t, app.prometheusAPIV1ExportURL, values)
+	return NewPrometheusAPIV1ExportArrowResponse(t, res)
+}
+
+// PrometheusAPIV1ExportCSV is a test helper function that performs the export of
+// raw samples in CSV format by sending a HTTP POST request to
+// /prometheus/api/v1/export vmsingle endpoint.
+//
+// See https://docs.victoriametrics.com/#how-to-export-data-in-csv-line-format
+func (app *Vmsingle) PrometheusAPIV1ExportCSV(t *testing.T, query string, opts QueryOpts) []*ExportCSVRow {
+	t.Helper()
+
+	values := opts.asURLValues()
+	values.Add("match[]", query)
+	values.Add("format", "csv")
+
+	res, _ := app.cli.PostForm(t, app.prometheusAPIV1ExportURL, values)
+	return NewPrometheusAPIV1ExportCSVResponse(t, res)
+}
+
 // PrometheusAPIV1Query is a test helper function that performs PromQL/MetricsQL
 // instant query by sending a HTTP POST request to /prometheus/api/v1/query
 // vmsingle endpoint.
@@ -16,6 +16,7 @@ require (
 	github.com/VictoriaMetrics/fastcache v1.12.2
 	github.com/VictoriaMetrics/metrics v1.35.2
 	github.com/VictoriaMetrics/metricsql v0.83.1
+	github.com/andybalholm/brotli v1.1.0
 	github.com/aws/aws-sdk-go-v2 v1.36.1
 	github.com/aws/aws-sdk-go-v2/config v1.29.6
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.17.61
@@ -31,6 +32,7 @@ require (
 	github.com/influxdata/influxdb v1.11.8
 	github.com/klauspost/compress v1.17.11
 	github.com/mattn/go-isatty v0.0.20
+	github.com/pierrec/lz4/v4 v4.1.29
 	github.com/prometheus/prometheus v0.301.0
 	github.com/urfave/cli/v2 v2.27.5
 	github.com/valyala/fastjson v1.6.4
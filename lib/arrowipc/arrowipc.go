@@ -0,0 +1,291 @@
+// Package arrowipc implements a minimal subset of Apache Arrow IPC streaming format.
+//
+// See https://arrow.apache.org/docs/format/Columnar.html#ipc-streaming-format
+//
+// Only non-nullable columns of Utf8, Int64, Float64 and Timestamp(millisecond) types are supported.
+package arrowipc
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// ContentType is the content type for Arrow IPC stream.
+const ContentType = "application/vnd.apache.arrow.stream"
+
+// See https://github.com/apache/arrow/blob/main/format/Message.fbs and https://github.com/apache/arrow/blob/main/format/Schema.fbs
+const (
+	metadataVersionV5 = 4
+
+	messageHeaderSchema      = 1
+	messageHeaderRecordBatch = 3
+
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeUtf8          = 5
+	typeTimestamp     = 10
+
+	precisionDouble = 2
+
+	timeUnitMillisecond = 1
+
+	continuationMarker = 0xffffffff
+)
+
+// FieldType is the type of Arrow field.
+type FieldType int
+
+const (
+	// FieldTypeUtf8 is the type for string fields.
+	FieldTypeUtf8 = FieldType(iota)
+
+	// FieldTypeInt64 is the type for signed 64-bit integer fields.
+	FieldTypeInt64
+
+	// FieldTypeFloat64 is the type for 64-bit floating-point fields.
+	FieldTypeFloat64
+
+	// FieldTypeTimestampMillis is the type for unix timestamps in milliseconds without timezone.
+	FieldTypeTimestampMillis
+)
+
+// String returns string representation for ft.
+func (ft FieldType) String() string {
+	switch ft {
+	case FieldTypeUtf8:
+		return "utf8"
+	case FieldTypeInt64:
+		return "int64"
+	case FieldTypeFloat64:
+		return "float64"
+	case FieldTypeTimestampMillis:
+		return "timestamp[ms]"
+	default:
+		return "unknown"
+	}
+}
+
+// Field is Arrow field in the schema.
+type Field struct {
+	// Name is the field name.
+	Name string
+
+	// Type is the field type.
+	Type FieldType
+}
+
+// Column contains values for a single field in the record batch.
+type Column struct {
+	// Strings contains values for FieldTypeUtf8 field.
+	Strings []string
+
+	// Int64s contains values for FieldTypeInt64 and FieldTypeTimestampMillis fields.
+	Int64s []int64
+
+	// Float64s contains values for FieldTypeFloat64 field.
+	Float64s []float64
+}
+
+func (c *Column) valuesCount(ft FieldType) int {
+	switch ft {
+	case FieldTypeUtf8:
+		return len(c.Strings)
+	case FieldTypeInt64, FieldTypeTimestampMillis:
+		return len(c.Int64s)
+	case FieldTypeFloat64:
+		return len(c.Float64s)
+	default:
+		logger.Panicf("BUG: unexpected field type: %d", ft)
+		return 0
+	}
+}
+
+// MarshalSchema appends the schema message with the given fields to dst and returns the result.
+//
+// The schema message must be written at the start of the stream.
+func MarshalSchema(dst []byte, fields []Field) []byte {
+	var b fbBuilder
+	rootPos := b.initRoot()
+	messageOffsets := b.writeTable(rootPos, []fbField{
+		fbScalar(2, metadataVersionV5),   // version
+		fbScalar(1, messageHeaderSchema), // header_type
+		fbOffset(),                       // header
+		fbScalar(8, 0),                   // bodyLength
+	})
+	schemaOffsets := b.writeTable(messageOffsets[0], []fbField{
+		fbScalar(2, 0), // endianness: Little
+		fbOffset(),     // fields
+	})
+	fieldPositions := b.writeOffsetsVector(schemaOffsets[0], len(fields))
+	for i := range fields {
+		b.writeField(fieldPositions[i], &fields[i])
+	}
+	return appendMessageMetadata(dst, b.buf)
+}
+
+func (b *fbBuilder) writeField(refPos int, f *Field) {
+	offsets := b.writeTable(refPos, []fbField{
+		fbOffset(),                            // name
+		fbScalar(1, 0),                        // nullable
+		fbScalar(1, getFieldTypeType(f.Type)), // type_type
+		fbOffset(),                            // type
+		fbAbsent(),                            // dictionary
+		fbOffset(),                            // children
+	})
+	b.writeString(offsets[0], f.Name)
+	switch f.Type {
+	case FieldTypeUtf8:
+		b.writeTable(offsets[1], nil)
+	case FieldTypeInt64:
+		b.writeTable(offsets[1], []fbField{
+			fbScalar(4, 64), // bitWidth
+			fbScalar(1, 1),  // is_signed
+		})
+	case FieldTypeFloat64:
+		b.writeTable(offsets[1], []fbField{
+			fbScalar(2, precisionDouble), // precision
+		})
+	case FieldTypeTimestampMillis:
+		b.writeTable(offsets[1], []fbField{
+			fbScalar(2, timeUnitMillisecond), // unit
+		})
+	default:
+		logger.Panicf("BUG: unexpected field type: %d", f.Type)
+	}
+	b.writeOffsetsVector(offsets[2], 0)
+}
+
+func getFieldTypeType(ft FieldType) uint64 {
+	switch ft {
+	case FieldTypeUtf8:
+		return typeUtf8
+	case FieldTypeInt64:
+		return typeInt
+	case FieldTypeFloat64:
+		return typeFloatingPoint
+	case FieldTypeTimestampMillis:
+		return typeTimestamp
+	default:
+		logger.Panicf("BUG: unexpected field type: %d", ft)
+		return 0
+	}
+}
+
+// MarshalRecordBatch appends the record batch message with the given columns to dst and returns the result.
+//
+// columns must contain rowsCount values per each field in fields, which must match the fields passed to MarshalSchema.
+func MarshalRecordBatch(dst []byte, rowsCount int, fields []Field, columns []Column) []byte {
+	if len(fields) != len(columns) {
+		logger.Panicf("BUG: the number of columns must match the number of fields; got %d columns; want %d columns", len(columns), len(fields))
+	}
+
+	// Calculate the layout for the message body.
+	nodes := make([][2]int64, len(fields))
+	var buffers [][2]int64
+	bodyLength := 0
+	addBuffer := func(size int) {
+		buffers = append(buffers, [2]int64{int64(bodyLength), int64(size)})
+		bodyLength += alignInt(size, 8)
+	}
+	for i := range fields {
+		ft := fields[i].Type
+		c := &columns[i]
+		if n := c.valuesCount(ft); n != rowsCount {
+			logger.Panicf("BUG: unexpected number of values in the column %q; got %d; want %d", fields[i].Name, n, rowsCount)
+		}
+		nodes[i] = [2]int64{int64(rowsCount), 0}
+
+		// Validity bitmap isn't needed, since all the values are non-null.
+		addBuffer(0)
+
+		switch ft {
+		case FieldTypeUtf8:
+			dataSize := 0
+			for _, s := range c.Strings {
+				dataSize += len(s)
+			}
+			if dataSize > math.MaxInt32 {
+				logger.Panicf("BUG: too big data size for the column %q: %d bytes; it mustn't exceed %d bytes", fields[i].Name, dataSize, math.MaxInt32)
+			}
+			addBuffer(4 * (rowsCount + 1))
+			addBuffer(dataSize)
+		case FieldTypeInt64, FieldTypeTimestampMillis, FieldTypeFloat64:
+			addBuffer(8 * rowsCount)
+		default:
+			logger.Panicf("BUG: unexpected field type: %d", ft)
+		}
+	}
+
+	// Marshal message metadata.
+	var b fbBuilder
+	rootPos := b.initRoot()
+	messageOffsets := b.writeTable(rootPos, []fbField{
+		fbScalar(2, metadataVersionV5),        // version
+		fbScalar(1, messageHeaderRecordBatch), // header_type
+		fbOffset(),                            // header
+		fbScalar(8, uint64(bodyLength)),       // bodyLength
+	})
+	recordBatchOffsets := b.writeTable(messageOffsets[0], []fbField{
+		fbScalar(8, uint64(rowsCount)), // length
+		fbOffset(),                     // nodes
+		fbOffset(),                     // buffers
+	})
+	b.writeInt64PairsVector(recordBatchOffsets[0], nodes)
+	b.writeInt64PairsVector(recordBatchOffsets[1], buffers)
+	dst = appendMessageMetadata(dst, b.buf)
+
+	// Marshal message body.
+	for i := range fields {
+		c := &columns[i]
+		switch fields[i].Type {
+		case FieldTypeUtf8:
+			offset := 0
+			dst = binary.LittleEndian.AppendUint32(dst, 0)
+			for _, s := range c.Strings {
+				offset += len(s)
+				dst = binary.LittleEndian.AppendUint32(dst, uint32(offset))
+			}
+			dst = appendPadding(dst, 4*(rowsCount+1))
+			for _, s := range c.Strings {
+				dst = append(dst, s...)
+			}
+			dst = appendPadding(dst, offset)
+		case FieldTypeInt64, FieldTypeTimestampMillis:
+			for _, v := range c.Int64s {
+				dst = binary.LittleEndian.AppendUint64(dst, uint64(v))
+			}
+		case FieldTypeFloat64:
+			for _, v := range c.Float64s {
+				dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+			}
+		}
+	}
+	return dst
+}
+
+// MarshalEndOfStream appends the end of stream marker to dst and returns the result.
+func MarshalEndOfStream(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, continuationMarker)
+	dst = binary.LittleEndian.AppendUint32(dst, 0)
+	return dst
+}
+
+func appendMessageMetadata(dst, metadata []byte) []byte {
+	// The message prefix occupies 8 bytes, so the message body starts at 8-byte boundary
+	// when the metadata size is aligned to 8 bytes.
+	metadataSize := alignInt(len(metadata), 8)
+	dst = binary.LittleEndian.AppendUint32(dst, continuationMarker)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(metadataSize))
+	dst = append(dst, metadata...)
+	return appendPadding(dst, len(metadata))
+}
+
+// appendPadding appends zero padding to dst for aligning the buffer of the given size to 8 bytes.
+func appendPadding(dst []byte, size int) []byte {
+	for i := size; i < alignInt(size, 8); i++ {
+		dst = append(dst, 0)
+	}
+	return dst
+}
@@ -0,0 +1,291 @@
+package arrowipc
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalParseStream(t *testing.T) {
+	f := func(fields []Field, rbs []RecordBatch) {
+		t.Helper()
+
+		data := MarshalSchema(nil, fields)
+		for _, rb := range rbs {
+			data = MarshalRecordBatch(data, rb.RowsCount, fields, rb.Columns)
+		}
+		data = MarshalEndOfStream(data)
+
+		s, err := ParseStream(data)
+		if err != nil {
+			t.Fatalf("cannot parse stream: %s", err)
+		}
+		if !reflect.DeepEqual(s.Fields, fields) {
+			t.Fatalf("unexpected fields\ngot\n%v\nwant\n%v", s.Fields, fields)
+		}
+		if len(s.RecordBatches) != len(rbs) {
+			t.Fatalf("unexpected number of record batches; got %d; want %d", len(s.RecordBatches), len(rbs))
+		}
+		for i := range rbs {
+			checkRecordBatch(t, &s.RecordBatches[i], &rbs[i])
+		}
+
+		// The stream without end of stream marker must be parsed properly.
+		data = data[:len(data)-8]
+		s, err = ParseStream(data)
+		if err != nil {
+			t.Fatalf("cannot parse stream without end of stream marker: %s", err)
+		}
+		if len(s.RecordBatches) != len(rbs) {
+			t.Fatalf("unexpected number of record batches in the stream without end of stream marker; got %d; want %d", len(s.RecordBatches), len(rbs))
+		}
+	}
+
+	// empty schema
+	f([]Field{}, nil)
+
+	// schema without record batches
+	f([]Field{
+		{
+			Name: "foo",
+			Type: FieldTypeUtf8,
+		},
+	}, nil)
+
+	// multiple record batches
+	fields := []Field{
+		{
+			Name: "metric",
+			Type: FieldTypeUtf8,
+		},
+		{
+			Name: "timestamp",
+			Type: FieldTypeTimestampMillis,
+		},
+		{
+			Name: "value",
+			Type: FieldTypeFloat64,
+		},
+		{
+			Name: "n",
+			Type: FieldTypeInt64,
+		},
+	}
+	f(fields, []RecordBatch{
+		{
+			RowsCount: 3,
+			Columns: []Column{
+				{
+					Strings: []string{`{"__name__":"foo"}`, "", "abcde"},
+				},
+				{
+					Int64s: []int64{1700000000000, 1700000001000, 1700000002000},
+				},
+				{
+					Float64s: []float64{1.5, math.Inf(-1), -3},
+				},
+				{
+					Int64s: []int64{-1, 0, math.MaxInt64},
+				},
+			},
+		},
+		{
+			RowsCount: 0,
+			Columns: []Column{
+				{},
+				{},
+				{},
+				{},
+			},
+		},
+		{
+			RowsCount: 1,
+			Columns: []Column{
+				{
+					Strings: []string{"x"},
+				},
+				{
+					Int64s: []int64{10},
+				},
+				{
+					Float64s: []float64{2},
+				},
+				{
+					Int64s: []int64{7},
+				},
+			},
+		},
+	})
+}
+
+func TestParseStreamArrowGo(t *testing.T) {
+	// The stream has been generated by github.com/apache/arrow-go/v18/arrow/ipc.Writer
+	data, err := hex.DecodeString(
+		"ffffffff180100001000000000000a000c000a00090004000a0000001000000000010400080008000000040008000000" +
+			"0400000004000000b80000006c0000003c0000000400000068ffffff1000000018000000000000021c00000000000000" +
+			"08000c0008000700080000000000000140000000010000006e0000009cffffff10000000100000000000000310000000" +
+			"00000000d2ffffff000002000500000076616c7565000000c8ffffff10000000180000000000000a1800000000000000" +
+			"000006000800060006000000000001000900000074696d657374616d7000000010001400100000000f00080000000400" +
+			"1000000010000000140000000000000510000000000000000400040004000000060000006d6574726963000000000000" +
+			"ffffffff2801000014000000000000000c001600140013000c0004000c00000050000000000000001400000000000003" +
+			"04000a0018000c00080004000a00000014000000a8000000020000000000000000000000090000000000000000000000" +
+			"000000000000000000000000000000000c00000000000000100000000000000009000000000000002000000000000000" +
+			"000000000000000020000000000000001000000000000000300000000000000000000000000000003000000000000000" +
+			"100000000000000040000000000000000000000000000000400000000000000010000000000000000000000004000000" +
+			"020000000000000000000000000000000200000000000000000000000000000002000000000000000000000000000000" +
+			"0200000000000000000000000000000000000000030000000900000000000000666f6f62617262617a00000000000000" +
+			"0068e5cf8b010000e86be5cf8b010000000000000000f83f00000000000000c0fbffffffffffffff2a00000000000000" +
+			"ffffffff00000000")
+	if err != nil {
+		t.Fatalf("cannot decode hex: %s", err)
+	}
+
+	s, err := ParseStream(data)
+	if err != nil {
+		t.Fatalf("cannot parse stream: %s", err)
+	}
+	fieldsExpected := []Field{
+		{
+			Name: "metric",
+			Type: FieldTypeUtf8,
+		},
+		{
+			Name: "timestamp",
+			Type: FieldTypeTimestampMillis,
+		},
+		{
+			Name: "value",
+			Type: FieldTypeFloat64,
+		},
+		{
+			Name: "n",
+			Type: FieldTypeInt64,
+		},
+	}
+	if !reflect.DeepEqual(s.Fields, fieldsExpected) {
+		t.Fatalf("unexpected fields\ngot\n%v\nwant\n%v", s.Fields, fieldsExpected)
+	}
+	if len(s.RecordBatches) != 1 {
+		t.Fatalf("unexpected number of record batches; got %d; want 1", len(s.RecordBatches))
+	}
+	checkRecordBatch(t, &s.RecordBatches[0], &RecordBatch{
+		RowsCount: 2,
+		Columns: []Column{
+			{
+				Strings: []string{"foo", "barbaz"},
+			},
+			{
+				Int64s: []int64{1700000000000, 1700000001000},
+			},
+			{
+				Float64s: []float64{1.5, -2},
+			},
+			{
+				Int64s: []int64{-5, 42},
+			},
+		},
+	})
+}
+
+func TestParseStreamFailure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		s, err := ParseStream(data)
+		if err == nil {
+			t.Fatalf("expecting non-nil error when parsing %X; got %+v", data, s)
+		}
+	}
+
+	// missing schema
+	f(nil)
+	f(MarshalEndOfStream(nil))
+
+	// invalid continuation marker
+	f([]byte("foobarbaz"))
+
+	fields := []Field{
+		{
+			Name: "foo",
+			Type: FieldTypeUtf8,
+		},
+		{
+			Name: "bar",
+			Type: FieldTypeFloat64,
+		},
+	}
+	columns := []Column{
+		{
+			Strings: []string{"abc", "de"},
+		},
+		{
+			Float64s: []float64{1, 2},
+		},
+	}
+	schema := MarshalSchema(nil, fields)
+	recordBatch := MarshalRecordBatch(nil, 2, fields, columns)
+
+	// record batch without schema
+	f(recordBatch)
+
+	// duplicate schema
+	f(append(append([]byte{}, schema...), schema...))
+
+	// data after the end of stream
+	data := append([]byte{}, schema...)
+	data = MarshalEndOfStream(data)
+	data = append(data, recordBatch...)
+	f(data)
+
+	// truncated streams
+	data = append([]byte{}, schema...)
+	data = append(data, recordBatch...)
+	for i := 1; i < len(data); i++ {
+		if i == len(schema) {
+			// The stream with only schema is valid.
+			continue
+		}
+		f(data[:i])
+	}
+
+	// corrupted data mustn't result in panic
+	for i := range data {
+		dataCorrupted := append([]byte{}, data...)
+		dataCorrupted[i] ^= 0xff
+		_, _ = ParseStream(dataCorrupted)
+	}
+}
+
+func checkRecordBatch(t *testing.T, rb, rbExpected *RecordBatch) {
+	t.Helper()
+
+	if rb.RowsCount != rbExpected.RowsCount {
+		t.Fatalf("unexpected RowsCount; got %d; want %d", rb.RowsCount, rbExpected.RowsCount)
+	}
+	if len(rb.Columns) != len(rbExpected.Columns) {
+		t.Fatalf("unexpected number of columns; got %d; want %d", len(rb.Columns), len(rbExpected.Columns))
+	}
+	for i := range rb.Columns {
+		c := &rb.Columns[i]
+		cExpected := &rbExpected.Columns[i]
+		if len(c.Strings) != len(cExpected.Strings) || len(c.Int64s) != len(cExpected.Int64s) || len(c.Float64s) != len(cExpected.Float64s) {
+			t.Fatalf("unexpected column #%d\ngot\n%+v\nwant\n%+v", i, c, cExpected)
+		}
+		for j := range c.Strings {
+			if c.Strings[j] != cExpected.Strings[j] {
+				t.Fatalf("unexpected string #%d in column #%d; got %q; want %q", j, i, c.Strings[j], cExpected.Strings[j])
+			}
+		}
+		for j := range c.Int64s {
+			if c.Int64s[j] != cExpected.Int64s[j] {
+				t.Fatalf("unexpected int64 #%d in column #%d; got %d; want %d", j, i, c.Int64s[j], cExpected.Int64s[j])
+			}
+		}
+		for j := range c.Float64s {
+			if c.Float64s[j] != cExpected.Float64s[j] {
+				t.Fatalf("unexpected float64 #%d in column #%d; got %v; want %v", j, i, c.Float64s[j], cExpected.Float64s[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package arrowipc
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// fbBuilder builds flatbuffers front-to-back.
+//
+// All the uoffsets in flatbuffers point forward, so objects referenced by a table are written after the table.
+// Every write* function accepts refPos - the position of the uoffset slot, which must be patched
+// to point to the written object. Negative refPos means there is no need in patching.
+type fbBuilder struct {
+	buf []byte
+}
+
+// fbField describes a table field for fbBuilder.writeTable.
+type fbField struct {
+	// size is the field size in bytes. Zero size means the field is absent.
+	size int
+
+	// value is the value for scalar field.
+	value uint64
+
+	// isOffset is set for fields containing uoffset to other objects.
+	isOffset bool
+}
+
+func fbScalar(size int, value uint64) fbField {
+	return fbField{
+		size:  size,
+		value: value,
+	}
+}
+
+func fbOffset() fbField {
+	return fbField{
+		size:     4,
+		isOffset: true,
+	}
+}
+
+func fbAbsent() fbField {
+	return fbField{}
+}
+
+// initRoot writes the uoffset slot for the root table and returns its position.
+func (b *fbBuilder) initRoot() int {
+	b.buf = append(b.buf[:0], 0, 0, 0, 0)
+	return 0
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// patchOffset makes the uoffset at refPos pointing to the end of b.buf.
+func (b *fbBuilder) patchOffset(refPos int) {
+	if refPos < 0 {
+		return
+	}
+	binary.LittleEndian.PutUint32(b.buf[refPos:], uint32(len(b.buf)-refPos))
+}
+
+// writeTable writes the table with the given fields.
+//
+// It returns the positions of uoffset slots for fields with isOffset set in the order of their appearance in fields.
+func (b *fbBuilder) writeTable(refPos int, fields []fbField) []int {
+	// Calculate the table layout. The table starts with soffset to its vtable.
+	fieldOffsets := make([]int, len(fields))
+	tableSize := 4
+	for i, f := range fields {
+		if f.size == 0 {
+			continue
+		}
+		tableSize = alignInt(tableSize, f.size)
+		fieldOffsets[i] = tableSize
+		tableSize += f.size
+	}
+
+	// Write vtable in front of the table.
+	b.align(2)
+	vtablePos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*len(fields)))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(tableSize))
+	for _, offset := range fieldOffsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(offset))
+	}
+
+	// Write the table. It is aligned to 8 bytes, so all the scalar fields inside it are properly aligned.
+	b.align(8)
+	tablePos := len(b.buf)
+	b.patchOffset(refPos)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(tablePos-vtablePos))
+	var offsetPositions []int
+	for i, f := range fields {
+		if f.size == 0 {
+			continue
+		}
+		for len(b.buf)-tablePos < fieldOffsets[i] {
+			b.buf = append(b.buf, 0)
+		}
+		if f.isOffset {
+			offsetPositions = append(offsetPositions, len(b.buf))
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, 0)
+			continue
+		}
+		switch f.size {
+		case 1:
+			b.buf = append(b.buf, byte(f.value))
+		case 2:
+			b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(f.value))
+		case 4:
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(f.value))
+		case 8:
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, f.value)
+		default:
+			logger.Panicf("BUG: unexpected field size: %d; want 1, 2, 4 or 8", f.size)
+		}
+	}
+	return offsetPositions
+}
+
+// writeString writes the given string s.
+func (b *fbBuilder) writeString(refPos int, s string) {
+	b.align(4)
+	b.patchOffset(refPos)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+}
+
+// writeOffsetsVector writes a vector of itemsCount uoffsets and returns positions for these uoffsets.
+func (b *fbBuilder) writeOffsetsVector(refPos, itemsCount int) []int {
+	b.align(4)
+	b.patchOffset(refPos)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(itemsCount))
+	offsetPositions := make([]int, itemsCount)
+	for i := range offsetPositions {
+		offsetPositions[i] = len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, 0)
+	}
+	return offsetPositions
+}
+
+// writeInt64PairsVector writes a vector of structs with two int64 fields, such as Arrow FieldNode and Buffer.
+func (b *fbBuilder) writeInt64PairsVector(refPos int, pairs [][2]int64) {
+	// Align vector items to 8 bytes. The vector starts with 4-byte length.
+	for (len(b.buf)+4)%8 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	b.patchOffset(refPos)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(pairs)))
+	for _, p := range pairs {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(p[0]))
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(p[1]))
+	}
+}
+
+func alignInt(n, alignment int) int {
+	if r := n % alignment; r != 0 {
+		n += alignment - r
+	}
+	return n
+}
+
+// fbReader reads flatbuffers.
+//
+// The first error is stored in err, while subsequent reads return zero values.
+type fbReader struct {
+	buf []byte
+	err error
+}
+
+// fbTable is a table read by fbReader.
+type fbTable struct {
+	pos        int
+	vtablePos  int
+	vtableSize int
+}
+
+func (r *fbReader) setOutOfBoundsError(pos, size int) {
+	if r.err == nil {
+		r.err = fmt.Errorf("cannot read %d bytes at offset %d from flatbuffer with %d bytes", size, pos, len(r.buf))
+	}
+}
+
+func (r *fbReader) bytes(pos, size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if pos < 0 || size < 0 || pos > len(r.buf) || size > len(r.buf)-pos {
+		r.setOutOfBoundsError(pos, size)
+		return nil
+	}
+	return r.buf[pos : pos+size]
+}
+
+func (r *fbReader) uint8(pos int) uint8 {
+	b := r.bytes(pos, 1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *fbReader) uint16(pos int) uint16 {
+	b := r.bytes(pos, 2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *fbReader) uint32(pos int) uint32 {
+	b := r.bytes(pos, 4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *fbReader) uint64(pos int) uint64 {
+	b := r.bytes(pos, 8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+// deref returns the position pointed by the uoffset at pos.
+func (r *fbReader) deref(pos int) int {
+	return pos + int(r.uint32(pos))
+}
+
+func (r *fbReader) rootTable() fbTable {
+	return r.table(r.deref(0))
+}
+
+func (r *fbReader) table(pos int) fbTable {
+	vtablePos := pos - int(int32(r.uint32(pos)))
+	return fbTable{
+		pos:        pos,
+		vtablePos:  vtablePos,
+		vtableSize: int(r.uint16(vtablePos)),
+	}
+}
+
+// fieldPos returns the position of the field with the given id in t.
+//
+// Zero is returned if the field is missing.
+func (r *fbReader) fieldPos(t fbTable, id int) int {
+	entryPos := 4 + 2*id
+	if entryPos+2 > t.vtableSize {
+		return 0
+	}
+	offset := r.uint16(t.vtablePos + entryPos)
+	if offset == 0 {
+		return 0
+	}
+	return t.pos + int(offset)
+}
+
+func (r *fbReader) fieldUint8(t fbTable, id int) uint8 {
+	pos := r.fieldPos(t, id)
+	if pos == 0 {
+		return 0
+	}
+	return r.uint8(pos)
+}
+
+func (r *fbReader) fieldUint16(t fbTable, id int) uint16 {
+	pos := r.fieldPos(t, id)
+	if pos == 0 {
+		return 0
+	}
+	return r.uint16(pos)
+}
+
+func (r *fbReader) fieldUint32(t fbTable, id int) uint32 {
+	pos := r.fieldPos(t, id)
+	if pos == 0 {
+		return 0
+	}
+	return r.uint32(pos)
+}
+
+func (r *fbReader) fieldUint64(t fbTable, id int) uint64 {
+	pos := r.fieldPos(t, id)
+	if pos == 0 {
+		return 0
+	}
+	return r.uint64(pos)
+}
+
+// fieldTable returns the table referenced by the field with the given id in t.
+//
+// false is returned if the field is missing.
+func (r *fbReader) fieldTable(t fbTable, id int) (fbTable, bool) {
+	pos := r.fieldPos(t, id)
+	if pos == 0 {
+		return fbTable{}, false
+	}
+	return r.table(r.deref(pos)), true
+}
+
+// fieldVector returns the position of the first item and the number of items for the vector referenced by the field with the given id in t.
+func (r *fbReader) fieldVector(t fbTable, id int) (int, int) {
+	pos := r.fieldPos(t, id)
+	if pos == 0 {
+		return 0, 0
+	}
+	vectorPos := r.deref(pos)
+	itemsCount := int(r.uint32(vectorPos))
+	return vectorPos + 4, itemsCount
+}
+
+func (r *fbReader) fieldString(t fbTable, id int) string {
+	itemsPos, itemsCount := r.fieldVector(t, id)
+	return string(r.bytes(itemsPos, itemsCount))
+}
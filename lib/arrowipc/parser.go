@@ -0,0 +1,270 @@
+package arrowipc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Stream is a parsed Arrow IPC stream.
+type Stream struct {
+	// Fields contains the stream schema.
+	Fields []Field
+
+	// RecordBatches contains record batches from the stream.
+	RecordBatches []RecordBatch
+}
+
+// RecordBatch is a parsed Arrow record batch.
+type RecordBatch struct {
+	// RowsCount is the number of rows in the record batch.
+	RowsCount int
+
+	// Columns contains columns for the fields from Stream.Fields.
+	Columns []Column
+}
+
+// ParseStream parses Arrow IPC stream from data.
+//
+// The stream may contain only the fields, which can be marshaled with MarshalSchema and MarshalRecordBatch.
+// The returned stream doesn't refer to data.
+func ParseStream(data []byte) (*Stream, error) {
+	var s Stream
+	hasSchema := false
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, fmt.Errorf("cannot read message prefix from %d bytes; want at least 8 bytes", len(data))
+		}
+		if marker := binary.LittleEndian.Uint32(data); marker != continuationMarker {
+			return nil, fmt.Errorf("unexpected continuation marker 0x%08x; want 0x%08x", marker, uint32(continuationMarker))
+		}
+		metadataSize := uint64(binary.LittleEndian.Uint32(data[4:]))
+		data = data[8:]
+		if metadataSize == 0 {
+			// End of stream
+			if len(data) > 0 {
+				return nil, fmt.Errorf("unexpected %d bytes after the end of stream", len(data))
+			}
+			break
+		}
+		if metadataSize > uint64(len(data)) {
+			return nil, fmt.Errorf("too big message metadata size: %d bytes; the remaining data size is %d bytes", metadataSize, len(data))
+		}
+		r := &fbReader{
+			buf: data[:metadataSize],
+		}
+		data = data[metadataSize:]
+
+		message := r.rootTable()
+		if version := r.fieldUint16(message, 0); version != metadataVersionV5 {
+			if r.err != nil {
+				return nil, fmt.Errorf("cannot read message metadata: %w", r.err)
+			}
+			return nil, fmt.Errorf("unsupported metadata version: %d; want %d", version, metadataVersionV5)
+		}
+		headerType := r.fieldUint8(message, 1)
+		header, ok := r.fieldTable(message, 2)
+		if !ok {
+			return nil, fmt.Errorf("missing message header")
+		}
+		bodyLength := r.fieldUint64(message, 3)
+		if r.err != nil {
+			return nil, fmt.Errorf("cannot read message metadata: %w", r.err)
+		}
+		if bodyLength > uint64(len(data)) {
+			return nil, fmt.Errorf("too big message body length: %d bytes; the remaining data size is %d bytes", bodyLength, len(data))
+		}
+		body := data[:bodyLength]
+		data = data[bodyLength:]
+
+		switch headerType {
+		case messageHeaderSchema:
+			if hasSchema {
+				return nil, fmt.Errorf("unexpected second schema message in the stream")
+			}
+			fields, err := parseSchema(r, header)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse schema: %w", err)
+			}
+			s.Fields = fields
+			hasSchema = true
+		case messageHeaderRecordBatch:
+			if !hasSchema {
+				return nil, fmt.Errorf("missing schema message in front of record batch message")
+			}
+			rb, err := parseRecordBatch(r, header, body, s.Fields)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse record batch #%d: %w", len(s.RecordBatches), err)
+			}
+			s.RecordBatches = append(s.RecordBatches, *rb)
+		default:
+			return nil, fmt.Errorf("unsupported message header type: %d", headerType)
+		}
+	}
+	if !hasSchema {
+		return nil, fmt.Errorf("missing schema message")
+	}
+	return &s, nil
+}
+
+func parseSchema(r *fbReader, schema fbTable) ([]Field, error) {
+	if endianness := r.fieldUint16(schema, 0); endianness != 0 {
+		return nil, fmt.Errorf("unsupported big endian schema")
+	}
+	itemsPos, itemsCount := r.fieldVector(schema, 1)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if itemsCount > len(r.buf)/4 {
+		return nil, fmt.Errorf("too big number of fields: %d", itemsCount)
+	}
+	fields := make([]Field, itemsCount)
+	for i := range fields {
+		t := r.table(r.deref(itemsPos + 4*i))
+		name := r.fieldString(t, 0)
+		typeType := r.fieldUint8(t, 2)
+		typeTable, ok := r.fieldTable(t, 3)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if !ok {
+			return nil, fmt.Errorf("missing type for the field %q", name)
+		}
+		var ft FieldType
+		switch typeType {
+		case typeUtf8:
+			ft = FieldTypeUtf8
+		case typeInt:
+			bitWidth := r.fieldUint32(typeTable, 0)
+			isSigned := r.fieldUint8(typeTable, 1)
+			if bitWidth != 64 || isSigned == 0 {
+				return nil, fmt.Errorf("unsupported integer type for the field %q: bitWidth=%d, isSigned=%v; want signed 64-bit integer", name, bitWidth, isSigned != 0)
+			}
+			ft = FieldTypeInt64
+		case typeFloatingPoint:
+			if precision := r.fieldUint16(typeTable, 0); precision != precisionDouble {
+				return nil, fmt.Errorf("unsupported floating-point precision for the field %q: %d; want %d", name, precision, precisionDouble)
+			}
+			ft = FieldTypeFloat64
+		case typeTimestamp:
+			if unit := r.fieldUint16(typeTable, 0); unit != timeUnitMillisecond {
+				return nil, fmt.Errorf("unsupported timestamp unit for the field %q: %d; want %d", name, unit, timeUnitMillisecond)
+			}
+			ft = FieldTypeTimestampMillis
+		default:
+			return nil, fmt.Errorf("unsupported type for the field %q: %d", name, typeType)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		fields[i] = Field{
+			Name: name,
+			Type: ft,
+		}
+	}
+	return fields, nil
+}
+
+func parseRecordBatch(r *fbReader, recordBatch fbTable, body []byte, fields []Field) (*RecordBatch, error) {
+	rowsCount := r.fieldUint64(recordBatch, 0)
+	nodesPos, nodesCount := r.fieldVector(recordBatch, 1)
+	buffersPos, buffersCount := r.fieldVector(recordBatch, 2)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if nodesCount != len(fields) {
+		return nil, fmt.Errorf("unexpected number of field nodes; got %d; want %d", nodesCount, len(fields))
+	}
+	if rowsCount > uint64(len(body)) {
+		return nil, fmt.Errorf("too big number of rows: %d", rowsCount)
+	}
+
+	nextBuffer := func() []byte {
+		if buffersCount <= 0 {
+			if r.err == nil {
+				r.err = fmt.Errorf("missing buffers for record batch")
+			}
+			return nil
+		}
+		offset := r.uint64(buffersPos)
+		length := r.uint64(buffersPos + 8)
+		buffersPos += 16
+		buffersCount--
+		if r.err != nil {
+			return nil
+		}
+		if offset > uint64(len(body)) || length > uint64(len(body))-offset {
+			r.err = fmt.Errorf("buffer with offset=%d and length=%d is out of message body with length %d", offset, length, len(body))
+			return nil
+		}
+		return body[offset : offset+length]
+	}
+
+	rb := &RecordBatch{
+		RowsCount: int(rowsCount),
+		Columns:   make([]Column, len(fields)),
+	}
+	for i := range fields {
+		f := &fields[i]
+		nodeLength := r.uint64(nodesPos + 16*i)
+		nullCount := r.uint64(nodesPos + 16*i + 8)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if nodeLength != rowsCount {
+			return nil, fmt.Errorf("unexpected number of values for the field %q; got %d; want %d", f.Name, nodeLength, rowsCount)
+		}
+		if nullCount != 0 {
+			return nil, fmt.Errorf("null values aren't supported; the field %q contains %d null values", f.Name, nullCount)
+		}
+
+		// Skip validity bitmap, since all the values are non-null.
+		_ = nextBuffer()
+
+		c := &rb.Columns[i]
+		switch f.Type {
+		case FieldTypeUtf8:
+			offsetsBuf := nextBuffer()
+			dataBuf := nextBuffer()
+			if r.err != nil {
+				return nil, r.err
+			}
+			if uint64(len(offsetsBuf)) < 4*(rowsCount+1) {
+				return nil, fmt.Errorf("too short offsets buffer for the field %q: %d bytes; want at least %d bytes", f.Name, len(offsetsBuf), 4*(rowsCount+1))
+			}
+			c.Strings = make([]string, rowsCount)
+			prevOffset := binary.LittleEndian.Uint32(offsetsBuf)
+			for j := range c.Strings {
+				offset := binary.LittleEndian.Uint32(offsetsBuf[4*(j+1):])
+				if offset < prevOffset || uint64(offset) > uint64(len(dataBuf)) {
+					return nil, fmt.Errorf("invalid offset for the value #%d at the field %q: %d; it must be in the range [%d..%d]", j, f.Name, offset, prevOffset, len(dataBuf))
+				}
+				c.Strings[j] = string(dataBuf[prevOffset:offset])
+				prevOffset = offset
+			}
+		case FieldTypeInt64, FieldTypeTimestampMillis, FieldTypeFloat64:
+			dataBuf := nextBuffer()
+			if r.err != nil {
+				return nil, r.err
+			}
+			if uint64(len(dataBuf)) < 8*rowsCount {
+				return nil, fmt.Errorf("too short data buffer for the field %q: %d bytes; want at least %d bytes", f.Name, len(dataBuf), 8*rowsCount)
+			}
+			if f.Type == FieldTypeFloat64 {
+				c.Float64s = make([]float64, rowsCount)
+				for j := range c.Float64s {
+					c.Float64s[j] = math.Float64frombits(binary.LittleEndian.Uint64(dataBuf[8*j:]))
+				}
+			} else {
+				c.Int64s = make([]int64, rowsCount)
+				for j := range c.Int64s {
+					c.Int64s[j] = int64(binary.LittleEndian.Uint64(dataBuf[8*j:]))
+				}
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return rb, nil
+}
@@ -517,7 +517,8 @@ func UnmarshalBytes(src []byte) ([]byte, int) {
 	if nSize <= 0 {
 		return nil, 0
 	}
-	if uint64(nSize)+n > uint64(len(src)) {
+	if n > uint64(len(src)-nSize) {
+		// The check is performed in this way in order to avoid uint64 overflow for too big n.
 		return nil, 0
 	}
 	start := nSize
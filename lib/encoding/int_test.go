@@ -333,3 +333,28 @@ func testMarshalUnmarshalBytes(t *testing.T, s string) {
 		t.Fatalf("unexpected b for s=%q; got\n%x; expecting\n%x", s, b1[len(prefix):], b)
 	}
 }
+
+func TestUnmarshalBytesFailure(t *testing.T) {
+	f := func(src []byte) {
+		t.Helper()
+
+		b, nSize := UnmarshalBytes(src)
+		if nSize > 0 {
+			t.Fatalf("expecting non-positive nSize when unmarshaling %x; got %d; b=%x", src, nSize, b)
+		}
+	}
+
+	// empty src
+	f(nil)
+
+	// truncated length
+	f([]byte{0x80})
+
+	// the length exceeds the src size
+	f(MarshalVarUint64(nil, 2))
+	f(append(MarshalVarUint64(nil, 10), "foo"...))
+
+	// the length overflows uint64 when added to the length size
+	f(append(MarshalVarUint64(nil, 1<<64-1), "foo"...))
+	f(append(MarshalVarUint64(nil, 1<<64-5), "foo"...))
+}
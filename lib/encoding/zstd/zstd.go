@@ -0,0 +1,72 @@
+package zstd
+
+import (
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
+)
+
+// Compression levels, which can be passed to CompressLevel and NewWriterLevel.
+//
+// Both cgo and pure Go implementations spend comparable efforts on compression at these levels.
+const (
+	// LevelFastest is the fastest non-negative compression level.
+	//
+	// Negative levels down to MinLevel are faster at the cost of worse compression ratio.
+	LevelFastest = 1
+
+	// LevelDefault is the default compression level.
+	LevelDefault = 3
+
+	// LevelBetter provides better compression ratio than LevelDefault at the cost of higher CPU usage.
+	LevelBetter = 7
+
+	// LevelBest is the compression level with the best compression ratio supported by pure Go implementation.
+	//
+	// Levels up to MaxLevel are supported by cgo implementation, but they are much slower and they need more memory.
+	LevelBest = 11
+
+	// MinLevel is the minimum supported compression level. It equals to ZSTD_minCLevel() in the reference implementation.
+	MinLevel = -(1 << 17)
+
+	// MaxLevel is the maximum supported compression level. It equals to ZSTD_maxCLevel() in the reference implementation.
+	MaxLevel = 22
+)
+
+// ValidLevel returns true if the given compression level is supported.
+func ValidLevel(level int) bool {
+	return level >= MinLevel && level <= MaxLevel
+}
+
+// ClampLevel returns the given compression level clamped to the supported range [MinLevel ... MaxLevel].
+func ClampLevel(level int) int {
+	return min(max(level, MinLevel), MaxLevel)
+}
+
+// Writer compresses the data written to it into zstd stream.
+//
+// Writer is obtained via NewWriterLevel. It may be re-used for compressing multiple streams via Reset.
+type Writer interface {
+	io.Writer
+
+	// Close flushes the pending data and finalizes zstd stream.
+	//
+	// It doesn't close the underlying writer.
+	Close() error
+
+	// Reset prepares the Writer for compressing a new stream into w with the same compression level.
+	//
+	// The pending data for the previous stream is dropped.
+	Reset(w io.Writer)
+}
+
+// DecompressWithSizeHint appends decompressed src to dst and returns the result.
+//
+// sizeHint must contain the expected size of the decompressed data. It is used for pre-allocating the needed space at dst,
+// so it isn't re-allocated multiple times during the decompression. dst is grown as needed if sizeHint is too small.
+func DecompressWithSizeHint(dst, src []byte, sizeHint int) ([]byte, error) {
+	if sizeHint > 0 {
+		dst = slicesutil.ExtendCapacity(dst, sizeHint)
+	}
+	return Decompress(dst, src)
+}
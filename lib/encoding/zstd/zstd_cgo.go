@@ -3,6 +3,8 @@
 package zstd
 
 import (
+	"io"
+
 	"github.com/valyala/gozstd"
 )
 
@@ -17,3 +19,21 @@ func Decompress(dst, src []byte) ([]byte, error) {
 func CompressLevel(dst, src []byte, compressionLevel int) []byte {
 	return gozstd.CompressLevel(dst, src, compressionLevel)
 }
+
+// NewWriterLevel returns new Writer, which writes the data compressed with the given compressionLevel to w.
+func NewWriterLevel(w io.Writer, compressionLevel int) Writer {
+	return &writer{
+		Writer:           gozstd.NewWriterLevel(w, compressionLevel),
+		compressionLevel: compressionLevel,
+	}
+}
+
+type writer struct {
+	*gozstd.Writer
+
+	compressionLevel int
+}
+
+func (zw *writer) Reset(w io.Writer) {
+	zw.Writer.Reset(w, nil, zw.compressionLevel)
+}
@@ -3,6 +3,7 @@
 package zstd
 
 import (
+	"io"
 	"sync"
 	"sync/atomic"
 
@@ -78,3 +79,16 @@ func newEncoder(compressionLevel int) *zstd.Encoder {
 	}
 	return e
 }
+
+// NewWriterLevel returns new Writer, which writes the data compressed with the given compressionLevel to w.
+func NewWriterLevel(w io.Writer, compressionLevel int) Writer {
+	level := zstd.EncoderLevelFromZstd(compressionLevel)
+	e, err := zstd.NewWriter(w,
+		zstd.WithEncoderCRC(false),     // Disable CRC for performance reasons.
+		zstd.WithEncoderConcurrency(1), // Do not start background goroutines per every Writer.
+		zstd.WithEncoderLevel(level))
+	if err != nil {
+		logger.Panicf("BUG: failed to create ZSTD writer: %s", err)
+	}
+	return e
+}
@@ -3,6 +3,7 @@
 package zstd
 
 import (
+	"bytes"
 	"math/rand"
 	"testing"
 
@@ -95,3 +96,91 @@ func pureDecompress(dst, src []byte) ([]byte, error) {
 func cgoDecompress(dst, src []byte) ([]byte, error) {
 	return cgo.Decompress(dst, src)
 }
+
+func TestDecompressWithSizeHint(t *testing.T) {
+	f := func(data []byte, sizeHint int) {
+		t.Helper()
+
+		// Compress data via Writer, since it doesn't store the decompressed size in the frame header.
+		var bb bytes.Buffer
+		zw := NewWriterLevel(&bb, 1)
+		if _, err := zw.Write(data); err != nil {
+			t.Fatalf("cannot compress data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+
+		prefix := []byte("foo")
+		result, err := DecompressWithSizeHint(prefix, bb.Bytes(), sizeHint)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(result[:len(prefix)]) != string(prefix) {
+			t.Fatalf("unexpected prefix; got %q; want %q", result[:len(prefix)], prefix)
+		}
+		if string(result[len(prefix):]) != string(data) {
+			t.Fatalf("unexpected decompressed data; got %d bytes; want %d bytes", len(result)-len(prefix), len(data))
+		}
+	}
+
+	data := bytes.Repeat([]byte("foobar baz "), 10_000)
+
+	// valid size hint
+	f(data, len(data))
+
+	// too small size hint
+	f(data, len(data)/3)
+	f(data, 0)
+	f(data, -1)
+
+	// too big size hint
+	f(data, 3*len(data))
+
+	// empty data
+	f(nil, 0)
+	f(nil, 100)
+}
+
+func TestValidLevel(t *testing.T) {
+	f := func(level int, resultExpected bool) {
+		t.Helper()
+		result := ValidLevel(level)
+		if result != resultExpected {
+			t.Fatalf("unexpected ValidLevel(%d); got %v; want %v", level, result, resultExpected)
+		}
+	}
+
+	f(0, true)
+	f(LevelFastest, true)
+	f(LevelDefault, true)
+	f(LevelBetter, true)
+	f(LevelBest, true)
+	f(MinLevel, true)
+	f(MaxLevel, true)
+	f(-5, true)
+
+	f(MinLevel-1, false)
+	f(MaxLevel+1, false)
+	f(100, false)
+}
+
+func TestClampLevel(t *testing.T) {
+	f := func(level, resultExpected int) {
+		t.Helper()
+		result := ClampLevel(level)
+		if result != resultExpected {
+			t.Fatalf("unexpected ClampLevel(%d); got %d; want %d", level, result, resultExpected)
+		}
+	}
+
+	f(0, 0)
+	f(LevelDefault, LevelDefault)
+	f(-5, -5)
+	f(MinLevel, MinLevel)
+	f(MaxLevel, MaxLevel)
+
+	f(MinLevel-1, MinLevel)
+	f(MaxLevel+1, MaxLevel)
+	f(100, MaxLevel)
+}
@@ -0,0 +1,48 @@
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func BenchmarkDecompressWithSizeHint(b *testing.B) {
+	data := bytes.Repeat([]byte("foobar baz "), 100_000)
+
+	// Compress data via Writer, since it doesn't store the decompressed size in the frame header.
+	var bb bytes.Buffer
+	zw := NewWriterLevel(&bb, 1)
+	if _, err := zw.Write(data); err != nil {
+		b.Fatalf("cannot compress data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		b.Fatalf("cannot close writer: %s", err)
+	}
+	src := bb.Bytes()
+
+	b.Run("without-hint", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			dst, err := Decompress(nil, src)
+			if err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+			if len(dst) != len(data) {
+				b.Fatalf("unexpected decompressed size; got %d; want %d", len(dst), len(data))
+			}
+		}
+	})
+	b.Run("with-hint", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			dst, err := DecompressWithSizeHint(nil, src, len(data))
+			if err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+			if len(dst) != len(data) {
+				b.Fatalf("unexpected decompressed size; got %d; want %d", len(dst), len(data))
+			}
+		}
+	})
+}
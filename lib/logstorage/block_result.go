@@ -2,12 +2,14 @@ package logstorage
 
 import (
 	"math"
+	"net/netip"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 	"unsafe"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
@@ -679,11 +681,17 @@ func (br *blockResult) newValuesForColumn(c *blockResultColumn) []string {
 }
 
 func (br *blockResult) newValuesBucketedForColumn(c *blockResultColumn, bf *byStatsField) []string {
+	if bf.transform != nil {
+		return br.getTransformedValues(c, bf)
+	}
 	if c.isConst {
 		v := c.valuesEncoded[0]
 		s := br.getBucketedValue(v, bf)
 		return br.getConstValues(s)
 	}
+	if bf.isTimePartBucket() {
+		return br.getTimePartValues(c, bf)
+	}
 	if c.isTime {
 		return br.getBucketedTimestampValues(bf)
 	}
@@ -824,6 +832,88 @@ func truncateTimestamp(ts, bucketSizeInt, bucketOffsetInt int64, bucketSizeStr s
 	return ts
 }
 
+// getTimePartValues returns the part of timestamps in c according to bf, such as hour of the day or day of the week.
+//
+// Values, which cannot be parsed as timestamps, are returned as is.
+func (br *blockResult) getTimePartValues(c *blockResultColumn, bf *byStatsField) []string {
+	buf := br.a.b
+	valuesBuf := br.valuesBuf
+	valuesBufLen := len(valuesBuf)
+	valuesBuf = slicesutil.SetLength(valuesBuf, valuesBufLen+br.rowsLen)
+	values := valuesBuf[valuesBufLen:]
+
+	if c.isTime {
+		var s string
+		timestamps := br.getTimestamps()
+		for i := range timestamps {
+			if i > 0 && timestamps[i-1] == timestamps[i] {
+				values[i] = s
+				continue
+			}
+			bufLen := len(buf)
+			buf = marshalTimePart(buf, timestamps[i], bf)
+			s = bytesutil.ToUnsafeString(buf[bufLen:])
+			values[i] = s
+		}
+	} else {
+		var s string
+		valuesOrig := c.getValues(br)
+		for i, v := range valuesOrig {
+			if i > 0 && valuesOrig[i-1] == v {
+				values[i] = s
+				continue
+			}
+			timestamp, ok := TryParseTimestampRFC3339Nano(v)
+			if !ok {
+				s = v
+			} else {
+				bufLen := len(buf)
+				buf = marshalTimePart(buf, timestamp, bf)
+				s = bytesutil.ToUnsafeString(buf[bufLen:])
+			}
+			values[i] = s
+		}
+	}
+
+	br.a.b = buf
+	br.valuesBuf = valuesBuf
+
+	return values
+}
+
+// tryParseIPv6 parses s as IPv6 address.
+func tryParseIPv6(s string) (netip.Addr, bool) {
+	if strings.IndexByte(s, ':') < 0 {
+		// Fast path - s cannot be IPv6 address.
+		return netip.Addr{}, false
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil || !ip.Is6() {
+		return netip.Addr{}, false
+	}
+	return ip, true
+}
+
+// marshalTimePart appends the part of the given timestamp in nanoseconds according to bf to dst and returns the result.
+func marshalTimePart(dst []byte, timestamp int64, bf *byStatsField) []byte {
+	timezone := bf.timezone
+	if timezone == nil {
+		timezone = time.UTC
+	}
+	t := time.Unix(0, timestamp-int64(bf.bucketOffset)).In(timezone)
+
+	switch bf.bucketSizeStr {
+	case "hour_of_day":
+		return strconv.AppendInt(dst, int64(t.Hour()), 10)
+	case "day_of_week":
+		// 0 is Sunday, 6 is Saturday
+		return strconv.AppendInt(dst, int64(t.Weekday()), 10)
+	default:
+		logger.Panicf("BUG: unexpected time part bucket: %q", bf.bucketSizeStr)
+		return nil
+	}
+}
+
 func (br *blockResult) getTimestampValues() []string {
 	buf := br.a.b
 	valuesBuf := br.valuesBuf
@@ -1645,6 +1735,36 @@ func (br *blockResult) getBucketedValue(s string, bf *byStatsField) string {
 		return ""
 	}
 
+	if bf.transform != nil {
+		return br.getTransformedValue(s, bf.transform)
+	}
+
+	if bf.isTimePartBucket() {
+		timestamp, ok := TryParseTimestampRFC3339Nano(s)
+		if !ok {
+			return s
+		}
+		buf := br.a.b
+		bufLen := len(buf)
+		buf = marshalTimePart(buf, timestamp, bf)
+		br.a.b = buf
+		return bytesutil.ToUnsafeString(buf[bufLen:])
+	}
+
+	if bf.isIPMaskBucket() {
+		if ip, ok := tryParseIPv6(s); ok {
+			prefix, err := ip.Prefix(bf.ipv6PrefixLen)
+			if err != nil {
+				logger.Panicf("BUG: cannot apply /%d mask to %q: %s", bf.ipv6PrefixLen, s, err)
+			}
+			buf := br.a.b
+			bufLen := len(buf)
+			buf = prefix.Addr().AppendTo(buf)
+			br.a.b = buf
+			return bytesutil.ToUnsafeString(buf[bufLen:])
+		}
+	}
+
 	c := s[0]
 	if (c < '0' || c > '9') && c != '-' {
 		// Fast path - the value cannot be bucketed, since it starts with unexpected chars.
@@ -2323,6 +2443,35 @@ func (c *blockResultColumn) sumLenValues(br *blockResult) uint64 {
 	}
 }
 
+// sumRuneLenValues returns the sum of lengths in runes for all the values in c.
+func (c *blockResultColumn) sumRuneLenValues(br *blockResult) uint64 {
+	if c.isConst {
+		v := c.valuesEncoded[0]
+		return uint64(utf8.RuneCountInString(v)) * uint64(br.rowsLen)
+	}
+
+	switch c.valueType {
+	case valueTypeString:
+		n := uint64(0)
+		for _, v := range c.getValues(br) {
+			n += uint64(utf8.RuneCountInString(v))
+		}
+		return n
+	case valueTypeDict:
+		n := uint64(0)
+		dictValues := c.dictValues
+		for _, v := range c.getValuesEncoded(br) {
+			idx := v[0]
+			v := dictValues[idx]
+			n += uint64(utf8.RuneCountInString(v))
+		}
+		return n
+	default:
+		// Other value types contain only ASCII chars, so their length in runes equals to their length in bytes.
+		return c.sumLenValues(br)
+	}
+}
+
 func (c *blockResultColumn) sumLenStringValues(br *blockResult) uint64 {
 	n := uint64(0)
 	for _, v := range c.getValues(br) {
@@ -13,20 +13,29 @@ import (
 // chunkedAllocator cannot be used from concurrently running goroutines.
 type chunkedAllocator struct {
 	avgProcessors           []statsAvgProcessor
+	avgWeightedProcessors   []statsAvgWeightedProcessor
 	countProcessors         []statsCountProcessor
 	countEmptyProcessors    []statsCountEmptyProcessor
+	countNonEmptyProcessors []statsCountNonEmptyProcessor
 	countUniqProcessors     []statsCountUniqProcessor
 	countUniqHashProcessors []statsCountUniqHashProcessor
+	deltaProcessors         []statsDeltaProcessor
+	ewmaProcessors          []statsEWMAProcessor
 	histogramProcessors     []statsHistogramProcessor
+	joinProcessors          []statsJoinProcessor
 	maxProcessors           []statsMaxProcessor
+	madProcessors           []statsMADProcessor
 	medianProcessors        []statsMedianProcessor
+	mergeUniqHashProcessors []statsMergeUniqHashProcessor
 	minProcessors           []statsMinProcessor
 	quantileProcessors      []statsQuantileProcessor
 	rateProcessors          []statsRateProcessor
 	rateSumProcessors       []statsRateSumProcessor
+	rateCounterProcessors   []statsRateCounterProcessor
 	rowAnyProcessors        []statsRowAnyProcessor
 	rowMaxProcessors        []statsRowMaxProcessor
 	rowMinProcessors        []statsRowMinProcessor
+	sampleProcessors        []statsSampleProcessor
 	sumProcessors           []statsSumProcessor
 	sumLenProcessors        []statsSumLenProcessor
 	uniqValuesProcessors    []statsUniqValuesProcessor
@@ -40,6 +49,8 @@ type chunkedAllocator struct {
 	statsCountUniqSets     []statsCountUniqSet
 	statsCountUniqHashSets []statsCountUniqHashSet
 
+	countUniqHashRegisters []uint8
+
 	hitsMaps []hitsMap
 
 	u64Buf []uint64
@@ -53,6 +64,10 @@ func (a *chunkedAllocator) newStatsAvgProcessor() (p *statsAvgProcessor) {
 	return addNewItem(&a.avgProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsAvgWeightedProcessor() (p *statsAvgWeightedProcessor) {
+	return addNewItem(&a.avgWeightedProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsCountProcessor() (p *statsCountProcessor) {
 	return addNewItem(&a.countProcessors, a)
 }
@@ -61,6 +76,10 @@ func (a *chunkedAllocator) newStatsCountEmptyProcessor() (p *statsCountEmptyProc
 	return addNewItem(&a.countEmptyProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsCountNonEmptyProcessor() (p *statsCountNonEmptyProcessor) {
+	return addNewItem(&a.countNonEmptyProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsCountUniqProcessor() (p *statsCountUniqProcessor) {
 	return addNewItem(&a.countUniqProcessors, a)
 }
@@ -69,18 +88,38 @@ func (a *chunkedAllocator) newStatsCountUniqHashProcessor() (p *statsCountUniqHa
 	return addNewItem(&a.countUniqHashProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsDeltaProcessor() (p *statsDeltaProcessor) {
+	return addNewItem(&a.deltaProcessors, a)
+}
+
+func (a *chunkedAllocator) newStatsEWMAProcessor() (p *statsEWMAProcessor) {
+	return addNewItem(&a.ewmaProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsHistogramProcessor() (p *statsHistogramProcessor) {
 	return addNewItem(&a.histogramProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsJoinProcessor() (p *statsJoinProcessor) {
+	return addNewItem(&a.joinProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsMaxProcessor() (p *statsMaxProcessor) {
 	return addNewItem(&a.maxProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsMADProcessor() (p *statsMADProcessor) {
+	return addNewItem(&a.madProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsMedianProcessor() (p *statsMedianProcessor) {
 	return addNewItem(&a.medianProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsMergeUniqHashProcessor() (p *statsMergeUniqHashProcessor) {
+	return addNewItem(&a.mergeUniqHashProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsMinProcessor() (p *statsMinProcessor) {
 	return addNewItem(&a.minProcessors, a)
 }
@@ -97,6 +136,10 @@ func (a *chunkedAllocator) newStatsRateSumProcessor() (p *statsRateSumProcessor)
 	return addNewItem(&a.rateSumProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsRateCounterProcessor() (p *statsRateCounterProcessor) {
+	return addNewItem(&a.rateCounterProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsRowAnyProcessor() (p *statsRowAnyProcessor) {
 	return addNewItem(&a.rowAnyProcessors, a)
 }
@@ -109,6 +152,10 @@ func (a *chunkedAllocator) newStatsRowMinProcessor() (p *statsRowMinProcessor) {
 	return addNewItem(&a.rowMinProcessors, a)
 }
 
+func (a *chunkedAllocator) newStatsSampleProcessor() (p *statsSampleProcessor) {
+	return addNewItem(&a.sampleProcessors, a)
+}
+
 func (a *chunkedAllocator) newStatsSumProcessor() (p *statsSumProcessor) {
 	return addNewItem(&a.sumProcessors, a)
 }
@@ -145,6 +192,10 @@ func (a *chunkedAllocator) newStatsCountUniqHashSets(itemsLen uint) []statsCount
 	return addNewItems(&a.statsCountUniqHashSets, itemsLen, a)
 }
 
+func (a *chunkedAllocator) newCountUniqHashRegisters(itemsLen uint) []uint8 {
+	return addNewItems(&a.countUniqHashRegisters, itemsLen, a)
+}
+
 func (a *chunkedAllocator) newHitsMaps(itemsLen uint) []hitsMap {
 	return addNewItems(&a.hitsMaps, itemsLen, a)
 }
@@ -61,6 +61,11 @@ type datadb struct {
 	bigPartMergesTotal  atomic.Uint64
 	bigPartActiveMerges atomic.Int64
 
+	// dataGeneration is updated every time new data is added to datadb.
+	//
+	// It is used for invalidating the cached stats results. See statsResultCache.
+	dataGeneration atomic.Uint64
+
 	// pt is the partition the datadb belongs to
 	pt *partition
 
@@ -679,6 +684,10 @@ func (ddb *datadb) mustAddRows(lr *LogRows) {
 	ddb.inmemoryParts = append(ddb.inmemoryParts, pw)
 	ddb.startInmemoryPartsMergerLocked()
 	ddb.partsLock.Unlock()
+
+	// Update the data generation after the added data becomes visible for search,
+	// so queries started after this point cannot use stats results cached before the data has been added.
+	ddb.dataGeneration.Store(dataGenerationSeq.Add(1))
 }
 
 // DatadbStats contains various stats for datadb.
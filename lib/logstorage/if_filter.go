@@ -18,8 +18,13 @@ func parseIfFilter(lex *lexer) (*ifFilter, error) {
 		return nil, fmt.Errorf("unexpected keyword %q; expecting 'if'", lex.token)
 	}
 	lex.nextToken()
+	return parseIfFilterArgs(lex, "if")
+}
+
+// parseIfFilterArgs parses '(filter)' after the given keyword.
+func parseIfFilterArgs(lex *lexer, keyword string) (*ifFilter, error) {
 	if !lex.isKeyword("(") {
-		return nil, fmt.Errorf("unexpected token %q after 'if'; expecting '('", lex.token)
+		return nil, fmt.Errorf("unexpected token %q after '%s'; expecting '('", lex.token, keyword)
 	}
 	lex.nextToken()
 
@@ -33,10 +38,10 @@ func parseIfFilter(lex *lexer) (*ifFilter, error) {
 
 	f, err := parseFilter(lex)
 	if err != nil {
-		return nil, fmt.Errorf("cannot parse 'if' filter: %w", err)
+		return nil, fmt.Errorf("cannot parse '%s' filter: %w", keyword, err)
 	}
 	if !lex.isKeyword(")") {
-		return nil, fmt.Errorf("unexpected token %q after 'if' filter; expecting ')'", lex.token)
+		return nil, fmt.Errorf("unexpected token %q after '%s' filter; expecting ')'", lex.token, keyword)
 	}
 	lex.nextToken()
 
@@ -452,6 +452,7 @@ func (q *Query) CanReturnLastNResults() bool {
 			*pipeLast,
 			*pipeLimit,
 			*pipeOffset,
+			*pipePivot,
 			*pipeTop,
 			*pipeSort,
 			*pipeStats,
@@ -500,6 +501,7 @@ func (q *Query) AddTimeFilter(start, end int64) {
 	q.visitSubqueries(func(q *Query) {
 		q.addTimeFilterNoSubqueries(ft)
 	})
+	q.initStatsWindows()
 }
 
 func (q *Query) addTimeFilterNoSubqueries(ft *filterTime) {
@@ -563,6 +565,7 @@ func (q *Query) optimizeNoSubqueries() {
 	q.pipes = optimizeSortOffsetPipes(q.pipes)
 	q.pipes = optimizeSortLimitPipes(q.pipes)
 	q.pipes = optimizeUniqLimitPipes(q.pipes)
+	q.pipes = optimizeStatsSortLimitPipes(q.pipes)
 	q.pipes = optimizeFilterPipes(q.pipes)
 
 	// Merge `q | filter ...` into q.
@@ -718,7 +721,7 @@ func (q *Query) GetStatsByFieldsAddGroupingByTime(step int64) ([]string, error)
 	// extract by(...) field names from ps
 	byFields := make([]string, len(ps.byFields))
 	for i, f := range ps.byFields {
-		byFields[i] = f.name
+		byFields[i] = f.resultName()
 	}
 
 	// extract metric fields from stats pipe
@@ -1034,6 +1037,32 @@ func optimizeUniqLimitPipes(pipes []pipe) []pipe {
 	return pipes
 }
 
+func optimizeStatsSortLimitPipes(pipes []pipe) []pipe {
+	// Pass only the top N results from 'stats ... | sort ... limit N' to the sort pipe.
+	for i := 1; i < len(pipes); i++ {
+		var sp *pipeSort
+		switch t := pipes[i].(type) {
+		case *pipeSort:
+			sp = t
+		case *pipeFirst:
+			sp = t.ps
+		case *pipeLast:
+			sp = t.ps
+		default:
+			continue
+		}
+		if sp.limit == 0 {
+			continue
+		}
+		ps, ok := pipes[i-1].(*pipeStats)
+		if !ok {
+			continue
+		}
+		ps.sortPipe = sp
+	}
+	return pipes
+}
+
 func optimizeFilterPipes(pipes []pipe) []pipe {
 	// Merge multiple `| filter ...` pipes into a single `filter ...` pipe
 	i := 1
@@ -1133,10 +1162,34 @@ func ParseQueryAtTimestamp(s string, timestamp int64) (*Query, error) {
 		step := end - start + 1 // 1 is needed in order to include [start ... end] in the step.
 		q.initStatsRateFuncs(step)
 	}
+	q.initStatsWindows()
 
 	return q, nil
 }
 
+// initStatsWindows passes the query time range to 'stats window ...' pipes, so they could detect complete windows.
+func (q *Query) initStatsWindows() {
+	start, end := q.GetFilterTimeRange()
+	for _, p := range q.pipes {
+		if ps, ok := p.(*pipeStats); ok {
+			ps.initWindowTimeRange(start, end)
+		}
+	}
+}
+
+// GetStatsWindowStart returns the start of the first incomplete window for 'stats window ...' pipe in q if the query time range ends at end.
+//
+// The window isn't returned by q, so the next query must start from the returned timestamp in order to return every window exactly once.
+// False is returned if q doesn't contain 'stats window ...' pipes.
+func (q *Query) GetStatsWindowStart(end int64) (int64, bool) {
+	for _, p := range q.pipes {
+		if ps, ok := p.(*pipeStats); ok && ps.isWindow {
+			return ps.truncateWindowTimestamp(end + 1), true
+		}
+	}
+	return 0, false
+}
+
 func (q *Query) initStatsRateFuncs(step int64) {
 	for _, p := range q.pipes {
 		if ps, ok := p.(*pipeStats); ok {
@@ -1145,6 +1198,40 @@ func (q *Query) initStatsRateFuncs(step int64) {
 	}
 }
 
+// SetStatsProgressFunc sets f for periodic reporting of the progress for `stats` pipes in q,
+// including `stats` pipes in subqueries, `union` and `join` pipes.
+//
+// f is called at most once per second per every `stats` pipe while the pipe processes the input rows.
+// Progress isn't reported by default.
+func (q *Query) SetStatsProgressFunc(f StatsProgressFunc) {
+	q.visitSubqueries(func(q *Query) {
+		for _, p := range q.pipes {
+			if ps, ok := p.(*pipeStats); ok {
+				ps.progressFunc = f
+			}
+		}
+	})
+}
+
+// SetStatsMaxStateSizePercent sets the maximum share of the allowed memory in percent, which can be used by every `stats` pipe in q,
+// including `stats` pipes in subqueries, `union` and `join` pipes.
+//
+// By default `stats` pipes may use up to 40% of the allowed memory. The share cannot exceed 80% in order to leave memory for the rest of the process.
+// This function must be called only by trusted callers, since concurrently executed queries with big shares may result in OOM.
+func (q *Query) SetStatsMaxStateSizePercent(percent float64) error {
+	if percent <= 0 || percent > maxStatsMaxStateSizePercent {
+		return fmt.Errorf("the max state size for stats pipes must be in the range (0%%..%d%%]; got %v%%", maxStatsMaxStateSizePercent, percent)
+	}
+	q.visitSubqueries(func(q *Query) {
+		for _, p := range q.pipes {
+			if ps, ok := p.(*pipeStats); ok {
+				ps.maxStateSizePercent = percent
+			}
+		}
+	})
+	return nil
+}
+
 func (q *Query) addByTimeFieldToStatsPipes(step int64) {
 	for _, p := range q.pipes {
 		if ps, ok := p.(*pipeStats); ok {
@@ -127,6 +127,66 @@ func TestParseQuery_OptimizeStreamFilters(t *testing.T) {
 	f(`{foo="bar"} or {baz="x"}`, `{foo="bar"} or {baz="x"}`)
 }
 
+func TestParseQuery_OptimizeStatsSortLimitPipes(t *testing.T) {
+	f := func(s string, sortPipeIdxExpected int) {
+		t.Helper()
+		q, err := ParseQuery(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		ps, ok := q.pipes[0].(*pipeStats)
+		if !ok {
+			t.Fatalf("unexpected first pipe; got %T; want *pipeStats", q.pipes[0])
+		}
+		if sortPipeIdxExpected < 0 {
+			if ps.sortPipe != nil {
+				t.Fatalf("unexpected non-nil sortPipe: [%s]", ps.sortPipe)
+			}
+			return
+		}
+		var sp *pipeSort
+		switch t := q.pipes[sortPipeIdxExpected].(type) {
+		case *pipeSort:
+			sp = t
+		case *pipeFirst:
+			sp = t.ps
+		case *pipeLast:
+			sp = t.ps
+		}
+		if ps.sortPipe != sp {
+			t.Fatalf("unexpected sortPipe; got [%v]; want [%v]", ps.sortPipe, sp)
+		}
+
+		// The query string representation mustn't change
+		qStr := q.String()
+		q, err = ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", qStr, err)
+		}
+		if result := q.String(); result != qStr {
+			t.Fatalf("unexpected string representation; got\n%s\nwant\n%s", result, qStr)
+		}
+	}
+
+	// stats without sort
+	f(`* | stats by (x) count() c`, -1)
+	f(`* | stats by (x) count() c | limit 10`, -1)
+
+	// sort without limit
+	f(`* | stats by (x) count() c | sort by (c desc)`, -1)
+
+	// sort isn't the next pipe after stats
+	f(`* | stats by (x) count() c | filter c:>10 | sort by (c desc) limit 10`, -1)
+
+	// sort with limit
+	f(`* | stats by (x) count() c | sort by (c desc) limit 10`, 1)
+	f(`* | stats by (x) count() c | sort by (c desc) | limit 10`, 1)
+	f(`* | stats by (x) count() c | sort by (c desc) offset 5 limit 10`, 1)
+	f(`* | stats by (x) count() c | sort by (c desc) | offset 5 | limit 10`, 1)
+	f(`* | stats by (x) count() c | first 10 by (c)`, 1)
+	f(`* | stats by (x) count() c | last by (c)`, 1)
+}
+
 func TestParseDayRange(t *testing.T) {
 	f := func(s string, startExpected, endExpected, offsetExpected int64) {
 		t.Helper()
@@ -691,6 +751,25 @@ func TestParseFilterPhrase(t *testing.T) {
 	f(`"abc-de.fg":"foo-bar+baz"`, `abc-de.fg`, `foo-bar+baz`)
 	f(`"abc-de.fg":"foo-bar*baz *"`, `abc-de.fg`, `foo-bar*baz *`)
 	f(`"foo:bar*,( baz"`, ``, `foo:bar*,( baz`)
+
+	// words matching names of stats functions, which aren't reserved
+	f(`countif`, ``, `countif`)
+	f(`p50`, ``, `p50`)
+	f(`p90`, ``, `p90`)
+	f(`p95`, ``, `p95`)
+	f(`p99`, ``, `p99`)
+	f(`p999`, ``, `p999`)
+	f(`sample`, ``, `sample`)
+	f(`count_nonempty`, ``, `count_nonempty`)
+	f(`rate_counter`, ``, `rate_counter`)
+	f(`ewma`, ``, `ewma`)
+	f(`mad`, ``, `mad`)
+	f(`delta`, ``, `delta`)
+	f(`merge_uniq_hash`, ``, `merge_uniq_hash`)
+
+	// words matching names of pipes, which aren't reserved
+	f(`distinct`, ``, `distinct`)
+	f(`pivot`, ``, `pivot`)
 }
 
 func TestParseFilterPrefix(t *testing.T) {
@@ -1272,6 +1351,11 @@ func TestParseQuery_Success(t *testing.T) {
 	f(`* | stats by (x, y) count_empty(a,b,c) z`, `* | stats by (x, y) count_empty(a, b, c) as z`)
 	f(`* | count_empty()`, `* | stats count_empty(*) as "count_empty(*)"`)
 
+	// stats pipe count_nonempty
+	f(`* | stats count_nonempty() x`, `* | stats count_nonempty(*) as x`)
+	f(`* | stats by (x, y) count_nonempty(a,b,c) z`, `* | stats by (x, y) count_nonempty(a, b, c) as z`)
+	f(`* | count_nonempty()`, `* | stats count_nonempty(*) as "count_nonempty(*)"`)
+
 	// stats pipe sum
 	f(`* | stats Sum(foo) bar`, `* | stats sum(foo) as bar`)
 	f(`* | stats BY(x, y, ) SUM(foo,bar,) bar`, `* | stats by (x, y) sum(foo, bar) as bar`)
@@ -1386,6 +1470,10 @@ func TestParseQuery_Success(t *testing.T) {
 
 	// stats pipe with per-func filters
 	f(`* | stats count() if (foo bar) rows`, `* | stats count(*) if (foo bar) as rows`)
+	f(`* | stats countif(status:>=500) errors`, `* | stats count(*) if (status:>=500) as errors`)
+	f(`* | stats P90(duration), p999(x) as y`, `* | stats p90(duration) as "p90(duration)", p999(x) as y`)
+	f(`* | stats count_uniq(explode(tags)), sum(explode( "a:b" )) x`, `* | stats count_uniq(explode(tags)) as "count_uniq(explode(tags))", sum(explode("a:b")) as x`)
+	f(`* | countif(foo), countif()`, `* | stats count(*) if (foo) as "count(*) if (foo)", count(*) if (*) as "count(*) if (*)"`)
 	f(`* | stats by (_time:1d offset -2h, f2)
 	   count() if (is_admin:true or _msg:"foo bar"*) as foo,
 	   sum(duration) if (host:in('foo.com', 'bar.com') and path:/foobar) as bar`,
@@ -1441,6 +1529,17 @@ func TestParseQuery_Success(t *testing.T) {
 	f(`* | uniq (f1,f2) limit 10`, `* | uniq by (f1, f2) limit 10`)
 	f(`* | uniq limit 10`, `* | uniq limit 10`)
 
+	// distinct pipe
+	f(`* | distinct`, `* | uniq`)
+	f(`* | distinct by (f1,f2)`, `* | uniq by (f1, f2)`)
+	f(`* | DISTINCT (f1,f2) limit 10`, `* | uniq by (f1, f2) limit 10`)
+	f(`* | distinct by (f1) with hits`, `* | uniq by (f1) with hits`)
+	f(`distinct | distinct by (x)`, `distinct | uniq by (x)`)
+
+	// pivot pipe
+	f(`* | pivot by (a) on (x) using (y)`, `* | pivot by (a) on (x) using (y)`)
+	f(`pivot error | pivot on (x) using (y)`, `pivot error | pivot on (x) using (y)`)
+
 	// filter pipe
 	f(`* | filter error ip:12.3.4.5 or warn`, `error ip:12.3.4.5 or warn`)
 	f(`foo | stats by (host) count() logs | filter logs:>50 | sort by (logs desc) | limit 10`, `foo | stats by (host) count(*) as logs | filter logs:>50 | sort by (logs desc) limit 10`)
@@ -1867,6 +1966,11 @@ func TestParseQuery_Failure(t *testing.T) {
 	f(`foo | stats count_empty() as`)
 	f(`foo | stats count_empty() as |`)
 
+	// invalid stats count_nonempty
+	f(`foo | stats count_nonempty`)
+	f(`foo | stats count_nonempty() as`)
+	f(`foo | stats count_nonempty() as |`)
+
 	// invalid stats sum
 	f(`foo | stats sum`)
 
@@ -2144,6 +2248,9 @@ func TestQueryGetNeededColumns(t *testing.T) {
 	f(`* | stats count_empty() q`, `*`, ``)
 	f(`* | stats count_empty(*) q`, `*`, ``)
 	f(`* | stats count_empty(x) q`, `x`, ``)
+	f(`* | stats count_nonempty() q`, `*`, ``)
+	f(`* | stats count_nonempty(*) q`, `*`, ``)
+	f(`* | stats count_nonempty(x) q`, `x`, ``)
 	f(`* | stats count() q`, ``, ``)
 	f(`* | stats count(*) q`, ``, ``)
 	f(`* | stats count(x) q`, `x`, ``)
@@ -2513,6 +2620,7 @@ func TestQueryCanLiveTail(t *testing.T) {
 	f("* | replace_regexp ('foo', 'bar')", true)
 	f("* | sort by (a)", false)
 	f("* | stats count() rows", false)
+	f("* | stats window by (_time:1m) count() rows", true)
 	f("* | stream_context after 10", false)
 	f("* | top 10 by (x)", false)
 	f("* | union (foo)", false)
@@ -2525,6 +2633,41 @@ func TestQueryCanLiveTail(t *testing.T) {
 	f("* | hash(a)", true)
 }
 
+func TestQueryGetStatsWindowStart(t *testing.T) {
+	f := func(qStr, end string, resultExpected string) {
+		t.Helper()
+
+		q, err := ParseQuery(qStr)
+		if err != nil {
+			t.Fatalf("cannot parse [%s]: %s", qStr, err)
+		}
+		endTimestamp, ok := TryParseTimestampRFC3339Nano(end)
+		if !ok {
+			t.Fatalf("cannot parse end=%q", end)
+		}
+		windowStart, ok := q.GetStatsWindowStart(endTimestamp)
+		if resultExpected == "" {
+			if ok {
+				t.Fatalf("unexpected window start for [%s]: %d", qStr, windowStart)
+			}
+			return
+		}
+		if !ok {
+			t.Fatalf("missing window start for [%s]", qStr)
+		}
+		result := marshalTimestampRFC3339NanoString(nil, windowStart)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected window start for [%s]; got %s; want %s", qStr, result, resultExpected)
+		}
+	}
+
+	f("* | stats window by (_time:1m) count() rows", "2024-01-01T00:02:30Z", "2024-01-01T00:02:00Z")
+	f("* | stats window by (_time:1m) count() rows", "2024-01-01T00:02:59.999999999Z", "2024-01-01T00:03:00Z")
+	f("* | stats window by (_time:1m offset 30s, x) count() rows", "2024-01-01T00:02:20Z", "2024-01-01T00:01:30Z")
+	f("* | stats by (_time:1m) count() rows", "2024-01-01T00:02:30Z", "")
+	f("*", "2024-01-01T00:02:30Z", "")
+}
+
 func TestQueryDropAllPipes(t *testing.T) {
 	f := func(qStr, resultExpected string) {
 		t.Helper()
@@ -2573,6 +2716,7 @@ func TestQueryGetStatsByFieldsAddGroupingByTime_Success(t *testing.T) {
 	f(`* | by (level) count() x`, nsecsPerDay, []string{"level", "_time"}, `* | stats by (level, _time:86400000000000) count(*) as x`)
 	f(`* | by (_time:1m) count() x`, nsecsPerDay, []string{"_time"}, `* | stats by (_time:86400000000000) count(*) as x`)
 	f(`* | by (_time:1m offset 30s,level) count() x, count_uniq(z) y`, nsecsPerDay, []string{"_time", "level"}, `* | stats by (_time:86400000000000, level) count(*) as x, count_uniq(z) as y`)
+	f(`* | by (_time:1m as t, level as l) count() x`, nsecsPerDay, []string{"_time", "l"}, `* | stats by (_time:86400000000000, level as l) count(*) as x`)
 	f(`* | by (path) rate() rps | last 3 by (rps)`, nsecsPerDay, []string{"path", "_time"}, `* | stats by (path, _time:86400000000000) rate() as rps | last 3 by (rps) partition by (_time)`)
 	f(`* | by (path) rate() rps | first 3 by (rps)`, nsecsPerDay, []string{"path", "_time"}, `* | stats by (path, _time:86400000000000) rate() as rps | first 3 by (rps) partition by (_time)`)
 	f(`* | by (path) rate() rps | sort (rps) limit 3`, nsecsPerDay, []string{"path", "_time"}, `* | stats by (path, _time:86400000000000) rate() as rps | sort by (rps) partition by (_time) limit 3`)
@@ -2633,6 +2777,7 @@ func TestQueryGetStatsByFields_Success(t *testing.T) {
 	f(`* | count()`, []string{})
 	f(`* | by (foo) count(), count_uniq(bar)`, []string{"foo"})
 	f(`* | stats by (a, b, cd) min(foo), max(bar)`, []string{"a", "b", "cd"})
+	f(`* | stats by (a as x, b, _time:1h as hour) min(foo), max(bar)`, []string{"x", "b", "hour"})
 
 	// multiple pipes before stats is ok
 	f(`foo | extract "ip=<ip>," | stats by (host) count_uniq(ip)`, []string{"host"})
@@ -243,6 +243,12 @@ func parsePipe(lex *lexer) (pipe, error) {
 			return nil, fmt.Errorf("cannot parse 'pack_logfmt' pipe: %w", err)
 		}
 		return pp, nil
+	case lex.isKeyword("pivot"):
+		pp, err := parsePipePivot(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'pivot' pipe: %w", err)
+		}
+		return pp, nil
 	case lex.isKeyword("rename", "mv"):
 		pr, err := parsePipeRename(lex)
 		if err != nil {
@@ -291,7 +297,7 @@ func parsePipe(lex *lexer) (pipe, error) {
 			return nil, fmt.Errorf("cannot parse 'union' pipe: %w", err)
 		}
 		return pu, nil
-	case lex.isKeyword("uniq"):
+	case lex.isKeyword("uniq", "distinct"):
 		pu, err := parsePipeUniq(lex)
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse 'uniq' pipe: %w", err)
@@ -342,6 +348,10 @@ func parsePipe(lex *lexer) (pipe, error) {
 	}
 }
 
+// pipeNames contains pipe names, which cannot be used as the first token in query filters.
+//
+// Aliases and names of newly added pipes, which match common words such as `distinct`, mustn't be registered here,
+// since this breaks existing queries starting with these words. Such pipes are still parsed by parsePipe.
 var pipeNames = func() map[string]struct{} {
 	a := []string{
 		"block_stats",
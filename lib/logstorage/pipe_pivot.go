@@ -0,0 +1,472 @@
+package logstorage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+)
+
+// pipePivotDefaultMaxColumns is the default limit on the number of columns, which can be created by pivot pipe.
+const pipePivotDefaultMaxColumns = 1000
+
+// pipePivot processes '| pivot ...' pipe.
+//
+// See https://docs.victoriametrics.com/victorialogs/logsql/#pivot-pipe
+type pipePivot struct {
+	// byFields contains field names for grouping the rows. Every group is converted into a single output row.
+	byFields []string
+
+	// onField contains the field name with values, which are converted into column names.
+	onField string
+
+	// usingField contains the field name with values, which are put into the created columns.
+	usingField string
+
+	// defaultValue is put into the created columns if the group has no value for the given column.
+	defaultValue string
+
+	// maxColumns is the maximum number of columns, which can be created by the pipe.
+	maxColumns uint64
+}
+
+func (pp *pipePivot) String() string {
+	s := "pivot"
+	if len(pp.byFields) > 0 {
+		s += " by (" + fieldNamesString(pp.byFields) + ")"
+	}
+	s += " on (" + quoteTokenIfNeeded(pp.onField) + ") using (" + quoteTokenIfNeeded(pp.usingField) + ")"
+	if pp.defaultValue != "" {
+		s += " default " + quoteTokenIfNeeded(pp.defaultValue)
+	}
+	if pp.maxColumns != pipePivotDefaultMaxColumns {
+		s += fmt.Sprintf(" max_columns %d", pp.maxColumns)
+	}
+	return s
+}
+
+func (pp *pipePivot) canLiveTail() bool {
+	return false
+}
+
+func (pp *pipePivot) updateNeededFields(neededFields, unneededFields fieldsSet) {
+	neededFields.reset()
+	unneededFields.reset()
+
+	neededFields.addFields(pp.byFields)
+	neededFields.add(pp.onField)
+	neededFields.add(pp.usingField)
+}
+
+func (pp *pipePivot) hasFilterInWithQuery() bool {
+	return false
+}
+
+func (pp *pipePivot) initFilterInValues(_ *inValuesCache, _ getFieldValuesFunc) (pipe, error) {
+	return pp, nil
+}
+
+func (pp *pipePivot) visitSubqueries(_ func(q *Query)) {
+	// nothing to do
+}
+
+func (pp *pipePivot) newPipeProcessor(workersCount int, stopCh <-chan struct{}, cancel func(), ppNext pipeProcessor) pipeProcessor {
+	maxStateSize := int64(float64(memory.Allowed()) * 0.2)
+
+	shards := make([]pipePivotProcessorShard, workersCount)
+	for i := range shards {
+		shards[i] = pipePivotProcessorShard{
+			pipePivotProcessorShardNopad: pipePivotProcessorShardNopad{
+				pp:      pp,
+				groups:  make(map[string]*pipePivotGroup),
+				columns: make(map[string]struct{}),
+			},
+		}
+	}
+
+	ppp := &pipePivotProcessor{
+		pp:     pp,
+		stopCh: stopCh,
+		cancel: cancel,
+		ppNext: ppNext,
+
+		shards: shards,
+
+		maxStateSize: maxStateSize,
+	}
+	ppp.stateSizeBudget.Store(maxStateSize)
+
+	return ppp
+}
+
+type pipePivotProcessor struct {
+	pp     *pipePivot
+	stopCh <-chan struct{}
+	cancel func()
+	ppNext pipeProcessor
+
+	shards []pipePivotProcessorShard
+
+	maxStateSize    int64
+	stateSizeBudget atomic.Int64
+}
+
+type pipePivotProcessorShard struct {
+	pipePivotProcessorShardNopad
+
+	// The padding prevents false sharing on widespread platforms with 128 mod (cache line size) = 0 .
+	_ [128 - unsafe.Sizeof(pipePivotProcessorShardNopad{})%128]byte
+}
+
+type pipePivotProcessorShardNopad struct {
+	// pp points to the parent pipePivot.
+	pp *pipePivot
+
+	// groups contains the collected groups keyed by the marshaled values of pp.byFields.
+	groups map[string]*pipePivotGroup
+
+	// columns contains the collected distinct values for pp.onField.
+	columns map[string]struct{}
+
+	// keyBuf is a temporary buffer for building keys for groups.
+	keyBuf []byte
+
+	// columnValues is a temporary buffer for the processed by(...) column values.
+	columnValues [][]string
+
+	// stateSizeBudget is the remaining budget for the whole state size for the shard.
+	// The per-shard budget is provided in chunks from the parent pipePivotProcessor.
+	stateSizeBudget int
+}
+
+// pipePivotGroup contains the collected cells for a single output row.
+type pipePivotGroup struct {
+	// byValues contains values for pipePivot.byFields.
+	byValues []string
+
+	// cells contains pipePivot.usingField values keyed by pipePivot.onField values.
+	cells map[string]string
+}
+
+// writeBlock writes br to shard.
+//
+// It returns false if the number of distinct pp.onField values exceeds pp.maxColumns.
+func (shard *pipePivotProcessorShard) writeBlock(br *blockResult) bool {
+	pp := shard.pp
+
+	columnValues := shard.columnValues[:0]
+	for _, f := range pp.byFields {
+		c := br.getColumnByName(f)
+		columnValues = append(columnValues, c.getValues(br))
+	}
+	shard.columnValues = columnValues
+
+	onValues := br.getColumnByName(pp.onField).getValues(br)
+	usingValues := br.getColumnByName(pp.usingField).getValues(br)
+
+	keyBuf := shard.keyBuf
+	for i := 0; i < br.rowsLen; i++ {
+		column := onValues[i]
+		if column == "" {
+			// Rows without column name cannot be pivoted.
+			continue
+		}
+
+		isClonedColumn := false
+		if _, ok := shard.columns[column]; !ok {
+			column = strings.Clone(column)
+			isClonedColumn = true
+			shard.columns[column] = struct{}{}
+			shard.stateSizeBudget -= len(column) + int(unsafe.Sizeof(column))
+			if uint64(len(shard.columns)) > pp.maxColumns {
+				return false
+			}
+		}
+
+		keyBuf = keyBuf[:0]
+		for _, values := range columnValues {
+			keyBuf = encoding.MarshalBytes(keyBuf, bytesutil.ToUnsafeBytes(values[i]))
+		}
+		g := shard.groups[string(keyBuf)]
+		if g == nil {
+			byValues := make([]string, len(columnValues))
+			for j, values := range columnValues {
+				byValues[j] = strings.Clone(values[i])
+				shard.stateSizeBudget -= len(byValues[j])
+			}
+			g = &pipePivotGroup{
+				byValues: byValues,
+				cells:    make(map[string]string),
+			}
+			key := string(keyBuf)
+			shard.groups[key] = g
+			shard.stateSizeBudget -= len(key) + int(unsafe.Sizeof(*g)) + len(byValues)*int(unsafe.Sizeof(byValues[0]))
+		}
+
+		v := usingValues[i]
+		if vPrev, ok := g.cells[column]; !ok || vPrev != v {
+			if !ok {
+				if !isClonedColumn {
+					column = strings.Clone(column)
+					shard.stateSizeBudget -= len(column)
+				}
+				shard.stateSizeBudget -= int(unsafe.Sizeof(column))
+			}
+			v = strings.Clone(v)
+			g.cells[column] = v
+			shard.stateSizeBudget -= len(v) + int(unsafe.Sizeof(v))
+		}
+	}
+	shard.keyBuf = keyBuf
+
+	return true
+}
+
+func (ppp *pipePivotProcessor) writeBlock(workerID uint, br *blockResult) {
+	if br.rowsLen == 0 {
+		return
+	}
+
+	shard := &ppp.shards[workerID]
+
+	for shard.stateSizeBudget < 0 {
+		// steal some budget for the state size from the global budget.
+		remaining := ppp.stateSizeBudget.Add(-stateSizeBudgetChunk)
+		if remaining < 0 {
+			// The state size is too big. Stop processing data in order to avoid OOM crash.
+			if remaining+stateSizeBudgetChunk >= 0 {
+				// Notify worker goroutines to stop calling writeBlock() in order to save CPU time.
+				ppp.cancel()
+			}
+			return
+		}
+		shard.stateSizeBudget += stateSizeBudgetChunk
+	}
+
+	if !shard.writeBlock(br) {
+		ppp.cancel()
+	}
+}
+
+func (ppp *pipePivotProcessor) flush() error {
+	pp := ppp.pp
+	if n := ppp.stateSizeBudget.Load(); n <= 0 {
+		return fmt.Errorf("cannot calculate [%s], since it requires more than %dMB of memory", pp.String(), ppp.maxStateSize/(1<<20))
+	}
+
+	// Merge the collected groups and columns across shards.
+	groups := ppp.shards[0].groups
+	columnsMap := ppp.shards[0].columns
+	for i := 1; i < len(ppp.shards); i++ {
+		if needStop(ppp.stopCh) {
+			return nil
+		}
+
+		shard := &ppp.shards[i]
+		for column := range shard.columns {
+			columnsMap[column] = struct{}{}
+		}
+		for key, g := range shard.groups {
+			gDst := groups[key]
+			if gDst == nil {
+				groups[key] = g
+				continue
+			}
+			for column, v := range g.cells {
+				gDst.cells[column] = v
+			}
+		}
+		shard.groups = nil
+		shard.columns = nil
+	}
+	if uint64(len(columnsMap)) > pp.maxColumns {
+		return fmt.Errorf("cannot calculate [%s], since it creates more than %d columns from distinct %q values; "+
+			"reduce the number of distinct values via filters or increase the limit via 'max_columns' option", pp.String(), pp.maxColumns, pp.onField)
+	}
+
+	columns := make([]string, 0, len(columnsMap))
+	for column := range columnsMap {
+		if slices.Contains(pp.byFields, column) {
+			return fmt.Errorf("cannot calculate [%s], since the column %q created from %q value clashes with the same by(...) field", pp.String(), column, pp.onField)
+		}
+		columns = append(columns, column)
+	}
+	sortStatsJoinValues(columns)
+
+	// Write the pivoted rows to the next pipe.
+	wctx := &pipePivotWriteContext{
+		ppp: ppp,
+	}
+	rcs := wctx.rcs[:0]
+	for _, f := range pp.byFields {
+		rcs = appendResultColumnWithName(rcs, f)
+	}
+	for _, column := range columns {
+		rcs = appendResultColumnWithName(rcs, column)
+	}
+	wctx.rcs = rcs
+
+	for _, g := range groups {
+		if needStop(ppp.stopCh) {
+			return nil
+		}
+		wctx.writeGroup(g, columns)
+	}
+	wctx.flush()
+
+	return nil
+}
+
+type pipePivotWriteContext struct {
+	ppp *pipePivotProcessor
+	rcs []resultColumn
+	br  blockResult
+
+	// rowsCount is the number of rows in the current block
+	rowsCount int
+
+	// valuesLen is the total length of values in the current block
+	valuesLen int
+}
+
+func (wctx *pipePivotWriteContext) writeGroup(g *pipePivotGroup, columns []string) {
+	rcs := wctx.rcs
+	defaultValue := wctx.ppp.pp.defaultValue
+
+	for i, v := range g.byValues {
+		rcs[i].addValue(v)
+		wctx.valuesLen += len(v)
+	}
+	rcs = rcs[len(g.byValues):]
+	for i, column := range columns {
+		v, ok := g.cells[column]
+		if !ok {
+			v = defaultValue
+		}
+		rcs[i].addValue(v)
+		wctx.valuesLen += len(v)
+	}
+
+	wctx.rowsCount++
+
+	// The 64_000 limit provides the best performance results.
+	if wctx.valuesLen >= 64_000 {
+		wctx.flush()
+	}
+}
+
+func (wctx *pipePivotWriteContext) flush() {
+	if wctx.rowsCount == 0 {
+		return
+	}
+
+	// Flush rcs to ppNext
+	wctx.br.setResultColumns(wctx.rcs, wctx.rowsCount)
+	wctx.valuesLen = 0
+	wctx.rowsCount = 0
+	wctx.ppp.ppNext.writeBlock(0, &wctx.br)
+	wctx.br.reset()
+	for i := range wctx.rcs {
+		wctx.rcs[i].resetValues()
+	}
+}
+
+func parsePipePivot(lex *lexer) (pipe, error) {
+	if !lex.isKeyword("pivot") {
+		return nil, fmt.Errorf("expecting 'pivot'; got %q", lex.token)
+	}
+	lex.nextToken()
+
+	var byFields []string
+	if lex.isKeyword("by") {
+		lex.nextToken()
+		bfs, err := parsePipePivotFields(lex, "by")
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(bfs, "*") {
+			return nil, fmt.Errorf("'*' isn't allowed in 'by(...)'")
+		}
+		byFields = bfs
+	}
+
+	if !lex.isKeyword("on") {
+		return nil, fmt.Errorf("missing 'on' keyword; got %q", lex.token)
+	}
+	lex.nextToken()
+	onField, err := parsePipePivotField(lex, "on")
+	if err != nil {
+		return nil, err
+	}
+
+	if !lex.isKeyword("using") {
+		return nil, fmt.Errorf("missing 'using' keyword; got %q", lex.token)
+	}
+	lex.nextToken()
+	usingField, err := parsePipePivotField(lex, "using")
+	if err != nil {
+		return nil, err
+	}
+
+	pp := &pipePivot{
+		byFields:   byFields,
+		onField:    onField,
+		usingField: usingField,
+		maxColumns: pipePivotDefaultMaxColumns,
+	}
+
+	if lex.isKeyword("default") {
+		lex.nextToken()
+		v, err := getCompoundToken(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'default' value: %w", err)
+		}
+		pp.defaultValue = v
+	}
+
+	if lex.isKeyword("max_columns") {
+		lex.nextToken()
+		n, ok := tryParseUint64(lex.token)
+		if !ok || n == 0 {
+			return nil, fmt.Errorf("cannot parse 'max_columns %s'; it must be a positive integer", lex.token)
+		}
+		lex.nextToken()
+		pp.maxColumns = n
+	}
+
+	return pp, nil
+}
+
+func parsePipePivotField(lex *lexer, keyword string) (string, error) {
+	fields, err := parsePipePivotFields(lex, keyword)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 1 || fields[0] == "*" {
+		return "", fmt.Errorf("'%s(...)' must contain a single field name; got %s", keyword, fieldNamesString(fields))
+	}
+	return fields[0], nil
+}
+
+func parsePipePivotFields(lex *lexer, keyword string) ([]string, error) {
+	if lex.isKeyword("(") {
+		fields, err := parseFieldNamesInParens(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse '%s(...)': %w", keyword, err)
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("missing fields in '%s(...)'", keyword)
+		}
+		return fields, nil
+	}
+	fields, err := parseCommaSeparatedFields(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse '%s ...': %w", keyword, err)
+	}
+	return fields, nil
+}
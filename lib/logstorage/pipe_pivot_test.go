@@ -0,0 +1,234 @@
+package logstorage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePipePivotSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeSuccess(t, pipeStr)
+	}
+
+	f(`pivot on (x) using (y)`)
+	f(`pivot by (a) on (x) using (y)`)
+	f(`pivot by (a, b) on (x) using (y)`)
+	f(`pivot by (a) on (x) using (y) default 0`)
+	f(`pivot by (a) on (x) using (y) default "foo bar"`)
+	f(`pivot by (a) on (x) using (y) max_columns 10`)
+	f(`pivot by (a) on (x) using (y) default 0 max_columns 10`)
+}
+
+func TestParsePipePivotFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParsePipeFailure(t, pipeStr)
+	}
+
+	f(`pivot`)
+	f(`pivot by`)
+	f(`pivot by (a)`)
+	f(`pivot by (*) on (x) using (y)`)
+	f(`pivot by (a) on`)
+	f(`pivot by (a) on (x)`)
+	f(`pivot by (a) on () using (y)`)
+	f(`pivot by (a) on (x, z) using (y)`)
+	f(`pivot by (a) on (*) using (y)`)
+	f(`pivot by (a) on (x) using`)
+	f(`pivot by (a) on (x) using (y, z)`)
+	f(`pivot by (a) on (x) using (y) default`)
+	f(`pivot by (a) on (x) using (y) max_columns`)
+	f(`pivot by (a) on (x) using (y) max_columns foo`)
+	f(`pivot by (a) on (x) using (y) max_columns 0`)
+	f(`pivot by (a) on (x) using (y) foo`)
+}
+
+func TestPipePivot(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// missing cells are filled with empty values by default
+	f("pivot by (host) on (status) using (c)", [][]Field{
+		{
+			{"host", "a"},
+			{"status", "200"},
+			{"c", "10"},
+		},
+		{
+			{"host", "a"},
+			{"status", "500"},
+			{"c", "2"},
+		},
+		{
+			{"host", "b"},
+			{"status", "200"},
+			{"c", "5"},
+		},
+		{
+			{"host", "b"},
+			{"status", "404"},
+			{"c", "1"},
+		},
+	}, [][]Field{
+		{
+			{"host", "a"},
+			{"200", "10"},
+			{"404", ""},
+			{"500", "2"},
+		},
+		{
+			{"host", "b"},
+			{"200", "5"},
+			{"404", "1"},
+			{"500", ""},
+		},
+	})
+
+	// default value for missing cells
+	f("pivot by (host) on (status) using (c) default 0", [][]Field{
+		{
+			{"host", "a"},
+			{"status", "200"},
+			{"c", "10"},
+		},
+		{
+			{"host", "b"},
+			{"status", "404"},
+			{"c", "1"},
+		},
+	}, [][]Field{
+		{
+			{"host", "a"},
+			{"200", "10"},
+			{"404", "0"},
+		},
+		{
+			{"host", "b"},
+			{"200", "0"},
+			{"404", "1"},
+		},
+	})
+
+	// multiple by fields, rows with empty 'on' values are skipped, other fields are dropped
+	f("pivot by (host, path) on (status) using (c)", [][]Field{
+		{
+			{"host", "a"},
+			{"path", "/foo"},
+			{"status", "200"},
+			{"c", "10"},
+			{"x", "y"},
+		},
+		{
+			{"host", "a"},
+			{"path", "/bar"},
+			{"status", "200"},
+			{"c", "3"},
+		},
+		{
+			{"host", "a"},
+			{"path", "/bar"},
+			{"c", "7"},
+		},
+	}, [][]Field{
+		{
+			{"host", "a"},
+			{"path", "/foo"},
+			{"200", "10"},
+		},
+		{
+			{"host", "a"},
+			{"path", "/bar"},
+			{"200", "3"},
+		},
+	})
+
+	// without by(...) fields
+	f("pivot on (status) using (c)", [][]Field{
+		{
+			{"status", "200"},
+			{"c", "10"},
+		},
+		{
+			{"status", "500"},
+			{"c", "2"},
+		},
+	}, [][]Field{
+		{
+			{"200", "10"},
+			{"500", "2"},
+		},
+	})
+
+	// empty input
+	f("pivot by (host) on (status) using (c)", [][]Field{}, [][]Field{})
+}
+
+func TestPipePivotMaxColumnsExceeded(t *testing.T) {
+	f := func(pipeStr string, rows [][]Field, errExpected string) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", pipeStr, err)
+		}
+
+		workersCount := 3
+		stopCh := make(chan struct{})
+		cancel := func() {}
+		ppTest := newTestPipeProcessor()
+		pp := p.newPipeProcessor(workersCount, stopCh, cancel, ppTest)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for _, row := range rows {
+			brw.writeRow(row)
+		}
+		brw.flush()
+		err = pp.flush()
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if !strings.Contains(err.Error(), errExpected) {
+			t.Fatalf("unexpected error; got %q; want it to contain %q", err, errExpected)
+		}
+	}
+
+	var rows [][]Field
+	for _, status := range []string{"200", "404", "500"} {
+		rows = append(rows, []Field{
+			{"host", "a"},
+			{"status", status},
+			{"c", "1"},
+		})
+	}
+	f("pivot by (host) on (status) using (c) max_columns 2", rows, "more than 2 columns")
+
+	// the column created from 'on' value clashes with by(...) field
+	f("pivot by (host) on (status) using (c)", [][]Field{
+		{
+			{"host", "a"},
+			{"status", "host"},
+			{"c", "1"},
+		},
+	}, `column "host"`)
+}
+
+func TestPipePivotUpdateNeededFields(t *testing.T) {
+	f := func(s, neededFields, unneededFields, neededFieldsExpected, unneededFieldsExpected string) {
+		t.Helper()
+		expectPipeNeededFields(t, s, neededFields, unneededFields, neededFieldsExpected, unneededFieldsExpected)
+	}
+
+	// all the needed fields
+	f("pivot by (a) on (x) using (y)", "*", "", "a,x,y", "")
+	f("pivot on (x) using (y)", "*", "", "x,y", "")
+
+	// all the needed fields, unneeded fields intersect with src
+	f("pivot by (a) on (x) using (y)", "*", "a,x,f1", "a,x,y", "")
+
+	// needed fields do not intersect with src
+	f("pivot by (a) on (x) using (y)", "f1,f2", "", "a,x,y", "")
+}
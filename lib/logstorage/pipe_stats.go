@@ -2,9 +2,11 @@ package logstorage
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/cespare/xxhash/v2"
@@ -20,11 +22,47 @@ import (
 //
 // See https://docs.victoriametrics.com/victorialogs/logsql/#stats-pipe
 type pipeStats struct {
+	// emitPartial is set if the stats pipe must return the stats accumulated so far when the query is canceled.
+	//
+	// Such results are marked with the partialResultField field. By default nothing is returned on cancellation.
+	emitPartial bool
+
+	// isWindow is set for 'stats window by (_time:step, ...)'.
+	//
+	// In this mode the stats are returned only for complete tumbling windows [t ... t+step),
+	// which cannot receive new logs anymore. See getWindowTimeRange for details.
+	isWindow bool
+
+	// windowMinTimestamp and windowMaxTimestamp contain the query time range for detecting complete windows if isWindow is set.
+	//
+	// They are set by Query.initStatsWindows.
+	windowMinTimestamp int64
+	windowMaxTimestamp int64
+
 	// byFields contains field names with optional buckets from 'by(...)' clause.
 	byFields []*byStatsField
 
 	// funcs contains stats functions to execute.
 	funcs []pipeStatsFunc
+
+	// sortPipe is an optional 'sort ... limit N' pipe, which immediately follows the stats pipe.
+	//
+	// If it is set, then only the top N stats results according to sortPipe are passed to the next pipe.
+	// This reduces memory usage at the sortPipe when calculating stats over big number of groups.
+	// sortPipe isn't removed from the query, so it still returns properly sorted results.
+	//
+	// It is set by optimizeStatsSortLimitPipes.
+	sortPipe *pipeSort
+
+	// progressFunc is an optional func for reporting the progress of the stats calculations.
+	//
+	// It is set by Query.SetStatsProgressFunc.
+	progressFunc StatsProgressFunc
+
+	// maxStateSizePercent is the maximum share of memory.Allowed() in percent, which can be used by the stats pipe state.
+	//
+	// defaultStatsMaxStateSizePercent is used if it is zero. It is set by Query.SetStatsMaxStateSizePercent.
+	maxStateSizePercent float64
 }
 
 type pipeStatsFunc struct {
@@ -34,6 +72,33 @@ type pipeStatsFunc struct {
 	// iff is an additional filter, which is applied to results before executing f on them
 	iff *ifFilter
 
+	// explodeField is set if f is called with explode(field) arg.
+	//
+	// In this case f is applied to elements of JSON arrays stored in the given field.
+	explodeField string
+
+	// withExcluded is set for 'f if (...) with_excluded'.
+	//
+	// In this case the number of rows excluded by iff is returned in the resultName+"_excluded" field.
+	// It is calculated by the next func in pipeStats.funcs with isExcludedCounter set.
+	withExcluded bool
+
+	// isExcludedCounter is set for the func, which counts the rows excluded by iff at the previous func with withExcluded set.
+	//
+	// Such a func is added by the parser, so it is skipped in pipeStats.String().
+	isExcludedCounter bool
+
+	// withCount is set for 'f with_count'.
+	//
+	// In this case the number of values, which contributed to the result of f, is returned in the resultName+"_count" field.
+	// It is calculated by the next func in pipeStats.funcs with isValuesCounter set.
+	withCount bool
+
+	// isValuesCounter is set for the func, which counts the values contributed to the result of the previous func with withCount set.
+	//
+	// Such a func is added by the parser, so it is skipped in pipeStats.String().
+	isValuesCounter bool
+
 	// resultName is the name of the output generated by f
 	resultName string
 }
@@ -51,6 +116,12 @@ type statsFunc interface {
 	newStatsProcessor(a *chunkedAllocator) statsProcessor
 }
 
+// statsFuncWithCount is an optional interface for statsFunc, which supports 'with_count' suffix.
+type statsFuncWithCount interface {
+	// newValuesCounter must return statsFunc, which returns the number of values contributed to the result of the given statsFunc.
+	newValuesCounter() statsFunc
+}
+
 // statsProcessor must process stats for some statsFunc.
 //
 // All the statsProcessor methods are called from a single goroutine at a time,
@@ -71,6 +142,14 @@ type statsProcessor interface {
 	// It must return the change of internal state size in bytes for the statsProcessor.
 	updateStatsForRow(sf statsFunc, br *blockResult, rowIndex int) int
 
+	// updateStatsForRows must update statsProcessor stats for the rows at rowIndexes in br.
+	//
+	// It must return the change of internal state size in bytes for the statsProcessor.
+	//
+	// rowIndexes are sorted in ascending order. Use updateStatsForRowsDefault if there is no more efficient way
+	// to process the given rows than calling updateStatsForRow for every row.
+	updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int
+
 	// mergeState must merge sfp state into statsProcessor state.
 	//
 	// a must be used for allocating memory inside mergeState.
@@ -82,8 +161,34 @@ type statsProcessor interface {
 	finalizeStats(sf statsFunc, dst []byte, stopCh <-chan struct{}) []byte
 }
 
+// updateStatsForRowsDefault updates sfp stats for the rows at rowIndexes in br by calling sfp.updateStatsForRow for every row.
+//
+// It is the default implementation of statsProcessor.updateStatsForRows.
+func updateStatsForRowsDefault(sfp statsProcessor, sf statsFunc, br *blockResult, rowIndexes []int) int {
+	n := 0
+	for _, rowIdx := range rowIndexes {
+		n += sfp.updateStatsForRow(sf, br, rowIdx)
+	}
+	return n
+}
+
+// statsRowsRangeProcessor is an optional interface, which can be implemented by statsProcessor
+// for efficient processing of consecutive rows belonging to the same group.
+type statsRowsRangeProcessor interface {
+	// updateStatsForRowsRange must update statsProcessor stats for rowsCount rows starting from startIdx in br.
+	//
+	// It must return the change of internal state size in bytes for the statsProcessor.
+	updateStatsForRowsRange(sf statsFunc, br *blockResult, startIdx, rowsCount int) int
+}
+
 func (ps *pipeStats) String() string {
 	s := "stats "
+	if ps.emitPartial {
+		s += "partial "
+	}
+	if ps.isWindow {
+		s += "window "
+	}
 	if len(ps.byFields) > 0 {
 		a := make([]string, len(ps.byFields))
 		for i := range ps.byFields {
@@ -95,21 +200,84 @@ func (ps *pipeStats) String() string {
 	if len(ps.funcs) == 0 {
 		logger.Panicf("BUG: pipeStats must contain at least a single statsFunc")
 	}
-	a := make([]string, len(ps.funcs))
-	for i, f := range ps.funcs {
-		line := f.f.String()
+	a := make([]string, 0, len(ps.funcs))
+	for _, f := range ps.funcs {
+		if f.isExcludedCounter || f.isValuesCounter {
+			continue
+		}
+		line := f.funcString()
 		if f.iff != nil {
 			line += " " + f.iff.String()
 		}
+		if f.withExcluded {
+			line += " with_excluded"
+		}
+		if f.withCount {
+			line += " with_count"
+		}
 		line += " as " + quoteTokenIfNeeded(f.resultName)
-		a[i] = line
+		a = append(a, line)
 	}
 	s += strings.Join(a, ", ")
 	return s
 }
 
 func (ps *pipeStats) canLiveTail() bool {
-	return false
+	// Only 'stats window ...' can be used in live tailing, since it returns every window exactly once
+	// if the next query starts from the window returned by Query.GetStatsWindowStart.
+	return ps.isWindow
+}
+
+// getWindowByField returns 'by (_time:step)' field for 'stats window ...'.
+func (ps *pipeStats) getWindowByField() *byStatsField {
+	for _, bf := range ps.byFields {
+		if bf.name == "_time" {
+			return bf
+		}
+	}
+	return nil
+}
+
+// truncateWindowTimestamp returns the start of the window containing the given ts for 'stats window ...'.
+func (ps *pipeStats) truncateWindowTimestamp(ts int64) int64 {
+	bf := ps.getWindowByField()
+	return truncateTimestamp(ts, int64(bf.bucketSize), int64(bf.bucketOffset), bf.bucketSizeStr)
+}
+
+// getWindowTimeRange returns [minTimestamp ... maxTimestamp) time range for the rows, which belong to complete windows for 'stats window ...'.
+//
+// The window [t ... t+step) is complete if it is fully covered by the query time range [windowMinTimestamp ... windowMaxTimestamp].
+// The windows, which start before windowMinTimestamp, miss the logs outside the query time range, so they are dropped.
+//
+// The windowMaxTimestamp is the watermark: all the logs with timestamps up to the watermark are expected to be already ingested,
+// so the windows ending at or before it cannot receive new logs. The window containing the watermark may still receive new logs,
+// so it is dropped together with the rest of windows after it. The dropped window is returned by the next query
+// with the time range starting at the returned maxTimestamp - see Query.GetStatsWindowStart.
+// The allowed lateness for the ingested logs is controlled by the lag between the watermark and the current time.
+func (ps *pipeStats) getWindowTimeRange() (int64, int64) {
+	minTimestamp := ps.windowMinTimestamp
+	if minTimestamp != math.MinInt64 {
+		ts := ps.truncateWindowTimestamp(minTimestamp)
+		if ts < minTimestamp {
+			bf := ps.getWindowByField()
+			ts = ps.truncateWindowTimestamp(ts + int64(bf.bucketSize))
+		}
+		minTimestamp = ts
+	}
+
+	maxTimestamp := ps.windowMaxTimestamp
+	if maxTimestamp != math.MaxInt64 {
+		maxTimestamp = ps.truncateWindowTimestamp(maxTimestamp + 1)
+	}
+	return minTimestamp, maxTimestamp
+}
+
+func (ps *pipeStats) initWindowTimeRange(start, end int64) {
+	if !ps.isWindow {
+		return
+	}
+	ps.windowMinTimestamp = start
+	ps.windowMaxTimestamp = end
 }
 
 func (ps *pipeStats) updateNeededFields(neededFields, unneededFields fieldsSet) {
@@ -130,9 +298,86 @@ func (ps *pipeStats) updateNeededFields(neededFields, unneededFields fieldsSet)
 		}
 	}
 
+	// Bucket fields are generated from byFields, so they mustn't be fetched from the input logs.
+	for _, bf := range ps.byFields {
+		if bf.hasBucketConfig() {
+			neededFields.remove(bucketFieldPrefix + bf.name)
+			neededFields.remove(bucketEndFieldPrefix + bf.name)
+		}
+	}
+
 	unneededFields.reset()
 }
 
+const (
+	// bucketFieldPrefix is the prefix for the synthetic field with the lower bound of the bucket for 'by (field:bucket)'.
+	//
+	// Such a field can be referenced by stats functions and by per-function filters in the form '_bucket.field'.
+	bucketFieldPrefix = "_bucket."
+
+	// bucketEndFieldPrefix is the prefix for the synthetic field with the upper bound of the bucket for 'by (field:bucket)'.
+	//
+	// The upper bound isn't included in the bucket. It is empty if it cannot be calculated for the given bucket.
+	bucketEndFieldPrefix = "_bucket_end."
+)
+
+// pipeStatsBucketField is the synthetic field with the lower or upper bound of the bucket for 'by (field:bucket)' at pipeStats.
+type pipeStatsBucketField struct {
+	// name is the name of the synthetic field
+	name string
+
+	// byFieldIdx is the index of the corresponding field at pipeStats.byFields
+	byFieldIdx int
+
+	// isEnd is set if the field contains the upper bound of the bucket
+	isEnd bool
+}
+
+// getBucketFields returns synthetic bucket fields referenced by stats functions and per-function filters at ps.
+func (ps *pipeStats) getBucketFields() []pipeStatsBucketField {
+	// Collect the explicitly referenced fields per every func, since fieldsSet drops all the fields after adding '*'.
+	refs := make(map[string]struct{})
+	fs := newFieldsSet()
+	for _, f := range ps.funcs {
+		fs.reset()
+		f.f.updateNeededFields(fs)
+		for name := range fs {
+			refs[name] = struct{}{}
+		}
+		if f.iff != nil {
+			for _, name := range f.iff.neededFields {
+				refs[name] = struct{}{}
+			}
+		}
+	}
+
+	var bucketFields []pipeStatsBucketField
+	for i, bf := range ps.byFields {
+		if !bf.hasBucketConfig() {
+			continue
+		}
+		if name := bucketFieldPrefix + bf.name; hasField(refs, name) {
+			bucketFields = append(bucketFields, pipeStatsBucketField{
+				name:       name,
+				byFieldIdx: i,
+			})
+		}
+		if name := bucketEndFieldPrefix + bf.name; hasField(refs, name) {
+			bucketFields = append(bucketFields, pipeStatsBucketField{
+				name:       name,
+				byFieldIdx: i,
+				isEnd:      true,
+			})
+		}
+	}
+	return bucketFields
+}
+
+func hasField(m map[string]struct{}, name string) bool {
+	_, ok := m[name]
+	return ok
+}
+
 func (ps *pipeStats) hasFilterInWithQuery() bool {
 	for _, f := range ps.funcs {
 		if f.iff.hasFilterInWithQuery() {
@@ -146,6 +391,13 @@ func (ps *pipeStats) initFilterInValues(cache *inValuesCache, getFieldValuesFunc
 	funcsNew := make([]pipeStatsFunc, len(ps.funcs))
 	for i := range ps.funcs {
 		f := &ps.funcs[i]
+		if f.isExcludedCounter || f.isValuesCounter {
+			// Share the filter with the previous func, since it is the same filter.
+			fNew := *f
+			fNew.iff = funcsNew[i-1].iff
+			funcsNew[i] = fNew
+			continue
+		}
 		iffNew, err := f.iff.initFilterInValues(cache, getFieldValuesFunc)
 		if err != nil {
 			return nil, err
@@ -161,6 +413,10 @@ func (ps *pipeStats) initFilterInValues(cache *inValuesCache, getFieldValuesFunc
 
 func (ps *pipeStats) visitSubqueries(visitFunc func(q *Query)) {
 	for _, f := range ps.funcs {
+		if f.isExcludedCounter || f.isValuesCounter {
+			// The filter is shared with the previous func, so it has been already visited.
+			continue
+		}
 		f.iff.visitSubqueries(visitFunc)
 	}
 }
@@ -176,6 +432,7 @@ func (ps *pipeStats) addByTimeField(step int64) {
 	hasByTime := false
 	for _, f := range ps.byFields {
 		if f.name == "_time" {
+			// The alias is dropped, since the callers expect the _time field with the step-aligned timestamps in the output.
 			f = &byStatsField{
 				name:          "_time",
 				bucketSizeStr: stepStr,
@@ -207,29 +464,63 @@ func (ps *pipeStats) initRateFuncs(step int64) {
 			t.stepSeconds = stepSeconds
 		case *statsRateSum:
 			t.stepSeconds = stepSeconds
+		case *statsRateCounter:
+			t.stepSeconds = stepSeconds
 		}
 	}
 }
 
 const stateSizeBudgetChunk = 1 << 20
 
+const (
+	// defaultStatsMaxStateSizePercent is the default share of memory.Allowed() in percent, which can be used by the stats pipe state.
+	defaultStatsMaxStateSizePercent = 40
+
+	// maxStatsMaxStateSizePercent is the upper limit for the share of memory.Allowed() in percent,
+	// which can be set via Query.SetStatsMaxStateSizePercent.
+	//
+	// The remaining memory is left for other query pipes and for the rest of the process in order to avoid OOM.
+	maxStatsMaxStateSizePercent = 80
+)
+
+// getMaxStateSize returns the maximum state size in bytes for ps.
+func (ps *pipeStats) getMaxStateSize() int64 {
+	percent := ps.maxStateSizePercent
+	if percent <= 0 {
+		percent = defaultStatsMaxStateSizePercent
+	}
+	percent = min(percent, maxStatsMaxStateSizePercent)
+	return int64(float64(memory.Allowed()) * percent / 100)
+}
+
 func (ps *pipeStats) newPipeProcessor(workersCount int, stopCh <-chan struct{}, cancel func(), ppNext pipeProcessor) pipeProcessor {
-	maxStateSize := int64(float64(memory.Allowed()) * 0.4)
+	if ps.hasPercentBuckets() {
+		return newPipeStatsPercentProcessor(ps, workersCount, stopCh, cancel, ppNext)
+	}
+
+	maxStateSize := ps.getMaxStateSize()
 
 	psp := &pipeStatsProcessor{
-		ps:     ps,
+		pipeStatsProcessorConfig: pipeStatsProcessorConfig{
+			ps:          ps,
+			shardsCount: uint(workersCount),
+		},
 		stopCh: stopCh,
 		cancel: cancel,
 		ppNext: ppNext,
 
 		maxStateSize: maxStateSize,
 	}
+	if ps.isWindow {
+		psp.windowMinTimestamp, psp.windowMaxTimestamp = ps.getWindowTimeRange()
+	}
+	psp.bucketFields = ps.getBucketFields()
 
 	shards := make([]pipeStatsProcessorShard, workersCount)
 	for i := range shards {
 		shards[i] = pipeStatsProcessorShard{
 			pipeStatsProcessorShardNopad: pipeStatsProcessorShardNopad{
-				psp: psp,
+				cfg: &psp.pipeStatsProcessorConfig,
 			},
 		}
 		shards[i].init()
@@ -242,7 +533,8 @@ func (ps *pipeStats) newPipeProcessor(workersCount int, stopCh <-chan struct{},
 }
 
 type pipeStatsProcessor struct {
-	ps     *pipeStats
+	pipeStatsProcessorConfig
+
 	stopCh <-chan struct{}
 	cancel func()
 	ppNext pipeProcessor
@@ -251,6 +543,28 @@ type pipeStatsProcessor struct {
 
 	maxStateSize    int64
 	stateSizeBudget atomic.Int64
+
+	// progressLastReportTime is the last time in seconds when ps.progressFunc was called.
+	progressLastReportTime atomic.Uint64
+}
+
+// pipeStatsProcessorConfig contains read-only settings for pipeStatsProcessor, which are shared with its shards.
+//
+// It mustn't refer to pipeStatsProcessorShard, since the padding for pipeStatsProcessorShard cannot be calculated for recursive types.
+type pipeStatsProcessorConfig struct {
+	ps *pipeStats
+
+	// shardsCount is the number of pipeStatsProcessor shards.
+	shardsCount uint
+
+	// windowMinTimestamp and windowMaxTimestamp contain the time range for the rows, which belong to complete windows.
+	//
+	// They are set only for 'stats window ...'. See pipeStats.getWindowTimeRange.
+	windowMinTimestamp int64
+	windowMaxTimestamp int64
+
+	// bucketFields contains synthetic bucket fields referenced by stats functions. See pipeStats.getBucketFields.
+	bucketFields []pipeStatsBucketField
 }
 
 type pipeStatsProcessorShard struct {
@@ -261,7 +575,8 @@ type pipeStatsProcessorShard struct {
 }
 
 type pipeStatsProcessorShardNopad struct {
-	psp *pipeStatsProcessor
+	// cfg points to the settings of the parent pipeStatsProcessor.
+	cfg *pipeStatsProcessorConfig
 
 	// groupMap is used for tracking small number of groups until it reaches pipeStatsGroupMapMaxLen.
 	// After that the groups are tracked by groupMapShards.
@@ -279,10 +594,43 @@ type pipeStatsProcessorShardNopad struct {
 	bms   []bitmap
 	brTmp blockResult
 
+	// exploder is used for stats funcs with explode(field) arg.
+	exploder statsExploder
+
+	// bmWindow and brWindow are used for selecting rows belonging to complete windows for 'stats window ...'.
+	bmWindow bitmap
+	brWindow blockResult
+
+	// bucketColumns and bucketBuf are used for generating synthetic bucket fields. See pipeStatsProcessor.bucketFields.
+	bucketColumns []resultColumn
+	bucketBuf     []byte
+
 	columnValues [][]string
 	keyBuf       []byte
 
+	// lastGroupKey and lastGroup contain the most recently used group for 'by (...)' with multiple fields.
+	//
+	// They are used for avoiding group lookups for rows with the same key across consecutive blocks.
+	// This is safe, since groups aren't moved in memory until flush().
+	lastGroupKey []byte
+	lastGroup    *pipeStatsGroup
+
+	// groupRows and groupRowsIdxs are used for collecting row indexes per every group
+	// when grouping by multiple columns with different values across rows.
+	//
+	// groupRowsIdxs maps a group to its index in groupRows.
+	groupRows     []pipeStatsGroupRows
+	groupRowsIdxs map[*pipeStatsGroup]int
+
+	// rowIndexesFiltered is used for applying per-func filters to row indexes.
+	rowIndexesFiltered []int
+
 	stateSizeBudget int
+
+	// groupsCount is the number of groups tracked by the shard. It is updated only if ps.progressFunc is set.
+	//
+	// It is read by other goroutines when reporting the progress.
+	groupsCount atomic.Uint64
 }
 
 // the maximum number of groups to track in pipeStatsProcessorShard.groupMap before switching to pipeStatsProcessorShard.groupMapShards
@@ -292,7 +640,11 @@ type pipeStatsProcessorShardNopad struct {
 const pipeStatsGroupMapMaxLen = 4 << 10
 
 type pipeStatsGroupMap struct {
-	shard *pipeStatsProcessorShard
+	// shard is the owner of the map.
+	//
+	// It points to pipeStatsProcessorShardNopad instead of pipeStatsProcessorShard,
+	// since the padding size for pipeStatsProcessorShard cannot be calculated for recursive types.
+	shard *pipeStatsProcessorShardNopad
 
 	u64        map[uint64]*pipeStatsGroup
 	negative64 map[uint64]*pipeStatsGroup
@@ -303,7 +655,7 @@ func (psm *pipeStatsGroupMap) reset() {
 	*psm = pipeStatsGroupMap{}
 }
 
-func (psm *pipeStatsGroupMap) init(shard *pipeStatsProcessorShard) {
+func (psm *pipeStatsGroupMap) init(shard *pipeStatsProcessorShardNopad) {
 	psm.shard = shard
 }
 
@@ -424,26 +776,26 @@ func initStatsConcurrency(sfp statsProcessor, concurrency uint) {
 }
 
 func (shard *pipeStatsProcessorShard) init() {
-	shard.groupMap.init(shard)
+	shard.groupMap.init(&shard.pipeStatsProcessorShardNopad)
 
-	funcsLen := len(shard.psp.ps.funcs)
+	funcsLen := len(shard.cfg.ps.funcs)
 	shard.bms = make([]bitmap, funcsLen)
 }
 
-func (shard *pipeStatsProcessorShard) newPipeStatsGroup() *pipeStatsGroup {
+func (shard *pipeStatsProcessorShardNopad) newPipeStatsGroup() *pipeStatsGroup {
 	bytesAllocated := shard.a.bytesAllocated
 
-	funcsLen := len(shard.psp.ps.funcs)
+	funcsLen := len(shard.cfg.ps.funcs)
 	sfps := shard.a.newStatsProcessors(uint(funcsLen))
 
-	for i, f := range shard.psp.ps.funcs {
+	for i, f := range shard.cfg.ps.funcs {
 		sfp := f.f.newStatsProcessor(&shard.a)
-		initStatsConcurrency(sfp, uint(len(shard.psp.shards)))
+		initStatsConcurrency(sfp, shard.cfg.shardsCount)
 		sfps[i] = sfp
 	}
 
 	psg := shard.a.newPipeStatsGroup()
-	psg.funcs = shard.psp.ps.funcs
+	psg.funcs = shard.cfg.ps.funcs
 	psg.sfps = sfps
 
 	shard.stateSizeBudget -= shard.a.bytesAllocated - bytesAllocated
@@ -452,7 +804,13 @@ func (shard *pipeStatsProcessorShard) newPipeStatsGroup() *pipeStatsGroup {
 }
 
 func (shard *pipeStatsProcessorShard) writeBlock(br *blockResult) {
-	byFields := shard.psp.ps.byFields
+	byFields := shard.cfg.ps.byFields
+
+	// Add synthetic bucket fields before applying per-function filters, since they may be referenced by these filters.
+	if len(shard.cfg.bucketFields) > 0 {
+		shard.addBucketColumns(br)
+		defer shard.resetBucketColumns()
+	}
 
 	// Update shard.bms by applying per-function filters
 	shard.applyPerFunctionFilters(br)
@@ -461,7 +819,7 @@ func (shard *pipeStatsProcessorShard) writeBlock(br *blockResult) {
 	if len(byFields) == 0 {
 		// Fast path - pass all the rows to a single group with empty key.
 		psg := shard.getPipeStatsGroupString(nil)
-		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp)
+		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp, &shard.exploder)
 		return
 	}
 	if len(byFields) == 1 {
@@ -496,14 +854,23 @@ func (shard *pipeStatsProcessorShard) writeBlock(br *blockResult) {
 		for _, values := range columnValues {
 			keyBuf = encoding.MarshalBytes(keyBuf, bytesutil.ToUnsafeBytes(values[0]))
 		}
-		psg := shard.getPipeStatsGroupString(keyBuf)
-		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp)
+		psg := shard.getPipeStatsGroupStringCached(keyBuf)
+		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp, &shard.exploder)
 		shard.keyBuf = keyBuf
 		return
 	}
 
 	// The slowest path - group by multiple columns with different values across rows.
-	var psg *pipeStatsGroup
+	//
+	// Collect row indexes per every group at first and then update the stats for every group in bulk,
+	// since this is faster than updating the stats row by row if rows for distinct groups are interleaved.
+	if shard.groupRowsIdxs == nil {
+		shard.groupRowsIdxs = make(map[*pipeStatsGroup]int)
+	}
+	groupRowsIdxs := shard.groupRowsIdxs
+	groupRows := shard.groupRows[:0]
+
+	var rowIndexes *[]int
 	keyBuf := shard.keyBuf[:0]
 	for i := 0; i < br.rowsLen; i++ {
 		// Verify whether the key for 'by (...)' fields equals the previous key
@@ -520,11 +887,72 @@ func (shard *pipeStatsProcessorShard) writeBlock(br *blockResult) {
 			for _, values := range columnValues {
 				keyBuf = encoding.MarshalBytes(keyBuf, bytesutil.ToUnsafeBytes(values[i]))
 			}
-			psg = shard.getPipeStatsGroupString(keyBuf)
+			psg := shard.getPipeStatsGroupStringCached(keyBuf)
+
+			idx, ok := groupRowsIdxs[psg]
+			if !ok {
+				idx = len(groupRows)
+				groupRowsIdxs[psg] = idx
+				groupRows = slicesutil.SetLength(groupRows, idx+1)
+				gr := &groupRows[idx]
+				gr.psg = psg
+				gr.rowIndexes = gr.rowIndexes[:0]
+			}
+			rowIndexes = &groupRows[idx].rowIndexes
 		}
-		shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+		*rowIndexes = append(*rowIndexes, i)
 	}
 	shard.keyBuf = keyBuf
+
+	for i := range groupRows {
+		gr := &groupRows[i]
+		shard.updateGroupStatsForRows(gr.psg, br, gr.rowIndexes)
+		gr.psg = nil
+	}
+	shard.groupRows = groupRows
+	clear(groupRowsIdxs)
+}
+
+// pipeStatsGroupRows contains row indexes for the given group in the currently processed block.
+type pipeStatsGroupRows struct {
+	psg        *pipeStatsGroup
+	rowIndexes []int
+}
+
+// updateGroupStatsForRows updates psg stats for the rows at rowIndexes in br.
+func (shard *pipeStatsProcessorShard) updateGroupStatsForRows(psg *pipeStatsGroup, br *blockResult, rowIndexes []int) {
+	if len(rowIndexes) == 1 {
+		// Fast path - a single row.
+		shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, rowIndexes[0], &shard.exploder)
+		return
+	}
+
+	for i, sfp := range psg.sfps {
+		f := &psg.funcs[i]
+		if f.explodeField != "" {
+			for _, rowIdx := range rowIndexes {
+				shard.stateSizeBudget -= psg.updateFuncStatsForRow(i, shard.bms, br, rowIdx, &shard.exploder)
+			}
+			continue
+		}
+
+		funcRowIndexes := rowIndexes
+		if f.iff != nil {
+			// Leave only the rows matching the per-function filter.
+			bm := &shard.bms[i]
+			funcRowIndexes = shard.rowIndexesFiltered[:0]
+			for _, rowIdx := range rowIndexes {
+				if bm.isSetBit(rowIdx) {
+					funcRowIndexes = append(funcRowIndexes, rowIdx)
+				}
+			}
+			shard.rowIndexesFiltered = funcRowIndexes
+			if len(funcRowIndexes) == 0 {
+				continue
+			}
+		}
+		shard.stateSizeBudget -= sfp.updateStatsForRows(f.f, br, funcRowIndexes)
+	}
 }
 
 func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, bf *byStatsField) {
@@ -536,7 +964,7 @@ func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, b
 			v = br.getBucketedValue(c.valuesEncoded[0], bf)
 		}
 		psg := shard.getPipeStatsGroupGeneric(v)
-		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp)
+		shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp, &shard.exploder)
 		return
 	}
 
@@ -545,7 +973,7 @@ func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, b
 		if areConstValues(values) {
 			// Fast path - values are constant after bucketing.
 			psg := shard.getPipeStatsGroupGeneric(values[0])
-			shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp)
+			shard.stateSizeBudget -= psg.updateStatsForAllRows(shard.bms, br, &shard.brTmp, &shard.exploder)
 			return
 		}
 
@@ -554,54 +982,54 @@ func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, b
 			if i <= 0 || values[i-1] != values[i] {
 				psg = shard.getPipeStatsGroupGeneric(values[i])
 			}
-			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i, &shard.exploder)
 		}
 		return
 	}
 
 	switch c.valueType {
 	case valueTypeUint8:
-		var psg *pipeStatsGroup
 		values := c.getValuesEncoded(br)
-		for i, v := range values {
-			if i <= 0 || values[i-1] != v {
-				n := unmarshalUint8(v)
-				psg = shard.getPipeStatsGroupUint64(uint64(n))
-			}
-			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+		for startIdx := 0; startIdx < len(values); {
+			v := values[startIdx]
+			rowsCount := getIdenticalValuesRunLen(values, startIdx)
+			n := unmarshalUint8(v)
+			psg := shard.getPipeStatsGroupUint64(uint64(n))
+			shard.stateSizeBudget -= psg.updateStatsForRowsRange(shard.bms, br, startIdx, rowsCount, &shard.exploder)
+			startIdx += rowsCount
 		}
 		return
 	case valueTypeUint16:
-		var psg *pipeStatsGroup
 		values := c.getValuesEncoded(br)
-		for i, v := range values {
-			if i <= 0 || values[i-1] != v {
-				n := unmarshalUint16(v)
-				psg = shard.getPipeStatsGroupUint64(uint64(n))
-			}
-			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+		for startIdx := 0; startIdx < len(values); {
+			v := values[startIdx]
+			rowsCount := getIdenticalValuesRunLen(values, startIdx)
+			n := unmarshalUint16(v)
+			psg := shard.getPipeStatsGroupUint64(uint64(n))
+			shard.stateSizeBudget -= psg.updateStatsForRowsRange(shard.bms, br, startIdx, rowsCount, &shard.exploder)
+			startIdx += rowsCount
 		}
 		return
 	case valueTypeUint32:
-		var psg *pipeStatsGroup
 		values := c.getValuesEncoded(br)
-		for i, v := range values {
-			if i <= 0 || values[i-1] != v {
-				n := unmarshalUint32(v)
-				psg = shard.getPipeStatsGroupUint64(uint64(n))
-			}
-			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+		for startIdx := 0; startIdx < len(values); {
+			v := values[startIdx]
+			rowsCount := getIdenticalValuesRunLen(values, startIdx)
+			n := unmarshalUint32(v)
+			psg := shard.getPipeStatsGroupUint64(uint64(n))
+			shard.stateSizeBudget -= psg.updateStatsForRowsRange(shard.bms, br, startIdx, rowsCount, &shard.exploder)
+			startIdx += rowsCount
 		}
 		return
 	case valueTypeUint64:
-		var psg *pipeStatsGroup
 		values := c.getValuesEncoded(br)
-		for i, v := range values {
-			if i <= 0 || values[i-1] != v {
-				n := unmarshalUint64(v)
-				psg = shard.getPipeStatsGroupUint64(n)
-			}
-			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+		for startIdx := 0; startIdx < len(values); {
+			v := values[startIdx]
+			rowsCount := getIdenticalValuesRunLen(values, startIdx)
+			n := unmarshalUint64(v)
+			psg := shard.getPipeStatsGroupUint64(n)
+			shard.stateSizeBudget -= psg.updateStatsForRowsRange(shard.bms, br, startIdx, rowsCount, &shard.exploder)
+			startIdx += rowsCount
 		}
 		return
 	case valueTypeInt64:
@@ -612,7 +1040,7 @@ func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, b
 				n := unmarshalInt64(v)
 				psg = shard.getPipeStatsGroupInt64(n)
 			}
-			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+			shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i, &shard.exploder)
 		}
 		return
 	}
@@ -625,15 +1053,72 @@ func (shard *pipeStatsProcessorShard) updateStatsSingleColumn(br *blockResult, b
 		if i <= 0 || values[i-1] != values[i] {
 			psg = shard.getPipeStatsGroupGeneric(values[i])
 		}
-		shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i)
+		shard.stateSizeBudget -= psg.updateStatsForRow(shard.bms, br, i, &shard.exploder)
+	}
+}
+
+// getIdenticalValuesRunLen returns the number of consecutive values identical to values[startIdx] starting from startIdx.
+func getIdenticalValuesRunLen(values []string, startIdx int) int {
+	v := values[startIdx]
+	endIdx := startIdx + 1
+	for endIdx < len(values) && values[endIdx] == v {
+		endIdx++
+	}
+	return endIdx - startIdx
+}
+
+// addBucketColumns adds synthetic bucket fields referenced by stats functions to br.
+func (shard *pipeStatsProcessorShard) addBucketColumns(br *blockResult) {
+	byFields := shard.cfg.ps.byFields
+
+	rcs := shard.bucketColumns[:0]
+	for _, bucketField := range shard.cfg.bucketFields {
+		bf := byFields[bucketField.byFieldIdx]
+		c := br.getColumnByName(bf.name)
+		values := c.getValuesBucketed(br, bf)
+
+		rcs = appendResultColumnWithName(rcs, bucketField.name)
+		rc := &rcs[len(rcs)-1]
+		if !bucketField.isEnd {
+			for _, v := range values {
+				rc.addValue(v)
+			}
+			continue
+		}
+
+		// Calculate the upper bound only once per every run of identical lower bounds.
+		lower := ""
+		upper := ""
+		for i, v := range values {
+			if i == 0 || v != lower {
+				bufLen := len(shard.bucketBuf)
+				shard.bucketBuf = appendBucketUpperBound(shard.bucketBuf, v, bf)
+				lower = v
+				upper = bytesutil.ToUnsafeString(shard.bucketBuf[bufLen:])
+			}
+			rc.addValue(upper)
+		}
+	}
+	shard.bucketColumns = rcs
+
+	// Add the columns after obtaining all the bucketed values, since adding columns to br may invalidate the obtained columns.
+	for i := range rcs {
+		br.addResultColumn(&rcs[i])
+	}
+}
+
+func (shard *pipeStatsProcessorShard) resetBucketColumns() {
+	for i := range shard.bucketColumns {
+		shard.bucketColumns[i].resetValues()
 	}
+	shard.bucketBuf = shard.bucketBuf[:0]
 }
 
 func (shard *pipeStatsProcessorShard) applyPerFunctionFilters(br *blockResult) {
-	funcs := shard.psp.ps.funcs
+	funcs := shard.cfg.ps.funcs
 	for i := range funcs {
-		iff := funcs[i].iff
-		if iff == nil {
+		f := &funcs[i]
+		if f.iff == nil {
 			continue
 		}
 
@@ -641,7 +1126,18 @@ func (shard *pipeStatsProcessorShard) applyPerFunctionFilters(br *blockResult) {
 		bm.init(br.rowsLen)
 		bm.setBits()
 
-		iff.f.applyToBlockResult(br, bm)
+		if f.isExcludedCounter {
+			// The excluded rows are the rows, which do not match the filter at the previous func.
+			// The filter has been already applied to the previous func, so just invert its results.
+			bm.andNot(&shard.bms[i-1])
+			continue
+		}
+		if f.isValuesCounter {
+			// The values counter uses the same filter as the previous func, so just copy its results.
+			bm.copyFrom(&shard.bms[i-1])
+			continue
+		}
+		f.iff.f.applyToBlockResult(br, bm)
 	}
 }
 
@@ -703,6 +1199,19 @@ func (shard *pipeStatsProcessorShard) getPipeStatsGroupString(v []byte) *pipeSta
 	return psg
 }
 
+// getPipeStatsGroupStringCached returns the group for the given key.
+//
+// It returns the cached group without the lookup if the key matches the previously requested key.
+func (shard *pipeStatsProcessorShard) getPipeStatsGroupStringCached(key []byte) *pipeStatsGroup {
+	if shard.lastGroup != nil && string(key) == string(shard.lastGroupKey) {
+		return shard.lastGroup
+	}
+	psg := shard.getPipeStatsGroupString(key)
+	shard.lastGroupKey = append(shard.lastGroupKey[:0], key...)
+	shard.lastGroup = psg
+	return psg
+}
+
 func (shard *pipeStatsProcessorShard) probablyMoveGroupMapToShards(a *chunkedAllocator) {
 	if shard.groupMap.entriesCount() < pipeStatsGroupMapMaxLen {
 		return
@@ -713,13 +1222,13 @@ func (shard *pipeStatsProcessorShard) probablyMoveGroupMapToShards(a *chunkedAll
 func (shard *pipeStatsProcessorShard) moveGroupMapToShards(a *chunkedAllocator) {
 	// set cpusCount to the number of shards, since this is the concurrency limit set by the caller.
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/8201
-	cpusCount := uint(len(shard.psp.shards))
+	cpusCount := shard.cfg.shardsCount
 	bytesAllocatedPrev := a.bytesAllocated
 	shard.groupMapShards = a.newPipeStatsGroupMaps(cpusCount)
 	shard.stateSizeBudget -= a.bytesAllocated - bytesAllocatedPrev
 
 	for i := range shard.groupMapShards {
-		shard.groupMapShards[i].init(shard)
+		shard.groupMapShards[i].init(&shard.pipeStatsProcessorShardNopad)
 	}
 
 	for n, psg := range shard.groupMap.u64 {
@@ -761,12 +1270,21 @@ func (psg *pipeStatsGroup) mergeState(a *chunkedAllocator, src *pipeStatsGroup)
 	}
 }
 
-func (psg *pipeStatsGroup) updateStatsForAllRows(bms []bitmap, br, brTmp *blockResult) int {
+func (psg *pipeStatsGroup) updateStatsForAllRows(bms []bitmap, br, brTmp *blockResult, se *statsExploder) int {
 	n := 0
 	for i, sfp := range psg.sfps {
 		f := &psg.funcs[i]
 		iff := f.iff
-		if iff == nil {
+		if f.explodeField != "" {
+			var bm *bitmap
+			if iff != nil {
+				bm = &bms[i]
+			}
+			brExploded := se.explodeAllRows(br, f.explodeField, bm)
+			if brExploded.rowsLen > 0 {
+				n += sfp.updateStatsForAllRows(f.f, brExploded)
+			}
+		} else if iff == nil {
 			n += sfp.updateStatsForAllRows(f.f, br)
 		} else {
 			brTmp.initFromFilterAllColumns(br, &bms[i])
@@ -778,18 +1296,53 @@ func (psg *pipeStatsGroup) updateStatsForAllRows(bms []bitmap, br, brTmp *blockR
 	return n
 }
 
-func (psg *pipeStatsGroup) updateStatsForRow(bms []bitmap, br *blockResult, rowIdx int) int {
+func (psg *pipeStatsGroup) updateStatsForRow(bms []bitmap, br *blockResult, rowIdx int, se *statsExploder) int {
+	n := 0
+	for i := range psg.sfps {
+		n += psg.updateFuncStatsForRow(i, bms, br, rowIdx, se)
+	}
+	return n
+}
+
+// updateStatsForRowsRange updates stats for rowsCount rows starting from startIdx in br.
+//
+// It is faster than calling updateStatsForRow for every row in the range if the stats funcs implement statsRowsRangeProcessor.
+func (psg *pipeStatsGroup) updateStatsForRowsRange(bms []bitmap, br *blockResult, startIdx, rowsCount int, se *statsExploder) int {
+	if rowsCount == 1 {
+		// Fast path - avoid the overhead on checking for statsRowsRangeProcessor implementation.
+		return psg.updateStatsForRow(bms, br, startIdx, se)
+	}
+
 	n := 0
 	for i, sfp := range psg.sfps {
 		f := &psg.funcs[i]
-		iff := f.iff
-		if iff == nil || bms[i].isSetBit(rowIdx) {
-			n += sfp.updateStatsForRow(f.f, br, rowIdx)
+		if srp, ok := sfp.(statsRowsRangeProcessor); ok && f.iff == nil && f.explodeField == "" {
+			n += srp.updateStatsForRowsRange(f.f, br, startIdx, rowsCount)
+			continue
+		}
+		for rowIdx := startIdx; rowIdx < startIdx+rowsCount; rowIdx++ {
+			n += psg.updateFuncStatsForRow(i, bms, br, rowIdx, se)
 		}
 	}
 	return n
 }
 
+func (psg *pipeStatsGroup) updateFuncStatsForRow(funcIdx int, bms []bitmap, br *blockResult, rowIdx int, se *statsExploder) int {
+	sfp := psg.sfps[funcIdx]
+	f := &psg.funcs[funcIdx]
+	if f.iff != nil && !bms[funcIdx].isSetBit(rowIdx) {
+		return 0
+	}
+	if f.explodeField != "" {
+		brExploded := se.explodeRow(br, f.explodeField, rowIdx)
+		if brExploded.rowsLen == 0 {
+			return 0
+		}
+		return sfp.updateStatsForAllRows(f.f, brExploded)
+	}
+	return sfp.updateStatsForRow(f.f, br, rowIdx)
+}
+
 func (psp *pipeStatsProcessor) writeBlock(workerID uint, br *blockResult) {
 	if br.rowsLen == 0 {
 		return
@@ -804,6 +1357,7 @@ func (psp *pipeStatsProcessor) writeBlock(workerID uint, br *blockResult) {
 			// The state size is too big. Stop processing data in order to avoid OOM crash.
 			if remaining+stateSizeBudgetChunk >= 0 {
 				// Notify worker goroutines to stop calling writeBlock() in order to save CPU time.
+				statsPipeMemoryLimitHits.Inc()
 				psp.cancel()
 			}
 			return
@@ -811,20 +1365,85 @@ func (psp *pipeStatsProcessor) writeBlock(workerID uint, br *blockResult) {
 		shard.stateSizeBudget += stateSizeBudgetChunk
 	}
 
+	if psp.ps.isWindow {
+		br = shard.getWindowRows(br)
+		if br.rowsLen == 0 {
+			return
+		}
+	}
+
 	shard.writeBlock(br)
+
+	if psp.ps.progressFunc != nil {
+		psp.reportProgressIfNeeded(workerID)
+	}
+}
+
+// getWindowRows returns rows from br, which belong to complete windows for 'stats window ...'.
+//
+// Rows without valid _time cannot be assigned to any window, so they are skipped.
+func (shard *pipeStatsProcessorShard) getWindowRows(br *blockResult) *blockResult {
+	minTimestamp := shard.cfg.windowMinTimestamp
+	maxTimestamp := shard.cfg.windowMaxTimestamp
+
+	bm := &shard.bmWindow
+	bm.init(br.rowsLen)
+	bm.setBits()
+
+	c := br.getColumnByName("_time")
+	if c.isTime {
+		timestamps := br.getTimestamps()
+		bm.forEachSetBit(func(idx int) bool {
+			ts := timestamps[idx]
+			return ts >= minTimestamp && ts < maxTimestamp
+		})
+	} else {
+		values := c.getValues(br)
+		bm.forEachSetBit(func(idx int) bool {
+			ts, ok := TryParseTimestampRFC3339Nano(values[idx])
+			return ok && ts >= minTimestamp && ts < maxTimestamp
+		})
+	}
+
+	if bm.areAllBitsSet() {
+		// Fast path - all the rows belong to complete windows.
+		return br
+	}
+	shard.brWindow.initFromFilterAllColumns(br, bm)
+	return &shard.brWindow
 }
 
+// partialResultField is the name of the field, which is added to the stats results calculated over the partially processed rows.
+//
+// See pipeStats.emitPartial.
+const partialResultField = "_partial"
+
 func (psp *pipeStatsProcessor) flush() error {
 	if n := psp.stateSizeBudget.Load(); n <= 0 {
 		return fmt.Errorf("cannot calculate [%s], since it requires more than %dMB of memory", psp.ps.String(), psp.maxStateSize/(1<<20))
 	}
 
-	// Merge states across shards in parallel
-	psms := psp.mergeShardsParallel()
+	isPartial := false
+	if psp.ps.emitPartial && needStop(psp.stopCh) {
+		// The query has been canceled while processing the input rows.
+		// Return the stats accumulated so far instead of nothing. Disable stopCh checks,
+		// since there is no sense in stopping the processing of the accumulated stats.
+		isPartial = true
+		psp.stopCh = nil
+	}
+
+	// Merge states across shards
+	psms := psp.mergeShards()
 	if needStop(psp.stopCh) {
 		return nil
 	}
 
+	groupsCount := uint64(0)
+	for _, psm := range psms {
+		groupsCount += psm.entriesCount()
+	}
+	updateStatsPipePeakGroups(groupsCount)
+
 	if len(psp.ps.byFields) == 0 && len(psms) == 0 {
 		// Special case - zero matching rows.
 		shard := &psp.shards[0]
@@ -834,25 +1453,77 @@ func (psp *pipeStatsProcessor) flush() error {
 	}
 
 	// Write the calculated stats in parallel to the next pipe.
+	var ppTopk pipeProcessor
+	ppNext := psp.ppNext
+	if psp.ps.sortPipe != nil {
+		// Pass only the top N results to the next pipe.
+		// The top N results are tracked with bounded heaps per every psms entry.
+		ppTopk = newPipeTopkProcessor(psp.ps.getTopkSortPipe(), len(psms), psp.stopCh, psp.cancel, ppNext)
+		ppNext = ppTopk
+	}
+	// Pass smaller blocks to the next pipe when the stats state occupies the most of its memory budget,
+	// so the next pipe starts processing the results earlier, while the pending results occupy less memory.
+	maxResultLen := getPipeStatsWriterMaxResultLen(psp.maxStateSize, psp.stateSizeBudget.Load())
+
 	var wg sync.WaitGroup
 	for i := range psms {
 		wg.Add(1)
 		go func(workerID uint) {
 			defer wg.Done()
 
-			psw := newPipeStatsWriter(psp, workerID)
+			psw := newPipeStatsWriter(psp, workerID, ppNext, isPartial, maxResultLen)
 			psw.writeShardData(psms[workerID])
 			psw.flush()
 		}(uint(i))
 	}
 	wg.Wait()
 
+	if ppTopk != nil {
+		return ppTopk.flush()
+	}
 	return nil
 }
 
+// getTopkSortPipe returns 'sort ... limit N' pipe for selecting the top N stats results according to ps.sortPipe.
+//
+// The returned pipe doesn't apply offset and doesn't add rank field, since this is performed by ps.sortPipe itself.
+func (ps *pipeStats) getTopkSortPipe() *pipeSort {
+	sp := ps.sortPipe
+	return &pipeSort{
+		byFields:          sp.byFields,
+		isDesc:            sp.isDesc,
+		limit:             sp.offset + sp.limit,
+		partitionByFields: sp.partitionByFields,
+	}
+}
+
+// pipeStatsWriterMaxResultLen is the maximum size of values in bytes, which are buffered by pipeStatsWriter before passing them to the next pipe.
+//
+// The 64_000 limit provides the best performance results when generating stats
+// over big number of distinct groups.
+const pipeStatsWriterMaxResultLen = 64_000
+
+// pipeStatsWriterMinResultLen is used instead of pipeStatsWriterMaxResultLen under memory pressure.
+const pipeStatsWriterMinResultLen = 8_000
+
+// getPipeStatsWriterMaxResultLen returns the maximum size of values in bytes, which can be buffered by pipeStatsWriter.
+//
+// maxStateSize is the memory budget for the stats pipe state, while remainingBudget is the unused part of this budget.
+// The returned limit is reduced when less than a quarter of the budget remains unused.
+func getPipeStatsWriterMaxResultLen(maxStateSize, remainingBudget int64) int {
+	if remainingBudget < maxStateSize/4 {
+		return pipeStatsWriterMinResultLen
+	}
+	return pipeStatsWriterMaxResultLen
+}
+
 type pipeStatsWriter struct {
 	psp      *pipeStatsProcessor
 	workerID uint
+	ppNext   pipeProcessor
+
+	// maxResultLen is the maximum size of buffered values before passing them to ppNext.
+	maxResultLen int
 
 	rcs []resultColumn
 	br  blockResult
@@ -860,24 +1531,35 @@ type pipeStatsWriter struct {
 	resultLen int
 	rowsCount int
 
+	// isPartial is set if the written stats are calculated over the partially processed rows.
+	isPartial bool
+
 	values    []string
 	valuesBuf []byte
 }
 
-func newPipeStatsWriter(psp *pipeStatsProcessor, workerID uint) *pipeStatsWriter {
+func newPipeStatsWriter(psp *pipeStatsProcessor, workerID uint, ppNext pipeProcessor, isPartial bool, maxResultLen int) *pipeStatsWriter {
 	byFields := psp.ps.byFields
-	rcs := make([]resultColumn, 0, len(byFields)+len(psp.ps.funcs))
+	rcs := make([]resultColumn, 0, len(byFields)+len(psp.ps.funcs)+1)
 	for _, bf := range byFields {
-		rcs = appendResultColumnWithName(rcs, bf.name)
+		rcs = appendResultColumnWithName(rcs, bf.resultName())
 	}
 	for _, f := range psp.ps.funcs {
 		rcs = appendResultColumnWithName(rcs, f.resultName)
 	}
+	if isPartial {
+		rcs = appendResultColumnWithName(rcs, partialResultField)
+	}
 
 	psw := &pipeStatsWriter{
 		psp:      psp,
 		workerID: workerID,
+		ppNext:   ppNext,
 		rcs:      rcs,
+
+		maxResultLen: maxResultLen,
+
+		isPartial: isPartial,
 	}
 	return psw
 }
@@ -889,6 +1571,9 @@ func (psw *pipeStatsWriter) writePipeStatsGroup(psg *pipeStatsGroup) {
 		value := bytesutil.ToUnsafeString(psw.valuesBuf[bufLen:])
 		psw.values = append(psw.values, value)
 	}
+	if psw.isPartial {
+		psw.values = append(psw.values, "1")
+	}
 	if len(psw.values) != len(psw.rcs) {
 		logger.Panicf("BUG: len(values)=%d must be equal to len(rcs)=%d", len(psw.values), len(psw.rcs))
 	}
@@ -901,9 +1586,7 @@ func (psw *pipeStatsWriter) writePipeStatsGroup(psg *pipeStatsGroup) {
 	psw.resultLen += n
 	psw.rowsCount++
 
-	// The 64_000 limit provides the best performance results when generating stats
-	// over big number of distinct groups.
-	if psw.resultLen >= 64_000 {
+	if psw.resultLen >= psw.maxResultLen {
 		psw.flush()
 	}
 }
@@ -912,7 +1595,7 @@ func (psw *pipeStatsWriter) flush() {
 	psw.br.setResultColumns(psw.rcs, psw.rowsCount)
 	psw.resultLen = 0
 	psw.rowsCount = 0
-	psw.psp.ppNext.writeBlock(psw.workerID, &psw.br)
+	psw.ppNext.writeBlock(psw.workerID, &psw.br)
 	psw.br.reset()
 	for i := range psw.rcs {
 		psw.rcs[i].resetValues()
@@ -985,6 +1668,22 @@ func (psw *pipeStatsWriter) writeShardData(psm *pipeStatsGroupMap) {
 	}
 }
 
+// pipeStatsSerialMergeMaxGroups is the maximum number of groups across all the shards, which are merged serially at flush().
+//
+// Parallel merge has the overhead of splitting every shard into per-CPU maps and starting goroutines for merging them.
+// This overhead exceeds the merge time itself when the number of groups is small.
+const pipeStatsSerialMergeMaxGroups = 4 << 10
+
+// mergeShards merges groups across psp.shards.
+//
+// Small number of groups is merged serially, while big number of groups is merged in parallel.
+func (psp *pipeStatsProcessor) mergeShards() []*pipeStatsGroupMap {
+	if canMergePipeStatsShardsSerially(psp.shards) {
+		return psp.mergeShardsSerial()
+	}
+	return psp.mergeShardsParallel()
+}
+
 func (psp *pipeStatsProcessor) mergeShardsParallel() []*pipeStatsGroupMap {
 	shards := psp.shards
 	var wg sync.WaitGroup
@@ -1038,6 +1737,42 @@ func (psp *pipeStatsProcessor) mergeShardsParallel() []*pipeStatsGroupMap {
 	return result
 }
 
+// canMergePipeStatsShardsSerially returns true if the groups at shards can be merged faster in a single goroutine.
+func canMergePipeStatsShardsSerially(shards []pipeStatsProcessorShard) bool {
+	groupsCount := uint64(0)
+	for i := range shards {
+		shard := &shards[i]
+		if shard.groupMapShards != nil {
+			// The shard already contains big number of groups.
+			return false
+		}
+		groupsCount += shard.groupMap.entriesCount()
+	}
+	return groupsCount < pipeStatsSerialMergeMaxGroups
+}
+
+// mergeShardsSerial merges small number of groups across psp.shards in the current goroutine.
+func (psp *pipeStatsProcessor) mergeShardsSerial() []*pipeStatsGroupMap {
+	var psmDst *pipeStatsGroupMap
+	var a chunkedAllocator
+	for i := range psp.shards {
+		psm := &psp.shards[i].groupMap
+		if psm.entriesCount() == 0 {
+			continue
+		}
+		if psmDst == nil {
+			psmDst = psm
+			continue
+		}
+		psmDst.mergeState(&a, psm, psp.stopCh)
+		psm.reset()
+	}
+	if needStop(psp.stopCh) || psmDst == nil {
+		return nil
+	}
+	return []*pipeStatsGroupMap{psmDst}
+}
+
 func parsePipeStats(lex *lexer, needStatsKeyword bool) (pipe, error) {
 	if needStatsKeyword {
 		if !lex.isKeyword("stats") {
@@ -1047,6 +1782,16 @@ func parsePipeStats(lex *lexer, needStatsKeyword bool) (pipe, error) {
 	}
 
 	var ps pipeStats
+	if needStatsKeyword && lex.isKeyword("partial") {
+		ps.emitPartial = true
+		lex.nextToken()
+	}
+	if needStatsKeyword && lex.isKeyword("window") {
+		ps.isWindow = true
+		ps.windowMinTimestamp = math.MinInt64
+		ps.windowMaxTimestamp = math.MaxInt64
+		lex.nextToken()
+	}
 	if lex.isKeyword("by", "(") {
 		if lex.isKeyword("by") {
 			lex.nextToken()
@@ -1057,10 +1802,19 @@ func parsePipeStats(lex *lexer, needStatsKeyword bool) (pipe, error) {
 		}
 		ps.byFields = bfs
 	}
+	if ps.isWindow {
+		if err := checkStatsWindowByFields(ps.byFields); err != nil {
+			return nil, err
+		}
+	}
 
 	seenByFields := make(map[string]*byStatsField, len(ps.byFields))
 	for _, bf := range ps.byFields {
-		seenByFields[bf.name] = bf
+		name := bf.resultName()
+		if bfPrev := seenByFields[name]; bfPrev != nil && (bfPrev.alias != "" || bf.alias != "") {
+			return nil, fmt.Errorf("cannot use identical output name %q for 'by' fields [%s] and [%s]", name, bfPrev, bf)
+		}
+		seenByFields[name] = bf
 	}
 
 	seenResultNames := make(map[string]statsFunc)
@@ -1069,23 +1823,51 @@ func parsePipeStats(lex *lexer, needStatsKeyword bool) (pipe, error) {
 	for {
 		var f pipeStatsFunc
 
-		sf, err := parseStatsFunc(lex)
-		if err != nil {
-			return nil, err
-		}
-		f.f = sf
-
-		if lex.isKeyword("if") {
-			iff, err := parseIfFilter(lex)
+		if lex.isKeyword("countif") {
+			// countif(filter) is a shorthand for count() if (filter)
+			sc, iff, err := parseStatsCountIf(lex)
 			if err != nil {
-				return nil, fmt.Errorf("cannot parse 'if' filter for [%s]: %w", sf, err)
+				return nil, fmt.Errorf("cannot parse 'countif' func: %w", err)
 			}
+			f.f = sc
 			f.iff = iff
+		} else {
+			explodeField, err := rewriteStatsFuncExplode(lex)
+			if err != nil {
+				return nil, err
+			}
+			sf, err := parseStatsFunc(lex)
+			if err != nil {
+				return nil, err
+			}
+			f.f = sf
+			f.explodeField = explodeField
+
+			if lex.isKeyword("if") {
+				iff, err := parseIfFilter(lex)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse 'if' filter for [%s]: %w", sf, err)
+				}
+				f.iff = iff
+			}
+		}
+		sf := f.f
+
+		if f.iff != nil && lex.isKeyword("with_excluded") {
+			lex.nextToken()
+			f.withExcluded = true
+		}
+		if lex.isKeyword("with_count") {
+			if _, ok := sf.(statsFuncWithCount); !ok {
+				return nil, fmt.Errorf("'with_count' isn't supported for [%s]", sf)
+			}
+			lex.nextToken()
+			f.withCount = true
 		}
 
 		resultName := ""
 		if lex.isKeyword(",", "|", ")", "") {
-			resultName = sf.String()
+			resultName = f.funcString()
 			if f.iff != nil {
 				resultName += " " + f.iff.String()
 			}
@@ -1110,6 +1892,21 @@ func parsePipeStats(lex *lexer, needStatsKeyword bool) (pipe, error) {
 
 		funcs = append(funcs, f)
 
+		if f.withCount {
+			fCount, err := newPipeStatsFuncValuesCounter(&f, seenByFields, seenResultNames)
+			if err != nil {
+				return nil, err
+			}
+			funcs = append(funcs, fCount)
+		}
+		if f.withExcluded {
+			fExcluded, err := newPipeStatsFuncExcludedCounter(&f, seenByFields, seenResultNames)
+			if err != nil {
+				return nil, err
+			}
+			funcs = append(funcs, fExcluded)
+		}
+
 		if lex.isKeyword("|", ")", "") {
 			ps.funcs = funcs
 			return &ps, nil
@@ -1121,6 +1918,72 @@ func parsePipeStats(lex *lexer, needStatsKeyword bool) (pipe, error) {
 	}
 }
 
+// newPipeStatsFuncExcludedCounter returns the func for counting the rows excluded by 'if (...)' filter at f with 'with_excluded' suffix.
+func newPipeStatsFuncExcludedCounter(f *pipeStatsFunc, seenByFields map[string]*byStatsField, seenResultNames map[string]statsFunc) (pipeStatsFunc, error) {
+	resultName := f.resultName + "_excluded"
+	if bf := seenByFields[resultName]; bf != nil {
+		return pipeStatsFunc{}, fmt.Errorf("the %q is used as 'by' field [%s], so it cannot be used as result name for 'with_excluded' at [%s]", resultName, bf, f.f)
+	}
+	if sfPrev := seenResultNames[resultName]; sfPrev != nil {
+		return pipeStatsFunc{}, fmt.Errorf("cannot use identical result name %q for [%s] and 'with_excluded' at [%s]", resultName, sfPrev, f.f)
+	}
+
+	sc := &statsCount{}
+	seenResultNames[resultName] = sc
+
+	// The iff is used only for obtaining the needed fields and for detecting the filtered func.
+	// The excluded rows are obtained by inverting the filter results for f. See pipeStatsProcessorShard.applyPerFunctionFilters.
+	fExcluded := pipeStatsFunc{
+		f:                 sc,
+		iff:               f.iff,
+		isExcludedCounter: true,
+		resultName:        resultName,
+	}
+	return fExcluded, nil
+}
+
+// newPipeStatsFuncValuesCounter returns the func for counting the values contributed to the result of f with 'with_count' suffix.
+func newPipeStatsFuncValuesCounter(f *pipeStatsFunc, seenByFields map[string]*byStatsField, seenResultNames map[string]statsFunc) (pipeStatsFunc, error) {
+	resultName := f.resultName + "_count"
+	if bf := seenByFields[resultName]; bf != nil {
+		return pipeStatsFunc{}, fmt.Errorf("the %q is used as 'by' field [%s], so it cannot be used as result name for 'with_count' at [%s]", resultName, bf, f.f)
+	}
+	if sfPrev := seenResultNames[resultName]; sfPrev != nil {
+		return pipeStatsFunc{}, fmt.Errorf("cannot use identical result name %q for [%s] and 'with_count' at [%s]", resultName, sfPrev, f.f)
+	}
+
+	sf := f.f.(statsFuncWithCount).newValuesCounter()
+	seenResultNames[resultName] = sf
+
+	// The values counter must see the same rows as f, so it shares iff and explodeField with f.
+	// See pipeStatsProcessorShard.applyPerFunctionFilters.
+	fCount := pipeStatsFunc{
+		f:               sf,
+		iff:             f.iff,
+		explodeField:    f.explodeField,
+		isValuesCounter: true,
+		resultName:      resultName,
+	}
+	return fCount, nil
+}
+
+// checkStatsWindowByFields verifies whether bfs contain '_time:step' with fixed step for 'stats window ...'.
+func checkStatsWindowByFields(bfs []*byStatsField) error {
+	for _, bf := range bfs {
+		if bf.name != "_time" {
+			continue
+		}
+		if bf.bucketSizeStr == "" {
+			return fmt.Errorf("'stats window' requires '_time:step' in 'by' clause; got %q", bf)
+		}
+		if bf.bucketSizePercent > 0 || bf.transform != nil || bf.isTimePartBucket() || bf.bucketSizeStr == "month" || bf.bucketSizeStr == "year" || bf.bucketSize <= 0 {
+			return fmt.Errorf("'stats window' requires '_time:step' with fixed step in 'by' clause; got %q", bf)
+		}
+		return nil
+	}
+	return fmt.Errorf("'stats window' requires '_time:step' in 'by' clause")
+}
+
 func parseStatsFunc(lex *lexer) (statsFunc, error) {
 	switch {
 	case lex.isKeyword("avg"):
@@ -1141,6 +2004,12 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 			return nil, fmt.Errorf("cannot parse 'count_empty' func: %w", err)
 		}
 		return scs, nil
+	case lex.isKeyword("count_nonempty"):
+		scs, err := parseStatsCountNonEmpty(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'count_nonempty' func: %w", err)
+		}
+		return scs, nil
 	case lex.isKeyword("count_uniq"):
 		sus, err := parseStatsCountUniq(lex)
 		if err != nil {
@@ -1153,12 +2022,36 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 			return nil, fmt.Errorf("cannot parse 'count_uniq_hash' func: %w", err)
 		}
 		return sus, nil
+	case lex.isKeyword("delta"):
+		sds, err := parseStatsDelta(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'delta' func: %w", err)
+		}
+		return sds, nil
+	case lex.isKeyword("ewma"):
+		ses, err := parseStatsEWMA(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'ewma' func: %w", err)
+		}
+		return ses, nil
 	case lex.isKeyword("histogram"):
 		shs, err := parseStatsHistogram(lex)
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse 'histogram' func: %w", err)
 		}
 		return shs, nil
+	case lex.isKeyword("join"):
+		sjs, err := parseStatsJoin(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'join' func: %w", err)
+		}
+		return sjs, nil
+	case lex.isKeyword("mad"):
+		sms, err := parseStatsMAD(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'mad' func: %w", err)
+		}
+		return sms, nil
 	case lex.isKeyword("max"):
 		sms, err := parseStatsMax(lex)
 		if err != nil {
@@ -1171,12 +2064,25 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 			return nil, fmt.Errorf("cannot parse 'median' func: %w", err)
 		}
 		return sms, nil
+	case lex.isKeyword("merge_uniq_hash"):
+		sms, err := parseStatsMergeUniqHash(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'merge_uniq_hash' func: %w", err)
+		}
+		return sms, nil
 	case lex.isKeyword("min"):
 		sms, err := parseStatsMin(lex)
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse 'min' func: %w", err)
 		}
 		return sms, nil
+	case lex.isKeyword("p50", "p90", "p95", "p99", "p999"):
+		funcName := strings.ToLower(lex.token)
+		sqs, err := parseStatsQuantileShortcut(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse '%s' func: %w", funcName, err)
+		}
+		return sqs, nil
 	case lex.isKeyword("quantile"):
 		sqs, err := parseStatsQuantile(lex)
 		if err != nil {
@@ -1195,6 +2101,12 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 			return nil, fmt.Errorf("cannot parse 'rate_sum' func: %w", err)
 		}
 		return srs, nil
+	case lex.isKeyword("rate_counter"):
+		srs, err := parseStatsRateCounter(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'rate_counter' func: %w", err)
+		}
+		return srs, nil
 	case lex.isKeyword("row_any"):
 		sas, err := parseStatsRowAny(lex)
 		if err != nil {
@@ -1213,6 +2125,12 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 			return nil, fmt.Errorf("cannot parse 'row_min' func: %w", err)
 		}
 		return sms, nil
+	case lex.isKeyword("sample"):
+		sss, err := parseStatsSample(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'sample' func: %w", err)
+		}
+		return sss, nil
 	case lex.isKeyword("sum"):
 		sss, err := parseStatsSum(lex)
 		if err != nil {
@@ -1242,6 +2160,11 @@ func parseStatsFunc(lex *lexer) (statsFunc, error) {
 	}
 }
 
+// statsNames contains stats function names, which cannot be used as the first token in query filters,
+// since stats functions can be used without the initial `stats` keyword.
+//
+// Names of newly added stats functions mustn't be registered here, since this breaks existing queries
+// starting with words matching these names. Such functions are still parsed by parseStatsFunc.
 var statsNames = []string{
 	"avg",
 	"count",
@@ -1272,30 +2195,162 @@ var statsNames = []string{
 type byStatsField struct {
 	name string
 
+	// alias is the name of the output column for the given field set via 'as alias'.
+	//
+	// The output column has the name of the field if alias is empty.
+	alias string
+
 	// bucketSizeStr is string representation of the bucket size
 	bucketSizeStr string
 
 	// bucketSize is the bucket for grouping the given field values with value/bucketSize calculations
 	bucketSize float64
 
+	// bucketSizePercent is the bucket size in percents of the (max - min) range of the given field values.
+	//
+	// It is set for 'name:N%' buckets. Such buckets are resolved into bucketSize by pipeStatsPercentProcessor.
+	bucketSizePercent float64
+
 	// bucketOffsetStr is string representation of the offset for bucketSize
 	bucketOffsetStr string
 
 	// bucketOffset is the offset for bucketSize
 	bucketOffset float64
+
+	// ipv6PrefixLen is the prefix length for '/N' bucket, which is applied to IPv6 values.
+	//
+	// IPv4 values are bucketed via bucketSize for '/N' buckets.
+	ipv6PrefixLen int
+
+	// timezoneStr is string representation of the timezone for 'hour_of_day' and 'day_of_week' buckets.
+	timezoneStr string
+
+	// timezone is the timezone for 'hour_of_day' and 'day_of_week' buckets. UTC is used if it is nil.
+	timezone *time.Location
+
+	// transform is an optional transform for 'prefix(...)' and 'split(...)' buckets.
+	//
+	// bucketSizeStr contains string representation of the transform if it is set.
+	transform *byStatsFieldTransform
 }
 
+// String returns string representation of bf, which can be parsed back into bf.
+//
+// The name is quoted if it contains chars such as ':', which clash with the 'name:bucket' syntax, or if it matches reserved keywords.
 func (bf *byStatsField) String() string {
+	s := bf.fieldString()
+	if bf.alias != "" {
+		s += " as " + quoteTokenIfNeeded(bf.alias)
+	}
+	return s
+}
+
+func (bf *byStatsField) fieldString() string {
+	if bf.transform != nil && bf.transform.hashAlgo != "" {
+		s := "hash(" + quoteTokenIfNeeded(bf.name)
+		if bf.transform.hashAlgo != "xxhash" {
+			s += ", " + bf.transform.hashAlgo
+		}
+		return s + ")"
+	}
+
 	s := quoteTokenIfNeeded(bf.name)
 	if bf.bucketSizeStr != "" {
 		s += ":" + bf.bucketSizeStr
 		if bf.bucketOffsetStr != "" {
 			s += " offset " + bf.bucketOffsetStr
 		}
+		if bf.timezoneStr != "" {
+			s += " tz " + quoteTokenIfNeeded(bf.timezoneStr)
+		}
 	}
 	return s
 }
 
+// resultName returns the name of the output column for bf.
+func (bf *byStatsField) resultName() string {
+	if bf.alias != "" {
+		return bf.alias
+	}
+	return bf.name
+}
+
+// appendBucketUpperBound appends the upper bound for the bucket with the given lower bound according to bf and returns the result.
+//
+// The lower bound must be obtained via blockResult.getBucketedValue. The upper bound isn't included in the bucket.
+// Nothing is appended if the upper bound cannot be calculated, e.g. for 'prefix(...)', 'split(...)', 'hour_of_day', 'day_of_week' and IPv6 buckets.
+func appendBucketUpperBound(dst []byte, lower string, bf *byStatsField) []byte {
+	if len(lower) == 0 || bf.transform != nil || bf.isTimePartBucket() {
+		return dst
+	}
+	if bf.isIPMaskBucket() {
+		if _, ok := tryParseIPv4(lower); !ok {
+			return dst
+		}
+	}
+
+	c := lower[0]
+	if (c < '0' || c > '9') && c != '-' {
+		// The value couldn't be bucketed. See blockResult.getBucketedValue.
+		return dst
+	}
+
+	// The order of checks must be in sync with blockResult.getBucketedValue.
+	bucketSize := bf.bucketSize
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	bucketSizeInt := int64(bucketSize)
+	if bucketSizeInt <= 0 {
+		bucketSizeInt = 1
+	}
+
+	if n, ok := tryParseInt64(lower); ok {
+		return marshalInt64String(dst, n+bucketSizeInt)
+	}
+	if f, ok := tryParseFloat64(lower); ok {
+		return marshalFloat64String(dst, f+bucketSize)
+	}
+	if timestamp, ok := TryParseTimestampRFC3339Nano(lower); ok {
+		switch bf.bucketSizeStr {
+		case "month", "year":
+			bucketOffset := int64(bf.bucketOffset)
+			t := time.Unix(0, timestamp-bucketOffset).UTC()
+			if bf.bucketSizeStr == "month" {
+				t = t.AddDate(0, 1, 0)
+			} else {
+				t = t.AddDate(1, 0, 0)
+			}
+			timestamp = t.UnixNano() + bucketOffset
+		default:
+			timestamp += bucketSizeInt
+		}
+		return marshalTimestampRFC3339NanoString(dst, timestamp)
+	}
+	if n, ok := tryParseIPv4(lower); ok {
+		upper := uint64(n) + uint64(bucketSizeInt)
+		if upper > math.MaxUint32 {
+			// The upper bound is out of IPv4 range.
+			return dst
+		}
+		return marshalIPv4String(dst, uint32(upper))
+	}
+	if nsecs, ok := tryParseDuration(lower); ok {
+		return marshalDurationString(dst, nsecs+bucketSizeInt)
+	}
+	return dst
+}
+
+// isIPMaskBucket returns true if bf contains '/N' bucket for IP addresses.
+func (bf *byStatsField) isIPMaskBucket() bool {
+	return strings.HasPrefix(bf.bucketSizeStr, "/")
+}
+
+// isTimePartBucket returns true if bf returns the given part of the timestamp such as hour of the day or day of the week.
+func (bf *byStatsField) isTimePartBucket() bool {
+	return bf.bucketSizeStr == "hour_of_day" || bf.bucketSizeStr == "day_of_week"
+}
+
 func (bf *byStatsField) hasBucketConfig() bool {
 	return len(bf.bucketSizeStr) > 0 || len(bf.bucketOffsetStr) > 0
 }
@@ -1311,48 +2366,17 @@ func parseByStatsFields(lex *lexer) ([]*byStatsField, error) {
 			lex.nextToken()
 			return bfs, nil
 		}
-		fieldName, err := getCompoundPhrase(lex, false)
+		bf, err := parseByStatsField(lex)
 		if err != nil {
-			return nil, fmt.Errorf("cannot parse field name: %w", err)
-		}
-		fieldName = getCanonicalColumnName(fieldName)
-		bf := &byStatsField{
-			name: fieldName,
+			return nil, err
 		}
-		if lex.isKeyword(":") {
-			// Parse bucket size
-			lex.nextToken()
-			bucketSizeStr := lex.token
+		if lex.isKeyword("as") {
 			lex.nextToken()
-			if bucketSizeStr == "/" {
-				bucketSizeStr += lex.token
-				lex.nextToken()
-			}
-			if bucketSizeStr != "year" && bucketSizeStr != "month" {
-				bucketSize, ok := tryParseBucketSize(bucketSizeStr)
-				if !ok {
-					return nil, fmt.Errorf("cannot parse bucket size for field %q: %q", fieldName, bucketSizeStr)
-				}
-				bf.bucketSize = bucketSize
-			}
-			bf.bucketSizeStr = bucketSizeStr
-
-			// Parse bucket offset
-			if lex.isKeyword("offset") {
-				lex.nextToken()
-				bucketOffsetStr := lex.token
-				lex.nextToken()
-				if bucketOffsetStr == "-" {
-					bucketOffsetStr += lex.token
-					lex.nextToken()
-				}
-				bucketOffset, ok := tryParseBucketOffset(bucketOffsetStr)
-				if !ok {
-					return nil, fmt.Errorf("cannot parse bucket offset for field %q: %q", fieldName, bucketOffsetStr)
-				}
-				bf.bucketOffsetStr = bucketOffsetStr
-				bf.bucketOffset = bucketOffset
+			alias, err := parseFieldName(lex)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse alias for %s: %w", bf, err)
 			}
+			bf.alias = alias
 		}
 		bfs = append(bfs, bf)
 		switch {
@@ -1361,11 +2385,105 @@ func parseByStatsFields(lex *lexer) ([]*byStatsField, error) {
 			return bfs, nil
 		case lex.isKeyword(","):
 		default:
-			return nil, fmt.Errorf("unexpected token: %q; expecting ',' or ')'", lex.token)
+			return nil, fmt.Errorf("unexpected token after %s: %q; expecting ',' or ')'", bf, lex.token)
 		}
 	}
 }
 
+// parseByStatsField parses a single field with optional bucket config in 'by (...)' clause of the stats pipe.
+func parseByStatsField(lex *lexer) (*byStatsField, error) {
+	if bf, ok, err := tryParseByStatsFieldHash(lex); ok {
+		return bf, err
+	}
+	fieldName, err := getCompoundPhrase(lex, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse field name: %w", err)
+	}
+	fieldName = getCanonicalColumnName(fieldName)
+	bf := &byStatsField{
+		name: fieldName,
+	}
+	if !lex.isKeyword(":") {
+		return bf, nil
+	}
+	lex.nextToken()
+	if lex.isKeyword("prefix", "split") {
+		// Parse transform
+		t, err := parseByStatsFieldTransform(lex, fieldName)
+		if err != nil {
+			return nil, err
+		}
+		bf.transform = t
+		bf.bucketSizeStr = t.String()
+		return bf, nil
+	}
+
+	// Parse bucket size
+	bucketSizeStr := lex.token
+	lex.nextToken()
+	if bucketSizeStr == "/" {
+		bucketSizeStr += lex.token
+		lex.nextToken()
+	}
+	if lex.isKeyword("%") {
+		bucketSizeStr += lex.token
+		lex.nextToken()
+	}
+	if strings.HasSuffix(bucketSizeStr, "%") {
+		bucketSizePercent, ok := tryParseBucketSizePercent(bucketSizeStr)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse bucket size for field %q: %q; it must be in the range (0%%..100%%]", fieldName, bucketSizeStr)
+		}
+		bf.bucketSizePercent = bucketSizePercent
+	} else if bucketSizeStr != "year" && bucketSizeStr != "month" && bucketSizeStr != "hour_of_day" && bucketSizeStr != "day_of_week" {
+		bucketSize, ok := tryParseBucketSize(bucketSizeStr)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse bucket size for field %q: %q", fieldName, bucketSizeStr)
+		}
+		bf.bucketSize = bucketSize
+		if n, ok := tryParseIPv6Mask(bucketSizeStr); ok {
+			bf.ipv6PrefixLen = n
+		}
+	}
+	bf.bucketSizeStr = bucketSizeStr
+
+	// Parse bucket offset
+	if lex.isKeyword("offset") {
+		lex.nextToken()
+		bucketOffsetStr := lex.token
+		lex.nextToken()
+		if bucketOffsetStr == "-" {
+			bucketOffsetStr += lex.token
+			lex.nextToken()
+		}
+		bucketOffset, ok := tryParseBucketOffset(bucketOffsetStr)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse bucket offset for field %q: %q", fieldName, bucketOffsetStr)
+		}
+		bf.bucketOffsetStr = bucketOffsetStr
+		bf.bucketOffset = bucketOffset
+	}
+
+	// Parse timezone
+	if lex.isKeyword("tz") {
+		if !bf.isTimePartBucket() {
+			return nil, fmt.Errorf("'tz' can be used only with 'hour_of_day' and 'day_of_week' buckets for field %q; got %q bucket", fieldName, bucketSizeStr)
+		}
+		lex.nextToken()
+		timezoneStr, err := getCompoundToken(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse timezone for field %q: %w", fieldName, err)
+		}
+		timezone, err := time.LoadLocation(timezoneStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse timezone for field %q: %w", fieldName, err)
+		}
+		bf.timezoneStr = timezoneStr
+		bf.timezone = timezone
+	}
+	return bf, nil
+}
+
 // tryParseBucketOffset tries parsing bucket offset, which can have the following formats:
 //
 // - integer number: 12345
@@ -1391,6 +2509,21 @@ func tryParseBucketOffset(s string) (float64, bool) {
 	return 0, false
 }
 
+// tryParseBucketSizePercent tries parsing bucket size in percents such as 5%.
+//
+// The percent must be in the range (0..100].
+func tryParseBucketSizePercent(s string) (float64, bool) {
+	n := len(s) - 1
+	if n < 0 || s[n] != '%' {
+		return 0, false
+	}
+	f, ok := tryParseFloat64(s[:n])
+	if !ok || f <= 0 || f > 100 {
+		return 0, false
+	}
+	return f, true
+}
+
 // tryParseBucketSize tries parsing bucket size, which can have the following formats:
 //
 // - integer number: 12345
@@ -1398,6 +2531,7 @@ func tryParseBucketOffset(s string) (float64, bool) {
 // - duration: 1.5s - it is converted to nanoseconds
 // - bytes: 1.5KiB
 // - ipv4 mask: /24
+// - ipv6 mask: /64
 func tryParseBucketSize(s string) (float64, bool) {
 	switch s {
 	case "nanosecond":
@@ -1437,6 +2571,12 @@ func tryParseBucketSize(s string) (float64, bool) {
 		return float64(n), true
 	}
 
+	if _, ok := tryParseIPv6Mask(s); ok {
+		// '/33' ... '/128' masks are applied only to IPv6 values - see byStatsField.ipv6PrefixLen.
+		// IPv4 values remain unchanged for such masks.
+		return 1, true
+	}
+
 	return 0, false
 }
 
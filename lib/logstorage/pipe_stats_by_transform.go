@@ -0,0 +1,235 @@
+package logstorage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+)
+
+// byStatsFieldTransform is a transform for field values in 'by (...)' clause of the stats pipe.
+//
+// The following transforms are supported:
+//
+//   - 'field:prefix("prefix")' - values starting with the given prefix are grouped into the prefix, while the remaining values are grouped into an empty value.
+//   - 'field:split("separator", N)' - values are grouped by the N-th segment (starting from 0) of the value split by the given separator.
+//     Values with less than N+1 segments are grouped into an empty value.
+//   - 'hash(field)' or 'hash(field, algo)' - values are grouped by the hex-encoded hash of the value, so the original values aren't exposed in the results.
+//     The algo can be either 'xxhash' (the default) or 'sha256'. Empty values are grouped into an empty value.
+type byStatsFieldTransform struct {
+	// prefix is the prefix for 'prefix(...)' transform.
+	prefix string
+
+	// isSplit is set for 'split(...)' transform.
+	isSplit bool
+
+	// separator is the separator for 'split(...)' transform.
+	separator string
+
+	// segmentIdx is the index of the segment to return for 'split(...)' transform.
+	segmentIdx int
+
+	// hashAlgo is the hash algorithm for 'hash(...)' transform. It is either 'xxhash' or 'sha256'.
+	hashAlgo string
+}
+
+func (t *byStatsFieldTransform) String() string {
+	if t.hashAlgo != "" {
+		return "hash(" + t.hashAlgo + ")"
+	}
+	if t.isSplit {
+		return "split(" + strconv.Quote(t.separator) + ", " + strconv.Itoa(t.segmentIdx) + ")"
+	}
+	return "prefix(" + strconv.Quote(t.prefix) + ")"
+}
+
+// apply returns the transformed s.
+//
+// The returned value is either a substring of s or a string owned by t.
+// The result for 'hash(...)' transform is allocated on every call. Use blockResult.getTransformedValue for avoiding the allocation.
+func (t *byStatsFieldTransform) apply(s string) string {
+	if t.hashAlgo != "" {
+		return string(t.appendHash(nil, s))
+	}
+	if !t.isSplit {
+		if strings.HasPrefix(s, t.prefix) {
+			return t.prefix
+		}
+		return ""
+	}
+
+	for i := 0; i < t.segmentIdx; i++ {
+		n := strings.Index(s, t.separator)
+		if n < 0 {
+			return ""
+		}
+		s = s[n+len(t.separator):]
+	}
+	if n := strings.Index(s, t.separator); n >= 0 {
+		s = s[:n]
+	}
+	return s
+}
+
+// appendHash appends hex-encoded hash for s according to t.hashAlgo to dst and returns the result.
+//
+// Nothing is appended for empty s.
+func (t *byStatsFieldTransform) appendHash(dst []byte, s string) []byte {
+	if s == "" {
+		return dst
+	}
+	b := bytesutil.ToUnsafeBytes(s)
+	if t.hashAlgo == "sha256" {
+		h := sha256.Sum256(b)
+		return hex.AppendEncode(dst, h[:])
+	}
+	h := xxhash.Sum64(b)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], h)
+	return hex.AppendEncode(dst, buf[:])
+}
+
+// getTransformedValues returns values for the column c transformed with bf.transform.
+func (br *blockResult) getTransformedValues(c *blockResultColumn, bf *byStatsField) []string {
+	values := c.getValues(br)
+
+	valuesBuf := br.valuesBuf
+	valuesBufLen := len(valuesBuf)
+	for i, v := range values {
+		if i > 0 && values[i-1] == v {
+			// Fast path - reuse the transformed value for the previous row.
+			valuesBuf = append(valuesBuf, valuesBuf[len(valuesBuf)-1])
+			continue
+		}
+		valuesBuf = append(valuesBuf, br.getTransformedValue(v, bf.transform))
+	}
+	br.valuesBuf = valuesBuf
+
+	return valuesBuf[valuesBufLen:]
+}
+
+// getTransformedValue returns s transformed with t.
+//
+// The returned value is valid until br is reset.
+func (br *blockResult) getTransformedValue(s string, t *byStatsFieldTransform) string {
+	if t.hashAlgo == "" {
+		return t.apply(s)
+	}
+	bufLen := len(br.a.b)
+	br.a.b = t.appendHash(br.a.b, s)
+	return bytesutil.ToUnsafeString(br.a.b[bufLen:])
+}
+
+// tryParseByStatsFieldHash parses 'hash(field)' or 'hash(field, algo)' in 'by (...)' clause of the stats pipe.
+//
+// It returns false if lex doesn't point to 'hash(', e.g. if 'hash' is a regular field name.
+func tryParseByStatsFieldHash(lex *lexer) (*byStatsField, bool, error) {
+	if !lex.isKeyword("hash") {
+		return nil, false, nil
+	}
+	lexState := lex.backupState()
+	lex.nextToken()
+	if !lex.isKeyword("(") {
+		lex.restoreState(lexState)
+		return nil, false, nil
+	}
+	lex.nextToken()
+
+	fieldName, err := getCompoundPhrase(lex, false)
+	if err != nil {
+		return nil, true, fmt.Errorf("cannot parse field name in 'hash(...)': %w", err)
+	}
+	fieldName = getCanonicalColumnName(fieldName)
+
+	hashAlgo := "xxhash"
+	if lex.isKeyword(",") {
+		lex.nextToken()
+		if !lex.isKeyword("xxhash", "sha256") {
+			return nil, true, fmt.Errorf("unexpected hash algorithm in 'hash(%s, %s)'; supported algorithms: xxhash, sha256", quoteTokenIfNeeded(fieldName), lex.token)
+		}
+		hashAlgo = strings.ToLower(lex.token)
+		lex.nextToken()
+	}
+	if !lex.isKeyword(")") {
+		return nil, true, fmt.Errorf("missing ')' after 'hash(%s'", quoteTokenIfNeeded(fieldName))
+	}
+	lex.nextToken()
+
+	t := &byStatsFieldTransform{
+		hashAlgo: hashAlgo,
+	}
+	bf := &byStatsField{
+		name:          fieldName,
+		bucketSizeStr: t.String(),
+		transform:     t,
+	}
+	return bf, true, nil
+}
+
+// parseByStatsFieldTransform parses 'prefix("prefix")' or 'split("separator", N)' transform for 'by (...)' field.
+func parseByStatsFieldTransform(lex *lexer, fieldName string) (*byStatsFieldTransform, error) {
+	switch {
+	case lex.isKeyword("prefix"):
+		lex.nextToken()
+		if !lex.isKeyword("(") {
+			return nil, fmt.Errorf("missing '(' after 'prefix' for field %q", fieldName)
+		}
+		lex.nextToken()
+		prefix, err := getCompoundToken(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'prefix' arg for field %q: %w", fieldName, err)
+		}
+		if prefix == "" {
+			return nil, fmt.Errorf("'prefix' arg for field %q cannot be empty", fieldName)
+		}
+		if !lex.isKeyword(")") {
+			return nil, fmt.Errorf("missing ')' after 'prefix(%s' for field %q", quoteTokenIfNeeded(prefix), fieldName)
+		}
+		lex.nextToken()
+		t := &byStatsFieldTransform{
+			prefix: prefix,
+		}
+		return t, nil
+	case lex.isKeyword("split"):
+		lex.nextToken()
+		if !lex.isKeyword("(") {
+			return nil, fmt.Errorf("missing '(' after 'split' for field %q", fieldName)
+		}
+		lex.nextToken()
+		separator, err := getCompoundToken(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse separator in 'split' for field %q: %w", fieldName, err)
+		}
+		if separator == "" {
+			return nil, fmt.Errorf("separator in 'split' for field %q cannot be empty", fieldName)
+		}
+		if !lex.isKeyword(",") {
+			return nil, fmt.Errorf("missing ',' after 'split(%s' for field %q", quoteTokenIfNeeded(separator), fieldName)
+		}
+		lex.nextToken()
+		segmentIdxStr := lex.token
+		segmentIdx, ok := tryParseUint64(segmentIdxStr)
+		if !ok || segmentIdx > 1<<20 {
+			return nil, fmt.Errorf("cannot parse segment index in 'split(%s, %s)' for field %q; it must be non-negative integer", quoteTokenIfNeeded(separator), segmentIdxStr, fieldName)
+		}
+		lex.nextToken()
+		if !lex.isKeyword(")") {
+			return nil, fmt.Errorf("missing ')' after 'split(%s, %d' for field %q", quoteTokenIfNeeded(separator), segmentIdx, fieldName)
+		}
+		lex.nextToken()
+		t := &byStatsFieldTransform{
+			isSplit:    true,
+			separator:  separator,
+			segmentIdx: int(segmentIdx),
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unexpected transform for field %q: %q; want 'prefix' or 'split'", fieldName, lex.token)
+	}
+}
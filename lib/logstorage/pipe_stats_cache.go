@@ -0,0 +1,294 @@
+package logstorage
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/lrucache"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+)
+
+// statsResultCache caches the results of `stats` pipes, so repeated queries such as dashboard refreshes
+// do not recalculate identical stats.
+//
+// The results are keyed by the canonical string representation of the query up to the `stats` pipe,
+// by the tenants, by the query time range, by the data generation and by the current ttl interval.
+// So every cached result becomes inaccessible when new data is ingested into partitions covering the query time range
+// (see Storage.getDataGeneration) or when the ttl interval ends. Inaccessible results are removed by the periodic cleaner
+// of the underlying lrucache.Cache, which removes results not accessed during the last few minutes.
+type statsResultCache struct {
+	// ttlSecs is the lifetime in seconds for the cached results.
+	ttlSecs uint64
+
+	c *lrucache.Cache
+}
+
+type statsResultCacheEntry struct {
+	// blocks contains the `stats` pipe results.
+	blocks []statsResultCacheBlock
+
+	// sizeBytes is the approximate size of the entry.
+	sizeBytes int
+}
+
+// SizeBytes implements lrucache.Entry interface
+func (e *statsResultCacheEntry) SizeBytes() int {
+	return e.sizeBytes
+}
+
+type statsResultCacheBlock struct {
+	rowsLen int
+	columns []resultColumn
+}
+
+func newStatsResultCache(ttl time.Duration) *statsResultCache {
+	if ttl <= 0 {
+		return nil
+	}
+	ttlSecs := uint64(ttl.Seconds() + 0.5)
+	if ttlSecs == 0 {
+		ttlSecs = 1
+	}
+	return &statsResultCache{
+		ttlSecs: ttlSecs,
+		c:       lrucache.NewCache(getStatsResultCacheMaxSizeBytes),
+	}
+}
+
+func getStatsResultCacheMaxSizeBytes() int {
+	return memory.Allowed() / 20
+}
+
+// MustStop stops the background cleaner for c.
+func (c *statsResultCache) MustStop() {
+	c.c.MustStop()
+}
+
+// getMaxEntrySizeBytes returns the maximum size of a single cached result.
+//
+// Bigger results aren't cached in order to leave space for other results in the sharded lrucache.Cache.
+func (c *statsResultCache) getMaxEntrySizeBytes() int {
+	return c.c.SizeMaxBytes() / 1024
+}
+
+// get returns cached results for the given key.
+func (c *statsResultCache) get(key string) ([]statsResultCacheBlock, bool) {
+	e := c.c.GetEntry(key)
+	if e == nil {
+		return nil, false
+	}
+	return e.(*statsResultCacheEntry).blocks, true
+}
+
+// set stores blocks with the given sizeBytes under the given key.
+func (c *statsResultCache) set(key string, blocks []statsResultCacheBlock, sizeBytes int) {
+	sizeBytes += len(key) + int(unsafe.Sizeof(statsResultCacheEntry{}))
+	e := &statsResultCacheEntry{
+		blocks:    blocks,
+		sizeBytes: sizeBytes,
+	}
+	c.c.PutEntry(key, e)
+}
+
+// statsResultCacheQuery contains information needed for caching the results of the `stats` pipe at q.pipes[pipeIdx].
+type statsResultCacheQuery struct {
+	pipeIdx int
+	key     string
+}
+
+// getStatsResultCacheQuery returns information for caching the results of the first `stats` pipe in q.
+//
+// qOrig must contain q before subqueries' initialization. nil is returned if the results cannot be cached.
+func (s *Storage) getStatsResultCacheQuery(tenantIDs []TenantID, qOrig, q *Query) *statsResultCacheQuery {
+	if s.statsResultCache == nil {
+		return nil
+	}
+
+	// Subqueries may select data outside the query time range, so the cached results cannot be invalidated properly for them.
+	if hasFilterInWithQueryForFilter(qOrig.f) || hasFilterInWithQueryForPipes(qOrig.pipes) || hasJoinPipes(qOrig.pipes) || hasUnionPipes(qOrig.pipes) {
+		return nil
+	}
+
+	pipeIdx := -1
+	for i, p := range q.pipes {
+		if _, ok := p.(*pipeStreamContext); ok {
+			return nil
+		}
+		if _, ok := p.(*pipeStats); ok {
+			pipeIdx = i
+			break
+		}
+	}
+	if pipeIdx < 0 {
+		return nil
+	}
+	ps := q.pipes[pipeIdx].(*pipeStats)
+	if ps.emitPartial {
+		// Partial results mustn't be cached.
+		return nil
+	}
+
+	minTimestamp, maxTimestamp := q.GetFilterTimeRange()
+
+	// Put the data generation and the current ttl interval into the key, so the cached results become inaccessible
+	// after new data is ingested into the query time range or after the ttl interval ends.
+	dataGeneration := s.getDataGeneration(minTimestamp, maxTimestamp)
+	ttlInterval := fasttime.UnixTimestamp() / s.statsResultCache.ttlSecs
+
+	var sb strings.Builder
+	sb.WriteString(strconv.FormatUint(dataGeneration, 10))
+	sb.WriteByte(',')
+	sb.WriteString(strconv.FormatUint(ttlInterval, 10))
+	sb.WriteByte(',')
+	for _, tenantID := range tenantIDs {
+		sb.WriteString(tenantID.String())
+		sb.WriteByte(',')
+	}
+	sb.WriteString(strconv.FormatInt(minTimestamp, 10))
+	sb.WriteByte(',')
+	sb.WriteString(strconv.FormatInt(maxTimestamp, 10))
+	sb.WriteByte(',')
+	sb.WriteString(q.f.String())
+	for _, p := range q.pipes[:pipeIdx+1] {
+		sb.WriteString(" | ")
+		sb.WriteString(p.String())
+	}
+	if ps.sortPipe != nil {
+		// The sort pipe limits the number of results returned from the `stats` pipe.
+		sb.WriteString(" | ")
+		sb.WriteString(ps.sortPipe.String())
+	}
+
+	return &statsResultCacheQuery{
+		pipeIdx: pipeIdx,
+		key:     sb.String(),
+	}
+}
+
+// dataGenerationSeq is used for generating unique data generations for datadb.
+var dataGenerationSeq atomic.Uint64
+
+// getDataGeneration returns the data generation for partitions covering [minTimestamp, maxTimestamp] time range.
+//
+// The returned value changes when new data is ingested into these partitions or when these partitions are created or dropped.
+func (s *Storage) getDataGeneration(minTimestamp, maxTimestamp int64) uint64 {
+	minDay := minTimestamp / nsecsPerDay
+	maxDay := maxTimestamp / nsecsPerDay
+
+	var buf []byte
+	s.partitionsLock.Lock()
+	for _, ptw := range s.partitions {
+		if ptw.day < minDay || ptw.day > maxDay {
+			continue
+		}
+		buf = encoding.MarshalInt64(buf, ptw.day)
+		buf = encoding.MarshalUint64(buf, ptw.pt.ddb.dataGeneration.Load())
+	}
+	s.partitionsLock.Unlock()
+
+	return xxhash.Sum64(buf)
+}
+
+// statsResultCacheRecorder records the results of the `stats` pipe before passing them to ppNext.
+type statsResultCacheRecorder struct {
+	ppNext pipeProcessor
+
+	// maxSizeBytes is the maximum size of the recorded results.
+	maxSizeBytes int
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	blocks    []statsResultCacheBlock
+	sizeBytes int
+
+	// isTooBig is set if the results exceed maxSizeBytes.
+	isTooBig bool
+}
+
+func newStatsResultCacheRecorder(ppNext pipeProcessor, maxSizeBytes int) *statsResultCacheRecorder {
+	return &statsResultCacheRecorder{
+		ppNext:       ppNext,
+		maxSizeBytes: maxSizeBytes,
+	}
+}
+
+func (r *statsResultCacheRecorder) writeBlock(workerID uint, br *blockResult) {
+	r.recordBlock(br)
+	r.ppNext.writeBlock(workerID, br)
+}
+
+func (r *statsResultCacheRecorder) recordBlock(br *blockResult) {
+	if br.rowsLen == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isTooBig {
+		return
+	}
+
+	cs := br.getColumns()
+	sizeBytes := int(unsafe.Sizeof(statsResultCacheBlock{}))
+	columns := make([]resultColumn, len(cs))
+	for i, c := range cs {
+		values := c.getValues(br)
+		valuesCopy := make([]string, len(values))
+		for j, v := range values {
+			if j > 0 && values[j-1] == v {
+				valuesCopy[j] = valuesCopy[j-1]
+				continue
+			}
+			valuesCopy[j] = strings.Clone(v)
+			sizeBytes += len(v)
+		}
+		columns[i] = resultColumn{
+			name:   strings.Clone(c.name),
+			values: valuesCopy,
+		}
+		sizeBytes += len(c.name) + len(values)*int(unsafe.Sizeof(""))
+	}
+
+	if r.sizeBytes+sizeBytes > r.maxSizeBytes {
+		r.isTooBig = true
+		r.blocks = nil
+		return
+	}
+	r.blocks = append(r.blocks, statsResultCacheBlock{
+		rowsLen: br.rowsLen,
+		columns: columns,
+	})
+	r.sizeBytes += sizeBytes
+}
+
+func (r *statsResultCacheRecorder) flush() error {
+	return nil
+}
+
+// writeStatsResultCacheBlocks writes the cached blocks to pp.
+func writeStatsResultCacheBlocks(pp pipeProcessor, blocks []statsResultCacheBlock, stopCh <-chan struct{}) {
+	var br blockResult
+	var rcs []resultColumn
+	for _, b := range blocks {
+		if needStop(stopCh) {
+			return
+		}
+		rcs = rcs[:0]
+		for _, c := range b.columns {
+			rcs = appendResultColumnWithName(rcs, c.name)
+			rcs[len(rcs)-1].values = c.values
+		}
+		br.setResultColumns(rcs, b.rowsLen)
+		pp.writeBlock(0, &br)
+	}
+}
@@ -0,0 +1,174 @@
+package logstorage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestStorageRunQueryStatsResultCache(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	sc := &StorageConfig{
+		Retention:           24 * time.Hour,
+		StatsResultCacheTTL: time.Hour,
+	}
+	s := MustOpenStorage(path, sc)
+
+	tenantID := TenantID{
+		AccountID: 0,
+		ProjectID: 0,
+	}
+	rowsAdded := 0
+	addRows := func(rowsCount int) {
+		t.Helper()
+
+		lr := GetLogRows(nil, nil, nil, "")
+		timestamp := time.Now().UnixNano()
+		for i := 0; i < rowsCount; i++ {
+			fields := []Field{
+				{
+					Name:  "_msg",
+					Value: fmt.Sprintf("message %d", rowsAdded),
+				},
+				{
+					Name:  "x",
+					Value: fmt.Sprintf("%d", rowsAdded),
+				},
+			}
+			lr.MustAdd(tenantID, timestamp+int64(i), fields, nil)
+			rowsAdded++
+		}
+		s.MustAddRows(lr)
+		PutLogRows(lr)
+	}
+
+	runQuery := func(query string) []string {
+		t.Helper()
+
+		q := mustParseQuery(query)
+		var resultLock sync.Mutex
+		var result []string
+		writeBlock := func(_ uint, _ []int64, bcs []BlockColumn) {
+			resultLock.Lock()
+			for _, bc := range bcs {
+				for _, v := range bc.Values {
+					result = append(result, bc.Name+"="+v)
+				}
+			}
+			resultLock.Unlock()
+		}
+		if err := s.RunQuery(context.Background(), []TenantID{tenantID}, q, writeBlock); err != nil {
+			t.Fatalf("unexpected error in query [%s]: %s", query, err)
+		}
+		return result
+	}
+
+	f := func(query, resultExpected string, requestsExpected, missesExpected uint64) {
+		t.Helper()
+
+		result := runQuery(query)
+		if len(result) != 1 || result[0] != resultExpected {
+			t.Fatalf("unexpected result for [%s]; got %q; want %q", query, result, resultExpected)
+		}
+
+		var ss StorageStats
+		s.UpdateStats(&ss)
+		if ss.StatsResultCacheRequests != requestsExpected {
+			t.Fatalf("unexpected cache requests after [%s]; got %d; want %d", query, ss.StatsResultCacheRequests, requestsExpected)
+		}
+		if ss.StatsResultCacheMisses != missesExpected {
+			t.Fatalf("unexpected cache misses after [%s]; got %d; want %d", query, ss.StatsResultCacheMisses, missesExpected)
+		}
+	}
+
+	addRows(10)
+
+	// The first query results must be cached
+	f(`* | stats count() rows`, "rows=10", 1, 1)
+	f(`* | stats count() rows`, "rows=10", 2, 1)
+
+	// Pipes after the `stats` pipe must be applied to the cached results
+	f(`* | stats count() rows | math rows*2 as rows`, "rows=20", 3, 1)
+
+	// The cache is keyed by the canonical query representation, so the 'count()' shorthand for 'stats count()' uses the cached results
+	f(`* | count() rows | fields x`, "x=", 4, 1)
+
+	// Queries without `stats` pipe do not use the cache
+	f(`* | x:=5 | fields x`, "x=5", 4, 1)
+
+	// Incomplete results mustn't be cached
+	for i := 0; i < 2; i++ {
+		result := runQuery(`* | stats by (x) count() rows | limit 1 | fields rows`)
+		if len(result) != 1 || result[0] != "rows=1" {
+			t.Fatalf("unexpected result for the query with limit; got %q", result)
+		}
+	}
+	var ss StorageStats
+	s.UpdateStats(&ss)
+	if ss.StatsResultCacheMisses != 3 {
+		t.Fatalf("unexpected cache misses for the query with limit; got %d; want 3", ss.StatsResultCacheMisses)
+	}
+
+	// Newly ingested data must invalidate the cached results
+	addRows(1)
+	f(`* | stats count() rows`, "rows=11", 7, 4)
+	f(`* | stats count() rows`, "rows=11", 8, 4)
+
+	s.MustClose()
+	fs.MustRemoveAll(path)
+}
+
+func TestStorageRunQueryStatsResultCacheExpiration(t *testing.T) {
+	t.Parallel()
+
+	path := t.Name()
+	sc := &StorageConfig{
+		Retention:           24 * time.Hour,
+		StatsResultCacheTTL: time.Second,
+	}
+	s := MustOpenStorage(path, sc)
+
+	tenantIDs := []TenantID{{}}
+	lr := GetLogRows(nil, nil, nil, "")
+	lr.MustAdd(tenantIDs[0], time.Now().UnixNano(), []Field{{Name: "_msg", Value: "foo"}}, nil)
+	s.MustAddRows(lr)
+	PutLogRows(lr)
+
+	f := func(missesExpected uint64) {
+		t.Helper()
+
+		q := mustParseQuery(`* | stats count() rows`)
+		writeBlock := func(_ uint, _ []int64, _ []BlockColumn) {}
+		if err := s.RunQuery(context.Background(), tenantIDs, q, writeBlock); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		var ss StorageStats
+		s.UpdateStats(&ss)
+		if ss.StatsResultCacheMisses != missesExpected {
+			t.Fatalf("unexpected cache misses; got %d; want %d", ss.StatsResultCacheMisses, missesExpected)
+		}
+	}
+
+	// Wait for the beginning of the next ttl interval, so the cached results do not expire between the first two queries.
+	tStart := fasttime.UnixTimestamp()
+	for fasttime.UnixTimestamp() == tStart {
+		time.Sleep(10 * time.Millisecond)
+	}
+	f(1)
+	f(1)
+
+	// The cached results must expire after the ttl
+	time.Sleep(2 * time.Second)
+	f(2)
+
+	s.MustClose()
+	fs.MustRemoveAll(path)
+}
@@ -0,0 +1,143 @@
+package logstorage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// funcString returns string representation of f.f with the optional explode(...) arg.
+func (f *pipeStatsFunc) funcString() string {
+	s := f.f.String()
+	if f.explodeField == "" {
+		return s
+	}
+	arg := "(" + quoteTokenIfNeeded(f.explodeField) + ")"
+	return strings.Replace(s, arg, "(explode"+arg+")", 1)
+}
+
+// rewriteStatsFuncExplode checks whether lex points to 'func_name(explode(field))' and rewrites it to 'func_name(field)',
+// so it could be parsed by parseStatsFunc.
+//
+// It returns the exploded field name if the rewrite has been performed. Otherwise an empty string is returned
+// and lex remains unchanged.
+func rewriteStatsFuncExplode(lex *lexer) (string, error) {
+	ls := lex.backupState()
+	funcName := lex.token
+	funcNameRaw := lex.rawToken
+
+	lex.nextToken()
+	if !lex.isKeyword("(") {
+		lex.restoreState(ls)
+		return "", nil
+	}
+	lex.nextToken()
+	if !lex.isKeyword("explode") {
+		lex.restoreState(ls)
+		return "", nil
+	}
+	lex.nextToken()
+	if !lex.isKeyword("(") {
+		// The field with 'explode' name
+		lex.restoreState(ls)
+		return "", nil
+	}
+	lex.nextToken()
+
+	field, err := parseFieldName(lex)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse 'explode' arg for %q: %w", funcName, err)
+	}
+	if field == "*" {
+		return "", fmt.Errorf("'explode(*)' isn't supported at %q; explode the needed field instead", funcName)
+	}
+	if !lex.isKeyword(")") {
+		return "", fmt.Errorf("missing ')' after 'explode(%s' at %q", quoteTokenIfNeeded(field), funcName)
+	}
+	lex.nextToken()
+	if !lex.isKeyword(")") {
+		return "", fmt.Errorf("'explode(%s)' must be the only arg of %q", quoteTokenIfNeeded(field), funcName)
+	}
+	lex.nextToken()
+
+	// Rewrite lex, so it points to 'func_name(field)' followed by the remaining query.
+	tail := lex.rawToken + lex.s
+	if lex.isSkippedSpace {
+		tail = " " + tail
+	}
+	lex.s = "(" + quoteTokenIfNeeded(field) + ")" + tail
+	lex.token = funcName
+	lex.rawToken = funcNameRaw
+	lex.isSkippedSpace = ls.lex.isSkippedSpace
+
+	return field, nil
+}
+
+// statsExploder splits JSON arrays into distinct elements for stats functions with explode(field) arg.
+type statsExploder struct {
+	a      arena
+	values []string
+	rcs    []resultColumn
+	br     blockResult
+}
+
+// explodeAllRows returns a block with the single column containing exploded values of the given field for rows set in bm.
+//
+// All the rows are exploded if bm is nil.
+//
+// The returned block is valid until the next call to se.
+func (se *statsExploder) explodeAllRows(br *blockResult, field string, bm *bitmap) *blockResult {
+	se.reset()
+
+	c := br.getColumnByName(field)
+	values := c.getValues(br)
+	for rowIdx, v := range values {
+		if bm != nil && !bm.isSetBit(rowIdx) {
+			continue
+		}
+		se.values = explodeValue(se.values, &se.a, v)
+	}
+	return se.getBlockResult(field)
+}
+
+// explodeRow returns a block with the single column containing exploded value of the given field at rowIdx.
+//
+// The returned block is valid until the next call to se.
+func (se *statsExploder) explodeRow(br *blockResult, field string, rowIdx int) *blockResult {
+	se.reset()
+
+	c := br.getColumnByName(field)
+	v := c.getValueAtRow(br, rowIdx)
+	se.values = explodeValue(se.values, &se.a, v)
+	return se.getBlockResult(field)
+}
+
+func (se *statsExploder) reset() {
+	se.a.reset()
+	se.values = se.values[:0]
+}
+
+func (se *statsExploder) getBlockResult(field string) *blockResult {
+	se.rcs = appendResultColumnWithName(se.rcs[:0], field)
+	se.rcs[0].values = se.values
+	se.br.setResultColumns(se.rcs, len(se.values))
+	return &se.br
+}
+
+// explodeValue appends elements of JSON array v to dst and returns the result.
+//
+// Non-array v is appended to dst as a single element.
+func explodeValue(dst []string, a *arena, v string) []string {
+	dstLen := len(dst)
+	dst = unpackJSONArray(dst, a, v)
+	if len(dst) > dstLen || isEmptyJSONArray(v) {
+		return dst
+	}
+	return append(dst, v)
+}
+
+func isEmptyJSONArray(s string) bool {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return false
+	}
+	return strings.TrimSpace(s[1:len(s)-1]) == ""
+}
@@ -0,0 +1,32 @@
+package logstorage
+
+import (
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	// statsPipeMemoryLimitHits is the number of `stats` pipes canceled because of the exhausted memory limit.
+	statsPipeMemoryLimitHits = metrics.NewCounter(`vl_stats_pipe_memory_limit_hits_total`)
+
+	// statsPipePeakGroups is the maximum number of groups calculated by a single `stats` pipe since the process start.
+	statsPipePeakGroups atomic.Uint64
+
+	_ = metrics.NewGauge(`vl_stats_pipe_peak_groups`, func() float64 {
+		return float64(statsPipePeakGroups.Load())
+	})
+)
+
+// updateStatsPipePeakGroups updates statsPipePeakGroups with the given groupsCount if it exceeds the current peak.
+func updateStatsPipePeakGroups(groupsCount uint64) {
+	for {
+		n := statsPipePeakGroups.Load()
+		if groupsCount <= n {
+			return
+		}
+		if statsPipePeakGroups.CompareAndSwap(n, groupsCount) {
+			return
+		}
+	}
+}
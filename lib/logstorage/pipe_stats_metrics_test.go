@@ -0,0 +1,57 @@
+package logstorage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPipeStatsMetrics(t *testing.T) {
+	f := func(maxStateSizePercent float64, rowsCount int, memoryLimitHitsExpected uint64) {
+		t.Helper()
+
+		q, err := ParseQuery("* | stats by (a) count() as hits")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := q.SetStatsMaxStateSizePercent(maxStateSizePercent); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		memoryLimitHitsPrev := statsPipeMemoryLimitHits.Get()
+
+		workersCount := 1
+		stopCh := make(chan struct{})
+		cancel := func() {}
+		ppTest := newTestPipeProcessor()
+		pp := q.pipes[0].newPipeProcessor(workersCount, stopCh, cancel, ppTest)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for i := 0; i < rowsCount; i++ {
+			brw.writeRow([]Field{
+				{"a", fmt.Sprintf("%d", i)},
+			})
+		}
+		brw.flush()
+		err = pp.flush()
+
+		memoryLimitHits := statsPipeMemoryLimitHits.Get() - memoryLimitHitsPrev
+		if memoryLimitHits != memoryLimitHitsExpected {
+			t.Fatalf("unexpected memory limit hits; got %d; want %d", memoryLimitHits, memoryLimitHitsExpected)
+		}
+		if memoryLimitHits > 0 {
+			if err == nil {
+				t.Fatalf("expecting non-nil error when the memory limit is exceeded")
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n := statsPipePeakGroups.Load(); n < uint64(rowsCount) {
+			t.Fatalf("unexpected peak groups; got %d; want at least %d", n, rowsCount)
+		}
+	}
+
+	f(40, 1234, 0)
+	f(1e-9, 1234, 1)
+}
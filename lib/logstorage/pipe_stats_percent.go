@@ -0,0 +1,248 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// hasPercentBuckets returns true if ps contains 'by (field:N%)' buckets.
+func (ps *pipeStats) hasPercentBuckets() bool {
+	for _, bf := range ps.byFields {
+		if bf.bucketSizePercent > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newPipeStatsPercentProcessor returns processor for ps with 'by (field:N%)' buckets.
+//
+// The bucket size for such fields depends on the range of field values across all the input rows,
+// so the stats are calculated in two passes:
+//
+//   - The first pass buffers all the input blocks and tracks min and max values for the fields with percent buckets.
+//   - The second pass feeds the buffered blocks to the ordinary pipeStats processor with the resolved bucket sizes.
+//
+// This requires additional memory for buffering all the input blocks and additional CPU time for parsing
+// the values of fields with percent buckets. That's why it is used only if percent buckets are present in the query,
+// so the ordinary queries aren't affected.
+func newPipeStatsPercentProcessor(ps *pipeStats, workersCount int, stopCh <-chan struct{}, cancel func(), ppNext pipeProcessor) pipeProcessor {
+	// Buffered blocks may occupy up to a half of the memory allowed for ps, since the remaining half is needed for the second pass.
+	maxStateSize := ps.getMaxStateSize() / 2
+
+	shards := make([]pipeStatsPercentProcessorShard, workersCount)
+	for i := range shards {
+		shard := &shards[i]
+		shard.ps = ps
+		shard.minValues = make([]float64, len(ps.byFields))
+		shard.maxValues = make([]float64, len(ps.byFields))
+		for j := range ps.byFields {
+			shard.minValues[j] = math.Inf(1)
+			shard.maxValues[j] = math.Inf(-1)
+		}
+	}
+
+	pspp := &pipeStatsPercentProcessor{
+		ps:     ps,
+		stopCh: stopCh,
+		cancel: cancel,
+		ppNext: ppNext,
+
+		shards: shards,
+
+		maxStateSize: maxStateSize,
+	}
+	pspp.stateSizeBudget.Store(maxStateSize)
+
+	return pspp
+}
+
+type pipeStatsPercentProcessor struct {
+	ps     *pipeStats
+	stopCh <-chan struct{}
+	cancel func()
+	ppNext pipeProcessor
+
+	shards []pipeStatsPercentProcessorShard
+
+	maxStateSize    int64
+	stateSizeBudget atomic.Int64
+}
+
+type pipeStatsPercentProcessorShard struct {
+	pipeStatsPercentProcessorShardNopad
+
+	// The padding prevents false sharing on widespread platforms with 128 mod (cache line size) = 0 .
+	_ [128 - unsafe.Sizeof(pipeStatsPercentProcessorShardNopad{})%128]byte
+}
+
+type pipeStatsPercentProcessorShardNopad struct {
+	ps *pipeStats
+
+	// blocks contains the buffered blocks for the second pass.
+	blocks []*blockResult
+
+	// minValues and maxValues contain min and max values per every ps.byFields entry with percent bucket.
+	minValues []float64
+	maxValues []float64
+
+	stateSizeBudget int
+}
+
+func (shard *pipeStatsPercentProcessorShard) writeBlock(br *blockResult) {
+	// clone br, so it could be owned by shard
+	br = br.clone()
+	shard.stateSizeBudget -= br.sizeBytes() + int(unsafe.Sizeof(br))
+	shard.blocks = append(shard.blocks, br)
+
+	for i, bf := range shard.ps.byFields {
+		if bf.bucketSizePercent <= 0 {
+			continue
+		}
+
+		minValue := shard.minValues[i]
+		maxValue := shard.maxValues[i]
+
+		c := br.getColumnByName(bf.name)
+		if c.isTime {
+			for _, ts := range br.getTimestamps() {
+				f := float64(ts)
+				minValue = min(minValue, f)
+				maxValue = max(maxValue, f)
+			}
+		} else {
+			for _, v := range c.getValues(br) {
+				f, ok := tryParseBucketableValue(v)
+				if !ok {
+					continue
+				}
+				minValue = min(minValue, f)
+				maxValue = max(maxValue, f)
+			}
+		}
+
+		shard.minValues[i] = minValue
+		shard.maxValues[i] = maxValue
+	}
+}
+
+func (pspp *pipeStatsPercentProcessor) writeBlock(workerID uint, br *blockResult) {
+	if br.rowsLen == 0 {
+		return
+	}
+
+	shard := &pspp.shards[workerID]
+
+	for shard.stateSizeBudget < 0 {
+		// steal some budget for the state size from the global budget.
+		remaining := pspp.stateSizeBudget.Add(-stateSizeBudgetChunk)
+		if remaining < 0 {
+			// The state size is too big. Stop processing data in order to avoid OOM crash.
+			if remaining+stateSizeBudgetChunk >= 0 {
+				// Notify worker goroutines to stop calling writeBlock() in order to save CPU time.
+				statsPipeMemoryLimitHits.Inc()
+				pspp.cancel()
+			}
+			return
+		}
+		shard.stateSizeBudget += stateSizeBudgetChunk
+	}
+
+	shard.writeBlock(br)
+}
+
+func (pspp *pipeStatsPercentProcessor) flush() error {
+	if n := pspp.stateSizeBudget.Load(); n <= 0 {
+		return fmt.Errorf("cannot calculate [%s], since it requires more than %dMB of memory", pspp.ps.String(), pspp.maxStateSize/(1<<20))
+	}
+
+	// Resolve percent buckets into ordinary buckets according to the collected min and max values.
+	ps := pspp.ps
+	byFields := make([]*byStatsField, len(ps.byFields))
+	for i, bf := range ps.byFields {
+		if bf.bucketSizePercent <= 0 {
+			byFields[i] = bf
+			continue
+		}
+
+		minValue := math.Inf(1)
+		maxValue := math.Inf(-1)
+		for j := range pspp.shards {
+			shard := &pspp.shards[j]
+			minValue = min(minValue, shard.minValues[i])
+			maxValue = max(maxValue, shard.maxValues[i])
+		}
+
+		bfNew := *bf
+		bfNew.bucketSizePercent = 0
+		bfNew.bucketSize = 0
+		if minValue < maxValue {
+			bfNew.bucketSize = (maxValue - minValue) * bf.bucketSizePercent / 100
+		}
+		byFields[i] = &bfNew
+	}
+	psNew := *ps
+	psNew.byFields = byFields
+
+	// Feed the buffered blocks to the ordinary pipeStats processor.
+	psp := psNew.newPipeProcessor(len(pspp.shards), pspp.stopCh, pspp.cancel, pspp.ppNext)
+
+	stopCh := pspp.stopCh
+	if ps.emitPartial {
+		// Feed all the buffered blocks to psp, so it could return partial results if the query has been canceled.
+		stopCh = nil
+	}
+
+	var wg sync.WaitGroup
+	for i := range pspp.shards {
+		wg.Add(1)
+		go func(workerID uint) {
+			defer wg.Done()
+
+			shard := &pspp.shards[workerID]
+			for j, br := range shard.blocks {
+				if needStop(stopCh) {
+					return
+				}
+				psp.writeBlock(workerID, br)
+
+				// Release the processed block, so it could be garbage collected.
+				shard.blocks[j] = nil
+			}
+			shard.blocks = nil
+		}(uint(i))
+	}
+	wg.Wait()
+
+	if needStop(stopCh) {
+		return nil
+	}
+
+	return psp.flush()
+}
+
+// tryParseBucketableValue tries parsing s into a number for determining the range of values
+// for percent buckets.
+//
+// The parsing order must be consistent with blockResult.getBucketedValue.
+func tryParseBucketableValue(s string) (float64, bool) {
+	if n, ok := tryParseInt64(s); ok {
+		return float64(n), true
+	}
+	if f, ok := tryParseFloat64(s); ok {
+		return f, true
+	}
+	if timestamp, ok := TryParseTimestampRFC3339Nano(s); ok {
+		return float64(timestamp), true
+	}
+	if n, ok := tryParseIPv4(s); ok {
+		return float64(n), true
+	}
+	if nsecs, ok := tryParseDuration(s); ok {
+		return float64(nsecs), true
+	}
+	return 0, false
+}
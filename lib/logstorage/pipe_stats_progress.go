@@ -0,0 +1,66 @@
+package logstorage
+
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+)
+
+// StatsProgress contains progress information for the `stats` pipe.
+type StatsProgress struct {
+	// GroupsCount is the number of groups accumulated by the `stats` pipe so far.
+	GroupsCount uint64
+
+	// StateSizeBytes is the approximate memory in bytes used by the `stats` pipe state so far.
+	StateSizeBytes int64
+
+	// MaxStateSizeBytes is the maximum memory in bytes, which can be used by the `stats` pipe state.
+	MaxStateSizeBytes int64
+}
+
+// StatsProgressFunc is called periodically while the `stats` pipe processes the input rows.
+//
+// It may be called concurrently from multiple goroutines, so it must be thread-safe.
+// It must return quickly, since it is called from the goroutines, which process the input rows.
+type StatsProgressFunc func(p *StatsProgress)
+
+// statsProgressInterval is the minimum interval in seconds between StatsProgressFunc calls for a single `stats` pipe.
+const statsProgressInterval = 1
+
+// reportProgressIfNeeded calls psp.ps.progressFunc if at least statsProgressInterval seconds passed since the previous call.
+//
+// It must be called after the shard at workerID has finished processing the block.
+func (psp *pipeStatsProcessor) reportProgressIfNeeded(workerID uint) {
+	shard := &psp.shards[workerID]
+	shard.groupsCount.Store(shard.getGroupsCount())
+
+	currentTime := fasttime.UnixTimestamp()
+	lastReportTime := psp.progressLastReportTime.Load()
+	if lastReportTime > 0 && currentTime < lastReportTime+statsProgressInterval {
+		return
+	}
+	if !psp.progressLastReportTime.CompareAndSwap(lastReportTime, currentTime) {
+		// Another goroutine is reporting the progress.
+		return
+	}
+
+	groupsCount := uint64(0)
+	for i := range psp.shards {
+		groupsCount += psp.shards[i].groupsCount.Load()
+	}
+	p := &StatsProgress{
+		GroupsCount:       groupsCount,
+		StateSizeBytes:    psp.maxStateSize - psp.stateSizeBudget.Load(),
+		MaxStateSizeBytes: psp.maxStateSize,
+	}
+	psp.ps.progressFunc(p)
+}
+
+// getGroupsCount returns the number of groups tracked by the shard.
+//
+// It must be called from the goroutine, which owns the shard.
+func (shard *pipeStatsProcessorShard) getGroupsCount() uint64 {
+	n := shard.groupMap.entriesCount()
+	for i := range shard.groupMapShards {
+		n += shard.groupMapShards[i].entriesCount()
+	}
+	return n
+}
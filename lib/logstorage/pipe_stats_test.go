@@ -1,7 +1,12 @@
 package logstorage
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
 )
 
 func TestParsePipeStatsSuccess(t *testing.T) {
@@ -14,6 +19,37 @@ func TestParsePipeStatsSuccess(t *testing.T) {
 	f(`stats by (x) count(*) as rows, count_uniq(x) as uniqs`)
 	f(`stats by (_time:month offset 6.5h, y) count(*) as rows, count_uniq(x) as uniqs`)
 	f(`stats by (_time:month offset 6.5h, y) count(*) if (q:w) as rows, count_uniq(x) as uniqs`)
+	f(`stats by (x:5%) count(*) as rows`)
+	f(`stats by (x:2.5% offset 1, y) count(*) as rows`)
+	f(`stats by (url:prefix("/api/")) count(*) as rows`)
+	f(`stats by (name:split(".", 0), y) count(*) as rows`)
+	f(`stats by (name:split("::", 2)) count(*) as rows`)
+	f(`stats by (_time:hour_of_day) count(*) as rows`)
+	f(`stats by (_time:hour_of_day tz "Europe/Berlin") count(*) as rows`)
+	f(`stats by (_time:hour_of_day offset 30m tz UTC, x) count(*) as rows`)
+	f(`stats by (_time:day_of_week) count(*) as rows`)
+	f(`stats by (ip:/64) count(*) as rows`)
+	f(`stats by (hash(user_id)) count(*) as rows`)
+	f(`stats by (hash(user_id, sha256), x) count(*) as rows`)
+	f(`stats by ("hash", x) count(*) as rows`)
+	f(`stats by (_time:1h as hour) count(*) as rows`)
+	f(`stats by (_time:1h offset 30m as hour, x as y) count(*) as rows`)
+	f(`stats by (hash(user_id) as user, url:prefix("/api/") as api) count(*) as rows`)
+	f(`stats by (x as "a b") count(*) as rows`)
+	f(`stats by (ip:/128) count(*) as rows`)
+	f(`stats count_uniq(explode(tags)) as rows`)
+	f(`stats by (x) count_uniq(explode(tags)) limit 10 as rows, values(explode("a b")) if (x:y) as z`)
+	f(`stats count(explode) as rows`)
+	f(`stats by (_time:day_of_week tz "America/New_York", _time:hour_of_day) count(*) as rows`)
+	f(`stats partial count(*) as rows`)
+	f(`stats partial by (x) count(*) as rows`)
+	f(`stats window by (_time:1m) count(*) as rows`)
+	f(`stats window by (_time:5m offset 30s, x) count(*) as rows`)
+	f(`stats partial window by (x, _time:1h) count(*) as rows`)
+	f(`stats count(*) if (status:>=500) with_excluded as errs`)
+	f(`stats by (x) count(*) if (a:b) with_excluded as rows, sum(y) if (c:d) with_excluded as total`)
+	f(`stats avg(x) with_count as a`)
+	f(`stats by (x) avg(y) if (a:b) with_excluded with_count as a, avg(z) weighted by (w) with_count as b`)
 }
 
 func TestParsePipeStatsFailure(t *testing.T) {
@@ -31,6 +67,58 @@ func TestParsePipeStatsFailure(t *testing.T) {
 	f(`stats by(x:abc) count() rows`)
 	f(`stats by(x:1h offset) count () rows`)
 	f(`stats by(x:1h offset foo) count() rows`)
+	f(`stats by(x:0%) count() rows`)
+	f(`stats by(x:101%) count() rows`)
+	f(`stats by(x:foo%) count() rows`)
+	f(`stats by(_time:hour_of_day tz) count() rows`)
+	f(`stats by(_time:hour_of_day tz "Foo/Bar") count() rows`)
+	f(`stats by(_time:1h tz UTC) count() rows`)
+	f(`stats by(ip:/129) count() rows`)
+	f(`stats count_uniq(explode(*)) rows`)
+	f(`stats count_uniq(explode(a, b)) rows`)
+	f(`stats count_uniq(explode(a), b) rows`)
+	f(`stats count_uniq(explode()) rows`)
+	f(`stats countif`)
+	f(`stats countif(a:b`)
+	f(`stats countif(a:b) if (c:d) rows`)
+	f(`stats partial`)
+	f(`stats partial partial count() rows`)
+	f(`stats by (x) partial count() rows`)
+	f(`stats by(x:prefix) count() rows`)
+	f(`stats by(x:prefix()) count() rows`)
+	f(`stats by(x:prefix("")) count() rows`)
+	f(`stats by(x:prefix(a, b)) count() rows`)
+	f(`stats by(x:prefix(a) offset 1) count() rows`)
+	f(`stats by(x:split(".")) count() rows`)
+	f(`stats by(x:split("", 0)) count() rows`)
+	f(`stats by(x:split(".", -1)) count() rows`)
+	f(`stats by(x:split(".", foo)) count() rows`)
+	f(`stats by(x:split(".", 1, 2)) count() rows`)
+	f(`stats by(hash()) count() rows`)
+	f(`stats by(hash(x, md5)) count() rows`)
+	f(`stats by(hash(x, sha256, y)) count() rows`)
+	f(`stats by(hash(x) y) count() rows`)
+	f(`stats by(hash(x):10) count() rows`)
+	f(`stats by(x as) count() rows`)
+	f(`stats by(x as y z) count() rows`)
+	f(`stats by(x as y, z as y) count() rows`)
+	f(`stats by(x as y, y) count() rows`)
+	f(`stats by(x as y) count() y`)
+	f(`stats window count() rows`)
+	f(`stats window by (x) count() rows`)
+	f(`stats window by (_time) count() rows`)
+	f(`stats window by (_time:month) count() rows`)
+	f(`stats window by (_time:hour_of_day) count() rows`)
+	f(`stats window by (_time:5%) count() rows`)
+	f(`stats window partial by (_time:1m) count() rows`)
+	f(`stats by (_time:1m) window count() rows`)
+	f(`stats count() with_excluded rows`)
+	f(`stats count() if (a:b) with_excluded rows, count() rows_excluded`)
+	f(`stats by (rows_excluded) count() if (a:b) with_excluded rows`)
+	f(`stats count() with_count rows`)
+	f(`stats avg(x) with_count a, count() a_count`)
+	f(`stats by (a_count) avg(x) with_count a`)
+	f(`stats avg(x) with_count with_excluded a`)
 }
 
 func TestPipeStats(t *testing.T) {
@@ -103,6 +191,28 @@ func TestPipeStats(t *testing.T) {
 		},
 	})
 
+	f("stats count() as rows, countif(a:2) rows2, countif(b:>10)", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1`},
+		},
+		{
+			{"a", `2`},
+			{"b", `54`},
+		},
+	}, [][]Field{
+		{
+			{"rows", "3"},
+			{"rows2", "2"},
+			{"count(*) if (b:>10)", "1"},
+		},
+	})
+
 	f("stats count(*) as rows", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -464,51 +574,1504 @@ func TestPipeStats(t *testing.T) {
 	})
 }
 
-func TestPipeStatsUpdateNeededFields(t *testing.T) {
-	f := func(s, neededFields, unneededFields, neededFieldsExpected, unneededFieldsExpected string) {
+func TestPipeStatsPercentBuckets(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
 		t.Helper()
-		expectPipeNeededFields(t, s, neededFields, unneededFields, neededFieldsExpected, unneededFieldsExpected)
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
 	}
 
-	// all the needed fields
-	f("stats count() r1", "*", "", "", "")
-	f("stats count(*) r1", "*", "", "", "")
-	f("stats count(f1,f2) r1", "*", "", "f1,f2", "")
-	f("stats count(f1,f2) r1, sum(f3,f4) r2", "*", "", "f1,f2,f3,f4", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "*", "", "b1,b2,f1,f2", "")
-	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "*", "", "b1,b2,f1,f2,f3", "")
+	var rows [][]Field
+	for i := 0; i <= 10; i++ {
+		rows = append(rows, []Field{
+			{"a", fmt.Sprintf("%d", i)},
+		})
+	}
+	rows = append(rows, []Field{
+		{"a", "foo"},
+	})
 
-	// all the needed fields, unneeded fields do not intersect with stats fields
-	f("stats count() r1", "*", "f1,f2", "", "")
-	f("stats count(*) r1", "*", "f1,f2", "", "")
-	f("stats count(f1,f2) r1", "*", "f3,f4", "f1,f2", "")
-	f("stats count(f1,f2) r1, sum(f3,f4) r2", "*", "f5,f6", "f1,f2,f3,f4", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "*", "f3,f4", "b1,b2,f1,f2", "")
-	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "*", "f4,f5", "b1,b2,f1,f2,f3", "")
+	f("stats by (a:20%) count() as rows", rows, [][]Field{
+		{
+			{"a", "0"},
+			{"rows", "2"},
+		},
+		{
+			{"a", "2"},
+			{"rows", "2"},
+		},
+		{
+			{"a", "4"},
+			{"rows", "2"},
+		},
+		{
+			{"a", "6"},
+			{"rows", "2"},
+		},
+		{
+			{"a", "8"},
+			{"rows", "2"},
+		},
+		{
+			{"a", "10"},
+			{"rows", "1"},
+		},
+		{
+			{"a", "foo"},
+			{"rows", "1"},
+		},
+	})
 
-	// all the needed fields, unneeded fields intersect with stats fields
-	f("stats count() r1", "*", "r1,r2", "", "")
-	f("stats count(*) r1", "*", "r1,r2", "", "")
-	f("stats count(f1,f2) r1", "*", "r1,r2", "", "")
-	f("stats count(f1,f2) r1, sum(f3,f4) r2", "*", "r1,r3", "f3,f4", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "*", "r1,r2", "b1,b2", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "*", "r1,r2,b1", "b1,b2", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "*", "r1,r2,b1,b2", "b1,b2", "")
-	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "*", "r1,r3", "b1,b2,f1,f3", "")
+	// percent bucket and ordinary field
+	f("stats by (a:50%, b) count() as rows", [][]Field{
+		{
+			{"a", "0.5"},
+			{"b", "x"},
+		},
+		{
+			{"a", "1.5"},
+			{"b", "x"},
+		},
+		{
+			{"a", "1.25"},
+			{"b", "y"},
+		},
+		{
+			{"a", "0.75"},
+			{"b", "x"},
+		},
+	}, [][]Field{
+		{
+			{"a", "0.5"},
+			{"b", "x"},
+			{"rows", "2"},
+		},
+		{
+			{"a", "1"},
+			{"b", "y"},
+			{"rows", "1"},
+		},
+		{
+			{"a", "1.5"},
+			{"b", "x"},
+			{"rows", "1"},
+		},
+	})
 
-	// needed fields do not intersect with stats fields
-	f("stats count() r1", "r2", "", "", "")
-	f("stats count(*) r1", "r2", "", "", "")
-	f("stats count(f1,f2) r1", "r2", "", "", "")
-	f("stats count(f1,f2) r1, sum(f3,f4) r2", "r3", "", "", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "r2", "", "b1,b2", "")
-	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "r3", "", "b1,b2", "")
+	// all the values are identical
+	f("stats by (a:10%) count() as rows", [][]Field{
+		{
+			{"a", "3"},
+		},
+		{
+			{"a", "3"},
+		},
+	}, [][]Field{
+		{
+			{"a", "3"},
+			{"rows", "2"},
+		},
+	})
+}
 
-	// needed fields intersect with stats fields
-	f("stats count() r1", "r1,r2", "", "", "")
-	f("stats count(*) r1", "r1,r2", "", "", "")
-	f("stats count(f1,f2) r1", "r1,r2", "", "f1,f2", "")
-	f("stats count(f1,f2) r1, sum(f3,f4) r2", "r1,r3", "", "f1,f2", "")
-	f("stats by (b1,b2) count(f1,f2) r1", "r1,r2", "", "b1,b2,f1,f2", "")
-	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "r1,r3", "", "b1,b2,f1,f2", "")
+func TestPipeStatsHourOfDay(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"_time", "2024-04-01T23:30:00Z"},
+		},
+		{
+			{"_time", "2024-04-02T23:10:00Z"},
+		},
+		{
+			{"_time", "2024-04-02T05:10:00Z"},
+		},
+		{
+			{"_time", "foobar"},
+		},
+	}
+
+	f("stats by (_time:hour_of_day) count() as rows", rows, [][]Field{
+		{
+			{"_time", "23"},
+			{"rows", "2"},
+		},
+		{
+			{"_time", "5"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "foobar"},
+			{"rows", "1"},
+		},
+	})
+
+	f(`stats by (_time:hour_of_day tz "Asia/Kolkata") count() as rows`, rows, [][]Field{
+		{
+			{"_time", "5"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "4"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "10"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "foobar"},
+			{"rows", "1"},
+		},
+	})
+
+	f(`stats by (_time:hour_of_day offset 1h) count() as rows`, rows, [][]Field{
+		{
+			{"_time", "22"},
+			{"rows", "2"},
+		},
+		{
+			{"_time", "4"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "foobar"},
+			{"rows", "1"},
+		},
+	})
+}
+
+func TestPipeStatsDayOfWeek(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// 2024-04-06 is Saturday, 2024-04-07 is Sunday, 2024-04-08 is Monday
+	rows := [][]Field{
+		{
+			{"_time", "2024-04-06T10:00:00Z"},
+		},
+		{
+			{"_time", "2024-04-07T02:00:00Z"},
+		},
+		{
+			{"_time", "2024-04-08T12:00:00Z"},
+		},
+		{
+			{"_time", "2024-04-15T03:00:00Z"},
+		},
+	}
+
+	f("stats by (_time:day_of_week) count() as rows", rows, [][]Field{
+		{
+			{"_time", "6"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "0"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "1"},
+			{"rows", "2"},
+		},
+	})
+
+	f(`stats by (_time:day_of_week tz "America/New_York") count() as rows`, rows, [][]Field{
+		{
+			{"_time", "6"},
+			{"rows", "2"},
+		},
+		{
+			{"_time", "1"},
+			{"rows", "1"},
+		},
+		{
+			{"_time", "0"},
+			{"rows", "1"},
+		},
+	})
+}
+
+func TestPipeStatsIPMaskBuckets(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"ip", "2001:db8:1:2::1"},
+		},
+		{
+			{"ip", "2001:db8:1:2:abcd::5"},
+		},
+		{
+			{"ip", "2001:db8:1:3::1"},
+		},
+		{
+			{"ip", "fe80::1"},
+		},
+		{
+			{"ip", "10.1.2.3"},
+		},
+		{
+			{"ip", "10.1.2.4"},
+		},
+		{
+			{"ip", "foo"},
+		},
+	}
+
+	f("stats by (ip:/64) count() as rows", rows, [][]Field{
+		{
+			{"ip", "2001:db8:1:2::"},
+			{"rows", "2"},
+		},
+		{
+			{"ip", "2001:db8:1:3::"},
+			{"rows", "1"},
+		},
+		{
+			{"ip", "fe80::"},
+			{"rows", "1"},
+		},
+		{
+			{"ip", "10.1.2.3"},
+			{"rows", "1"},
+		},
+		{
+			{"ip", "10.1.2.4"},
+			{"rows", "1"},
+		},
+		{
+			{"ip", "foo"},
+			{"rows", "1"},
+		},
+	})
+
+	f("stats by (ip:/24) count() as rows", rows, [][]Field{
+		{
+			{"ip", "2001:d00::"},
+			{"rows", "3"},
+		},
+		{
+			{"ip", "fe80::"},
+			{"rows", "1"},
+		},
+		{
+			{"ip", "10.1.2.0"},
+			{"rows", "2"},
+		},
+		{
+			{"ip", "foo"},
+			{"rows", "1"},
+		},
+	})
+}
+
+func TestPipeStatsByFieldsAlias(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"_time", "2024-01-01T10:20:00Z"},
+			{"host", "a"},
+		},
+		{
+			{"_time", "2024-01-01T10:40:00Z"},
+			{"host", "b"},
+		},
+		{
+			{"_time", "2024-01-01T11:10:00Z"},
+			{"host", "a"},
+		},
+	}
+
+	f(`stats by (_time:1h as hour) count() as rows`, rows, [][]Field{
+		{
+			{"hour", "2024-01-01T10:00:00Z"},
+			{"rows", "2"},
+		},
+		{
+			{"hour", "2024-01-01T11:00:00Z"},
+			{"rows", "1"},
+		},
+	})
+
+	f(`stats by (_time:1h as hour, host as h) count() as rows`, rows, [][]Field{
+		{
+			{"hour", "2024-01-01T10:00:00Z"},
+			{"h", "a"},
+			{"rows", "1"},
+		},
+		{
+			{"hour", "2024-01-01T10:00:00Z"},
+			{"h", "b"},
+			{"rows", "1"},
+		},
+		{
+			{"hour", "2024-01-01T11:00:00Z"},
+			{"h", "a"},
+			{"rows", "1"},
+		},
+	})
+
+	// the original field can be used in stats funcs together with its alias
+	f(`stats by (host as h) count_uniq(host) as hosts`, rows, [][]Field{
+		{
+			{"h", "a"},
+			{"hosts", "1"},
+		},
+		{
+			{"h", "b"},
+			{"hosts", "1"},
+		},
+	})
+
+	// the original field name can be used as result name
+	f(`stats by (host as h) count() as host`, rows, [][]Field{
+		{
+			{"h", "a"},
+			{"host", "2"},
+		},
+		{
+			{"h", "b"},
+			{"host", "1"},
+		},
+	})
+}
+
+func TestPipeStatsHashBuckets(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"user_id", "alice"},
+			{"x", "1"},
+		},
+		{
+			{"user_id", "bob"},
+			{"x", "2"},
+		},
+		{
+			{"user_id", "alice"},
+			{"x", "3"},
+		},
+		{
+			{"x", "4"},
+		},
+	}
+
+	f(`stats by (hash(user_id)) sum(x) as total`, rows, [][]Field{
+		{
+			{"user_id", "73a3ea485f2e6049"},
+			{"total", "4"},
+		},
+		{
+			{"user_id", "92878a3b42bad03b"},
+			{"total", "2"},
+		},
+		{
+			{"user_id", ""},
+			{"total", "4"},
+		},
+	})
+
+	f(`stats by (hash(user_id, sha256)) count() as rows`, rows, [][]Field{
+		{
+			{"user_id", "2bd806c97f0e00af1a1fc3328fa763a9269723c8db8fac4f93af71db186d6e90"},
+			{"rows", "2"},
+		},
+		{
+			{"user_id", "81b637d8fcd2c6da6359e6963113a1170de795e4b725b84d1e0b4cfd9ec58ce9"},
+			{"rows", "1"},
+		},
+		{
+			{"user_id", ""},
+			{"rows", "1"},
+		},
+	})
+
+	// constant column
+	f(`stats by (hash(user_id), x) count() as rows`, rows[:1], [][]Field{
+		{
+			{"user_id", "73a3ea485f2e6049"},
+			{"x", "1"},
+			{"rows", "1"},
+		},
+	})
+
+	// the original field values can be referenced by stats functions
+	f(`stats by (hash(user_id)) count_uniq(user_id) as users`, rows[:3], [][]Field{
+		{
+			{"user_id", "73a3ea485f2e6049"},
+			{"users", "1"},
+		},
+		{
+			{"user_id", "92878a3b42bad03b"},
+			{"users", "1"},
+		},
+	})
+
+	// 'hash' field name
+	f(`stats by (hash) count() as rows`, [][]Field{
+		{
+			{"hash", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"hash", "foo"},
+			{"rows", "1"},
+		},
+	})
+}
+
+func TestPipeStatsTransformBuckets(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"url", "/api/v1/query"},
+			{"name", "http.requests.total"},
+		},
+		{
+			{"url", "/api/v1/query"},
+			{"name", "http.requests.errors"},
+		},
+		{
+			{"url", "/api/v2/foo"},
+			{"name", "db.queries"},
+		},
+		{
+			{"url", "/static/main.js"},
+			{"name", "uptime"},
+		},
+		{
+			{"name", "db.conns"},
+		},
+	}
+
+	f(`stats by (url:prefix("/api/")) count() as rows`, rows, [][]Field{
+		{
+			{"url", "/api/"},
+			{"rows", "3"},
+		},
+		{
+			{"url", ""},
+			{"rows", "2"},
+		},
+	})
+
+	f(`stats by (name:split(".", 0)) count() as rows`, rows, [][]Field{
+		{
+			{"name", "http"},
+			{"rows", "2"},
+		},
+		{
+			{"name", "db"},
+			{"rows", "2"},
+		},
+		{
+			{"name", "uptime"},
+			{"rows", "1"},
+		},
+	})
+
+	f(`stats by (name:split(".", 1), url:prefix("/api/")) count() as rows`, rows, [][]Field{
+		{
+			{"name", "requests"},
+			{"url", "/api/"},
+			{"rows", "2"},
+		},
+		{
+			{"name", "queries"},
+			{"url", "/api/"},
+			{"rows", "1"},
+		},
+		{
+			{"name", ""},
+			{"url", ""},
+			{"rows", "1"},
+		},
+		{
+			{"name", "conns"},
+			{"url", ""},
+			{"rows", "1"},
+		},
+	})
+}
+
+func TestPipeStatsExplode(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"host", "h1"},
+			{"tags", `["a","b"]`},
+		},
+		{
+			{"host", "h1"},
+			{"tags", `["b","c",1]`},
+		},
+		{
+			{"host", "h2"},
+			{"tags", `[]`},
+		},
+		{
+			{"host", "h2"},
+			{"tags", `foo`},
+		},
+	}
+
+	f("stats count_uniq(explode(tags)) as uniqs, count(explode(tags)) as cnt, count() as rows", rows, [][]Field{
+		{
+			{"uniqs", "5"},
+			{"cnt", "6"},
+			{"rows", "4"},
+		},
+	})
+
+	f("stats by (host) uniq_values(explode(tags)) as tags", rows, [][]Field{
+		{
+			{"host", "h1"},
+			{"tags", `["1","a","b","c"]`},
+		},
+		{
+			{"host", "h2"},
+			{"tags", `["foo"]`},
+		},
+	})
+
+	f("stats count_uniq(explode(tags)) if (host:h1) as uniqs", rows, [][]Field{
+		{
+			{"uniqs", "4"},
+		},
+	})
+
+	f("stats by (host) count(explode(tags)) if (host:h2)", rows, [][]Field{
+		{
+			{"host", "h1"},
+			{"count(explode(tags)) if (host:h2)", "0"},
+		},
+		{
+			{"host", "h2"},
+			{"count(explode(tags)) if (host:h2)", "1"},
+		},
+	})
+}
+
+func TestPipeStatsWithSortPipe(t *testing.T) {
+	f := func(statsPipeStr, sortPipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+
+		lex := newLexer(sortPipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", sortPipeStr, err)
+		}
+		sp := p.(*pipeSort)
+
+		lex = newLexer(statsPipeStr, 0)
+		p, err = parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", statsPipeStr, err)
+		}
+		ps := p.(*pipeStats)
+		ps.sortPipe = sp
+
+		workersCount := 5
+		stopCh := make(chan struct{})
+		cancel := func() {}
+		ppTest := newTestPipeProcessor()
+		ppSort := sp.newPipeProcessor(workersCount, stopCh, cancel, ppTest)
+		pp := ps.newPipeProcessor(workersCount, stopCh, cancel, ppSort)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for _, row := range rows {
+			brw.writeRow(row)
+		}
+		brw.flush()
+		if err := pp.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := ppSort.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		ppTest.expectRows(t, rowsExpected)
+	}
+
+	var rows [][]Field
+	for i := 0; i < 10_000; i++ {
+		rows = append(rows, []Field{
+			{"a", fmt.Sprintf("%d", i%1000)},
+			{"b", fmt.Sprintf("%d", i)},
+		})
+	}
+
+	f("stats by (a) sum(b) as b", "sort by (b desc) limit 3", rows, [][]Field{
+		{
+			{"a", "999"},
+			{"b", "54990"},
+		},
+		{
+			{"a", "998"},
+			{"b", "54980"},
+		},
+		{
+			{"a", "997"},
+			{"b", "54970"},
+		},
+	})
+	f("stats by (a) sum(b) as b", "sort by (b) offset 1 limit 2 rank as r", rows, [][]Field{
+		{
+			{"a", "1"},
+			{"b", "45010"},
+			{"r", "2"},
+		},
+		{
+			{"a", "2"},
+			{"b", "45020"},
+			{"r", "3"},
+		},
+	})
+	f("stats by (a) count() as c", "sort by (c, a) limit 2", rows, [][]Field{
+		{
+			{"a", "0"},
+			{"c", "10"},
+		},
+		{
+			{"a", "1"},
+			{"c", "10"},
+		},
+	})
+	f("stats count() as c", "sort by (c) limit 5", rows, [][]Field{
+		{
+			{"c", "10000"},
+		},
+	})
+}
+
+func TestPipeStatsRepeatedMultiFieldKeys(t *testing.T) {
+	// Rows with the same multi-field key must be counted properly when they span multiple blocks.
+	var rows [][]Field
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, []Field{
+			{"a", fmt.Sprintf("%d", i/300)},
+			{"b", "x"},
+			{"c", fmt.Sprintf("%d", i)},
+		})
+	}
+
+	expectPipeResults(t, "stats by (a, b) count() as hits, count_uniq(c) as uniqs", rows, [][]Field{
+		{
+			{"a", "0"},
+			{"b", "x"},
+			{"hits", "300"},
+			{"uniqs", "300"},
+		},
+		{
+			{"a", "1"},
+			{"b", "x"},
+			{"hits", "300"},
+			{"uniqs", "300"},
+		},
+		{
+			{"a", "2"},
+			{"b", "x"},
+			{"hits", "300"},
+			{"uniqs", "300"},
+		},
+		{
+			{"a", "3"},
+			{"b", "x"},
+			{"hits", "100"},
+			{"uniqs", "100"},
+		},
+	})
+}
+
+func TestPipeStatsInterleavedMultiFieldKeys(t *testing.T) {
+	// Rows for distinct multi-field keys are interleaved, so the stats are updated in bulk for every group.
+	var rows [][]Field
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, []Field{
+			{"a", fmt.Sprintf("%d", i%2)},
+			{"b", "x"},
+			{"c", fmt.Sprintf("%d", i%10)},
+		})
+	}
+
+	expectPipeResults(t, "stats by (a, b) count() as hits, count() if (c:5) as fives, sum(c) as total, count_uniq(c) as uniqs", rows, [][]Field{
+		{
+			{"a", "0"},
+			{"b", "x"},
+			{"hits", "500"},
+			{"fives", "0"},
+			{"total", "2000"},
+			{"uniqs", "5"},
+		},
+		{
+			{"a", "1"},
+			{"b", "x"},
+			{"hits", "500"},
+			{"fives", "100"},
+			{"total", "2500"},
+			{"uniqs", "5"},
+		},
+	})
+}
+
+func TestPipeStatsMergeShards(t *testing.T) {
+	f := func(groupsCount int) {
+		t.Helper()
+
+		// Small number of groups is merged serially, while big number of groups is merged in parallel.
+		var rows, rowsExpected [][]Field
+		for i := 0; i < 3*groupsCount; i++ {
+			rows = append(rows, []Field{
+				{"a", fmt.Sprintf("%d", i%groupsCount)},
+			})
+		}
+		for i := 0; i < groupsCount; i++ {
+			rowsExpected = append(rowsExpected, []Field{
+				{"a", fmt.Sprintf("%d", i)},
+				{"hits", "3"},
+			})
+		}
+		expectPipeResults(t, "stats by (a) count() as hits", rows, rowsExpected)
+	}
+
+	f(1)
+	f(10)
+	f(pipeStatsSerialMergeMaxGroups / 3)
+	f(2 * pipeStatsSerialMergeMaxGroups)
+}
+
+func TestPipeStatsProgressFunc(t *testing.T) {
+	q, err := ParseQuery("* | stats by (a) count() as hits")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var progress []StatsProgress
+	q.SetStatsProgressFunc(func(p *StatsProgress) {
+		progress = append(progress, *p)
+	})
+
+	workersCount := 1
+	stopCh := make(chan struct{})
+	cancel := func() {}
+	ppTest := newTestPipeProcessor()
+	pp := q.pipes[0].newPipeProcessor(workersCount, stopCh, cancel, ppTest)
+
+	brw := newTestBlockResultWriter(workersCount, pp)
+	for i := 0; i < 10; i++ {
+		brw.writeRow([]Field{
+			{"a", fmt.Sprintf("%d", i)},
+		})
+	}
+	brw.flush()
+	if err := pp.flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The progress must be reported at least once, since the first report isn't throttled.
+	if len(progress) == 0 {
+		t.Fatalf("expecting non-empty progress reports")
+	}
+	p := progress[0]
+	if p.GroupsCount == 0 || p.GroupsCount > 10 {
+		t.Fatalf("unexpected GroupsCount; got %d; want value in the range [1..10]", p.GroupsCount)
+	}
+	if p.MaxStateSizeBytes <= 0 {
+		t.Fatalf("unexpected MaxStateSizeBytes; got %d; want positive value", p.MaxStateSizeBytes)
+	}
+	if p.StateSizeBytes < 0 || p.StateSizeBytes > p.MaxStateSizeBytes {
+		t.Fatalf("unexpected StateSizeBytes; got %d; want value in the range [0..%d]", p.StateSizeBytes, p.MaxStateSizeBytes)
+	}
+
+	// The progress func must be set for `stats` pipes in subqueries, `union` and `join` pipes too.
+	q, err = ParseQuery(`x:in(* | stats by (x) count() as c | fields x) | stats by (a) count() as hits ` +
+		`| union (* | stats count() as hits) | join by (hits) (* | stats by (hits) count() as c)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	q.SetStatsProgressFunc(func(_ *StatsProgress) {})
+	statsPipesCount := 0
+	q.visitSubqueries(func(q *Query) {
+		for _, p := range q.pipes {
+			ps, ok := p.(*pipeStats)
+			if !ok {
+				continue
+			}
+			if ps.progressFunc == nil {
+				t.Fatalf("missing progress func for [%s]", ps)
+			}
+			statsPipesCount++
+		}
+	})
+	if statsPipesCount != 4 {
+		t.Fatalf("unexpected number of stats pipes; got %d; want 4", statsPipesCount)
+	}
+}
+
+func TestPipeStatsPartial(t *testing.T) {
+	f := func(pipeStr string, isCanceled bool, rows, rowsExpected [][]Field) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", pipeStr, err)
+		}
+
+		workersCount := 3
+		stopCh := make(chan struct{})
+		cancel := func() {}
+		ppTest := newTestPipeProcessor()
+		pp := p.newPipeProcessor(workersCount, stopCh, cancel, ppTest)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for _, row := range rows {
+			brw.writeRow(row)
+		}
+		brw.flush()
+		if isCanceled {
+			close(stopCh)
+		}
+		if err := pp.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		ppTest.expectRows(t, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"a", "x"},
+		},
+		{
+			{"a", "y"},
+		},
+		{
+			{"a", "x"},
+		},
+	}
+
+	// canceled query without partial results
+	f("stats by (a) count() as hits", true, rows, nil)
+	f("stats by (a:5%) count() as hits", true, rows, nil)
+
+	// canceled query with partial results
+	f("stats partial by (a) count() as hits", true, rows, [][]Field{
+		{
+			{"a", "x"},
+			{"hits", "2"},
+			{"_partial", "1"},
+		},
+		{
+			{"a", "y"},
+			{"hits", "1"},
+			{"_partial", "1"},
+		},
+	})
+	f("stats partial count() as hits", true, rows, [][]Field{
+		{
+			{"hits", "3"},
+			{"_partial", "1"},
+		},
+	})
+	f("stats partial by (a:5%) count() as hits", true, rows, [][]Field{
+		{
+			{"a", "x"},
+			{"hits", "2"},
+			{"_partial", "1"},
+		},
+		{
+			{"a", "y"},
+			{"hits", "1"},
+			{"_partial", "1"},
+		},
+	})
+
+	// non-canceled query with partial results
+	f("stats partial by (a) count() as hits", false, rows, [][]Field{
+		{
+			{"a", "x"},
+			{"hits", "2"},
+		},
+		{
+			{"a", "y"},
+			{"hits", "1"},
+		},
+	})
+}
+
+func TestPipeStatsWindow(t *testing.T) {
+	f := func(pipeStr string, start, end string, rows, rowsExpected [][]Field) {
+		t.Helper()
+
+		lex := newLexer(pipeStr, 0)
+		p, err := parsePipe(lex)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", pipeStr, err)
+		}
+		startTimestamp, ok := TryParseTimestampRFC3339Nano(start)
+		if !ok {
+			t.Fatalf("cannot parse start=%q", start)
+		}
+		endTimestamp, ok := TryParseTimestampRFC3339Nano(end)
+		if !ok {
+			t.Fatalf("cannot parse end=%q", end)
+		}
+		p.(*pipeStats).initWindowTimeRange(startTimestamp, endTimestamp)
+
+		workersCount := 3
+		stopCh := make(chan struct{})
+		cancel := func() {}
+		ppTest := newTestPipeProcessor()
+		pp := p.newPipeProcessor(workersCount, stopCh, cancel, ppTest)
+
+		brw := newTestBlockResultWriter(workersCount, pp)
+		for _, row := range rows {
+			brw.writeRow(row)
+		}
+		brw.flush()
+		if err := pp.flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		ppTest.expectRows(t, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"a", "x"},
+		},
+		{
+			{"_time", "2024-01-01T00:01:10Z"},
+			{"a", "x"},
+		},
+		{
+			{"_time", "2024-01-01T00:01:50Z"},
+			{"a", "y"},
+		},
+		{
+			{"_time", "2024-01-01T00:02:20Z"},
+			{"a", "x"},
+		},
+		{
+			{"_time", "foobar"},
+			{"a", "x"},
+		},
+	}
+
+	// the first window starts before the query time range, while the last window ends after the query time range
+	f("stats window by (_time:1m) count() as hits", "2024-01-01T00:00:20Z", "2024-01-01T00:02:30Z", rows, [][]Field{
+		{
+			{"_time", "2024-01-01T00:01:00Z"},
+			{"hits", "2"},
+		},
+	})
+
+	// windows aligned to the query time range
+	f("stats window by (_time:1m, a) count() as hits", "2024-01-01T00:00:00Z", "2024-01-01T00:02:59.999999999Z", rows, [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", "x"},
+			{"hits", "1"},
+		},
+		{
+			{"_time", "2024-01-01T00:01:00Z"},
+			{"a", "x"},
+			{"hits", "1"},
+		},
+		{
+			{"_time", "2024-01-01T00:01:00Z"},
+			{"a", "y"},
+			{"hits", "1"},
+		},
+		{
+			{"_time", "2024-01-01T00:02:00Z"},
+			{"a", "x"},
+			{"hits", "1"},
+		},
+	})
+
+	// windows with offset
+	f("stats window by (_time:1m offset 30s) count() as hits", "2024-01-01T00:00:00Z", "2024-01-01T00:02:30Z", rows, [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"hits", "2"},
+		},
+		{
+			{"_time", "2024-01-01T00:01:30Z"},
+			{"hits", "2"},
+		},
+	})
+
+	// no complete windows
+	f("stats window by (_time:1h) count() as hits", "2024-01-01T00:00:00Z", "2024-01-01T00:02:30Z", rows, nil)
+}
+
+func TestPipeStatsWithExcluded(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"status", "200"},
+			{"host", "a"},
+			{"size", "10"},
+		},
+		{
+			{"status", "500"},
+			{"host", "a"},
+			{"size", "20"},
+		},
+		{
+			{"status", "503"},
+			{"host", "b"},
+			{"size", "30"},
+		},
+		{
+			{"status", "404"},
+			{"host", "a"},
+			{"size", "40"},
+		},
+	}
+
+	f("stats count() if (status:>=500) with_excluded as errs", rows, [][]Field{
+		{
+			{"errs", "2"},
+			{"errs_excluded", "2"},
+		},
+	})
+
+	f("stats by (host) count() if (status:>=500) with_excluded as errs, sum(size) as total", rows, [][]Field{
+		{
+			{"host", "a"},
+			{"errs", "1"},
+			{"errs_excluded", "2"},
+			{"total", "70"},
+		},
+		{
+			{"host", "b"},
+			{"errs", "1"},
+			{"errs_excluded", "0"},
+			{"total", "30"},
+		},
+	})
+
+	// the excluded rows are counted independently of the func
+	f("stats sum(size) if (status:<500) with_excluded as ok_size", rows, [][]Field{
+		{
+			{"ok_size", "50"},
+			{"ok_size_excluded", "2"},
+		},
+	})
+}
+
+func TestPipeStatsWithCount(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"status", "200"},
+			{"host", "a"},
+			{"duration", "10"},
+		},
+		{
+			{"status", "500"},
+			{"host", "a"},
+			{"duration", "20"},
+		},
+		{
+			{"status", "503"},
+			{"host", "b"},
+			{"duration", "30"},
+		},
+		{
+			{"status", "404"},
+			{"host", "a"},
+			{"duration", "foo"},
+		},
+	}
+
+	// non-numeric values do not contribute to avg
+	f("stats avg(duration) with_count as d", rows, [][]Field{
+		{
+			{"d", "20"},
+			{"d_count", "3"},
+		},
+	})
+
+	f("stats by (host) avg(duration) if (status:>=500) with_count as errs_duration, avg(duration) with_count as duration", rows, [][]Field{
+		{
+			{"host", "a"},
+			{"errs_duration", "20"},
+			{"errs_duration_count", "1"},
+			{"duration", "15"},
+			{"duration_count", "2"},
+		},
+		{
+			{"host", "b"},
+			{"errs_duration", "30"},
+			{"errs_duration_count", "1"},
+			{"duration", "30"},
+			{"duration_count", "1"},
+		},
+	})
+
+	// with_count and with_excluded at the same func
+	f("stats avg(duration) if (status:>=500) with_excluded with_count as d", rows, [][]Field{
+		{
+			{"d", "25"},
+			{"d_count", "2"},
+			{"d_excluded", "2"},
+		},
+	})
+
+	// missing values
+	f("stats avg(x) with_count as x", rows, [][]Field{
+		{
+			{"x", "NaN"},
+			{"x_count", "0"},
+		},
+	})
+}
+
+func TestPipeStatsBucketFields(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"x", "3"},
+			{"_time", "2024-01-15T10:20:30Z"},
+			{"ip", "10.1.2.3"},
+		},
+		{
+			{"x", "7"},
+			{"_time", "2024-01-20T00:00:00Z"},
+			{"ip", "10.1.2.200"},
+		},
+		{
+			{"x", "12"},
+			{"_time", "2024-02-29T23:59:59Z"},
+			{"ip", "10.1.3.1"},
+		},
+	}
+
+	// numeric buckets
+	f("stats by (x:10) min(_bucket.x) as lower, max(_bucket_end.x) as upper, count() as hits", rows, [][]Field{
+		{
+			{"x", "0"},
+			{"lower", "0"},
+			{"upper", "10"},
+			{"hits", "2"},
+		},
+		{
+			{"x", "10"},
+			{"lower", "10"},
+			{"upper", "20"},
+			{"hits", "1"},
+		},
+	})
+
+	// numeric buckets with offset
+	f("stats by (x:10 offset 5) max(_bucket_end.x) as upper", rows, [][]Field{
+		{
+			{"x", "-5"},
+			{"upper", "5"},
+		},
+		{
+			{"x", "5"},
+			{"upper", "15"},
+		},
+	})
+
+	// time buckets
+	f("stats by (_time:1d) max(_bucket_end._time) as upper", rows[:1], [][]Field{
+		{
+			{"_time", "2024-01-15T00:00:00Z"},
+			{"upper", "2024-01-16T00:00:00Z"},
+		},
+	})
+	f("stats by (_time:month) min(_bucket._time) as lower, max(_bucket_end._time) as upper", rows, [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"lower", "2024-01-01T00:00:00Z"},
+			{"upper", "2024-02-01T00:00:00Z"},
+		},
+		{
+			{"_time", "2024-02-01T00:00:00Z"},
+			{"lower", "2024-02-01T00:00:00Z"},
+			{"upper", "2024-03-01T00:00:00Z"},
+		},
+	})
+
+	// IPv4 buckets
+	f("stats by (ip:/24) max(_bucket_end.ip) as upper", rows, [][]Field{
+		{
+			{"ip", "10.1.2.0"},
+			{"upper", "10.1.3.0"},
+		},
+		{
+			{"ip", "10.1.3.0"},
+			{"upper", "10.1.4.0"},
+		},
+	})
+
+	// bucket fields in per-function filters
+	f("stats by (x:10) count() if (_bucket.x:0) as first_bucket_hits", rows, [][]Field{
+		{
+			{"x", "0"},
+			{"first_bucket_hits", "2"},
+		},
+		{
+			{"x", "10"},
+			{"first_bucket_hits", "0"},
+		},
+	})
+
+	// the upper bound cannot be calculated for transforms
+	f(`stats by (ip:prefix("10.1.2")) max(_bucket_end.ip) as upper`, rows[:1], [][]Field{
+		{
+			{"ip", "10.1.2"},
+			{"upper", ""},
+		},
+	})
+
+	// bucket fields aren't generated for fields without buckets
+	f("stats by (x) count_uniq(_bucket.x) as u", rows[:1], [][]Field{
+		{
+			{"x", "3"},
+			{"u", "0"},
+		},
+	})
+}
+
+func TestByStatsFieldStringRoundTrip(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		parseByStatsField := func(s string) *byStatsField {
+			t.Helper()
+			lex := newLexer("("+s+")", 0)
+			bfs, err := parseByStatsFields(lex)
+			if err != nil {
+				t.Fatalf("cannot parse %q: %s", s, err)
+			}
+			if len(bfs) != 1 {
+				t.Fatalf("unexpected number of fields parsed from %q; got %d; want 1", s, len(bfs))
+			}
+			// Timezones are compared via timezoneStr.
+			bfs[0].timezone = nil
+			return bfs[0]
+		}
+
+		bf := parseByStatsField(s)
+		result := bf.String()
+		bfResult := parseByStatsField(result)
+		if !reflect.DeepEqual(bf, bfResult) {
+			t.Fatalf("unexpected byStatsField after the round-trip via %q\ngot\n%#v\nwant\n%#v", result, bfResult, bf)
+		}
+	}
+
+	f(`a`)
+	f(`"a:b"`)
+	f(`"a:b":1h`)
+	f(`"_time:1h"`)
+	f(`"x:prefix(\"a\")"`)
+	f(`"a b":5 offset 1`)
+	f(`"offset"`)
+	f(`"offset":1h offset -30m`)
+	f(`tz:10`)
+	f(`"by":5%`)
+	f(`"if"`)
+	f(`"a,b"`)
+	f(`"a)"`)
+	f(`"|"`)
+	f(`"*"`)
+	f(`"a\"b"`)
+	f(`"1h"`)
+	f(`"-"`)
+	f(`_time:hour_of_day offset 30m tz "Europe/Berlin"`)
+	f(`"a:b":split(":", 1)`)
+	f(`"a:b":prefix("x:")`)
+	f(`"ip:addr":/64`)
+	f(`hash(a)`)
+	f(`hash("a:b", sha256)`)
+	f(`a as b`)
+	f(`_time:1h offset 30m as hour`)
+	f(`"a:b":prefix("x:") as "c:d"`)
+	f(`hash(a, sha256) as "as"`)
+}
+
+func TestPipeStatsUpdateNeededFields(t *testing.T) {
+	f := func(s, neededFields, unneededFields, neededFieldsExpected, unneededFieldsExpected string) {
+		t.Helper()
+		expectPipeNeededFields(t, s, neededFields, unneededFields, neededFieldsExpected, unneededFieldsExpected)
+	}
+
+	// synthetic bucket fields
+	f("stats by (x:10) min(_bucket.x) a, max(_bucket_end.x) b", "*", "", "x", "")
+
+	// hash transform
+	f("stats by (hash(user_id)) count() r1", "*", "", "user_id", "")
+
+	// aliased by fields
+	f("stats by (x as y) count() r1", "*", "", "x", "")
+	f("stats by (_time:1h as hour) min(_bucket._time) r1", "*", "", "_time", "")
+	f("stats by (hash(user_id, sha256), x) count() r1", "*", "", "user_id,x", "")
+	f("stats by (x) min(_bucket.x) a", "*", "", "_bucket.x,x", "")
+
+	// all the needed fields
+	f("stats count() r1", "*", "", "", "")
+	f("stats count(*) r1", "*", "", "", "")
+	f("stats count(f1,f2) r1", "*", "", "f1,f2", "")
+	f("stats count(f1,f2) r1, sum(f3,f4) r2", "*", "", "f1,f2,f3,f4", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "*", "", "b1,b2,f1,f2", "")
+	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "*", "", "b1,b2,f1,f2,f3", "")
+
+	// all the needed fields, unneeded fields do not intersect with stats fields
+	f("stats count() r1", "*", "f1,f2", "", "")
+	f("stats count(*) r1", "*", "f1,f2", "", "")
+	f("stats count(f1,f2) r1", "*", "f3,f4", "f1,f2", "")
+	f("stats count(f1,f2) r1, sum(f3,f4) r2", "*", "f5,f6", "f1,f2,f3,f4", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "*", "f3,f4", "b1,b2,f1,f2", "")
+	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "*", "f4,f5", "b1,b2,f1,f2,f3", "")
+
+	// all the needed fields, unneeded fields intersect with stats fields
+	f("stats count() r1", "*", "r1,r2", "", "")
+	f("stats count(*) r1", "*", "r1,r2", "", "")
+	f("stats count(f1,f2) r1", "*", "r1,r2", "", "")
+	f("stats count(f1,f2) r1, sum(f3,f4) r2", "*", "r1,r3", "f3,f4", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "*", "r1,r2", "b1,b2", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "*", "r1,r2,b1", "b1,b2", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "*", "r1,r2,b1,b2", "b1,b2", "")
+	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "*", "r1,r3", "b1,b2,f1,f3", "")
+
+	// needed fields do not intersect with stats fields
+	f("stats count() r1", "r2", "", "", "")
+	f("stats count(*) r1", "r2", "", "", "")
+	f("stats count(f1,f2) r1", "r2", "", "", "")
+	f("stats count(f1,f2) r1, sum(f3,f4) r2", "r3", "", "", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "r2", "", "b1,b2", "")
+	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "r3", "", "b1,b2", "")
+
+	// needed fields intersect with stats fields
+	f("stats count() r1", "r1,r2", "", "", "")
+	f("stats count(*) r1", "r1,r2", "", "", "")
+	f("stats count(f1,f2) r1", "r1,r2", "", "f1,f2", "")
+	f("stats count(f1,f2) r1, sum(f3,f4) r2", "r1,r3", "", "f1,f2", "")
+	f("stats by (b1,b2) count(f1,f2) r1", "r1,r2", "", "b1,b2,f1,f2", "")
+	f("stats by (b1,b2) count(f1,f2) r1, count(f1,f3) r2", "r1,r3", "", "b1,b2,f1,f2", "")
+}
+
+func TestQuerySetStatsMaxStateSizePercent(t *testing.T) {
+	f := func(percent float64, maxStateSizeExpected int64) {
+		t.Helper()
+
+		// The max state size must be applied to `stats` pipes in subqueries, `union` and `join` pipes too.
+		q, err := ParseQuery(`x:in(* | stats by (x) count() as c | fields x) | stats by (a) count() as hits | stats count() as groups ` +
+			`| union (* | stats count() as groups) | join by (groups) (* | stats by (groups) count() as c)`)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := q.SetStatsMaxStateSizePercent(percent); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		statsPipesCount := 0
+		q.visitSubqueries(func(q *Query) {
+			for _, p := range q.pipes {
+				ps, ok := p.(*pipeStats)
+				if !ok {
+					continue
+				}
+				if maxStateSize := ps.getMaxStateSize(); maxStateSize != maxStateSizeExpected {
+					t.Fatalf("unexpected max state size for [%s] at percent=%v; got %d; want %d", ps, percent, maxStateSize, maxStateSizeExpected)
+				}
+				statsPipesCount++
+			}
+		})
+		if statsPipesCount != 5 {
+			t.Fatalf("unexpected number of stats pipes; got %d; want 5", statsPipesCount)
+		}
+	}
+
+	f(60, int64(float64(memory.Allowed())*60/100))
+	f(80, int64(float64(memory.Allowed())*80/100))
+	f(0.5, int64(float64(memory.Allowed())*0.5/100))
+
+	// The default max state size
+	ps := &pipeStats{}
+	if maxStateSize, maxStateSizeExpected := ps.getMaxStateSize(), int64(float64(memory.Allowed())*40/100); maxStateSize != maxStateSizeExpected {
+		t.Fatalf("unexpected default max state size; got %d; want %d", maxStateSize, maxStateSizeExpected)
+	}
+
+	// Invalid percent values
+	q, err := ParseQuery("* | stats count() as hits")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, percent := range []float64{-1, 0, 80.1, 100} {
+		if err := q.SetStatsMaxStateSizePercent(percent); err == nil {
+			t.Fatalf("expecting non-nil error for percent=%v", percent)
+		}
+	}
+}
+
+func TestGetPipeStatsWriterMaxResultLen(t *testing.T) {
+	f := func(maxStateSize, remainingBudget int64, resultExpected int) {
+		t.Helper()
+		result := getPipeStatsWriterMaxResultLen(maxStateSize, remainingBudget)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for maxStateSize=%d, remainingBudget=%d; got %d; want %d", maxStateSize, remainingBudget, result, resultExpected)
+		}
+	}
+
+	f(1000, 1000, pipeStatsWriterMaxResultLen)
+	f(1000, 250, pipeStatsWriterMaxResultLen)
+	f(1000, 249, pipeStatsWriterMinResultLen)
+	f(1000, 0, pipeStatsWriterMinResultLen)
+	f(1000, -100, pipeStatsWriterMinResultLen)
+}
+
+func TestPipeStatsProcessorShardPadding(t *testing.T) {
+	// The size of shards must be multiple of 128 bytes in order to prevent false sharing
+	// on platforms with 32, 64 and 128 bytes cache lines.
+	if n := unsafe.Sizeof(pipeStatsProcessorShard{}); n%128 != 0 {
+		t.Fatalf("unexpected size of pipeStatsProcessorShard; got %d bytes; want multiple of 128 bytes", n)
+	}
+	if n := unsafe.Sizeof(pipeStatsPercentProcessorShard{}); n%128 != 0 {
+		t.Fatalf("unexpected size of pipeStatsPercentProcessorShard; got %d bytes; want multiple of 128 bytes", n)
+	}
 }
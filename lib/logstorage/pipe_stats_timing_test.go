@@ -0,0 +1,234 @@
+package logstorage
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+)
+
+func BenchmarkPipeStats(b *testing.B) {
+	for _, groupsCount := range []int{10, 10_000, benchPipeStatsRowsCount} {
+		for _, columnsCount := range []int{1, 3} {
+			b.Run(fmt.Sprintf("groups-%d-columns-%d", groupsCount, columnsCount), func(b *testing.B) {
+				benchmarkPipeStats(b, groupsCount, columnsCount)
+			})
+		}
+	}
+}
+
+// benchPipeStatsRowsCount is the number of rows passed to the stats pipe per every BenchmarkPipeStats iteration.
+const benchPipeStatsRowsCount = 256 * 1024
+
+func benchmarkPipeStats(b *testing.B, groupsCount, columnsCount int) {
+	const rowsPerBlock = 8192
+	const workersCount = 4
+
+	columnNames := make([]string, columnsCount)
+	for i := range columnNames {
+		columnNames[i] = fmt.Sprintf("c%d", i)
+	}
+	brs := make([]*blockResult, 0, benchPipeStatsRowsCount/rowsPerBlock)
+	for offset := 0; offset < benchPipeStatsRowsCount; offset += rowsPerBlock {
+		br := newBenchBlockResultGroups(offset, rowsPerBlock, groupsCount, columnNames)
+		brs = append(brs, br)
+	}
+
+	pipeStr := fmt.Sprintf("stats by (%s) count() as hits, sum(v) as total", strings.Join(columnNames, ", "))
+	lex := newLexer(pipeStr, 0)
+	p, err := parsePipe(lex)
+	if err != nil {
+		b.Fatalf("cannot parse [%s]: %s", pipeStr, err)
+	}
+
+	b.SetBytes(benchPipeStatsRowsCount)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var ppNext benchRowsCounterPipeProcessor
+		pp := p.newPipeProcessor(workersCount, nil, func() {}, &ppNext)
+		for j, br := range brs {
+			pp.writeBlock(uint(j%workersCount), br)
+		}
+		if err := pp.flush(); err != nil {
+			b.Fatalf("unexpected error: %s", err)
+		}
+		if n := ppNext.rowsCount.Load(); n != uint64(groupsCount) {
+			b.Fatalf("unexpected number of stats results; got %d; want %d", n, groupsCount)
+		}
+	}
+}
+
+// benchRowsCounterPipeProcessor counts the rows passed to it and drops them.
+type benchRowsCounterPipeProcessor struct {
+	rowsCount atomic.Uint64
+}
+
+func (pp *benchRowsCounterPipeProcessor) writeBlock(_ uint, br *blockResult) {
+	pp.rowsCount.Add(uint64(br.rowsLen))
+}
+
+func (pp *benchRowsCounterPipeProcessor) flush() error {
+	return nil
+}
+
+// newBenchBlockResultGroups returns blockResult with rowsCount rows starting from the given offset.
+//
+// The returned blockResult contains string columns with the given columnNames and numeric string column 'v'.
+// Every row belongs to the group (offset+rowIdx)%groupsCount. Values for all the columnNames are derived from the group,
+// so grouping by any subset of columnNames results in groupsCount distinct groups across all the rows.
+func newBenchBlockResultGroups(offset, rowsCount, groupsCount int, columnNames []string) *blockResult {
+	cs := make([]blockResultColumn, 0, len(columnNames)+1)
+	for _, name := range columnNames {
+		values := make([]string, rowsCount)
+		for i := range values {
+			values[i] = fmt.Sprintf("%s-%d", name, (offset+i)%groupsCount)
+		}
+		cs = append(cs, blockResultColumn{
+			name:          name,
+			valueType:     valueTypeString,
+			valuesEncoded: values,
+		})
+	}
+
+	values := make([]string, rowsCount)
+	for i := range values {
+		values[i] = fmt.Sprintf("%d", (offset+i)%1000)
+	}
+	cs = append(cs, blockResultColumn{
+		name:          "v",
+		valueType:     valueTypeString,
+		valuesEncoded: values,
+	})
+
+	br := &blockResult{
+		rowsLen: rowsCount,
+	}
+	br.csBuf = cs
+	return br
+}
+
+func BenchmarkPipeStatsSingleColumnUint64(b *testing.B) {
+	for _, runLen := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("count-run-%d", runLen), func(b *testing.B) {
+			benchmarkPipeStatsSingleColumnUint64(b, "stats by (n) count() as hits", runLen)
+		})
+		b.Run(fmt.Sprintf("sum-run-%d", runLen), func(b *testing.B) {
+			benchmarkPipeStatsSingleColumnUint64(b, "stats by (n) sum(v) as total", runLen)
+		})
+	}
+}
+
+func BenchmarkPipeStatsMultiColumn(b *testing.B) {
+	for _, runLen := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("count-run-%d", runLen), func(b *testing.B) {
+			benchmarkPipeStatsSingleColumnUint64(b, "stats by (n, x) count() as hits", runLen)
+		})
+		b.Run(fmt.Sprintf("sum-run-%d", runLen), func(b *testing.B) {
+			benchmarkPipeStatsSingleColumnUint64(b, "stats by (n, x) sum(v) as total", runLen)
+		})
+	}
+}
+
+func BenchmarkPipeStatsMergeShards(b *testing.B) {
+	for _, groupsCount := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("serial-groups-%d", groupsCount), func(b *testing.B) {
+			benchmarkPipeStatsMergeShards(b, groupsCount, (*pipeStatsProcessor).mergeShardsSerial)
+		})
+		b.Run(fmt.Sprintf("parallel-groups-%d", groupsCount), func(b *testing.B) {
+			benchmarkPipeStatsMergeShards(b, groupsCount, (*pipeStatsProcessor).mergeShardsParallel)
+		})
+	}
+}
+
+func benchmarkPipeStatsMergeShards(b *testing.B, groupsCount int, mergeShards func(psp *pipeStatsProcessor) []*pipeStatsGroupMap) {
+	const rowsCount = 1024
+	const workersCount = 8
+
+	br := newBenchBlockResultUint64(rowsCount, groupsCount, 1)
+
+	pipeStr := "stats by (n) count() as hits, sum(v) as total"
+	lex := newLexer(pipeStr, 0)
+	p, err := parsePipe(lex)
+	if err != nil {
+		b.Fatalf("cannot parse [%s]: %s", pipeStr, err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		psp := p.newPipeProcessor(workersCount, nil, func() {}, newTestPipeProcessor()).(*pipeStatsProcessor)
+		for workerID := uint(0); workerID < workersCount; workerID++ {
+			psp.writeBlock(workerID, br)
+		}
+		b.StartTimer()
+
+		psms := mergeShards(psp)
+		n := uint64(0)
+		for _, psm := range psms {
+			n += psm.entriesCount()
+		}
+		if n != uint64(groupsCount) {
+			b.Fatalf("unexpected number of groups after the merge; got %d; want %d", n, groupsCount)
+		}
+	}
+}
+
+func benchmarkPipeStatsSingleColumnUint64(b *testing.B, pipeStr string, runLen int) {
+	const rowsCount = 8192
+	const groupsCount = 100
+	const blocksCount = 10
+
+	br := newBenchBlockResultUint64(rowsCount, groupsCount, runLen)
+
+	lex := newLexer(pipeStr, 0)
+	p, err := parsePipe(lex)
+	if err != nil {
+		b.Fatalf("cannot parse [%s]: %s", pipeStr, err)
+	}
+
+	b.SetBytes(rowsCount * blocksCount)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pp := p.newPipeProcessor(1, nil, func() {}, newTestPipeProcessor())
+		for j := 0; j < blocksCount; j++ {
+			pp.writeBlock(0, br)
+		}
+	}
+}
+
+// newBenchBlockResultUint64 returns blockResult with uint64 column 'n' and string column 'v'.
+//
+// The 'n' column contains runs of identical values with the given runLen across groupsCount distinct values.
+func newBenchBlockResultUint64(rowsCount, groupsCount, runLen int) *blockResult {
+	valuesEncoded := make([]string, rowsCount)
+	values := make([]string, rowsCount)
+	for i := range valuesEncoded {
+		n := uint64((i / runLen) % groupsCount)
+		valuesEncoded[i] = string(encoding.MarshalUint64(nil, n))
+		values[i] = fmt.Sprintf("%d", i%1000)
+	}
+
+	br := &blockResult{
+		rowsLen: rowsCount,
+	}
+	br.csBuf = []blockResultColumn{
+		{
+			name:          "n",
+			valueType:     valueTypeUint64,
+			minValue:      0,
+			maxValue:      uint64(groupsCount - 1),
+			valuesEncoded: valuesEncoded,
+		},
+		{
+			name:          "v",
+			valueType:     valueTypeString,
+			valuesEncoded: values,
+		},
+	}
+	return br
+}
@@ -568,8 +568,8 @@ func (wctx *pipeUniqWriteContext) flush() {
 }
 
 func parsePipeUniq(lex *lexer) (pipe, error) {
-	if !lex.isKeyword("uniq") {
-		return nil, fmt.Errorf("expecting 'uniq'; got %q", lex.token)
+	if !lex.isKeyword("uniq", "distinct") {
+		return nil, fmt.Errorf("expecting 'uniq' or 'distinct'; got %q", lex.token)
 	}
 	lex.nextToken()
 
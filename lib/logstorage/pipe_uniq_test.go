@@ -69,6 +69,33 @@ func TestPipeUniq(t *testing.T) {
 		},
 	})
 
+	// distinct is an alias for uniq
+	f("distinct by (a, b)", [][]Field{
+		{
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"a", "2"},
+			{"b", "3"},
+			{"c", "x"},
+		},
+		{
+			{"a", `2`},
+			{"b", `54`},
+			{"c", "d"},
+		},
+	}, [][]Field{
+		{
+			{"a", "2"},
+			{"b", "3"},
+		},
+		{
+			{"a", `2`},
+			{"b", `54`},
+		},
+	})
+
 	f("uniq hits", [][]Field{
 		{
 			{"a", `2`},
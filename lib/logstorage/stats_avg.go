@@ -9,17 +9,45 @@ import (
 
 type statsAvg struct {
 	fields []string
+
+	// weightField is an optional field from 'weighted by (weightField)' clause.
+	//
+	// If it is set, then the weighted average sum(field*weightField)/sum(weightField) is calculated.
+	weightField string
+
+	// isValuesCounter is set for the avg created by newValuesCounter().
+	//
+	// In this case the number of values used for calculating the average is returned instead of the average.
+	isValuesCounter bool
 }
 
 func (sa *statsAvg) String() string {
-	return "avg(" + statsFuncFieldsToString(sa.fields) + ")"
+	s := "avg(" + statsFuncFieldsToString(sa.fields) + ")"
+	if sa.weightField != "" {
+		s += " weighted by (" + quoteTokenIfNeeded(sa.weightField) + ")"
+	}
+	return s
+}
+
+func (sa *statsAvg) newValuesCounter() statsFunc {
+	return &statsAvg{
+		fields:          sa.fields,
+		weightField:     sa.weightField,
+		isValuesCounter: true,
+	}
 }
 
 func (sa *statsAvg) updateNeededFields(neededFields fieldsSet) {
 	updateNeededFieldsForStatsFunc(neededFields, sa.fields)
+	if sa.weightField != "" {
+		neededFields.add(sa.weightField)
+	}
 }
 
 func (sa *statsAvg) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	if sa.weightField != "" {
+		return a.newStatsAvgWeightedProcessor()
+	}
 	return a.newStatsAvgProcessor()
 }
 
@@ -76,15 +104,148 @@ func (sap *statsAvgProcessor) updateStatsForRow(sf statsFunc, br *blockResult, r
 	return 0
 }
 
+func (sap *statsAvgProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sap, sf, br, rowIndexes)
+}
+
 func (sap *statsAvgProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsAvgProcessor)
 	sap.sum += src.sum
 	sap.count += src.count
 }
 
-func (sap *statsAvgProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+func (sap *statsAvgProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	sa := sf.(*statsAvg)
+	if sa.isValuesCounter {
+		return strconv.AppendUint(dst, sap.count, 10)
+	}
+
 	avg := sap.sum / float64(sap.count)
-	return strconv.AppendFloat(dst, avg, 'f', -1, 64)
+	return marshalStatsFloat64String(dst, avg)
+}
+
+// statsAvgWeightedProcessor calculates the weighted average for 'avg(...) weighted by (weightField)'.
+type statsAvgWeightedProcessor struct {
+	// sum is the sum of values multiplied by their weights.
+	sum float64
+
+	// weightsSum is the sum of weights for the values.
+	weightsSum float64
+
+	count uint64
+}
+
+func (sap *statsAvgWeightedProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sa := sf.(*statsAvg)
+	cWeight := br.getColumnByName(sa.weightField)
+
+	fields := sa.fields
+	if len(fields) == 0 {
+		// Scan all the columns except of the weight column
+		for _, c := range br.getColumns() {
+			if c.name == sa.weightField {
+				continue
+			}
+			for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+				sap.updateStatsForValue(br, c, cWeight, rowIdx)
+			}
+		}
+	} else {
+		// Scan the requested columns
+		for _, field := range fields {
+			c := br.getColumnByName(field)
+			for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+				sap.updateStatsForValue(br, c, cWeight, rowIdx)
+			}
+		}
+	}
+	return 0
+}
+
+func (sap *statsAvgWeightedProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sa := sf.(*statsAvg)
+	cWeight := br.getColumnByName(sa.weightField)
+
+	fields := sa.fields
+	if len(fields) == 0 {
+		// Scan all the fields except of the weight field for the given row
+		for _, c := range br.getColumns() {
+			if c.name == sa.weightField {
+				continue
+			}
+			sap.updateStatsForValue(br, c, cWeight, rowIdx)
+		}
+	} else {
+		// Scan only the given fields for the given row
+		for _, field := range fields {
+			c := br.getColumnByName(field)
+			sap.updateStatsForValue(br, c, cWeight, rowIdx)
+		}
+	}
+	return 0
+}
+
+func (sap *statsAvgWeightedProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	sa := sf.(*statsAvg)
+	cWeight := br.getColumnByName(sa.weightField)
+
+	fields := sa.fields
+	if len(fields) == 0 {
+		// Scan all the columns except of the weight column for the given rows
+		for _, c := range br.getColumns() {
+			if c.name == sa.weightField {
+				continue
+			}
+			for _, rowIdx := range rowIndexes {
+				sap.updateStatsForValue(br, c, cWeight, rowIdx)
+			}
+		}
+	} else {
+		// Scan the requested columns for the given rows
+		for _, field := range fields {
+			c := br.getColumnByName(field)
+			for _, rowIdx := range rowIndexes {
+				sap.updateStatsForValue(br, c, cWeight, rowIdx)
+			}
+		}
+	}
+	return 0
+}
+
+func (sap *statsAvgWeightedProcessor) updateStatsForValue(br *blockResult, c, cWeight *blockResultColumn, rowIdx int) {
+	w, ok := cWeight.getFloatValueAtRow(br, rowIdx)
+	if !ok {
+		return
+	}
+	f, ok := c.getFloatValueAtRow(br, rowIdx)
+	if !ok {
+		return
+	}
+	sap.sum += f * w
+	sap.weightsSum += w
+	sap.count++
+}
+
+func (sap *statsAvgWeightedProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsAvgWeightedProcessor)
+	sap.sum += src.sum
+	sap.weightsSum += src.weightsSum
+	sap.count += src.count
+}
+
+func (sap *statsAvgWeightedProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	sa := sf.(*statsAvg)
+	if sa.isValuesCounter {
+		return strconv.AppendUint(dst, sap.count, 10)
+	}
+
+	// The weighted average is undefined if the sum of weights is zero. Return NaN in this case
+	// the same way as avg() returns NaN if there are no numeric values.
+	if sap.weightsSum == 0 {
+		return marshalStatsFloat64String(dst, nan)
+	}
+	avg := sap.sum / sap.weightsSum
+	return marshalStatsFloat64String(dst, avg)
 }
 
 func parseStatsAvg(lex *lexer) (*statsAvg, error) {
@@ -95,6 +256,26 @@ func parseStatsAvg(lex *lexer) (*statsAvg, error) {
 	sa := &statsAvg{
 		fields: fields,
 	}
+
+	if lex.isKeyword("weighted") {
+		// The 'weighted' may be the result name for avg(...), so verify whether it is followed by 'by'.
+		ls := lex.backupState()
+		lex.nextToken()
+		if !lex.isKeyword("by") {
+			lex.restoreState(ls)
+			return sa, nil
+		}
+		lex.nextToken()
+		weightFields, err := parseFieldNamesInParens(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse 'weighted by' args: %w", err)
+		}
+		if len(weightFields) != 1 || weightFields[0] == "*" {
+			return nil, fmt.Errorf("'weighted by' must contain a single field name; got %d fields", len(weightFields))
+		}
+		sa.weightField = weightFields[0]
+	}
+
 	return sa, nil
 }
 
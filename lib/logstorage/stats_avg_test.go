@@ -13,6 +13,9 @@ func TestParseStatsAvgSuccess(t *testing.T) {
 	f(`avg(*)`)
 	f(`avg(a)`)
 	f(`avg(a, b)`)
+	f(`avg(a) weighted by (w)`)
+	f(`avg(*) weighted by (w)`)
+	f(`avg(a, b) weighted by ("foo bar")`)
 }
 
 func TestParseStatsAvgFailure(t *testing.T) {
@@ -24,6 +27,29 @@ func TestParseStatsAvgFailure(t *testing.T) {
 	f(`avg`)
 	f(`avg(a b)`)
 	f(`avg(x) y`)
+	f(`avg(x) weighted by`)
+	f(`avg(x) weighted by ()`)
+	f(`avg(x) weighted by (*)`)
+	f(`avg(x) weighted by (a, b)`)
+	f(`avg(x) weighted by (a`)
+}
+
+func TestParsePipeStatsAvgWeighted(t *testing.T) {
+	// 'weighted' without 'by' must be treated as the result name
+	expectParsePipeSuccess(t, `stats avg(x) as weighted`)
+
+	lex := newLexer(`stats avg(x) weighted`, 0)
+	p, err := parsePipe(lex)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ps := p.(*pipeStats)
+	if resultName := ps.funcs[0].resultName; resultName != "weighted" {
+		t.Fatalf("unexpected result name; got %q; want %q", resultName, "weighted")
+	}
+
+	expectParsePipeSuccess(t, `stats avg(x) weighted by (w) as weighted`)
+	expectParsePipeSuccess(t, `stats by (a) avg(x) weighted by (w) as y, avg(x) as z`)
 }
 
 func TestStatsAvg(t *testing.T) {
@@ -381,6 +407,130 @@ func TestStatsAvg(t *testing.T) {
 			{"x", "NaN"},
 		},
 	})
+
+	// insignificant digits caused by float64 rounding errors must be dropped
+	f("stats avg(a) as x", [][]Field{
+		{
+			{"a", `0.1`},
+		},
+		{
+			{"a", `0.2`},
+		},
+		{
+			{"a", `0.4`},
+		},
+	}, [][]Field{
+		{
+			{"x", "0.233333333333333"},
+		},
+	})
+}
+
+func TestStatsAvgWeighted(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"a", `1`},
+			{"latency", `10`},
+			{"requests", `1`},
+		},
+		{
+			{"a", `1`},
+			{"latency", `20`},
+			{"requests", `3`},
+		},
+		{
+			{"a", `2`},
+			{"latency", `5`},
+			{"requests", `4`},
+		},
+		{
+			{"a", `2`},
+			{"latency", `foo`},
+			{"requests", `10`},
+		},
+		{
+			{"a", `2`},
+			{"latency", `100`},
+		},
+		{
+			{"a", `3`},
+			{"latency", `100`},
+			{"requests", `0`},
+		},
+	}
+
+	f("stats avg(latency) weighted by (requests) as x", rows, [][]Field{
+		{
+			{"x", "11.25"},
+		},
+	})
+
+	f("stats by (a) avg(latency) weighted by (requests) as x", rows, [][]Field{
+		{
+			{"a", "1"},
+			{"x", "17.5"},
+		},
+		{
+			{"a", "2"},
+			{"x", "5"},
+		},
+		{
+			{"a", "3"},
+			{"x", "NaN"},
+		},
+	})
+
+	f("stats by (a) avg(latency) weighted by (requests) if (latency:>5) as x", rows, [][]Field{
+		{
+			{"a", "1"},
+			{"x", "17.5"},
+		},
+		{
+			{"a", "2"},
+			{"x", "NaN"},
+		},
+		{
+			{"a", "3"},
+			{"x", "NaN"},
+		},
+	})
+
+	// NaN is returned if the sum of weights is zero
+	f("stats avg(latency) weighted by (requests) as x", [][]Field{
+		{
+			{"latency", `10`},
+			{"requests", `1`},
+		},
+		{
+			{"latency", `20`},
+			{"requests", `-1`},
+		},
+	}, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+
+	f("stats avg(*) weighted by (requests) as x", [][]Field{
+		{
+			{"latency", `10`},
+			{"size", `2`},
+			{"requests", `2`},
+		},
+		{
+			{"latency", `20`},
+			{"requests", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", "12"},
+		},
+	})
 }
 
 func expectParseStatsFuncFailure(t *testing.T, s string) {
@@ -1,6 +1,7 @@
 package logstorage
 
 import (
+	"fmt"
 	"slices"
 	"strconv"
 
@@ -188,6 +189,73 @@ func (scp *statsCountProcessor) updateStatsForRow(sf statsFunc, br *blockResult,
 	return 0
 }
 
+func (scp *statsCountProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	sc := sf.(*statsCount)
+	fields := sc.fields
+	if len(fields) == 0 {
+		// Fast path - unconditionally count all the given rows
+		scp.rowsCount += uint64(len(rowIndexes))
+		return 0
+	}
+	if len(fields) == 1 {
+		// Fast path for count(single_column) - resolve the column only once for all the given rows
+		c := br.getColumnByName(fields[0])
+		if c.isConst {
+			if c.valuesEncoded[0] != "" {
+				scp.rowsCount += uint64(len(rowIndexes))
+			}
+			return 0
+		}
+		if c.isTime {
+			scp.rowsCount += uint64(len(rowIndexes))
+			return 0
+		}
+		switch c.valueType {
+		case valueTypeString:
+			valuesEncoded := c.getValuesEncoded(br)
+			for _, rowIdx := range rowIndexes {
+				if valuesEncoded[rowIdx] != "" {
+					scp.rowsCount++
+				}
+			}
+			return 0
+		case valueTypeDict:
+			valuesEncoded := c.getValuesEncoded(br)
+			for _, rowIdx := range rowIndexes {
+				dictIdx := valuesEncoded[rowIdx][0]
+				if c.dictValues[dictIdx] != "" {
+					scp.rowsCount++
+				}
+			}
+			return 0
+		case valueTypeUint8, valueTypeUint16, valueTypeUint32, valueTypeUint64, valueTypeInt64,
+			valueTypeFloat64, valueTypeIPv4, valueTypeTimestampISO8601:
+			scp.rowsCount += uint64(len(rowIndexes))
+			return 0
+		default:
+			logger.Panicf("BUG: unknown valueType=%d", c.valueType)
+			return 0
+		}
+	}
+
+	// Slow path - count rows with at least a single non-empty field enumerated inside count()
+	return updateStatsForRowsDefault(scp, sf, br, rowIndexes)
+}
+
+func (scp *statsCountProcessor) updateStatsForRowsRange(sf statsFunc, br *blockResult, startIdx, rowsCount int) int {
+	sc := sf.(*statsCount)
+	if len(sc.fields) == 0 {
+		// Fast path - unconditionally count all the rows in the range
+		scp.rowsCount += uint64(rowsCount)
+		return 0
+	}
+
+	for rowIdx := startIdx; rowIdx < startIdx+rowsCount; rowIdx++ {
+		scp.updateStatsForRow(sf, br, rowIdx)
+	}
+	return 0
+}
+
 func (scp *statsCountProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsCountProcessor)
 	scp.rowsCount += src.rowsCount
@@ -207,3 +275,18 @@ func parseStatsCount(lex *lexer) (*statsCount, error) {
 	}
 	return sc, nil
 }
+
+// parseStatsCountIf parses 'countif(filter)', which is a shorthand for 'count() if (filter)'.
+func parseStatsCountIf(lex *lexer) (*statsCount, *ifFilter, error) {
+	if !lex.isKeyword("countif") {
+		return nil, nil, fmt.Errorf("unexpected token %q; expecting 'countif'", lex.token)
+	}
+	lex.nextToken()
+
+	iff, err := parseIfFilterArgs(lex, "countif")
+	if err != nil {
+		return nil, nil, err
+	}
+	sc := &statsCount{}
+	return sc, iff, nil
+}
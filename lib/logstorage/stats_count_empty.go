@@ -185,6 +185,10 @@ func (scp *statsCountEmptyProcessor) updateStatsForRow(sf statsFunc, br *blockRe
 	return 0
 }
 
+func (scp *statsCountEmptyProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(scp, sf, br, rowIndexes)
+}
+
 func (scp *statsCountEmptyProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsCountEmptyProcessor)
 	scp.rowsCount += src.rowsCount
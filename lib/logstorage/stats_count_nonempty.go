@@ -0,0 +1,184 @@
+package logstorage
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+type statsCountNonEmpty struct {
+	fields []string
+}
+
+func (sc *statsCountNonEmpty) String() string {
+	return "count_nonempty(" + statsFuncFieldsToString(sc.fields) + ")"
+}
+
+func (sc *statsCountNonEmpty) updateNeededFields(neededFields fieldsSet) {
+	updateNeededFieldsForStatsFunc(neededFields, sc.fields)
+}
+
+func (sc *statsCountNonEmpty) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsCountNonEmptyProcessor()
+}
+
+type statsCountNonEmptyProcessor struct {
+	rowsCount uint64
+}
+
+func (scp *statsCountNonEmptyProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sc := sf.(*statsCountNonEmpty)
+	fields := sc.fields
+	if len(fields) == 0 {
+		bm := getBitmap(br.rowsLen)
+		bm.setBits()
+		for _, c := range br.getColumns() {
+			values := c.getValues(br)
+			bm.forEachSetBit(func(idx int) bool {
+				return values[idx] == ""
+			})
+		}
+		scp.rowsCount += uint64(br.rowsLen - bm.onesCount())
+		putBitmap(bm)
+		return 0
+	}
+	if len(fields) == 1 {
+		// Fast path for count_nonempty(single_column)
+		c := br.getColumnByName(fields[0])
+		if c.isConst {
+			if c.valuesEncoded[0] != "" {
+				scp.rowsCount += uint64(br.rowsLen)
+			}
+			return 0
+		}
+		if c.isTime {
+			scp.rowsCount += uint64(br.rowsLen)
+			return 0
+		}
+		switch c.valueType {
+		case valueTypeString:
+			for _, v := range c.getValuesEncoded(br) {
+				if v != "" {
+					scp.rowsCount++
+				}
+			}
+			return 0
+		case valueTypeDict:
+			zeroDictIdx := slices.Index(c.dictValues, "")
+			if zeroDictIdx < 0 {
+				scp.rowsCount += uint64(br.rowsLen)
+				return 0
+			}
+			for _, v := range c.getValuesEncoded(br) {
+				if int(v[0]) != zeroDictIdx {
+					scp.rowsCount++
+				}
+			}
+			return 0
+		case valueTypeUint8, valueTypeUint16, valueTypeUint32, valueTypeUint64, valueTypeInt64,
+			valueTypeFloat64, valueTypeIPv4, valueTypeTimestampISO8601:
+			scp.rowsCount += uint64(br.rowsLen)
+			return 0
+		default:
+			logger.Panicf("BUG: unknown valueType=%d", c.valueType)
+			return 0
+		}
+	}
+
+	// Slow path - count rows containing at least a single non-empty value for the fields enumerated inside count_nonempty().
+	// This is the complement of count_empty() for the same fields.
+	bm := getBitmap(br.rowsLen)
+	defer putBitmap(bm)
+
+	bm.setBits()
+	for _, f := range fields {
+		c := br.getColumnByName(f)
+		if c.isConst {
+			if c.valuesEncoded[0] != "" {
+				scp.rowsCount += uint64(br.rowsLen)
+				return 0
+			}
+			continue
+		}
+		if c.isTime {
+			scp.rowsCount += uint64(br.rowsLen)
+			return 0
+		}
+		switch c.valueType {
+		case valueTypeString:
+			valuesEncoded := c.getValuesEncoded(br)
+			bm.forEachSetBit(func(i int) bool {
+				return valuesEncoded[i] == ""
+			})
+		case valueTypeDict:
+			if !slices.Contains(c.dictValues, "") {
+				scp.rowsCount += uint64(br.rowsLen)
+				return 0
+			}
+			valuesEncoded := c.getValuesEncoded(br)
+			bm.forEachSetBit(func(i int) bool {
+				dictIdx := valuesEncoded[i][0]
+				return c.dictValues[dictIdx] == ""
+			})
+		case valueTypeUint8, valueTypeUint16, valueTypeUint32, valueTypeUint64, valueTypeInt64,
+			valueTypeFloat64, valueTypeIPv4, valueTypeTimestampISO8601:
+			scp.rowsCount += uint64(br.rowsLen)
+			return 0
+		default:
+			logger.Panicf("BUG: unknown valueType=%d", c.valueType)
+			return 0
+		}
+	}
+
+	scp.rowsCount += uint64(br.rowsLen - bm.onesCount())
+	return 0
+}
+
+func (scp *statsCountNonEmptyProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sc := sf.(*statsCountNonEmpty)
+	fields := sc.fields
+	if len(fields) == 0 {
+		for _, c := range br.getColumns() {
+			if v := c.getValueAtRow(br, rowIdx); v != "" {
+				scp.rowsCount++
+				return 0
+			}
+		}
+		return 0
+	}
+
+	// Count the row at rowIdx if at least a single field enumerated inside count_nonempty() is non-empty
+	for _, f := range fields {
+		c := br.getColumnByName(f)
+		if v := c.getValueAtRow(br, rowIdx); v != "" {
+			scp.rowsCount++
+			return 0
+		}
+	}
+	return 0
+}
+
+func (scp *statsCountNonEmptyProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(scp, sf, br, rowIndexes)
+}
+
+func (scp *statsCountNonEmptyProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsCountNonEmptyProcessor)
+	scp.rowsCount += src.rowsCount
+}
+
+func (scp *statsCountNonEmptyProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	return strconv.AppendUint(dst, scp.rowsCount, 10)
+}
+
+func parseStatsCountNonEmpty(lex *lexer) (*statsCountNonEmpty, error) {
+	fields, err := parseStatsFuncFields(lex, "count_nonempty")
+	if err != nil {
+		return nil, err
+	}
+	sc := &statsCountNonEmpty{
+		fields: fields,
+	}
+	return sc, nil
+}
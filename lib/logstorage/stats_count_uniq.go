@@ -15,10 +15,19 @@ import (
 type statsCountUniq struct {
 	fields []string
 	limit  uint64
+
+	// isExact is set if 'exact' keyword is specified after count_uniq(...).
+	//
+	// It guarantees that the exact number of unique values is returned regardless of the memory usage,
+	// so it cannot be combined with 'limit'.
+	isExact bool
 }
 
 func (su *statsCountUniq) String() string {
 	s := "count_uniq(" + statsFuncFieldsToString(su.fields) + ")"
+	if su.isExact {
+		s += " exact"
+	}
 	if su.limit > 0 {
 		s += fmt.Sprintf(" limit %d", su.limit)
 	}
@@ -326,6 +335,10 @@ func (sup *statsCountUniqProcessor) updateStatsForRow(sf statsFunc, br *blockRes
 	return sup.updateStateString(keyBuf)
 }
 
+func (sup *statsCountUniqProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sup, sf, br, rowIndexes)
+}
+
 func (sup *statsCountUniqProcessor) updateStatsForAllRowsSingleColumn(br *blockResult, columnName string) int {
 	stateSizeIncrease := 0
 	c := br.getColumnByName(columnName)
@@ -697,15 +710,29 @@ func (sup *statsCountUniqProcessor) limitReached(su *statsCountUniq) bool {
 	return sup.entriesCount() > limit
 }
 
-func parseStatsCountUniq(lex *lexer) (*statsCountUniq, error) {
+// parseStatsCountUniq parses 'count_uniq(...)' stats func.
+//
+// It returns statsCountUniqHash if 'hashed' keyword is specified after 'count_uniq(...)'.
+func parseStatsCountUniq(lex *lexer) (statsFunc, error) {
 	fields, err := parseStatsFuncFields(lex, "count_uniq")
 	if err != nil {
 		return nil, err
 	}
+	if lex.isKeyword("hashed") {
+		lex.nextToken()
+		return parseStatsCountUniqHashed(lex, fields)
+	}
 	su := &statsCountUniq{
 		fields: fields,
 	}
+	if lex.isKeyword("exact") {
+		lex.nextToken()
+		su.isExact = true
+	}
 	if lex.isKeyword("limit") {
+		if su.isExact {
+			return nil, fmt.Errorf("'limit' cannot be used together with 'exact' in 'count_uniq', since it returns inexact results")
+		}
 		lex.nextToken()
 		n, ok := tryParseUint64(lex.token)
 		if !ok {
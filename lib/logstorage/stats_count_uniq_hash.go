@@ -1,7 +1,11 @@
 package logstorage
 
 import (
+	"encoding/base64"
 	"fmt"
+	"math"
+	"math/bits"
+	"slices"
 	"strconv"
 	"sync"
 
@@ -9,18 +13,58 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 )
 
 type statsCountUniqHash struct {
 	fields []string
 	limit  uint64
+
+	// withError is set if 'with error' is specified after count_uniq_hash(...).
+	//
+	// In this case the result is returned as JSON object with the estimated number of unique values
+	// and the expected relative error for the estimate.
+	withError bool
+
+	// withSketch is set if 'with sketch' is specified after count_uniq_hash(...).
+	//
+	// In this case the HyperLogLog sketch is returned instead of the estimated number of unique values.
+	// See marshalCountUniqHashSketch for the sketch format.
+	withSketch bool
+
+	// isCountUniqHashed is set if the func is specified as 'count_uniq(...) hashed'.
+	isCountUniqHashed bool
+
+	// precision is the HyperLogLog precision set via 'count_uniq_hash(..., precision=N)'.
+	//
+	// If it is zero, then unique hashes are counted exactly.
+	// Otherwise the number of unique hashes is estimated with HyperLogLog sketch containing 2^precision registers.
+	precision uint8
 }
 
+const (
+	statsCountUniqHashMinPrecision = 4
+	statsCountUniqHashMaxPrecision = 18
+)
+
 func (su *statsCountUniqHash) String() string {
-	s := "count_uniq_hash(" + statsFuncFieldsToString(su.fields) + ")"
+	args := statsFuncFieldsToString(su.fields)
+	if su.precision > 0 {
+		args += fmt.Sprintf(", precision=%d", su.precision)
+	}
+	s := "count_uniq_hash(" + args + ")"
+	if su.isCountUniqHashed {
+		s = "count_uniq(" + statsFuncFieldsToString(su.fields) + ") hashed"
+	}
 	if su.limit > 0 {
 		s += fmt.Sprintf(" limit %d", su.limit)
 	}
+	if su.withError {
+		s += " with error"
+	}
+	if su.withSketch {
+		s += " with sketch"
+	}
 	return s
 }
 
@@ -31,6 +75,9 @@ func (su *statsCountUniqHash) updateNeededFields(neededFields fieldsSet) {
 func (su *statsCountUniqHash) newStatsProcessor(a *chunkedAllocator) statsProcessor {
 	sup := a.newStatsCountUniqHashProcessor()
 	sup.a = a
+	if su.precision > 0 {
+		sup.registers = a.newCountUniqHashRegisters(1 << su.precision)
+	}
 	return sup
 }
 
@@ -54,6 +101,11 @@ type statsCountUniqHashProcessor struct {
 	// shardss is used for collecting shards from other statsCountUniqProcessor instances at mergeState().
 	shardss [][]statsCountUniqHashSet
 
+	// registers contains HyperLogLog registers if statsCountUniqHash.precision is set.
+	//
+	// uniqValues and shards aren't used in this case.
+	registers []uint8
+
 	columnValues [][]string
 	keyBuf       []byte
 	tmpNum       int
@@ -260,6 +312,10 @@ func (sup *statsCountUniqHashProcessor) updateStatsForRow(sf statsFunc, br *bloc
 	return sup.updateStateString(keyBuf)
 }
 
+func (sup *statsCountUniqHashProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sup, sf, br, rowIndexes)
+}
+
 func (sup *statsCountUniqHashProcessor) updateStatsForAllRowsSingleColumn(br *blockResult, columnName string) int {
 	stateSizeIncrease := 0
 	c := br.getColumnByName(columnName)
@@ -437,6 +493,11 @@ func (sup *statsCountUniqHashProcessor) mergeState(a *chunkedAllocator, sf stats
 
 	src := sfp.(*statsCountUniqHashProcessor)
 
+	if sup.registers != nil {
+		mergeCountUniqHashRegisters(sup.registers, src.registers)
+		return
+	}
+
 	if sup.shards == nil {
 		if src.shards == nil {
 			sup.uniqValues.mergeState(&src.uniqValues, nil)
@@ -455,8 +516,15 @@ func (sup *statsCountUniqHashProcessor) mergeState(a *chunkedAllocator, sf stats
 }
 
 func (sup *statsCountUniqHashProcessor) finalizeStats(sf statsFunc, dst []byte, stopCh <-chan struct{}) []byte {
+	su := sf.(*statsCountUniqHash)
+	if su.withSketch {
+		return marshalCountUniqHashSketch(dst, sup.registers)
+	}
+
 	n := sup.entriesCount()
-	if len(sup.shardss) > 0 {
+	if sup.registers != nil {
+		n = estimateCountUniqHashRegisters(sup.registers)
+	} else if len(sup.shardss) > 0 {
 		if sup.shards != nil {
 			sup.shardss = append(sup.shardss, sup.shards)
 			sup.shards = nil
@@ -464,11 +532,205 @@ func (sup *statsCountUniqHashProcessor) finalizeStats(sf statsFunc, dst []byte,
 		n = countUniqHashParallel(sup.shardss, stopCh)
 	}
 
-	su := sf.(*statsCountUniqHash)
 	if limit := su.limit; limit > 0 && n > limit {
 		n = limit
 	}
-	return strconv.AppendUint(dst, n, 10)
+	if !su.withError {
+		return strconv.AppendUint(dst, n, 10)
+	}
+
+	dst = append(dst, `{"count":`...)
+	dst = strconv.AppendUint(dst, n, 10)
+	dst = append(dst, `,"relative_error":`...)
+	relativeError := getCountUniqHashRelativeError(n)
+	if sup.registers != nil {
+		relativeError = getCountUniqHashRegistersRelativeError(sup.registers)
+	}
+	dst = strconv.AppendFloat(dst, relativeError, 'g', 4, 64)
+	dst = append(dst, '}')
+	return dst
+}
+
+// getCountUniqHashRelativeError returns the expected relative error for count_uniq_hash() result n.
+//
+// count_uniq_hash() counts unique 64-bit hashes of values, so the only source of the error is hash collisions.
+// The expected number of colliding pairs among n unique values is n*(n-1)/2/2^64,
+// so the expected relative error is (n-1)/2^65.
+func getCountUniqHashRelativeError(n uint64) float64 {
+	if n <= 1 {
+		return 0
+	}
+	return float64(n-1) / (1 << 65)
+}
+
+// getCountUniqHashRegistersRelativeError returns the standard error for the estimate obtained from the given HyperLogLog registers.
+func getCountUniqHashRegistersRelativeError(registers []uint8) float64 {
+	return 1.04 / math.Sqrt(float64(len(registers)))
+}
+
+// updateCountUniqHashRegisters registers the hash h in HyperLogLog registers.
+//
+// The number of registers must be a power of two.
+func updateCountUniqHashRegisters(registers []uint8, h uint64) {
+	p := uint(bits.TrailingZeros(uint(len(registers))))
+	idx := h >> (64 - p)
+	// Set the lowest bit after the shift in order to limit the rank by 64-p+1.
+	w := (h << p) | (1 << (p - 1))
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > registers[idx] {
+		registers[idx] = rank
+	}
+}
+
+// hashCountUniqHashUint64 returns the hash for n, which can be passed to updateCountUniqHashRegisters.
+//
+// isNegative must be set if n contains negative int64 number. This allows distinguishing it from uint64 number with the same binary representation.
+func hashCountUniqHashUint64(n uint64, isNegative bool) uint64 {
+	var buf [9]byte
+	b := encoding.MarshalUint64(buf[:0], n)
+	if isNegative {
+		b = append(b, '-')
+	}
+	return xxhash.Sum64(b)
+}
+
+// mergeCountUniqHashRegisters merges src HyperLogLog registers into dst.
+func mergeCountUniqHashRegisters(dst, src []uint8) {
+	if len(dst) != len(src) {
+		logger.Panicf("BUG: cannot merge count_uniq_hash sketches with distinct precisions; got %d and %d registers", len(dst), len(src))
+	}
+	for i, rank := range src {
+		if rank > dst[i] {
+			dst[i] = rank
+		}
+	}
+}
+
+// foldCountUniqHashRegisters merges src HyperLogLog registers into dst registers with lower or equal precision.
+//
+// The resulting dst registers are identical to the registers obtained by registering the original hashes directly in dst.
+func foldCountUniqHashRegisters(dst, src []uint8) {
+	dstPrecision := uint(bits.TrailingZeros(uint(len(dst))))
+	srcPrecision := uint(bits.TrailingZeros(uint(len(src))))
+	if dstPrecision > srcPrecision {
+		logger.Panicf("BUG: cannot fold count_uniq_hash sketch with precision=%d into sketch with bigger precision=%d", srcPrecision, dstPrecision)
+	}
+	d := srcPrecision - dstPrecision
+	if d == 0 {
+		mergeCountUniqHashRegisters(dst, src)
+		return
+	}
+
+	// The lower d bits of src register index become the leading bits of the hash part used for calculating the rank in dst.
+	mask := uint64(1)<<d - 1
+	for i, rank := range src {
+		if rank == 0 {
+			continue
+		}
+		if r := uint64(i) & mask; r != 0 {
+			rank = uint8(d-uint(bits.Len64(r))) + 1
+		} else {
+			rank += uint8(d)
+		}
+		idx := i >> d
+		if rank > dst[idx] {
+			dst[idx] = rank
+		}
+	}
+}
+
+// countUniqHashSketchVersion is the version of the serialized count_uniq_hash sketch format.
+const countUniqHashSketchVersion = 1
+
+// marshalCountUniqHashSketch appends the serialized HyperLogLog registers to dst and returns the result.
+//
+// The serialized sketch is the standard base64 encoding (RFC 4648 with padding) of the following bytes:
+//
+//   - 1 byte: the format version; it must equal to countUniqHashSketchVersion
+//   - 1 byte: the precision P in the range [statsCountUniqHashMinPrecision..statsCountUniqHashMaxPrecision]
+//   - 2^P bytes: HyperLogLog registers; every register must be in the range [0..64-P+1]
+//
+// Empty string is returned for nil registers.
+func marshalCountUniqHashSketch(dst, registers []uint8) []byte {
+	if registers == nil {
+		return dst
+	}
+	precision := uint8(bits.TrailingZeros(uint(len(registers))))
+	bb := bbPool.Get()
+	bb.B = append(bb.B[:0], countUniqHashSketchVersion, precision)
+	bb.B = append(bb.B, registers...)
+	dst = base64.StdEncoding.AppendEncode(dst, bb.B)
+	bbPool.Put(bb)
+	return dst
+}
+
+// unmarshalCountUniqHashSketch unmarshals HyperLogLog registers from the sketch s serialized with marshalCountUniqHashSketch.
+//
+// The registers are appended to dst. The function returns the result and the sketch precision.
+func unmarshalCountUniqHashSketch(dst []uint8, s string) ([]uint8, uint8, error) {
+	dstLen := len(dst)
+	dst, err := base64.StdEncoding.AppendDecode(dst, bytesutil.ToUnsafeBytes(s))
+	if err != nil {
+		return dst[:dstLen], 0, fmt.Errorf("cannot decode base64-encoded sketch: %w", err)
+	}
+	b := dst[dstLen:]
+	if len(b) < 2 {
+		return dst[:dstLen], 0, fmt.Errorf("too short sketch; got %d bytes; want at least 2 bytes", len(b))
+	}
+	if b[0] != countUniqHashSketchVersion {
+		return dst[:dstLen], 0, fmt.Errorf("unsupported sketch version; got %d; want %d", b[0], countUniqHashSketchVersion)
+	}
+	precision := b[1]
+	if precision < statsCountUniqHashMinPrecision || precision > statsCountUniqHashMaxPrecision {
+		return dst[:dstLen], 0, fmt.Errorf("unexpected sketch precision=%d; it must be in the range [%d..%d]", precision, statsCountUniqHashMinPrecision, statsCountUniqHashMaxPrecision)
+	}
+	registers := b[2:]
+	if len(registers) != 1<<precision {
+		return dst[:dstLen], 0, fmt.Errorf("unexpected number of registers in the sketch with precision=%d; got %d; want %d", precision, len(registers), 1<<precision)
+	}
+	maxRank := 64 - precision + 1
+	for i, rank := range registers {
+		if rank > maxRank {
+			return dst[:dstLen], 0, fmt.Errorf("unexpected value for the register #%d in the sketch with precision=%d; got %d; want up to %d", i, precision, rank, maxRank)
+		}
+	}
+
+	// Drop the header
+	copy(dst[dstLen:], registers)
+	dst = dst[:dstLen+len(registers)]
+
+	return dst, precision, nil
+}
+
+// estimateCountUniqHashRegisters returns the estimated number of unique hashes registered in HyperLogLog registers.
+func estimateCountUniqHashRegisters(registers []uint8) uint64 {
+	m := float64(len(registers))
+	var alpha float64
+	switch len(registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	sum := float64(0)
+	zeros := 0
+	for _, rank := range registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Use linear counting for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
 }
 
 func countUniqHashParallel(shardss [][]statsCountUniqHashSet, stopCh <-chan struct{}) uint64 {
@@ -531,6 +793,10 @@ func (sup *statsCountUniqHashProcessor) updateStateInt64(n int64) int {
 
 func (sup *statsCountUniqHashProcessor) updateStateString(v []byte) int {
 	h := xxhash.Sum64(v)
+	if sup.registers != nil {
+		updateCountUniqHashRegisters(sup.registers, h)
+		return 0
+	}
 	if sup.shards == nil {
 		stateSizeIncrease := sup.uniqValues.updateStateStringHash(h)
 		if stateSizeIncrease > 0 {
@@ -547,6 +813,10 @@ func (sup *statsCountUniqHashProcessor) updateStateStringHash(h uint64) int {
 }
 
 func (sup *statsCountUniqHashProcessor) updateStateTimestamp(ts int64) int {
+	if sup.registers != nil {
+		updateCountUniqHashRegisters(sup.registers, hashCountUniqHashUint64(uint64(ts), false))
+		return 0
+	}
 	if sup.shards == nil {
 		stateSizeIncrease := sup.uniqValues.updateStateTimestamp(ts)
 		if stateSizeIncrease > 0 {
@@ -559,6 +829,10 @@ func (sup *statsCountUniqHashProcessor) updateStateTimestamp(ts int64) int {
 }
 
 func (sup *statsCountUniqHashProcessor) updateStateUint64(n uint64) int {
+	if sup.registers != nil {
+		updateCountUniqHashRegisters(sup.registers, hashCountUniqHashUint64(n, false))
+		return 0
+	}
 	if sup.shards == nil {
 		stateSizeIncrease := sup.uniqValues.updateStateUint64(n)
 		if stateSizeIncrease > 0 {
@@ -571,6 +845,10 @@ func (sup *statsCountUniqHashProcessor) updateStateUint64(n uint64) int {
 }
 
 func (sup *statsCountUniqHashProcessor) updateStateNegativeInt64(n int64) int {
+	if sup.registers != nil {
+		updateCountUniqHashRegisters(sup.registers, hashCountUniqHashUint64(uint64(n), true))
+		return 0
+	}
 	if sup.shards == nil {
 		stateSizeIncrease := sup.uniqValues.updateStateNegativeInt64(n)
 		if stateSizeIncrease > 0 {
@@ -629,6 +907,11 @@ func (sup *statsCountUniqHashProcessor) getShardByUint64(n uint64) *statsCountUn
 }
 
 func (sup *statsCountUniqHashProcessor) limitReached(su *statsCountUniqHash) bool {
+	if sup.registers != nil {
+		// HyperLogLog sketch has fixed size, so there is no need in stopping early.
+		// The limit is applied at finalizeStats().
+		return false
+	}
 	limit := su.limit
 	if limit <= 0 {
 		return false
@@ -637,12 +920,17 @@ func (sup *statsCountUniqHashProcessor) limitReached(su *statsCountUniqHash) boo
 }
 
 func parseStatsCountUniqHash(lex *lexer) (*statsCountUniqHash, error) {
-	fields, err := parseStatsFuncFields(lex, "count_uniq_hash")
+	if !lex.isKeyword("count_uniq_hash") {
+		return nil, fmt.Errorf("unexpected func; got %q; want 'count_uniq_hash'", lex.token)
+	}
+	lex.nextToken()
+	fields, precision, err := parseStatsCountUniqHashArgs(lex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot parse 'count_uniq_hash' args: %w", err)
 	}
 	su := &statsCountUniqHash{
-		fields: fields,
+		fields:    fields,
+		precision: precision,
 	}
 	if lex.isKeyword("limit") {
 		lex.nextToken()
@@ -653,6 +941,111 @@ func parseStatsCountUniqHash(lex *lexer) (*statsCountUniqHash, error) {
 		lex.nextToken()
 		su.limit = n
 	}
+	if lex.isKeyword("with") {
+		// Distinguish 'with error' and 'with sketch' from the result name 'with'.
+		ls := lex.backupState()
+		lex.nextToken()
+		switch {
+		case lex.isKeyword("error"):
+			lex.nextToken()
+			su.withError = true
+		case lex.isKeyword("sketch"):
+			lex.nextToken()
+			su.withSketch = true
+		default:
+			lex.restoreState(ls)
+		}
+	}
+	if su.withSketch {
+		if su.precision == 0 {
+			return nil, fmt.Errorf("'with sketch' requires 'precision=N' arg for 'count_uniq_hash'")
+		}
+		if su.limit > 0 {
+			return nil, fmt.Errorf("'limit' cannot be used together with 'with sketch' for 'count_uniq_hash'")
+		}
+	}
+	return su, nil
+}
+
+// parseStatsCountUniqHashArgs parses '(fields, precision=N)' args for count_uniq_hash.
+//
+// precision=N is optional. Zero precision is returned if it is missing.
+func parseStatsCountUniqHashArgs(lex *lexer) ([]string, uint8, error) {
+	if !lex.isKeyword("(") {
+		return nil, 0, fmt.Errorf("missing `(`")
+	}
+	var fields []string
+	precision := uint8(0)
+loop:
+	for {
+		lex.nextToken()
+		if lex.isKeyword(")") {
+			lex.nextToken()
+			break
+		}
+		if lex.isKeyword(",") {
+			return nil, 0, fmt.Errorf("unexpected `,`")
+		}
+		if lex.isKeyword("precision") {
+			// Distinguish 'precision=N' from the field name 'precision'.
+			ls := lex.backupState()
+			lex.nextToken()
+			if lex.isKeyword("=") {
+				lex.nextToken()
+				n, ok := tryParseUint64(lex.token)
+				if !ok {
+					return nil, 0, fmt.Errorf("cannot parse 'precision=%s'", lex.token)
+				}
+				if n < statsCountUniqHashMinPrecision || n > statsCountUniqHashMaxPrecision {
+					return nil, 0, fmt.Errorf("precision=%d must be in the range [%d..%d]", n, statsCountUniqHashMinPrecision, statsCountUniqHashMaxPrecision)
+				}
+				lex.nextToken()
+				if !lex.isKeyword(")") {
+					return nil, 0, fmt.Errorf("unexpected token after 'precision=%d': %q; expecting ')'", n, lex.token)
+				}
+				lex.nextToken()
+				precision = uint8(n)
+				break
+			}
+			lex.restoreState(ls)
+		}
+		field, err := parseFieldName(lex)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot parse field name: %w", err)
+		}
+		fields = append(fields, field)
+		switch {
+		case lex.isKeyword(")"):
+			lex.nextToken()
+			break loop
+		case lex.isKeyword(","):
+		default:
+			return nil, 0, fmt.Errorf("unexpected token: %q; expecting ',' or ')'", lex.token)
+		}
+	}
+	if len(fields) == 0 || slices.Contains(fields, "*") {
+		fields = nil
+	}
+	return fields, precision, nil
+}
+
+// parseStatsCountUniqHashed parses the remaining part of 'count_uniq(fields) hashed [limit N]'.
+//
+// It is equivalent to 'count_uniq_hash(fields) [limit N]'.
+func parseStatsCountUniqHashed(lex *lexer, fields []string) (*statsCountUniqHash, error) {
+	su := &statsCountUniqHash{
+		fields:            fields,
+		isCountUniqHashed: true,
+	}
+	if lex.isKeyword("limit") {
+		lex.nextToken()
+		n, ok := tryParseUint64(lex.token)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse 'limit %s' for 'count_uniq(...) hashed'", lex.token)
+		}
+		lex.nextToken()
+		su.limit = n
+	}
 	return su, nil
 }
 
@@ -1,6 +1,7 @@
 package logstorage
 
 import (
+	"math"
 	"testing"
 )
 
@@ -16,6 +17,14 @@ func TestParseStatsCountUniqHashSuccess(t *testing.T) {
 	f(`count_uniq_hash(*) limit 10`)
 	f(`count_uniq_hash(a) limit 20`)
 	f(`count_uniq_hash(a, b) limit 5`)
+	f(`count_uniq_hash(a) with error`)
+	f(`count_uniq_hash(a, b) limit 5 with error`)
+	f(`count_uniq_hash(a, precision=4)`)
+	f(`count_uniq_hash(a, b, precision=18) limit 5 with error`)
+	f(`count_uniq_hash(*, precision=14)`)
+	f(`count_uniq_hash(precision)`)
+	f(`count_uniq_hash(precision, a)`)
+	f(`count_uniq_hash(a, precision=10) with sketch`)
 }
 
 func TestParseStatsCountUniqHashFailure(t *testing.T) {
@@ -29,6 +38,16 @@ func TestParseStatsCountUniqHashFailure(t *testing.T) {
 	f(`count_uniq_hash(x) y`)
 	f(`count_uniq_hash(x) limit`)
 	f(`count_uniq_hash(x) limit N`)
+	f(`count_uniq_hash(x) with`)
+	f(`count_uniq_hash(x) with foo`)
+	f(`count_uniq_hash(x, precision=)`)
+	f(`count_uniq_hash(x, precision=foo)`)
+	f(`count_uniq_hash(x, precision=3)`)
+	f(`count_uniq_hash(x, precision=19)`)
+	f(`count_uniq_hash(x, precision=10, y)`)
+	f(`count_uniq_hash(x, precision=10`)
+	f(`count_uniq_hash(x) with sketch`)
+	f(`count_uniq_hash(x, precision=10) limit 5 with sketch`)
 }
 
 func TestStatsCountUniqHash(t *testing.T) {
@@ -37,6 +56,35 @@ func TestStatsCountUniqHash(t *testing.T) {
 		expectPipeResults(t, pipeStr, rows, rowsExpected)
 	}
 
+	f("stats count_uniq_hash(a) with error as x", [][]Field{
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `2`},
+		},
+		{
+			{"a", `2`},
+		},
+		{
+			{"a", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"x", `{"count":3,"relative_error":5.421e-20}`},
+		},
+	})
+
+	f("stats count_uniq_hash(a) with error as x", [][]Field{
+		{
+			{"b", `1`},
+		},
+	}, [][]Field{
+		{
+			{"x", `{"count":0,"relative_error":0}`},
+		},
+	})
+
 	f("stats count_uniq_hash(*) as x", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -371,3 +419,145 @@ func TestStatsCountUniqHash(t *testing.T) {
 		},
 	})
 }
+
+func TestGetCountUniqHashRelativeError(t *testing.T) {
+	f := func(n uint64, errorExpected float64) {
+		t.Helper()
+		e := getCountUniqHashRelativeError(n)
+		if e != errorExpected {
+			t.Fatalf("unexpected relative error for n=%d; got %v; want %v", n, e, errorExpected)
+		}
+	}
+
+	f(0, 0)
+	f(1, 0)
+	f(2, 1.0/(1<<65))
+	f(1<<33+1, 1.0/(1<<32))
+}
+
+func TestStatsCountUniqHashPrecision(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats count_uniq_hash(a, precision=14) as x", [][]Field{
+		{
+			{"a", `foo`},
+		},
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `-1`},
+		},
+		{
+			{"a", `foo`},
+		},
+		{
+			{"a", ``},
+		},
+	}, [][]Field{
+		{
+			{"x", "3"},
+		},
+	})
+
+	f("stats count_uniq_hash(a, precision=14) limit 2 with error as x", [][]Field{
+		{
+			{"a", `foo`},
+		},
+		{
+			{"a", `bar`},
+		},
+		{
+			{"a", `baz`},
+		},
+	}, [][]Field{
+		{
+			{"x", `{"count":2,"relative_error":0.008125}`},
+		},
+	})
+
+	f("stats by (b) count_uniq_hash(a, b, precision=10) as x", [][]Field{
+		{
+			{"a", `1`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `2`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `1`},
+			{"b", `bar`},
+		},
+	}, [][]Field{
+		{
+			{"b", "foo"},
+			{"x", "2"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "1"},
+		},
+	})
+}
+
+func TestCountUniqHashRegisters(t *testing.T) {
+	f := func(precision uint8, n int) {
+		t.Helper()
+
+		registers := make([]uint8, 1<<precision)
+		for i := 0; i < n; i++ {
+			h := hashCountUniqHashUint64(uint64(i), false)
+			updateCountUniqHashRegisters(registers, h)
+			// Duplicate values mustn't change the estimate.
+			updateCountUniqHashRegisters(registers, h)
+		}
+
+		// Merge registers obtained from two halves of the values.
+		a := make([]uint8, len(registers))
+		b := make([]uint8, len(registers))
+		for i := 0; i < n; i++ {
+			dst := a
+			if i%2 == 1 {
+				dst = b
+			}
+			updateCountUniqHashRegisters(dst, hashCountUniqHashUint64(uint64(i), false))
+		}
+		mergeCountUniqHashRegisters(a, b)
+		for i := range registers {
+			if a[i] != registers[i] {
+				t.Fatalf("unexpected register #%d after merge; got %d; want %d", i, a[i], registers[i])
+			}
+		}
+
+		estimate := estimateCountUniqHashRegisters(registers)
+		relativeError := math.Abs(float64(estimate)-float64(n)) / float64(n)
+		maxRelativeError := 4 * getCountUniqHashRegistersRelativeError(registers)
+		if relativeError > maxRelativeError {
+			t.Fatalf("too big relative error for precision=%d, n=%d; got %v; want no more than %v; estimate: %d", precision, n, relativeError, maxRelativeError, estimate)
+		}
+	}
+
+	f(4, 10)
+	f(4, 1000)
+	f(10, 100)
+	f(10, 100_000)
+	f(14, 1000)
+	f(14, 1_000_000)
+	f(18, 1_000_000)
+}
+
+func TestCountUniqHashRegistersNegative(t *testing.T) {
+	registers := make([]uint8, 1<<14)
+	for i := uint64(1); i <= 1000; i++ {
+		updateCountUniqHashRegisters(registers, hashCountUniqHashUint64(i, false))
+		updateCountUniqHashRegisters(registers, hashCountUniqHashUint64(i, true))
+	}
+	estimate := estimateCountUniqHashRegisters(registers)
+	if estimate < 1900 || estimate > 2100 {
+		t.Fatalf("unexpected estimate; got %d; want close to 2000", estimate)
+	}
+}
@@ -16,6 +16,11 @@ func TestParseStatsCountUniqSuccess(t *testing.T) {
 	f(`count_uniq(*) limit 10`)
 	f(`count_uniq(a) limit 20`)
 	f(`count_uniq(a, b) limit 5`)
+	f(`count_uniq(*) exact`)
+	f(`count_uniq(a, b) exact`)
+	f(`count_uniq(*) hashed`)
+	f(`count_uniq(a, b) hashed`)
+	f(`count_uniq(a) hashed limit 10`)
 }
 
 func TestParseStatsCountUniqFailure(t *testing.T) {
@@ -29,6 +34,13 @@ func TestParseStatsCountUniqFailure(t *testing.T) {
 	f(`count_uniq(x) y`)
 	f(`count_uniq(x) limit`)
 	f(`count_uniq(x) limit N`)
+	f(`count_uniq(x) exact limit 10`)
+	f(`count_uniq(x) exact exact`)
+	f(`count_uniq(x) hashed exact`)
+	f(`count_uniq(x) exact hashed`)
+	f(`count_uniq(x) hashed hashed`)
+	f(`count_uniq(x) hashed limit`)
+	f(`count_uniq(x) limit 10 hashed`)
 }
 
 func TestStatsCountUniq(t *testing.T) {
@@ -100,6 +112,24 @@ func TestStatsCountUniq(t *testing.T) {
 		},
 	})
 
+	f("stats count_uniq(*) exact as x", [][]Field{
+		{
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `2`},
+			{"b", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", "2"},
+		},
+	})
+
 	f("stats count_uniq(b) as x", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -371,3 +401,58 @@ func TestStatsCountUniq(t *testing.T) {
 		},
 	})
 }
+
+func TestStatsCountUniqHashed(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"a", `https://example.com/foo`},
+			{"b", `3`},
+		},
+		{
+			{"a", `https://example.com/bar`},
+			{"b", `3`},
+		},
+		{
+			{"a", `https://example.com/foo`},
+			{"b", `4`},
+		},
+		{
+			{"b", `5`},
+		},
+	}
+
+	f("stats count_uniq(a) hashed as x", rows, [][]Field{
+		{
+			{"x", "2"},
+		},
+	})
+	f("stats count_uniq(a, b) hashed as x", rows, [][]Field{
+		{
+			{"x", "4"},
+		},
+	})
+	f("stats by (b) count_uniq(a) hashed as x", rows, [][]Field{
+		{
+			{"b", "3"},
+			{"x", "2"},
+		},
+		{
+			{"b", "4"},
+			{"x", "1"},
+		},
+		{
+			{"b", "5"},
+			{"x", "0"},
+		},
+	})
+	f("stats count_uniq(a) hashed limit 1 as x", rows, [][]Field{
+		{
+			{"x", "1"},
+		},
+	})
+}
@@ -0,0 +1,117 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+)
+
+// statsDelta calculates the difference between the last and the first values of the field ordered by _time.
+//
+// Unlike rate_counter(), it doesn't detect counter resets and it doesn't divide the result by the step.
+type statsDelta struct {
+	field string
+}
+
+func (sd *statsDelta) String() string {
+	return "delta(" + quoteTokenIfNeeded(sd.field) + ")"
+}
+
+func (sd *statsDelta) updateNeededFields(neededFields fieldsSet) {
+	neededFields.add(sd.field)
+	neededFields.add("_time")
+}
+
+func (sd *statsDelta) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsDeltaProcessor()
+}
+
+type statsDeltaProcessor struct {
+	// first is the value with the smallest _time seen so far.
+	first timestampedValue
+
+	// last is the value with the biggest _time seen so far.
+	last timestampedValue
+
+	// hasValue is set if at least a single value is seen.
+	hasValue bool
+}
+
+func (sdp *statsDeltaProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sd := sf.(*statsDelta)
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		sdp.updateStatsForRow(sd, br, rowIdx)
+	}
+	return 0
+}
+
+func (sdp *statsDeltaProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sd := sf.(*statsDelta)
+
+	c := br.getColumnByName(sd.field)
+	f, ok := c.getFloatValueAtRow(br, rowIdx)
+	if !ok || math.IsNaN(f) {
+		return 0
+	}
+	timestamp, ok := getTimestampAtRow(br, rowIdx)
+	if !ok {
+		return 0
+	}
+
+	tv := timestampedValue{
+		timestamp: timestamp,
+		value:     f,
+	}
+	sdp.update(tv, tv)
+	return 0
+}
+
+func (sdp *statsDeltaProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sdp, sf, br, rowIndexes)
+}
+
+func (sdp *statsDeltaProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsDeltaProcessor)
+	if !src.hasValue {
+		return
+	}
+	sdp.update(src.first, src.last)
+}
+
+// update updates sdp with the given first and last values.
+//
+// The previously seen values are preferred over the given values with the same timestamps.
+func (sdp *statsDeltaProcessor) update(first, last timestampedValue) {
+	if !sdp.hasValue {
+		sdp.first = first
+		sdp.last = last
+		sdp.hasValue = true
+		return
+	}
+	if first.timestamp < sdp.first.timestamp {
+		sdp.first = first
+	}
+	if last.timestamp > sdp.last.timestamp {
+		sdp.last = last
+	}
+}
+
+func (sdp *statsDeltaProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	if !sdp.hasValue {
+		return marshalFloat64String(dst, nan)
+	}
+	return marshalStatsFloat64String(dst, sdp.last.value-sdp.first.value)
+}
+
+func parseStatsDelta(lex *lexer) (*statsDelta, error) {
+	fields, err := parseStatsFuncFields(lex, "delta")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("'delta' must contain a single field name; got %q", fields)
+	}
+	sd := &statsDelta{
+		field: fields[0],
+	}
+	return sd, nil
+}
@@ -0,0 +1,169 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseStatsDeltaSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`delta(a)`)
+	f(`delta("a b")`)
+}
+
+func TestParseStatsDeltaFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`delta`)
+	f(`delta()`)
+	f(`delta(*)`)
+	f(`delta(a, b)`)
+	f(`delta(a b)`)
+	f(`delta(x) y`)
+}
+
+func TestStatsDelta(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// values in arbitrary order
+	f("stats delta(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:20Z"},
+			{"a", `15`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `2`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `100`},
+		},
+	}, [][]Field{
+		{
+			{"x", "13"},
+		},
+	})
+
+	// counter resets aren't detected
+	f("stats delta(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `10`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `15`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:20Z"},
+			{"a", `3`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"a", `7.5`},
+		},
+	}, [][]Field{
+		{
+			{"x", "-2.5"},
+		},
+	})
+
+	// rows without numeric values or without valid timestamps are ignored
+	f("stats delta(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"a", `foo`},
+		},
+		{
+			{"_time", "bar"},
+			{"a", `100`},
+		},
+		{
+			{"a", `200`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:20Z"},
+			{"a", `4`},
+		},
+	}, [][]Field{
+		{
+			{"x", "3"},
+		},
+	})
+
+	// single value
+	f("stats delta(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1`},
+		},
+	}, [][]Field{
+		{
+			{"x", "0"},
+		},
+	})
+
+	// missing field
+	f("stats delta(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"b", `1`},
+		},
+	}, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+
+	// by group
+	f("stats by (b) delta(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1`},
+			{"b", `foo`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `100`},
+			{"b", `bar`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `5`},
+			{"b", `foo`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `20`},
+			{"b", `bar`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:05Z"},
+			{"a", `-30`},
+			{"b", `bar`},
+		},
+	}, [][]Field{
+		{
+			{"b", "foo"},
+			{"x", "4"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "-80"},
+		},
+	})
+}
@@ -0,0 +1,199 @@
+package logstorage
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+type statsEWMA struct {
+	field string
+
+	// halfLife is the duration in nanoseconds, after which the weight of a sample is halved.
+	halfLife    int64
+	halfLifeStr string
+
+	// isSorted is set if 'sorted' keyword is specified after ewma(...).
+	//
+	// In this case the samples are expected to arrive in the order of their _time,
+	// so the ewma is calculated on the fly without buffering the samples.
+	isSorted bool
+}
+
+func (se *statsEWMA) String() string {
+	s := "ewma(" + quoteTokenIfNeeded(se.field) + ", " + se.halfLifeStr + ")"
+	if se.isSorted {
+		s += " sorted"
+	}
+	return s
+}
+
+func (se *statsEWMA) updateNeededFields(neededFields fieldsSet) {
+	neededFields.add(se.field)
+	neededFields.add("_time")
+}
+
+func (se *statsEWMA) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsEWMAProcessor()
+}
+
+type statsEWMAProcessor struct {
+	// samples contains the buffered samples if statsEWMA.isSorted isn't set.
+	samples []timestampedValue
+
+	// state contains the ewma state if statsEWMA.isSorted is set.
+	state ewmaState
+}
+
+// ewmaState is the state for exponentially weighted moving average over samples ordered by time.
+type ewmaState struct {
+	ewma          float64
+	lastTimestamp int64
+	hasValue      bool
+}
+
+// update updates es with the sample v at the given timestamp.
+//
+// Samples with timestamps smaller or equal to the previous sample timestamp are ignored,
+// since their weight is zero.
+func (es *ewmaState) update(v float64, timestamp, halfLife int64) {
+	if !es.hasValue {
+		es.ewma = v
+		es.lastTimestamp = timestamp
+		es.hasValue = true
+		return
+	}
+	if timestamp <= es.lastTimestamp {
+		return
+	}
+	d := float64(timestamp - es.lastTimestamp)
+	alpha := -math.Expm1(-math.Ln2 * d / float64(halfLife))
+	es.ewma += alpha * (v - es.ewma)
+	es.lastTimestamp = timestamp
+}
+
+func (sep *statsEWMAProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	se := sf.(*statsEWMA)
+	stateSizeIncrease := 0
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		stateSizeIncrease += sep.updateStatsForRow(se, br, rowIdx)
+	}
+	return stateSizeIncrease
+}
+
+func (sep *statsEWMAProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	se := sf.(*statsEWMA)
+
+	c := br.getColumnByName(se.field)
+	f, ok := c.getFloatValueAtRow(br, rowIdx)
+	if !ok || math.IsNaN(f) {
+		return 0
+	}
+	timestamp, ok := getTimestampAtRow(br, rowIdx)
+	if !ok {
+		return 0
+	}
+
+	if se.isSorted {
+		sep.state.update(f, timestamp, se.halfLife)
+		return 0
+	}
+
+	sep.samples = append(sep.samples, timestampedValue{
+		timestamp: timestamp,
+		value:     f,
+	})
+	return int(unsafe.Sizeof(sep.samples[0]))
+}
+
+func (sep *statsEWMAProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sep, sf, br, rowIndexes)
+}
+
+func (sep *statsEWMAProcessor) mergeState(_ *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
+	se := sf.(*statsEWMA)
+	src := sfp.(*statsEWMAProcessor)
+
+	if !se.isSorted {
+		sep.samples = append(sep.samples, src.samples...)
+		return
+	}
+
+	// The states cannot be merged precisely without the original samples,
+	// so the state with the bigger last timestamp is applied as a sample to the other state.
+	if !src.state.hasValue {
+		return
+	}
+	if !sep.state.hasValue {
+		sep.state = src.state
+		return
+	}
+	first, last := sep.state, src.state
+	if last.lastTimestamp < first.lastTimestamp {
+		first, last = last, first
+	}
+	first.update(last.ewma, last.lastTimestamp, se.halfLife)
+	sep.state = first
+}
+
+func (sep *statsEWMAProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	se := sf.(*statsEWMA)
+
+	state := sep.state
+	if !se.isSorted {
+		sortTimestampedValues(sep.samples)
+		for _, s := range sep.samples {
+			state.update(s.value, s.timestamp, se.halfLife)
+		}
+	}
+	if !state.hasValue {
+		return marshalFloat64String(dst, nan)
+	}
+	return marshalStatsFloat64String(dst, state.ewma)
+}
+
+func parseStatsEWMA(lex *lexer) (*statsEWMA, error) {
+	if !lex.isKeyword("ewma") {
+		return nil, fmt.Errorf("unexpected func; got %q; want 'ewma'", lex.token)
+	}
+	lex.nextToken()
+
+	if !lex.isKeyword("(") {
+		return nil, fmt.Errorf("missing '(' after 'ewma'")
+	}
+	lex.nextToken()
+
+	field, err := parseFieldName(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse field name for 'ewma': %w", err)
+	}
+
+	if !lex.isKeyword(",") {
+		return nil, fmt.Errorf("missing half-life after 'ewma(%s'", quoteTokenIfNeeded(field))
+	}
+	lex.nextToken()
+
+	halfLife, halfLifeStr, err := parseDuration(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse half-life for 'ewma(%s': %w", quoteTokenIfNeeded(field), err)
+	}
+	if halfLife <= 0 {
+		return nil, fmt.Errorf("half-life for 'ewma(%s' must be positive; got %s", quoteTokenIfNeeded(field), halfLifeStr)
+	}
+
+	if !lex.isKeyword(")") {
+		return nil, fmt.Errorf("missing ')' after 'ewma(%s, %s'", quoteTokenIfNeeded(field), halfLifeStr)
+	}
+	lex.nextToken()
+
+	se := &statsEWMA{
+		field:       field,
+		halfLife:    halfLife,
+		halfLifeStr: halfLifeStr,
+	}
+	if lex.isKeyword("sorted") {
+		lex.nextToken()
+		se.isSorted = true
+	}
+	return se, nil
+}
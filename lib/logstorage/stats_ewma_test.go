@@ -0,0 +1,200 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseStatsEWMASuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`ewma(a, 5m)`)
+	f(`ewma("a b", 1h30m)`)
+	f(`ewma(a, 10s) sorted`)
+}
+
+func TestParseStatsEWMAFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`ewma`)
+	f(`ewma()`)
+	f(`ewma(a)`)
+	f(`ewma(a,)`)
+	f(`ewma(a, foo)`)
+	f(`ewma(a, 0s)`)
+	f(`ewma(a, -5m)`)
+	f(`ewma(a, 5m, b)`)
+	f(`ewma(a, 5m) y`)
+}
+
+func TestStatsEWMA(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// samples in arbitrary order
+	f("stats ewma(a, 10s) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"a", `12`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `0`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `8`},
+		},
+	}, [][]Field{
+		{
+			{"x", "10"},
+		},
+	})
+
+	// rows without numeric values or without valid timestamps are ignored
+	f("stats ewma(a, 10s) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `2`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:05Z"},
+			{"a", `foo`},
+		},
+		{
+			{"_time", "bar"},
+			{"a", `100`},
+		},
+		{
+			{"a", `100`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `4`},
+		},
+	}, [][]Field{
+		{
+			{"x", "3"},
+		},
+	})
+
+	// single sample
+	f("stats ewma(a, 10s) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1.5`},
+		},
+	}, [][]Field{
+		{
+			{"x", "1.5"},
+		},
+	})
+
+	// missing field
+	f("stats ewma(a, 10s) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"b", `1`},
+		},
+	}, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+
+	// by group
+	f("stats by (b) ewma(a, 10s) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `0`},
+			{"b", `foo`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `100`},
+			{"b", `bar`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `8`},
+			{"b", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"b", "foo"},
+			{"x", "4"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "100"},
+		},
+	})
+}
+
+func TestStatsEWMASorted(t *testing.T) {
+	// The states for sorted samples are merged approximately across workers, so use a single worker for exact results.
+	pipeStr := "stats ewma(a, 10s) sorted as x"
+	lex := newLexer(pipeStr, 0)
+	p, err := parsePipe(lex)
+	if err != nil {
+		t.Fatalf("unexpected error when parsing %q: %s", pipeStr, err)
+	}
+
+	ppTest := newTestPipeProcessor()
+	pp := p.newPipeProcessor(1, nil, func() {}, ppTest)
+	brw := newTestBlockResultWriter(1, pp)
+	for _, row := range [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `0`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `8`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"a", `12`},
+		},
+	} {
+		brw.writeRow(row)
+	}
+	brw.flush()
+	if err := pp.flush(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ppTest.expectRows(t, [][]Field{
+		{
+			{"x", "10"},
+		},
+	})
+}
+
+func TestEWMAStateUpdate(t *testing.T) {
+	halfLife := int64(10e9)
+
+	var es ewmaState
+	es.update(0, 0, halfLife)
+	es.update(8, 10e9, halfLife)
+	if es.ewma != 4 {
+		t.Fatalf("unexpected ewma after one half-life; got %v; want 4", es.ewma)
+	}
+
+	// Samples with the same or older timestamps are ignored.
+	es.update(100, 10e9, halfLife)
+	es.update(100, 5e9, halfLife)
+	if es.ewma != 4 {
+		t.Fatalf("unexpected ewma after out of order samples; got %v; want 4", es.ewma)
+	}
+	if es.lastTimestamp != 10e9 {
+		t.Fatalf("unexpected lastTimestamp; got %d; want %d", es.lastTimestamp, int64(10e9))
+	}
+}
@@ -154,6 +154,10 @@ func (shp *statsHistogramProcessor) updateStatsForRow(sf statsFunc, br *blockRes
 	return 0
 }
 
+func (shp *statsHistogramProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(shp, sf, br, rowIndexes)
+}
+
 func (shp *statsHistogramProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsHistogramProcessor)
 	shp.h.Merge(&src.h)
@@ -0,0 +1,208 @@
+package logstorage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// statsJoinDefaultSeparator is the default separator for join(...) stats function.
+const statsJoinDefaultSeparator = ","
+
+type statsJoin struct {
+	field     string
+	separator string
+	limit     uint64
+}
+
+func (sj *statsJoin) String() string {
+	s := "join(" + quoteTokenIfNeeded(sj.field)
+	if sj.separator != statsJoinDefaultSeparator {
+		s += ", " + strconv.Quote(sj.separator)
+	}
+	s += ")"
+	if sj.limit > 0 {
+		s += fmt.Sprintf(" limit %d", sj.limit)
+	}
+	return s
+}
+
+func (sj *statsJoin) updateNeededFields(neededFields fieldsSet) {
+	neededFields.add(sj.field)
+}
+
+func (sj *statsJoin) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsJoinProcessor()
+}
+
+type statsJoinProcessor struct {
+	// values contains non-empty values for the joined field.
+	//
+	// The values are sorted at finalizeStats, so the result doesn't depend on the order of processed rows.
+	values []string
+
+	// truncated is set if some values were dropped because of the limit.
+	truncated bool
+}
+
+func (sjp *statsJoinProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sj := sf.(*statsJoin)
+	stateSizeIncrease := 0
+
+	c := br.getColumnByName(sj.field)
+	if c.isConst {
+		v := c.valuesEncoded[0]
+		if v == "" {
+			return 0
+		}
+		v = strings.Clone(v)
+		stateSizeIncrease += len(v)
+		for i := 0; i < br.rowsLen; i++ {
+			stateSizeIncrease += sjp.addValue(sj, v)
+		}
+		return stateSizeIncrease
+	}
+
+	vPrev := ""
+	for _, v := range c.getValues(br) {
+		if v == "" {
+			continue
+		}
+		if v != vPrev {
+			vPrev = strings.Clone(v)
+			stateSizeIncrease += len(vPrev)
+		}
+		stateSizeIncrease += sjp.addValue(sj, vPrev)
+	}
+	return stateSizeIncrease
+}
+
+func (sjp *statsJoinProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sj := sf.(*statsJoin)
+
+	c := br.getColumnByName(sj.field)
+	v := c.getValueAtRow(br, rowIdx)
+	if v == "" {
+		return 0
+	}
+	v = strings.Clone(v)
+	return len(v) + sjp.addValue(sj, v)
+}
+
+func (sjp *statsJoinProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sjp, sf, br, rowIndexes)
+}
+
+func (sjp *statsJoinProcessor) addValue(sj *statsJoin, v string) int {
+	sjp.values = append(sjp.values, v)
+	sjp.maybeCompact(sj)
+	return int(unsafe.Sizeof(v))
+}
+
+// maybeCompact drops the values, which cannot get into the result because of the limit.
+//
+// It is called periodically in order to bound memory usage.
+func (sjp *statsJoinProcessor) maybeCompact(sj *statsJoin) {
+	limit := sj.limit
+	if limit == 0 || uint64(len(sjp.values)) <= 2*limit {
+		return
+	}
+	sortStatsJoinValues(sjp.values)
+	clear(sjp.values[limit:])
+	sjp.values = sjp.values[:limit]
+	sjp.truncated = true
+}
+
+func (sjp *statsJoinProcessor) mergeState(_ *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
+	sj := sf.(*statsJoin)
+	src := sfp.(*statsJoinProcessor)
+	sjp.values = append(sjp.values, src.values...)
+	sjp.truncated = sjp.truncated || src.truncated
+	sjp.maybeCompact(sj)
+}
+
+func (sjp *statsJoinProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	sj := sf.(*statsJoin)
+
+	values := sjp.values
+	sortStatsJoinValues(values)
+	truncated := sjp.truncated
+	if limit := sj.limit; limit > 0 && uint64(len(values)) > limit {
+		values = values[:limit]
+		truncated = true
+	}
+
+	for i, v := range values {
+		if i > 0 {
+			dst = append(dst, sj.separator...)
+		}
+		dst = append(dst, v...)
+	}
+	if truncated {
+		dst = append(dst, sj.separator...)
+		dst = append(dst, statsValuesTruncatedMarker...)
+	}
+	return dst
+}
+
+// sortStatsJoinValues sorts a in the same order as the `sort` pipe does.
+func sortStatsJoinValues(a []string) {
+	slices.SortStableFunc(a, func(x, y string) int {
+		if lessString(x, y) {
+			return -1
+		}
+		if lessString(y, x) {
+			return 1
+		}
+		return 0
+	})
+}
+
+func parseStatsJoin(lex *lexer) (*statsJoin, error) {
+	if !lex.isKeyword("join") {
+		return nil, fmt.Errorf("unexpected func; got %q; want 'join'", lex.token)
+	}
+	lex.nextToken()
+
+	if !lex.isKeyword("(") {
+		return nil, fmt.Errorf("missing '(' after 'join'")
+	}
+	lex.nextToken()
+
+	field, err := parseFieldName(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse field name for 'join': %w", err)
+	}
+
+	separator := statsJoinDefaultSeparator
+	if lex.isKeyword(",") {
+		lex.nextToken()
+		s, err := getCompoundToken(lex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse separator for 'join(%s': %w", quoteTokenIfNeeded(field), err)
+		}
+		separator = s
+	}
+
+	if !lex.isKeyword(")") {
+		return nil, fmt.Errorf("missing ')' after 'join(%s'", quoteTokenIfNeeded(field))
+	}
+	lex.nextToken()
+
+	sj := &statsJoin{
+		field:     field,
+		separator: separator,
+	}
+	if lex.isKeyword("limit") {
+		lex.nextToken()
+		n, ok := tryParseUint64(lex.token)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse 'limit %s' for 'join'", lex.token)
+		}
+		lex.nextToken()
+		sj.limit = n
+	}
+	return sj, nil
+}
@@ -0,0 +1,159 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseStatsJoinSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`join(a)`)
+	f(`join("a b")`)
+	f(`join(a, ", ")`)
+	f(`join(a, "")`)
+	f(`join(a, "\n")`)
+	f(`join(a, ";") limit 10`)
+	f(`join(a) limit 10`)
+}
+
+func TestParseStatsJoinFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`join`)
+	f(`join()`)
+	f(`join(a`)
+	f(`join(a,)`)
+	f(`join(a, b, c)`)
+	f(`join(a b)`)
+	f(`join(a) limit`)
+	f(`join(a) limit foo`)
+	f(`join(a) y`)
+}
+
+func TestStatsJoin(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// default separator; empty values are skipped, duplicates are preserved, values are sorted
+	f("stats join(a) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `foo`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `bar`},
+		},
+		{
+			{"_msg", `ghi`},
+		},
+		{
+			{"a", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"x", "bar,foo,foo"},
+		},
+	})
+
+	// custom separator; numeric values are sorted in numeric order
+	f(`stats join(a, ", ") as x`, [][]Field{
+		{
+			{"a", `10`},
+		},
+		{
+			{"a", `9`},
+		},
+		{
+			{"a", `100`},
+		},
+	}, [][]Field{
+		{
+			{"x", "9, 10, 100"},
+		},
+	})
+
+	// limit
+	f(`stats join(a, " ") limit 2 as x`, [][]Field{
+		{
+			{"a", `d`},
+		},
+		{
+			{"a", `c`},
+		},
+		{
+			{"a", `b`},
+		},
+		{
+			{"a", `a`},
+		},
+		{
+			{"a", `e`},
+		},
+		{
+			{"a", `f`},
+		},
+	}, [][]Field{
+		{
+			{"x", "a b " + statsValuesTruncatedMarker},
+		},
+	})
+
+	// limit isn't reached
+	f(`stats join(a) limit 2 as x`, [][]Field{
+		{
+			{"a", `d`},
+		},
+		{
+			{"a", `c`},
+		},
+	}, [][]Field{
+		{
+			{"x", "c,d"},
+		},
+	})
+
+	// missing field
+	f("stats join(a) as x", [][]Field{
+		{
+			{"b", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"x", ""},
+		},
+	})
+
+	// by group
+	f(`stats by (b) join(a, "|") as x`, [][]Field{
+		{
+			{"a", `1`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `2`},
+			{"b", `bar`},
+		},
+		{
+			{"a", `3`},
+			{"b", `foo`},
+		},
+	}, [][]Field{
+		{
+			{"b", "foo"},
+			{"x", "1|3"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "2"},
+		},
+	})
+}
@@ -0,0 +1,340 @@
+package logstorage
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"unsafe"
+)
+
+// statsMAD calculates median absolute deviation - the median of absolute deviations from the median.
+//
+// See https://en.wikipedia.org/wiki/Median_absolute_deviation
+type statsMAD struct {
+	// sq is used for collecting the samples in the same way as median() does.
+	sq *statsQuantile
+
+	// approx is set if the approximate t-digest-based calculation must be used instead of sampling.
+	//
+	// It uses less memory per group at the cost of lower precision.
+	approx bool
+}
+
+func (sm *statsMAD) String() string {
+	s := "mad(" + statsFuncFieldsToString(sm.sq.fields) + ")"
+	if sm.approx {
+		s += " approx"
+	}
+	return s
+}
+
+func (sm *statsMAD) updateNeededFields(neededFields fieldsSet) {
+	updateNeededFieldsForStatsFunc(neededFields, sm.sq.fields)
+}
+
+func (sm *statsMAD) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsMADProcessor()
+}
+
+type statsMADProcessor struct {
+	// sqp holds up to maxHistogramSamples samples if statsMAD.approx isn't set.
+	sqp statsQuantileProcessor
+
+	// td holds t-digest for the samples if statsMAD.approx is set.
+	td tdigest
+}
+
+func (smp *statsMADProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sm := sf.(*statsMAD)
+	if !sm.approx {
+		return smp.sqp.updateStatsForAllRows(sm.sq, br)
+	}
+
+	stateSizeIncrease := 0
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		stateSizeIncrease += smp.updateDigestForRow(sm, br, rowIdx)
+	}
+	return stateSizeIncrease
+}
+
+func (smp *statsMADProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sm := sf.(*statsMAD)
+	if !sm.approx {
+		return smp.sqp.updateStatsForRow(sm.sq, br, rowIdx)
+	}
+	return smp.updateDigestForRow(sm, br, rowIdx)
+}
+
+func (smp *statsMADProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
+func (smp *statsMADProcessor) updateDigestForRow(sm *statsMAD, br *blockResult, rowIdx int) int {
+	td := &smp.td
+	stateSizeIncrease := 0
+
+	fields := sm.sq.fields
+	if len(fields) == 0 {
+		for _, c := range br.getColumns() {
+			if f, ok := c.getFloatValueAtRow(br, rowIdx); ok {
+				stateSizeIncrease += td.add(f, 1)
+			}
+		}
+	} else {
+		for _, field := range fields {
+			c := br.getColumnByName(field)
+			if f, ok := c.getFloatValueAtRow(br, rowIdx); ok {
+				stateSizeIncrease += td.add(f, 1)
+			}
+		}
+	}
+
+	return stateSizeIncrease
+}
+
+func (smp *statsMADProcessor) mergeState(a *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
+	sm := sf.(*statsMAD)
+	src := sfp.(*statsMADProcessor)
+	if !sm.approx {
+		smp.sqp.mergeState(a, sm.sq, &src.sqp)
+		return
+	}
+	smp.td.mergeState(&src.td)
+}
+
+func (smp *statsMADProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	sm := sf.(*statsMAD)
+
+	var mad float64
+	if sm.approx {
+		mad = smp.td.mad()
+	} else {
+		mad = getMADForSamples(smp.sqp.h.a)
+	}
+	if math.IsNaN(mad) {
+		return marshalFloat64String(dst, nan)
+	}
+	return marshalStatsFloat64String(dst, mad)
+}
+
+// getMADForSamples returns median absolute deviation for numeric samples.
+//
+// Non-numeric samples are ignored. NaN is returned if samples do not contain numeric values.
+// The median is selected in the same way as median() does - the value at len/2 position among sorted values.
+func getMADForSamples(samples []string) float64 {
+	a := make([]float64, 0, len(samples))
+	for _, v := range samples {
+		if f, ok := tryParseFloat64(v); ok {
+			a = append(a, f)
+		}
+	}
+	if len(a) == 0 {
+		return nan
+	}
+
+	slices.Sort(a)
+	median := a[len(a)/2]
+	for i, f := range a {
+		a[i] = math.Abs(f - median)
+	}
+	slices.Sort(a)
+	return a[len(a)/2]
+}
+
+func parseStatsMAD(lex *lexer) (*statsMAD, error) {
+	fields, err := parseStatsFuncFields(lex, "mad")
+	if err != nil {
+		return nil, err
+	}
+	sm := &statsMAD{
+		sq: &statsQuantile{
+			fields: fields,
+			phi:    0.5,
+			phiStr: "0.5",
+		},
+	}
+	if lex.isKeyword("approx") {
+		lex.nextToken()
+		sm.approx = true
+	}
+	return sm, nil
+}
+
+// tdigest is a merging t-digest for approximate quantiles calculations over the stream of float64 values with bounded memory usage.
+//
+// See https://arxiv.org/abs/1902.04023
+type tdigest struct {
+	// centroids contains merged centroids sorted by mean.
+	centroids []tdigestCentroid
+
+	// buf contains the recently added values, which weren't merged into centroids yet.
+	buf []tdigestCentroid
+
+	totalWeight float64
+	min         float64
+	max         float64
+}
+
+type tdigestCentroid struct {
+	mean   float64
+	weight float64
+}
+
+// tdigestCompression limits the number of centroids in tdigest.
+//
+// Bigger value improves precision at the cost of higher memory usage.
+const tdigestCompression = 100
+
+// tdigestMaxBufLen is the maximum number of values in tdigest.buf before merging them into centroids.
+const tdigestMaxBufLen = 5 * tdigestCompression
+
+// add adds value v with the given weight to td and returns the change of td state size in bytes.
+func (td *tdigest) add(v, weight float64) int {
+	if math.IsNaN(v) || weight <= 0 {
+		return 0
+	}
+	sizeBefore := td.sizeBytes()
+
+	if td.totalWeight == 0 || v < td.min {
+		td.min = v
+	}
+	if td.totalWeight == 0 || v > td.max {
+		td.max = v
+	}
+	td.totalWeight += weight
+	td.buf = append(td.buf, tdigestCentroid{
+		mean:   v,
+		weight: weight,
+	})
+	if len(td.buf) >= tdigestMaxBufLen {
+		td.compress()
+	}
+
+	return td.sizeBytes() - sizeBefore
+}
+
+func (td *tdigest) sizeBytes() int {
+	return (cap(td.centroids) + cap(td.buf)) * int(unsafe.Sizeof(tdigestCentroid{}))
+}
+
+// mergeState merges src into td.
+func (td *tdigest) mergeState(src *tdigest) {
+	if src.totalWeight == 0 {
+		// Nothing to merge
+		return
+	}
+	if td.totalWeight == 0 || src.min < td.min {
+		td.min = src.min
+	}
+	if td.totalWeight == 0 || src.max > td.max {
+		td.max = src.max
+	}
+	td.totalWeight += src.totalWeight
+	td.buf = append(td.buf, src.centroids...)
+	td.buf = append(td.buf, src.buf...)
+	td.compress()
+}
+
+// compress merges td.buf into td.centroids, so the weight of every centroid doesn't exceed the limit defined by k1 scale function.
+func (td *tdigest) compress() {
+	if len(td.buf) == 0 {
+		return
+	}
+
+	cs := append(td.centroids, td.buf...)
+	td.buf = td.buf[:0]
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].mean < cs[j].mean
+	})
+
+	totalWeight := td.totalWeight
+	weightSoFar := 0.0
+	qLimit := tdigestInverseScale(tdigestScale(0) + 1)
+
+	// Merge the centroids in place, since the number of the resulting centroids cannot exceed the number of source centroids.
+	dst := cs[:0]
+	cur := cs[0]
+	for _, c := range cs[1:] {
+		q := (weightSoFar + cur.weight + c.weight) / totalWeight
+		if q <= qLimit {
+			cur.weight += c.weight
+			cur.mean += (c.mean - cur.mean) * c.weight / cur.weight
+			continue
+		}
+		weightSoFar += cur.weight
+		dst = append(dst, cur)
+		qLimit = tdigestInverseScale(tdigestScale(weightSoFar/totalWeight) + 1)
+		cur = c
+	}
+	dst = append(dst, cur)
+
+	td.centroids = dst
+}
+
+// tdigestScale is k1 scale function, which limits the size of centroids near the edges of the distribution.
+func tdigestScale(q float64) float64 {
+	return tdigestCompression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// tdigestInverseScale is the inverse function for tdigestScale.
+func tdigestInverseScale(k float64) float64 {
+	x := min(k*2*math.Pi/tdigestCompression, math.Pi/2)
+	return (math.Sin(x) + 1) / 2
+}
+
+// quantile returns the estimated phi quantile for td.
+//
+// NaN is returned if td is empty.
+func (td *tdigest) quantile(phi float64) float64 {
+	td.compress()
+
+	cs := td.centroids
+	if len(cs) == 0 {
+		return nan
+	}
+	if phi <= 0 {
+		return td.min
+	}
+	if phi >= 1 {
+		return td.max
+	}
+
+	// Interpolate between the midpoints of the neighbor centroids.
+	target := phi * td.totalWeight
+	prevMean := td.min
+	prevMid := 0.0
+	weightSoFar := 0.0
+	for _, c := range cs {
+		mid := weightSoFar + c.weight/2
+		if target <= mid {
+			if mid == prevMid {
+				return c.mean
+			}
+			return prevMean + (c.mean-prevMean)*(target-prevMid)/(mid-prevMid)
+		}
+		prevMean = c.mean
+		prevMid = mid
+		weightSoFar += c.weight
+	}
+	if td.totalWeight == prevMid {
+		return td.max
+	}
+	return prevMean + (td.max-prevMean)*(target-prevMid)/(td.totalWeight-prevMid)
+}
+
+// mad returns the estimated median absolute deviation for td.
+//
+// The median is estimated at first, and then the median of absolute deviations is estimated over the centroids.
+// NaN is returned if td is empty.
+func (td *tdigest) mad() float64 {
+	median := td.quantile(0.5)
+	if math.IsNaN(median) {
+		return nan
+	}
+
+	var tdDeviations tdigest
+	for _, c := range td.centroids {
+		tdDeviations.add(math.Abs(c.mean-median), c.weight)
+	}
+	return tdDeviations.quantile(0.5)
+}
@@ -0,0 +1,165 @@
+package logstorage
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestParseStatsMADSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`mad(*)`)
+	f(`mad(a)`)
+	f(`mad(a, b)`)
+	f(`mad(a) approx`)
+	f(`mad(*) approx`)
+}
+
+func TestParseStatsMADFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`mad`)
+	f(`mad(a b)`)
+	f(`mad(x) y`)
+	f(`mad(x) approx y`)
+}
+
+func TestStatsMAD(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"a", `1`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `2`},
+		},
+		{
+			{"a", `3`},
+			{"b", `3`},
+		},
+		{
+			{"a", `4`},
+		},
+		{
+			{"a", `100`},
+			{"b", `bar`},
+		},
+	}
+
+	f("stats mad(a) as x", rows, [][]Field{
+		{
+			{"x", "1"},
+		},
+	})
+	f("stats mad(a) approx as x", rows, [][]Field{
+		{
+			{"x", "1"},
+		},
+	})
+
+	// non-numeric values are ignored
+	f("stats mad(b) as x", rows, [][]Field{
+		{
+			{"x", "0"},
+		},
+	})
+
+	// missing field
+	f("stats mad(c) as x", rows, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+	f("stats mad(c) approx as x", rows, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+
+	f("stats by (b) mad(a) as x", [][]Field{
+		{
+			{"a", `1`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `2`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `10`},
+			{"b", `foo`},
+		},
+		{
+			{"a", `5`},
+			{"b", `bar`},
+		},
+	}, [][]Field{
+		{
+			{"b", "foo"},
+			{"x", "1"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "0"},
+		},
+	})
+}
+
+func TestTDigestQuantile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	// Split the samples across multiple digests in order to verify mergeState.
+	var tds [4]tdigest
+	for i := 0; i < 100_000; i++ {
+		tds[i%len(tds)].add(r.Float64()*1000, 1)
+	}
+	td := &tds[0]
+	for i := 1; i < len(tds); i++ {
+		td.mergeState(&tds[i])
+	}
+
+	if n := len(td.centroids); n > 2*tdigestCompression {
+		t.Fatalf("too many centroids; got %d; want up to %d", n, 2*tdigestCompression)
+	}
+
+	f := func(phi, resultExpected, maxDiff float64) {
+		t.Helper()
+		result := td.quantile(phi)
+		if math.Abs(result-resultExpected) > maxDiff {
+			t.Fatalf("unexpected quantile(%v); got %v; want %v +- %v", phi, result, resultExpected, maxDiff)
+		}
+	}
+	f(0, td.min, 0)
+	f(0.01, 10, 2)
+	f(0.5, 500, 10)
+	f(0.99, 990, 2)
+	f(1, td.max, 0)
+
+	// MAD for uniform distribution over [0..1000] is 250
+	mad := td.mad()
+	if math.Abs(mad-250) > 10 {
+		t.Fatalf("unexpected mad; got %v; want 250 +- 10", mad)
+	}
+}
+
+func TestTDigestEmpty(t *testing.T) {
+	var td tdigest
+	if q := td.quantile(0.5); !math.IsNaN(q) {
+		t.Fatalf("expecting NaN quantile for empty tdigest; got %v", q)
+	}
+	if mad := td.mad(); !math.IsNaN(mad) {
+		t.Fatalf("expecting NaN mad for empty tdigest; got %v", mad)
+	}
+}
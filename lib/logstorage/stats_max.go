@@ -71,6 +71,10 @@ func (smp *statsMaxProcessor) updateStatsForRow(sf statsFunc, br *blockResult, r
 	return maxLen - len(smp.max)
 }
 
+func (smp *statsMaxProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
 func (smp *statsMaxProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsMaxProcessor)
 	if src.hasItems {
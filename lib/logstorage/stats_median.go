@@ -30,6 +30,10 @@ func (smp *statsMedianProcessor) updateStatsForRow(sf statsFunc, br *blockResult
 	return smp.sqp.updateStatsForRow(sm.sq, br, rowIdx)
 }
 
+func (smp *statsMedianProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
 func (smp *statsMedianProcessor) mergeState(a *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
 	sm := sf.(*statsMedian)
 	src := sfp.(*statsMedianProcessor)
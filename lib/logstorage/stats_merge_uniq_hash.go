@@ -0,0 +1,217 @@
+package logstorage
+
+import (
+	"strconv"
+)
+
+// statsMergeUniqHash merges HyperLogLog sketches returned by 'count_uniq_hash(..., precision=N) with sketch'.
+//
+// See marshalCountUniqHashSketch for the sketch format.
+type statsMergeUniqHash struct {
+	fields []string
+
+	// withError is set if 'with error' is specified after merge_uniq_hash(...).
+	//
+	// In this case the result is returned as JSON object with the estimated number of unique values
+	// and the expected relative error for the estimate.
+	withError bool
+
+	// withSketch is set if 'with sketch' is specified after merge_uniq_hash(...).
+	//
+	// In this case the merged sketch is returned instead of the estimated number of unique values.
+	// This allows merging the returned sketches again at the next aggregation level.
+	withSketch bool
+}
+
+func (sm *statsMergeUniqHash) String() string {
+	s := "merge_uniq_hash(" + statsFuncFieldsToString(sm.fields) + ")"
+	if sm.withError {
+		s += " with error"
+	}
+	if sm.withSketch {
+		s += " with sketch"
+	}
+	return s
+}
+
+func (sm *statsMergeUniqHash) updateNeededFields(neededFields fieldsSet) {
+	updateNeededFieldsForStatsFunc(neededFields, sm.fields)
+}
+
+func (sm *statsMergeUniqHash) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	smp := a.newStatsMergeUniqHashProcessor()
+	smp.a = a
+	return smp
+}
+
+type statsMergeUniqHashProcessor struct {
+	a *chunkedAllocator
+
+	// registers contains HyperLogLog registers for the union of the merged sketches.
+	//
+	// It is nil until the first valid sketch is merged.
+	// If the merged sketches have distinct precisions, then the registers have the smallest precision among them.
+	registers []uint8
+}
+
+func (smp *statsMergeUniqHashProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sm := sf.(*statsMergeUniqHash)
+	stateSizeIncrease := 0
+	if len(sm.fields) == 0 {
+		for _, c := range br.getColumns() {
+			stateSizeIncrease += smp.updateStateForColumn(br, c)
+		}
+	} else {
+		for _, field := range sm.fields {
+			c := br.getColumnByName(field)
+			stateSizeIncrease += smp.updateStateForColumn(br, c)
+		}
+	}
+	return stateSizeIncrease
+}
+
+func (smp *statsMergeUniqHashProcessor) updateStateForColumn(br *blockResult, c *blockResultColumn) int {
+	if c.isConst {
+		return smp.updateState(c.valuesEncoded[0])
+	}
+	if c.isTime {
+		return 0
+	}
+
+	stateSizeIncrease := 0
+	values := c.getValues(br)
+	for i, v := range values {
+		if i > 0 && values[i-1] == v {
+			// Merging the same sketch multiple times doesn't change the result.
+			continue
+		}
+		stateSizeIncrease += smp.updateState(v)
+	}
+	return stateSizeIncrease
+}
+
+func (smp *statsMergeUniqHashProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sm := sf.(*statsMergeUniqHash)
+	stateSizeIncrease := 0
+	if len(sm.fields) == 0 {
+		for _, c := range br.getColumns() {
+			v := c.getValueAtRow(br, rowIdx)
+			stateSizeIncrease += smp.updateState(v)
+		}
+	} else {
+		for _, field := range sm.fields {
+			c := br.getColumnByName(field)
+			v := c.getValueAtRow(br, rowIdx)
+			stateSizeIncrease += smp.updateState(v)
+		}
+	}
+	return stateSizeIncrease
+}
+
+func (smp *statsMergeUniqHashProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
+// updateState merges the serialized sketch v into smp.
+//
+// Empty and malformed sketches are ignored in the same way as other stats functions ignore values with unexpected format.
+func (smp *statsMergeUniqHashProcessor) updateState(v string) int {
+	if v == "" {
+		return 0
+	}
+
+	bb := bbPool.Get()
+	registers, _, err := unmarshalCountUniqHashSketch(bb.B[:0], v)
+	bb.B = registers
+	stateSizeIncrease := 0
+	if err == nil {
+		stateSizeIncrease = smp.mergeRegisters(smp.a, registers)
+	}
+	bbPool.Put(bb)
+
+	return stateSizeIncrease
+}
+
+// mergeRegisters merges src HyperLogLog registers into smp.
+//
+// If src has smaller precision than smp.registers, then smp.registers are folded to the precision of src.
+func (smp *statsMergeUniqHashProcessor) mergeRegisters(a *chunkedAllocator, src []uint8) int {
+	if len(src) == 0 {
+		return 0
+	}
+	if len(smp.registers) > 0 && len(src) >= len(smp.registers) {
+		// Fast path - merge src into the existing registers.
+		foldCountUniqHashRegisters(smp.registers, src)
+		return 0
+	}
+
+	// Slow path - allocate new registers with the precision of src.
+	bytesAllocatedPrev := a.bytesAllocated
+	registers := a.newCountUniqHashRegisters(uint(len(src)))
+	stateSizeIncrease := a.bytesAllocated - bytesAllocatedPrev
+
+	copy(registers, src)
+	if len(smp.registers) > 0 {
+		foldCountUniqHashRegisters(registers, smp.registers)
+	}
+	smp.registers = registers
+
+	return stateSizeIncrease
+}
+
+func (smp *statsMergeUniqHashProcessor) mergeState(a *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsMergeUniqHashProcessor)
+	smp.mergeRegisters(a, src.registers)
+}
+
+func (smp *statsMergeUniqHashProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	sm := sf.(*statsMergeUniqHash)
+	if sm.withSketch {
+		return marshalCountUniqHashSketch(dst, smp.registers)
+	}
+
+	n := uint64(0)
+	if smp.registers != nil {
+		n = estimateCountUniqHashRegisters(smp.registers)
+	}
+	if !sm.withError {
+		return strconv.AppendUint(dst, n, 10)
+	}
+
+	relativeError := float64(0)
+	if smp.registers != nil {
+		relativeError = getCountUniqHashRegistersRelativeError(smp.registers)
+	}
+	dst = append(dst, `{"count":`...)
+	dst = strconv.AppendUint(dst, n, 10)
+	dst = append(dst, `,"relative_error":`...)
+	dst = strconv.AppendFloat(dst, relativeError, 'g', 4, 64)
+	dst = append(dst, '}')
+	return dst
+}
+
+func parseStatsMergeUniqHash(lex *lexer) (*statsMergeUniqHash, error) {
+	fields, err := parseStatsFuncFields(lex, "merge_uniq_hash")
+	if err != nil {
+		return nil, err
+	}
+	sm := &statsMergeUniqHash{
+		fields: fields,
+	}
+	if lex.isKeyword("with") {
+		// Distinguish 'with error' and 'with sketch' from the result name 'with'.
+		ls := lex.backupState()
+		lex.nextToken()
+		switch {
+		case lex.isKeyword("error"):
+			lex.nextToken()
+			sm.withError = true
+		case lex.isKeyword("sketch"):
+			lex.nextToken()
+			sm.withSketch = true
+		default:
+			lex.restoreState(ls)
+		}
+	}
+	return sm, nil
+}
@@ -0,0 +1,273 @@
+package logstorage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+)
+
+func TestParseStatsMergeUniqHashSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`merge_uniq_hash(*)`)
+	f(`merge_uniq_hash(a)`)
+	f(`merge_uniq_hash(a, b)`)
+	f(`merge_uniq_hash(a) with error`)
+	f(`merge_uniq_hash(a) with sketch`)
+}
+
+func TestParseStatsMergeUniqHashFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`merge_uniq_hash`)
+	f(`merge_uniq_hash(a b)`)
+	f(`merge_uniq_hash(x) y`)
+	f(`merge_uniq_hash(x) with`)
+	f(`merge_uniq_hash(x) with foo`)
+}
+
+func TestStatsMergeUniqHash(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	registersA := newTestCountUniqHashRegisters(10, 0, 1000)
+	registersB := newTestCountUniqHashRegisters(10, 500, 1500)
+	registersC := newTestCountUniqHashRegisters(12, 1000, 3000)
+
+	sketchA := string(marshalCountUniqHashSketch(nil, registersA))
+	sketchB := string(marshalCountUniqHashSketch(nil, registersB))
+	sketchC := string(marshalCountUniqHashSketch(nil, registersC))
+
+	registersAB := newTestCountUniqHashRegisters(10, 0, 1500)
+	registersABC := newTestCountUniqHashRegisters(10, 0, 3000)
+
+	// merge sketches with the same precision
+	f("stats merge_uniq_hash(s) as x", [][]Field{
+		{
+			{"s", sketchA},
+		},
+		{
+			{"s", sketchB},
+		},
+		{
+			{"s", sketchA},
+		},
+	}, [][]Field{
+		{
+			{"x", fmt.Sprintf("%d", estimateCountUniqHashRegisters(registersAB))},
+		},
+	})
+
+	// merge sketches with distinct precisions
+	f("stats merge_uniq_hash(s) as x", [][]Field{
+		{
+			{"s", sketchC},
+		},
+		{
+			{"s", sketchA},
+		},
+		{
+			{"s", sketchB},
+		},
+	}, [][]Field{
+		{
+			{"x", fmt.Sprintf("%d", estimateCountUniqHashRegisters(registersABC))},
+		},
+	})
+
+	// empty and malformed sketches are ignored
+	f("stats merge_uniq_hash(s) with error as x", [][]Field{
+		{
+			{"s", sketchA},
+		},
+		{
+			{"s", ""},
+		},
+		{
+			{"s", "foobar"},
+		},
+		{
+			{"b", "123"},
+		},
+	}, [][]Field{
+		{
+			{"x", fmt.Sprintf(`{"count":%d,"relative_error":0.0325}`, estimateCountUniqHashRegisters(registersA))},
+		},
+	})
+
+	// missing sketches
+	f("stats merge_uniq_hash(s) as x", [][]Field{
+		{
+			{"a", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"x", "0"},
+		},
+	})
+	f("stats merge_uniq_hash(s) with sketch as x", [][]Field{
+		{
+			{"a", "foo"},
+		},
+	}, [][]Field{
+		{
+			{"x", ""},
+		},
+	})
+
+	// the merged sketch can be merged again
+	f("stats by (g) merge_uniq_hash(s) with sketch as x", [][]Field{
+		{
+			{"g", "1"},
+			{"s", sketchA},
+		},
+		{
+			{"g", "1"},
+			{"s", sketchB},
+		},
+		{
+			{"g", "2"},
+			{"s", sketchC},
+		},
+	}, [][]Field{
+		{
+			{"g", "1"},
+			{"x", string(marshalCountUniqHashSketch(nil, registersAB))},
+		},
+		{
+			{"g", "2"},
+			{"x", sketchC},
+		},
+	})
+
+	// count_uniq_hash returns sketches in the format expected by merge_uniq_hash
+	f("stats count_uniq_hash(a, precision=10) with sketch as x", [][]Field{
+		{
+			{"a", "0"},
+		},
+		{
+			{"a", "1"},
+		},
+		{
+			{"a", "2"},
+		},
+		{
+			{"a", "1"},
+		},
+	}, [][]Field{
+		{
+			{"x", string(marshalCountUniqHashSketch(nil, newTestCountUniqHashRegisters(10, 0, 3)))},
+		},
+	})
+}
+
+func TestCountUniqHashSketchMarshalUnmarshal(t *testing.T) {
+	f := func(precision uint8) {
+		t.Helper()
+
+		registers := newTestCountUniqHashRegisters(precision, 0, 10_000)
+		sketch := marshalCountUniqHashSketch(nil, registers)
+
+		prefix := []uint8("foo")
+		result, resultPrecision, err := unmarshalCountUniqHashSketch(prefix, string(sketch))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if resultPrecision != precision {
+			t.Fatalf("unexpected precision; got %d; want %d", resultPrecision, precision)
+		}
+		if string(result[:len(prefix)]) != "foo" {
+			t.Fatalf("unexpected prefix; got %q; want %q", result[:len(prefix)], "foo")
+		}
+		if string(result[len(prefix):]) != string(registers) {
+			t.Fatalf("unexpected registers after unmarshal")
+		}
+	}
+
+	f(statsCountUniqHashMinPrecision)
+	f(10)
+	f(statsCountUniqHashMaxPrecision)
+}
+
+func TestUnmarshalCountUniqHashSketchFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		result, _, err := unmarshalCountUniqHashSketch([]uint8("foo"), s)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if string(result) != "foo" {
+			t.Fatalf("unexpected result; got %q; want %q", result, "foo")
+		}
+	}
+
+	encode := func(b []byte) string {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	newSketch := func(version, precision uint8, registers []uint8) string {
+		b := append([]byte{version, precision}, registers...)
+		return encode(b)
+	}
+
+	// invalid base64
+	f("foo!")
+
+	// too short sketch
+	f(encode(nil))
+	f(encode([]byte{countUniqHashSketchVersion}))
+
+	// unsupported version
+	f(newSketch(2, 4, make([]uint8, 16)))
+
+	// invalid precision
+	f(newSketch(countUniqHashSketchVersion, 3, make([]uint8, 8)))
+	f(newSketch(countUniqHashSketchVersion, 19, make([]uint8, 1<<19)))
+
+	// invalid number of registers
+	f(newSketch(countUniqHashSketchVersion, 4, make([]uint8, 15)))
+	f(newSketch(countUniqHashSketchVersion, 4, make([]uint8, 17)))
+
+	// too big register value
+	registers := make([]uint8, 16)
+	registers[3] = 62
+	f(newSketch(countUniqHashSketchVersion, 4, registers))
+}
+
+func TestFoldCountUniqHashRegisters(t *testing.T) {
+	f := func(dstPrecision, srcPrecision uint8) {
+		t.Helper()
+
+		src := newTestCountUniqHashRegisters(srcPrecision, 0, 100_000)
+		dst := make([]uint8, 1<<dstPrecision)
+		foldCountUniqHashRegisters(dst, src)
+
+		dstExpected := newTestCountUniqHashRegisters(dstPrecision, 0, 100_000)
+		if string(dst) != string(dstExpected) {
+			t.Fatalf("unexpected registers after folding precision=%d to precision=%d", srcPrecision, dstPrecision)
+		}
+	}
+
+	f(4, 4)
+	f(4, 5)
+	f(4, 18)
+	f(10, 14)
+	f(14, 18)
+}
+
+func newTestCountUniqHashRegisters(precision uint8, start, end int) []uint8 {
+	registers := make([]uint8, 1<<precision)
+	for i := start; i < end; i++ {
+		h := hashCountUniqHashUint64(uint64(i), false)
+		updateCountUniqHashRegisters(registers, h)
+	}
+	return registers
+}
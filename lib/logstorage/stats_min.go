@@ -73,6 +73,10 @@ func (smp *statsMinProcessor) updateStatsForRow(sf statsFunc, br *blockResult, r
 	return minLen - len(smp.min)
 }
 
+func (smp *statsMinProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
 func (smp *statsMinProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsMinProcessor)
 	if src.hasItems {
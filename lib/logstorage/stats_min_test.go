@@ -372,4 +372,21 @@ func TestStatsMin(t *testing.T) {
 			{"x", "4"},
 		},
 	})
+
+	// time values must be compared chronologically regardless of the timezone offset
+	f("stats min(_time) as x", [][]Field{
+		{
+			{"_time", `2025-01-01T01:00:00+02:00`},
+		},
+		{
+			{"_time", `2024-12-31T23:30:00Z`},
+		},
+		{
+			{"_time", `2024-12-31T22:15:00.5Z`},
+		},
+	}, [][]Field{
+		{
+			{"x", `2024-12-31T22:15:00.5Z`},
+		},
+	})
 }
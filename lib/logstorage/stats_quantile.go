@@ -2,6 +2,7 @@ package logstorage
 
 import (
 	"fmt"
+	"math"
 	"slices"
 	"sort"
 	"strings"
@@ -18,14 +19,30 @@ type statsQuantile struct {
 
 	phi    float64
 	phiStr string
+
+	// shortcutName is set to p50, p90, p95, p99 or p999 if the quantile is set via the corresponding shortcut.
+	shortcutName string
+
+	// mode is an optional interpolation mode for the quantile - 'nearest' or 'linear'.
+	//
+	// If it is empty, then the value at phi*N position is returned from N sorted samples.
+	mode string
 }
 
 func (sq *statsQuantile) String() string {
-	s := "quantile(" + sq.phiStr
-	if len(sq.fields) > 0 {
-		s += ", " + fieldNamesString(sq.fields)
+	var s string
+	if sq.shortcutName != "" {
+		s = sq.shortcutName + "(" + statsFuncFieldsToString(sq.fields) + ")"
+	} else {
+		s = "quantile(" + sq.phiStr
+		if len(sq.fields) > 0 {
+			s += ", " + fieldNamesString(sq.fields)
+		}
+		s += ")"
+	}
+	if sq.mode != "" {
+		s += " " + sq.mode
 	}
-	s += ")"
 	return s
 }
 
@@ -82,6 +99,10 @@ func (sqp *statsQuantileProcessor) updateStatsForRow(sf statsFunc, br *blockResu
 	return stateSizeIncrease
 }
 
+func (sqp *statsQuantileProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sqp, sf, br, rowIndexes)
+}
+
 func (sqp *statsQuantileProcessor) updateStateForColumn(br *blockResult, c *blockResultColumn) int {
 	h := &sqp.h
 	stateSizeIncrease := 0
@@ -194,8 +215,16 @@ func (sqp *statsQuantileProcessor) mergeState(_ *chunkedAllocator, _ statsFunc,
 
 func (sqp *statsQuantileProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
 	sq := sf.(*statsQuantile)
-	q := sqp.h.quantile(sq.phi)
-	return append(dst, q...)
+	switch sq.mode {
+	case "nearest":
+		q := sqp.h.quantileNearestRank(sq.phi)
+		return append(dst, q...)
+	case "linear":
+		return sqp.h.appendQuantileLinear(dst, sq.phi)
+	default:
+		q := sqp.h.quantile(sq.phi)
+		return append(dst, q...)
+	}
 }
 
 func parseStatsQuantile(lex *lexer) (*statsQuantile, error) {
@@ -234,6 +263,57 @@ func parseStatsQuantile(lex *lexer) (*statsQuantile, error) {
 		phi:    phi,
 		phiStr: phiStr,
 	}
+	sq.mode = parseStatsQuantileMode(lex)
+	return sq, nil
+}
+
+// parseStatsQuantileMode parses optional interpolation mode after quantile(...) args.
+func parseStatsQuantileMode(lex *lexer) string {
+	if !lex.isKeyword("nearest", "linear") {
+		return ""
+	}
+	mode := strings.ToLower(lex.token)
+	lex.nextToken()
+	return mode
+}
+
+// statsQuantileShortcuts maps quantile shortcut names to the corresponding phi values.
+var statsQuantileShortcuts = map[string]string{
+	"p50":  "0.5",
+	"p90":  "0.9",
+	"p95":  "0.95",
+	"p99":  "0.99",
+	"p999": "0.999",
+}
+
+// parseStatsQuantileShortcut parses p50(...), p90(...), p95(...), p99(...) or p999(...),
+// which are shortcuts for quantile(phi, ...).
+func parseStatsQuantileShortcut(lex *lexer) (*statsQuantile, error) {
+	shortcutName := strings.ToLower(lex.token)
+	phiStr, ok := statsQuantileShortcuts[shortcutName]
+	if !ok {
+		return nil, fmt.Errorf("unexpected token: %q; want p50, p90, p95, p99 or p999", lex.token)
+	}
+
+	fields, err := parseStatsFuncFields(lex, shortcutName)
+	if err != nil {
+		return nil, err
+	}
+
+	phi, ok := tryParseFloat64(phiStr)
+	if !ok {
+		logger.Panicf("BUG: cannot parse phi=%q for %q", phiStr, shortcutName)
+	}
+
+	sq := &statsQuantile{
+		fields: fields,
+
+		phi:    phi,
+		phiStr: phiStr,
+
+		shortcutName: shortcutName,
+	}
+	sq.mode = parseStatsQuantileMode(lex)
 	return sq, nil
 }
 
@@ -315,12 +395,74 @@ func (h *histogram) quantile(phi float64) string {
 		return h.max
 	}
 
-	sort.Slice(h.a, func(i, j int) bool {
-		return lessString(h.a[i], h.a[j])
-	})
+	h.sortSamples()
 	idx := int(phi * float64(len(h.a)))
 	if idx == len(h.a) {
 		return h.max
 	}
 	return h.a[idx]
 }
+
+// quantileNearestRank returns phi quantile for h according to nearest-rank method.
+//
+// See https://en.wikipedia.org/wiki/Percentile#The_nearest-rank_method
+func (h *histogram) quantileNearestRank(phi float64) string {
+	if len(h.a) == 0 {
+		return ""
+	}
+	if phi <= 0 {
+		return h.min
+	}
+	if phi >= 1 {
+		return h.max
+	}
+
+	h.sortSamples()
+	rank := int(math.Ceil(phi * float64(len(h.a))))
+	return h.a[max(rank-1, 0)]
+}
+
+// appendQuantileLinear appends phi quantile for h to dst according to linear interpolation between the closest ranks
+// and returns the result.
+//
+// Non-numeric values cannot be interpolated, so the value at the lower closest rank is returned for them.
+//
+// See https://en.wikipedia.org/wiki/Percentile#The_linear_interpolation_between_closest_ranks_method
+func (h *histogram) appendQuantileLinear(dst []byte, phi float64) []byte {
+	if len(h.a) == 0 {
+		return dst
+	}
+	if phi <= 0 {
+		return append(dst, h.min...)
+	}
+	if phi >= 1 {
+		return append(dst, h.max...)
+	}
+
+	h.sortSamples()
+	pos := phi * float64(len(h.a)-1)
+	idx := int(pos)
+	frac := pos - float64(idx)
+	lower := h.a[idx]
+	if frac == 0 || idx+1 >= len(h.a) {
+		return append(dst, lower...)
+	}
+	upper := h.a[idx+1]
+
+	fLower, ok := tryParseFloat64(lower)
+	if !ok {
+		return append(dst, lower...)
+	}
+	fUpper, ok := tryParseFloat64(upper)
+	if !ok {
+		return append(dst, lower...)
+	}
+	f := fLower + (fUpper-fLower)*frac
+	return marshalStatsFloat64String(dst, f)
+}
+
+func (h *histogram) sortSamples() {
+	sort.Slice(h.a, func(i, j int) bool {
+		return lessString(h.a[i], h.a[j])
+	})
+}
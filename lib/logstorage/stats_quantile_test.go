@@ -13,6 +13,15 @@ func TestParseStatsQuantileSuccess(t *testing.T) {
 	f(`quantile(0.3)`)
 	f(`quantile(1, a)`)
 	f(`quantile(0.99, a, b)`)
+	f(`p50(*)`)
+	f(`p90(a)`)
+	f(`p95(a, b)`)
+	f(`p99(a)`)
+	f(`p999(a)`)
+	f(`quantile(0.5, a) nearest`)
+	f(`quantile(0.5) linear`)
+	f(`p95(a, b) nearest`)
+	f(`p99(*) linear`)
 }
 
 func TestParseStatsQuantileFailure(t *testing.T) {
@@ -27,6 +36,10 @@ func TestParseStatsQuantileFailure(t *testing.T) {
 	f(`quantile(10, b)`)
 	f(`quantile(-1, b)`)
 	f(`quantile(0.5, b) c`)
+	f(`p90`)
+	f(`p99(a) b`)
+	f(`quantile(0.5, a) nearest b`)
+	f(`quantile(0.5, a) linear nearest`)
 }
 
 func TestStatsQuantile(t *testing.T) {
@@ -55,6 +68,28 @@ func TestStatsQuantile(t *testing.T) {
 		},
 	})
 
+	f("stats p90(a) as x, p50(a) as y, p99(a) z", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `1`},
+		},
+		{
+			{"a", `3`},
+			{"b", `54`},
+		},
+	}, [][]Field{
+		{
+			{"x", "3"},
+			{"y", "2"},
+			{"z", "3"},
+		},
+	})
+
 	f("stats quantile(0.9, a) as x", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -366,6 +401,123 @@ func TestStatsQuantile(t *testing.T) {
 	})
 }
 
+func TestStatsQuantileMode(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	rows := [][]Field{
+		{
+			{"a", "1"},
+		},
+		{
+			{"a", "2"},
+		},
+		{
+			{"a", "3"},
+		},
+		{
+			{"a", "4"},
+		},
+	}
+
+	f("stats quantile(0.5, a) as x", rows, [][]Field{
+		{
+			{"x", "3"},
+		},
+	})
+	f("stats quantile(0.5, a) nearest as x", rows, [][]Field{
+		{
+			{"x", "2"},
+		},
+	})
+	f("stats quantile(0.5, a) linear as x", rows, [][]Field{
+		{
+			{"x", "2.5"},
+		},
+	})
+	f("stats p90(a) linear as x", rows, [][]Field{
+		{
+			{"x", "3.7"},
+		},
+	})
+	f("stats p90(a) nearest as x", rows, [][]Field{
+		{
+			{"x", "4"},
+		},
+	})
+}
+
+func TestHistogramQuantileNearestRank(t *testing.T) {
+	f := func(a []string, phi float64, qExpected string) {
+		t.Helper()
+
+		var h histogram
+		for _, v := range a {
+			h.update(v)
+		}
+		q := h.quantileNearestRank(phi)
+
+		if q != qExpected {
+			t.Fatalf("unexpected result for q=%v, phi=%v; got %q; want %q", a, phi, q, qExpected)
+		}
+	}
+
+	f(nil, 0.5, "")
+
+	f([]string{"123"}, 0, "123")
+	f([]string{"123"}, 0.5, "123")
+	f([]string{"123"}, 1, "123")
+
+	f([]string{"5", "1"}, -1, "1")
+	f([]string{"5", "1"}, 0.5, "1")
+	f([]string{"5", "1"}, 0.5+1e-5, "5")
+	f([]string{"5", "1"}, 10, "5")
+
+	f([]string{"15", "20", "35", "40", "50"}, 0.05, "15")
+	f([]string{"15", "20", "35", "40", "50"}, 0.3, "20")
+	f([]string{"15", "20", "35", "40", "50"}, 0.4, "20")
+	f([]string{"15", "20", "35", "40", "50"}, 0.5, "35")
+	f([]string{"15", "20", "35", "40", "50"}, 0.99, "50")
+}
+
+func TestHistogramQuantileLinear(t *testing.T) {
+	f := func(a []string, phi float64, qExpected string) {
+		t.Helper()
+
+		var h histogram
+		for _, v := range a {
+			h.update(v)
+		}
+		q := string(h.appendQuantileLinear(nil, phi))
+
+		if q != qExpected {
+			t.Fatalf("unexpected result for q=%v, phi=%v; got %q; want %q", a, phi, q, qExpected)
+		}
+	}
+
+	f(nil, 0.5, "")
+
+	f([]string{"123"}, 0, "123")
+	f([]string{"123"}, 0.5, "123")
+	f([]string{"123"}, 1, "123")
+
+	f([]string{"5", "1"}, -1, "1")
+	f([]string{"5", "1"}, 0.5, "3")
+	f([]string{"5", "1"}, 0.25, "2")
+	f([]string{"5", "1"}, 10, "5")
+
+	f([]string{"15", "20", "35", "40", "50"}, 0.5, "35")
+	f([]string{"15", "20", "35", "40", "50"}, 0.4, "29")
+	f([]string{"15", "20", "35", "40", "50"}, 0.75, "40")
+
+	// non-numeric values
+	f([]string{"foo", "bar", "baz"}, 0.25, "bar")
+	f([]string{"foo", "bar", "baz"}, 0.75, "baz")
+	f([]string{"1", "2", "foo"}, 0.75, "2")
+}
+
 func TestHistogramQuantile(t *testing.T) {
 	f := func(a []string, phi float64, qExpected string) {
 		t.Helper()
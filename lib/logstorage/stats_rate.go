@@ -36,6 +36,11 @@ func (srp *statsRateProcessor) updateStatsForRow(_ statsFunc, _ *blockResult, _
 	return 0
 }
 
+func (srp *statsRateProcessor) updateStatsForRows(_ statsFunc, _ *blockResult, rowIndexes []int) int {
+	srp.rowsCount += uint64(len(rowIndexes))
+	return 0
+}
+
 func (srp *statsRateProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsRateProcessor)
 	srp.rowsCount += src.rowsCount
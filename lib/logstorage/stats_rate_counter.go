@@ -0,0 +1,144 @@
+package logstorage
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"unsafe"
+)
+
+type statsRateCounter struct {
+	field string
+
+	// stepSeconds must be updated by the caller before calling newStatsProcessor().
+	stepSeconds float64
+}
+
+func (sr *statsRateCounter) String() string {
+	return "rate_counter(" + quoteTokenIfNeeded(sr.field) + ")"
+}
+
+func (sr *statsRateCounter) updateNeededFields(neededFields fieldsSet) {
+	neededFields.add(sr.field)
+	neededFields.add("_time")
+}
+
+func (sr *statsRateCounter) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsRateCounterProcessor()
+}
+
+type statsRateCounterProcessor struct {
+	// samples contains counter values with the corresponding timestamps in the order they were seen.
+	//
+	// They are sorted by timestamp at finalizeStats, since rows may arrive in arbitrary order.
+	samples []timestampedValue
+}
+
+// timestampedValue is a numeric value with the corresponding _time.
+type timestampedValue struct {
+	timestamp int64
+	value     float64
+}
+
+// sortTimestampedValues sorts a by timestamp.
+func sortTimestampedValues(a []timestampedValue) {
+	slices.SortStableFunc(a, func(x, y timestampedValue) int {
+		return cmp.Compare(x.timestamp, y.timestamp)
+	})
+}
+
+func (srp *statsRateCounterProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	sr := sf.(*statsRateCounter)
+	stateSizeIncrease := 0
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		stateSizeIncrease += srp.updateStatsForRow(sr, br, rowIdx)
+	}
+	return stateSizeIncrease
+}
+
+func (srp *statsRateCounterProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	sr := sf.(*statsRateCounter)
+
+	c := br.getColumnByName(sr.field)
+	f, ok := c.getFloatValueAtRow(br, rowIdx)
+	if !ok || math.IsNaN(f) {
+		return 0
+	}
+	timestamp, ok := getTimestampAtRow(br, rowIdx)
+	if !ok {
+		return 0
+	}
+
+	srp.samples = append(srp.samples, timestampedValue{
+		timestamp: timestamp,
+		value:     f,
+	})
+	return int(unsafe.Sizeof(srp.samples[0]))
+}
+
+func (srp *statsRateCounterProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(srp, sf, br, rowIndexes)
+}
+
+func (srp *statsRateCounterProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
+	src := sfp.(*statsRateCounterProcessor)
+	srp.samples = append(srp.samples, src.samples...)
+}
+
+func (srp *statsRateCounterProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	sr := sf.(*statsRateCounter)
+
+	samples := srp.samples
+	if len(samples) == 0 {
+		return marshalFloat64String(dst, nan)
+	}
+	sortTimestampedValues(samples)
+
+	// Sum the increases between adjacent samples in the same way as PromQL rate() does.
+	// A decrease is treated as a counter reset, so the counter value after the reset
+	// is counted as the increase since the reset.
+	increase := float64(0)
+	prevValue := samples[0].value
+	for _, s := range samples[1:] {
+		if s.value >= prevValue {
+			increase += s.value - prevValue
+		} else {
+			increase += s.value
+		}
+		prevValue = s.value
+	}
+
+	rate := increase
+	if sr.stepSeconds > 0 {
+		rate /= sr.stepSeconds
+	}
+	return marshalStatsFloat64String(dst, rate)
+}
+
+// getTimestampAtRow returns the _time value at the given rowIdx in br.
+//
+// false is returned if the _time field at rowIdx doesn't contain a valid timestamp.
+func getTimestampAtRow(br *blockResult, rowIdx int) (int64, bool) {
+	c := br.getColumnByName("_time")
+	if c.isTime {
+		timestamps := br.getTimestamps()
+		return timestamps[rowIdx], true
+	}
+	v := c.getValueAtRow(br, rowIdx)
+	return TryParseTimestampRFC3339Nano(v)
+}
+
+func parseStatsRateCounter(lex *lexer) (*statsRateCounter, error) {
+	fields, err := parseStatsFuncFields(lex, "rate_counter")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("'rate_counter' must contain a single field name; got %q", fields)
+	}
+	sr := &statsRateCounter{
+		field: fields[0],
+	}
+	return sr, nil
+}
@@ -0,0 +1,176 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseStatsRateCounterSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`rate_counter(a)`)
+	f(`rate_counter("a b")`)
+}
+
+func TestParseStatsRateCounterFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`rate_counter`)
+	f(`rate_counter()`)
+	f(`rate_counter(*)`)
+	f(`rate_counter(a, b)`)
+	f(`rate_counter(a b)`)
+	f(`rate_counter(x) y`)
+}
+
+func TestStatsRateCounter(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// monotonically increasing counter in arbitrary order
+	f("stats rate_counter(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:20Z"},
+			{"a", `15`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `2`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `10`},
+		},
+	}, [][]Field{
+		{
+			{"x", "13"},
+		},
+	})
+
+	// counter resets
+	f("stats rate_counter(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `10`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `15`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:20Z"},
+			{"a", `3`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:30Z"},
+			{"a", `7.5`},
+		},
+	}, [][]Field{
+		{
+			{"x", "12.5"},
+		},
+	})
+
+	// rows without numeric values or without valid timestamps are ignored
+	f("stats rate_counter(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `foo`},
+		},
+		{
+			{"_time", "bar"},
+			{"a", `100`},
+		},
+		{
+			{"a", `200`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:20Z"},
+			{"a", `4`},
+		},
+	}, [][]Field{
+		{
+			{"x", "3"},
+		},
+	})
+
+	// single sample
+	f("stats rate_counter(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1`},
+		},
+	}, [][]Field{
+		{
+			{"x", "0"},
+		},
+	})
+
+	// missing field
+	f("stats rate_counter(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"b", `1`},
+		},
+	}, [][]Field{
+		{
+			{"x", "NaN"},
+		},
+	})
+
+	// by group
+	f("stats by (b) rate_counter(a) as x", [][]Field{
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `1`},
+			{"b", `foo`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:00Z"},
+			{"a", `100`},
+			{"b", `bar`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `5`},
+			{"b", `foo`},
+		},
+		{
+			{"_time", "2024-01-01T00:00:10Z"},
+			{"a", `20`},
+			{"b", `bar`},
+		},
+	}, [][]Field{
+		{
+			{"b", "foo"},
+			{"x", "4"},
+		},
+		{
+			{"b", "bar"},
+			{"x", "20"},
+		},
+	})
+}
+
+func TestStatsRateCounterStepSeconds(t *testing.T) {
+	q, err := ParseQuery(`_time:[2024-01-01T00:00:00Z, 2024-01-01T00:01:40Z) | stats rate_counter(a) as x`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ps := q.pipes[len(q.pipes)-1].(*pipeStats)
+	sr := ps.funcs[0].f.(*statsRateCounter)
+	if sr.stepSeconds != 100 {
+		t.Fatalf("unexpected stepSeconds; got %v; want 100", sr.stepSeconds)
+	}
+}
@@ -39,6 +39,10 @@ func (srp *statsRateSumProcessor) updateStatsForRow(sf statsFunc, br *blockResul
 	return srp.ssp.updateStatsForRow(ss.ss, br, rowIdx)
 }
 
+func (srp *statsRateSumProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(srp, sf, br, rowIndexes)
+}
+
 func (srp *statsRateSumProcessor) mergeState(a *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
 	ss := sf.(*statsRateSum)
 	src := sfp.(*statsRateSumProcessor)
@@ -52,6 +52,10 @@ func (sap *statsRowAnyProcessor) updateStatsForRow(sf statsFunc, br *blockResult
 	return sap.updateState(sa, br, rowIdx)
 }
 
+func (sap *statsRowAnyProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sap, sf, br, rowIndexes)
+}
+
 func (sap *statsRowAnyProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsRowAnyProcessor)
 	if !sap.captured {
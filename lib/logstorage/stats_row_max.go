@@ -148,6 +148,10 @@ func (smp *statsRowMaxProcessor) updateStatsForRow(sf statsFunc, br *blockResult
 	return stateSizeIncrease
 }
 
+func (smp *statsRowMaxProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
 func (smp *statsRowMaxProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsRowMaxProcessor)
 	if smp.needUpdateStateString(src.max) {
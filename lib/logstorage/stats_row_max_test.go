@@ -93,6 +93,29 @@ func TestStatsRowMax(t *testing.T) {
 		},
 	})
 
+	f("stats row_max(duration, duration, url, status) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"duration", `10`},
+			{"url", `/a`},
+			{"status", `200`},
+		},
+		{
+			{"_msg", `def`},
+			{"duration", `9`},
+			{"url", `/b`},
+			{"status", `500`},
+		},
+		{
+			{"url", `/c`},
+			{"status", `404`},
+		},
+	}, [][]Field{
+		{
+			{"x", `{"duration":"10","url":"/a","status":"200"}`},
+		},
+	})
+
 	f("stats row_max(b, a, x, b) as x", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -148,6 +148,10 @@ func (smp *statsRowMinProcessor) updateStatsForRow(sf statsFunc, br *blockResult
 	return stateSizeIncrease
 }
 
+func (smp *statsRowMinProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(smp, sf, br, rowIndexes)
+}
+
 func (smp *statsRowMinProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsRowMinProcessor)
 	if smp.needUpdateStateString(src.min) {
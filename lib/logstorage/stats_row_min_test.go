@@ -93,6 +93,29 @@ func TestStatsRowMin(t *testing.T) {
 		},
 	})
 
+	f("stats row_min(duration, duration, url, status) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"duration", `10`},
+			{"url", `/a`},
+			{"status", `200`},
+		},
+		{
+			{"_msg", `def`},
+			{"duration", `9`},
+			{"url", `/b`},
+			{"status", `500`},
+		},
+		{
+			{"url", `/c`},
+			{"status", `404`},
+		},
+	}, [][]Field{
+		{
+			{"x", `{"duration":"9","url":"/b","status":"500"}`},
+		},
+	})
+
 	f("stats row_min(b, a, x, b) as x", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -0,0 +1,222 @@
+package logstorage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/valyala/fastrand"
+)
+
+// statsSample implements 'sample(N, fields...)' stats function.
+//
+// It returns up to N sample rows per each group. The rows are selected with reservoir sampling (Algorithm R),
+// so every row in the group has equal chances to be selected, while the memory usage is bounded by N rows per group.
+type statsSample struct {
+	fields []string
+
+	limit uint64
+}
+
+func (ss *statsSample) String() string {
+	return "sample(" + strconv.FormatUint(ss.limit, 10) + ", " + statsFuncFieldsToString(ss.fields) + ")"
+}
+
+func (ss *statsSample) updateNeededFields(neededFields fieldsSet) {
+	if len(ss.fields) == 0 {
+		neededFields.add("*")
+	} else {
+		neededFields.addFields(ss.fields)
+	}
+}
+
+func (ss *statsSample) newStatsProcessor(a *chunkedAllocator) statsProcessor {
+	return a.newStatsSampleProcessor()
+}
+
+type statsSampleProcessor struct {
+	// rowsSeen is the number of rows seen by the processor.
+	rowsSeen uint64
+
+	// rows contains the reservoir of up to statsSample.limit sample rows.
+	rows [][]Field
+
+	rng fastrand.RNG
+}
+
+func (ssp *statsSampleProcessor) updateStatsForAllRows(sf statsFunc, br *blockResult) int {
+	ss := sf.(*statsSample)
+	stateSizeIncrease := 0
+	for rowIdx := 0; rowIdx < br.rowsLen; rowIdx++ {
+		stateSizeIncrease += ssp.updateState(ss, br, rowIdx)
+	}
+	return stateSizeIncrease
+}
+
+func (ssp *statsSampleProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
+	ss := sf.(*statsSample)
+	return ssp.updateState(ss, br, rowIdx)
+}
+
+func (ssp *statsSampleProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(ssp, sf, br, rowIndexes)
+}
+
+func (ssp *statsSampleProcessor) updateState(ss *statsSample, br *blockResult, rowIdx int) int {
+	ssp.rowsSeen++
+
+	if uint64(len(ssp.rows)) < ss.limit {
+		fields, stateSizeIncrease := ssp.fetchRow(ss, br, rowIdx)
+		ssp.rows = append(ssp.rows, fields)
+		return stateSizeIncrease + int(unsafe.Sizeof(fields))
+	}
+
+	// Algorithm R: replace a random row in the reservoir with the probability limit/rowsSeen.
+	n := ssp.randUint64n(ssp.rowsSeen)
+	if n >= ss.limit {
+		return 0
+	}
+	fields, stateSizeIncrease := ssp.fetchRow(ss, br, rowIdx)
+	ssp.rows[n] = fields
+	return stateSizeIncrease
+}
+
+func (ssp *statsSampleProcessor) fetchRow(ss *statsSample, br *blockResult, rowIdx int) ([]Field, int) {
+	stateSizeIncrease := 0
+	var fields []Field
+	if len(ss.fields) == 0 {
+		cs := br.getColumns()
+		fields = make([]Field, 0, len(cs))
+		for _, c := range cs {
+			v := c.getValueAtRow(br, rowIdx)
+			fields = append(fields, Field{
+				Name:  strings.Clone(c.name),
+				Value: strings.Clone(v),
+			})
+			stateSizeIncrease += len(c.name) + len(v)
+		}
+	} else {
+		fields = make([]Field, 0, len(ss.fields))
+		for _, field := range ss.fields {
+			c := br.getColumnByName(field)
+			v := c.getValueAtRow(br, rowIdx)
+			fields = append(fields, Field{
+				Name:  strings.Clone(c.name),
+				Value: strings.Clone(v),
+			})
+			stateSizeIncrease += len(c.name) + len(v)
+		}
+	}
+	stateSizeIncrease += len(fields) * int(unsafe.Sizeof(Field{}))
+	return fields, stateSizeIncrease
+}
+
+func (ssp *statsSampleProcessor) mergeState(_ *chunkedAllocator, sf statsFunc, sfp statsProcessor) {
+	ss := sf.(*statsSample)
+	src := sfp.(*statsSampleProcessor)
+
+	if src.rowsSeen == 0 {
+		return
+	}
+	if ssp.rowsSeen+src.rowsSeen <= ss.limit {
+		// Both reservoirs contain all the seen rows, so just concatenate them.
+		ssp.rows = append(ssp.rows, src.rows...)
+		ssp.rowsSeen += src.rowsSeen
+		return
+	}
+
+	// Every reservoir contains uniformly selected rows from the corresponding rows seen.
+	// Select up to limit rows from both reservoirs, so the chances to select a row from the particular reservoir
+	// are proportional to the number of rows remaining in the source the reservoir was collected from.
+	// This results in uniformly selected rows across the union of the rows seen.
+	dstRows := ssp.rows
+	srcRows := slices.Clone(src.rows)
+	dstRemaining := ssp.rowsSeen
+	srcRemaining := src.rowsSeen
+
+	rows := make([][]Field, 0, ss.limit)
+	for uint64(len(rows)) < ss.limit {
+		if ssp.randUint64n(dstRemaining+srcRemaining) < dstRemaining {
+			rows, dstRows = appendRandomSampleRow(rows, dstRows, &ssp.rng)
+			dstRemaining--
+		} else {
+			rows, srcRows = appendRandomSampleRow(rows, srcRows, &ssp.rng)
+			srcRemaining--
+		}
+	}
+
+	ssp.rows = rows
+	ssp.rowsSeen += src.rowsSeen
+}
+
+// appendRandomSampleRow moves a random row from src to dst and returns the updated dst and src.
+func appendRandomSampleRow(dst, src [][]Field, rng *fastrand.RNG) ([][]Field, [][]Field) {
+	n := rng.Uint32n(uint32(len(src)))
+	dst = append(dst, src[n])
+
+	lastIdx := len(src) - 1
+	src[n] = src[lastIdx]
+	src[lastIdx] = nil
+	src = src[:lastIdx]
+
+	return dst, src
+}
+
+// randUint64n returns pseudo-random number in the range [0..maxN).
+func (ssp *statsSampleProcessor) randUint64n(maxN uint64) uint64 {
+	if maxN < 1<<32 {
+		return uint64(ssp.rng.Uint32n(uint32(maxN)))
+	}
+	n := uint64(ssp.rng.Uint32())<<32 | uint64(ssp.rng.Uint32())
+	return n % maxN
+}
+
+func (ssp *statsSampleProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
+	dst = append(dst, '[')
+	for i, fields := range ssp.rows {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = MarshalFieldsToJSON(dst, fields)
+	}
+	dst = append(dst, ']')
+	return dst
+}
+
+func parseStatsSample(lex *lexer) (*statsSample, error) {
+	if !lex.isKeyword("sample") {
+		return nil, fmt.Errorf("unexpected func; got %q; want 'sample'", lex.token)
+	}
+	lex.nextToken()
+	fields, err := parseFieldNamesInParens(lex)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse 'sample' args: %w", err)
+	}
+	if len(fields) < 1 {
+		return nil, fmt.Errorf("'sample' must have at least the number of rows arg")
+	}
+
+	// Parse the number of rows
+	limitStr := fields[0]
+	limit, ok := tryParseUint64(limitStr)
+	if !ok {
+		return nil, fmt.Errorf("the number of rows arg in 'sample' must be positive integer; got %q", limitStr)
+	}
+	if limit == 0 {
+		return nil, fmt.Errorf("the number of rows arg in 'sample' must be bigger than 0")
+	}
+
+	// Parse fields
+	fields = fields[1:]
+	if slices.Contains(fields, "*") {
+		fields = nil
+	}
+
+	ss := &statsSample{
+		fields: fields,
+		limit:  limit,
+	}
+	return ss, nil
+}
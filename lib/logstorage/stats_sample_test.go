@@ -0,0 +1,166 @@
+package logstorage
+
+import (
+	"testing"
+)
+
+func TestParseStatsSampleSuccess(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncSuccess(t, pipeStr)
+	}
+
+	f(`sample(1, *)`)
+	f(`sample(10, foo)`)
+	f(`sample(10, foo, bar)`)
+}
+
+func TestParseStatsSampleFailure(t *testing.T) {
+	f := func(pipeStr string) {
+		t.Helper()
+		expectParseStatsFuncFailure(t, pipeStr)
+	}
+
+	f(`sample`)
+	f(`sample()`)
+	f(`sample(foo)`)
+	f(`sample(0)`)
+	f(`sample(-1)`)
+	f(`sample(1.5, foo)`)
+	f(`sample(1, x) bar`)
+}
+
+func TestStatsSample(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	f("stats sample(2)", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+		},
+	}, [][]Field{
+		{
+			{"sample(2, *)", `[{"_msg":"abc","a":"2"}]`},
+		},
+	})
+
+	f("stats sample(5, a) as x", [][]Field{
+		{
+			{"_msg", `abc`},
+			{"a", `2`},
+		},
+		{
+			{"_msg", `def`},
+			{"a", `2`},
+		},
+		{
+			{"a", `2`},
+		},
+	}, [][]Field{
+		{
+			{"x", `[{"a":"2"},{"a":"2"},{"a":"2"}]`},
+		},
+	})
+
+	f("stats sample(1, a) as x", [][]Field{
+		{
+			{"a", `2`},
+		},
+		{
+			{"a", `2`},
+		},
+		{
+			{"a", `2`},
+		},
+	}, [][]Field{
+		{
+			{"x", `[{"a":"2"}]`},
+		},
+	})
+
+	f("stats by (b) sample(3, a) if (a:2) as x", [][]Field{
+		{
+			{"a", `2`},
+			{"b", `3`},
+		},
+		{
+			{"a", `1`},
+			{"b", `3`},
+		},
+		{
+			{"a", `2`},
+			{"b", `4`},
+		},
+		{
+			{"b", `5`},
+		},
+	}, [][]Field{
+		{
+			{"b", "3"},
+			{"x", `[{"a":"2"}]`},
+		},
+		{
+			{"b", "4"},
+			{"x", `[{"a":"2"}]`},
+		},
+		{
+			{"b", "5"},
+			{"x", `[]`},
+		},
+	})
+}
+
+func TestStatsSampleProcessor_MergeState(t *testing.T) {
+	ss := &statsSample{
+		limit: 10,
+	}
+
+	newProcessor := func(start, end int) *statsSampleProcessor {
+		var ssp statsSampleProcessor
+		for i := start; i < end; i++ {
+			ssp.rowsSeen++
+			fields := []Field{
+				{
+					Name:  "n",
+					Value: string(rune('0' + i%10)),
+				},
+			}
+			if uint64(len(ssp.rows)) < ss.limit {
+				ssp.rows = append(ssp.rows, fields)
+			}
+		}
+		return &ssp
+	}
+
+	// The merged reservoir must contain all the rows if the total number of rows doesn't exceed the limit.
+	ssp := newProcessor(0, 4)
+	ssp.mergeState(nil, ss, newProcessor(4, 10))
+	if ssp.rowsSeen != 10 {
+		t.Fatalf("unexpected rowsSeen; got %d; want 10", ssp.rowsSeen)
+	}
+	if len(ssp.rows) != 10 {
+		t.Fatalf("unexpected number of rows; got %d; want 10", len(ssp.rows))
+	}
+
+	// The merged reservoir must be limited by ss.limit.
+	ssp = newProcessor(0, 1000)
+	ssp.mergeState(nil, ss, newProcessor(0, 5))
+	if ssp.rowsSeen != 1005 {
+		t.Fatalf("unexpected rowsSeen; got %d; want 1005", ssp.rowsSeen)
+	}
+	if len(ssp.rows) != 10 {
+		t.Fatalf("unexpected number of rows; got %d; want 10", len(ssp.rows))
+	}
+
+	// Merging empty state must leave the reservoir unchanged.
+	ssp.mergeState(nil, ss, newProcessor(0, 0))
+	if ssp.rowsSeen != 1005 {
+		t.Fatalf("unexpected rowsSeen; got %d; want 1005", ssp.rowsSeen)
+	}
+	if len(ssp.rows) != 10 {
+		t.Fatalf("unexpected number of rows; got %d; want 10", len(ssp.rows))
+	}
+}
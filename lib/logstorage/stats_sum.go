@@ -2,7 +2,6 @@ package logstorage
 
 import (
 	"math"
-	"strconv"
 )
 
 type statsSum struct {
@@ -69,6 +68,60 @@ func (ssp *statsSumProcessor) updateStatsForRow(sf statsFunc, br *blockResult, r
 	return 0
 }
 
+func (ssp *statsSumProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	ss := sf.(*statsSum)
+	fields := ss.fields
+	if len(fields) == 0 {
+		// Sum all the columns for the given rows
+		for _, c := range br.getColumns() {
+			ssp.updateStateForColumnRows(br, c, rowIndexes)
+		}
+	} else {
+		// Sum only the given columns for the given rows
+		for _, field := range fields {
+			c := br.getColumnByName(field)
+			ssp.updateStateForColumnRows(br, c, rowIndexes)
+		}
+	}
+	return 0
+}
+
+func (ssp *statsSumProcessor) updateStatsForRowsRange(sf statsFunc, br *blockResult, startIdx, rowsCount int) int {
+	ss := sf.(*statsSum)
+	fields := ss.fields
+	if len(fields) == 0 {
+		// Sum all the columns for the given rows
+		for _, c := range br.getColumns() {
+			ssp.updateStateForColumnRowsRange(br, c, startIdx, rowsCount)
+		}
+	} else {
+		// Sum only the given columns for the given rows
+		for _, field := range fields {
+			c := br.getColumnByName(field)
+			ssp.updateStateForColumnRowsRange(br, c, startIdx, rowsCount)
+		}
+	}
+	return 0
+}
+
+func (ssp *statsSumProcessor) updateStateForColumnRowsRange(br *blockResult, c *blockResultColumn, startIdx, rowsCount int) {
+	for rowIdx := startIdx; rowIdx < startIdx+rowsCount; rowIdx++ {
+		f, ok := c.getFloatValueAtRow(br, rowIdx)
+		if ok {
+			ssp.updateState(f)
+		}
+	}
+}
+
+func (ssp *statsSumProcessor) updateStateForColumnRows(br *blockResult, c *blockResultColumn, rowIndexes []int) {
+	for _, rowIdx := range rowIndexes {
+		f, ok := c.getFloatValueAtRow(br, rowIdx)
+		if ok {
+			ssp.updateState(f)
+		}
+	}
+}
+
 func (ssp *statsSumProcessor) updateStateForColumn(br *blockResult, c *blockResultColumn) {
 	f, count := c.sumValues(br)
 	if count > 0 {
@@ -92,7 +145,7 @@ func (ssp *statsSumProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp s
 }
 
 func (ssp *statsSumProcessor) finalizeStats(_ statsFunc, dst []byte, _ <-chan struct{}) []byte {
-	return strconv.AppendFloat(dst, ssp.sum, 'f', -1, 64)
+	return marshalStatsFloat64String(dst, ssp.sum)
 }
 
 func parseStatsSum(lex *lexer) (*statsSum, error) {
@@ -2,14 +2,24 @@ package logstorage
 
 import (
 	"strconv"
+	"unicode/utf8"
 )
 
 type statsSumLen struct {
 	fields []string
+
+	// isRunes is set if 'runes' keyword is specified after sum_len(...).
+	//
+	// In this case the lengths are calculated in runes (Unicode chars) instead of bytes.
+	isRunes bool
 }
 
 func (ss *statsSumLen) String() string {
-	return "sum_len(" + statsFuncFieldsToString(ss.fields) + ")"
+	s := "sum_len(" + statsFuncFieldsToString(ss.fields) + ")"
+	if ss.isRunes {
+		s += " runes"
+	}
+	return s
 }
 
 func (ss *statsSumLen) updateNeededFields(neededFields fieldsSet) {
@@ -30,18 +40,32 @@ func (ssp *statsSumLenProcessor) updateStatsForAllRows(sf statsFunc, br *blockRe
 	if len(fields) == 0 {
 		// Sum all the columns
 		for _, c := range br.getColumns() {
-			ssp.sumLen += c.sumLenValues(br)
+			ssp.sumLen += ss.sumLenColumn(c, br)
 		}
 	} else {
 		// Sum the requested columns
 		for _, field := range fields {
 			c := br.getColumnByName(field)
-			ssp.sumLen += c.sumLenValues(br)
+			ssp.sumLen += ss.sumLenColumn(c, br)
 		}
 	}
 	return 0
 }
 
+func (ss *statsSumLen) sumLenColumn(c *blockResultColumn, br *blockResult) uint64 {
+	if ss.isRunes {
+		return c.sumRuneLenValues(br)
+	}
+	return c.sumLenValues(br)
+}
+
+func (ss *statsSumLen) valueLen(v string) uint64 {
+	if ss.isRunes {
+		return uint64(utf8.RuneCountInString(v))
+	}
+	return uint64(len(v))
+}
+
 func (ssp *statsSumLenProcessor) updateStatsForRow(sf statsFunc, br *blockResult, rowIdx int) int {
 	ss := sf.(*statsSumLen)
 	fields := ss.fields
@@ -49,19 +73,23 @@ func (ssp *statsSumLenProcessor) updateStatsForRow(sf statsFunc, br *blockResult
 		// Sum all the fields for the given row
 		for _, c := range br.getColumns() {
 			v := c.getValueAtRow(br, rowIdx)
-			ssp.sumLen += uint64(len(v))
+			ssp.sumLen += ss.valueLen(v)
 		}
 	} else {
 		// Sum only the given fields for the given row
 		for _, field := range fields {
 			c := br.getColumnByName(field)
 			v := c.getValueAtRow(br, rowIdx)
-			ssp.sumLen += uint64(len(v))
+			ssp.sumLen += ss.valueLen(v)
 		}
 	}
 	return 0
 }
 
+func (ssp *statsSumLenProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(ssp, sf, br, rowIndexes)
+}
+
 func (ssp *statsSumLenProcessor) mergeState(_ *chunkedAllocator, _ statsFunc, sfp statsProcessor) {
 	src := sfp.(*statsSumLenProcessor)
 	ssp.sumLen += src.sumLen
@@ -79,5 +107,9 @@ func parseStatsSumLen(lex *lexer) (*statsSumLen, error) {
 	ss := &statsSumLen{
 		fields: fields,
 	}
+	if lex.isKeyword("runes") {
+		lex.nextToken()
+		ss.isRunes = true
+	}
 	return ss, nil
 }
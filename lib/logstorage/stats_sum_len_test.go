@@ -13,6 +13,7 @@ func TestParseStatsSumLenSuccess(t *testing.T) {
 	f(`sum_len(*)`)
 	f(`sum_len(a)`)
 	f(`sum_len(a, b)`)
+	f(`sum_len(a) runes`)
 }
 
 func TestParseStatsSumLenFailure(t *testing.T) {
@@ -24,6 +25,7 @@ func TestParseStatsSumLenFailure(t *testing.T) {
 	f(`sum_len`)
 	f(`sum_len(a b)`)
 	f(`sum_len(x) y`)
+	f(`sum_len(x) runes y`)
 }
 
 func TestStatsSumLen(t *testing.T) {
@@ -52,6 +54,48 @@ func TestStatsSumLen(t *testing.T) {
 		},
 	})
 
+	f("stats sum_len(a) as x, sum_len(a) runes as y, sum_len(a) bytes", [][]Field{
+		{
+			{"a", `привет`},
+		},
+		{
+			{"a", `abc`},
+		},
+		{
+			{"a", `日本`},
+		},
+	}, [][]Field{
+		{
+			{"x", "21"},
+			{"y", "11"},
+			{"bytes", "21"},
+		},
+	})
+
+	f("stats by (b) sum_len(a) runes as y", [][]Field{
+		{
+			{"a", `привет`},
+			{"b", `1`},
+		},
+		{
+			{"a", `abc`},
+			{"b", `2`},
+		},
+		{
+			{"a", `日本`},
+			{"b", `1`},
+		},
+	}, [][]Field{
+		{
+			{"b", "1"},
+			{"y", "8"},
+		},
+		{
+			{"b", "2"},
+			{"y", "3"},
+		},
+	})
+
 	f("stats sum_len(a) as x", [][]Field{
 		{
 			{"_msg", `abc`},
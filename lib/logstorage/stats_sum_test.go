@@ -361,4 +361,21 @@ func TestStatsSum(t *testing.T) {
 			{"x", "NaN"},
 		},
 	})
+
+	// insignificant digits caused by float64 rounding errors must be dropped
+	f("stats sum(a) as x", [][]Field{
+		{
+			{"a", `0.1`},
+		},
+		{
+			{"a", `0.2`},
+		},
+		{
+			{"a", `0.4`},
+		},
+	}, [][]Field{
+		{
+			{"x", "0.7"},
+		},
+	})
 }
@@ -121,6 +121,10 @@ func (sup *statsUniqValuesProcessor) updateStatsForRow(sf statsFunc, br *blockRe
 	return stateSizeIncrease
 }
 
+func (sup *statsUniqValuesProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(sup, sf, br, rowIndexes)
+}
+
 func (sup *statsUniqValuesProcessor) updateStatsForRowColumn(c *blockResultColumn, br *blockResult, rowIdx int) int {
 	if c.isConst {
 		// collect unique const values
@@ -157,6 +161,9 @@ func (sup *statsUniqValuesProcessor) mergeState(_ *chunkedAllocator, sf statsFun
 	for k := range src.m {
 		if _, ok := sup.m[k]; !ok {
 			sup.m[k] = struct{}{}
+			if sup.limitReached(su) {
+				return
+			}
 		}
 	}
 }
@@ -172,7 +179,7 @@ func (sup *statsUniqValuesProcessor) finalizeStats(sf statsFunc, dst []byte, sto
 	}
 
 	if limit := su.limit; limit > 0 && uint64(len(items)) > limit {
-		items = items[:limit]
+		items = append(items[:limit:limit], statsValuesTruncatedMarker)
 	}
 
 	return marshalJSONArray(dst, items)
@@ -76,6 +76,22 @@ func TestStatsUniqValues(t *testing.T) {
 		},
 	})
 
+	f("stats uniq_values(a) limit 2 as x", [][]Field{
+		{
+			{"a", `2`},
+		},
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `3`},
+		},
+	}, [][]Field{
+		{
+			{"x", `["1","2","…(truncated)"]`},
+		},
+	})
+
 	f("stats uniq_values(a) as x", [][]Field{
 		{
 			{"_msg", `abc`},
@@ -1,7 +1,9 @@
 package logstorage
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"strings"
 	"unsafe"
 )
@@ -9,10 +11,19 @@ import (
 type statsValues struct {
 	fields []string
 	limit  uint64
+
+	// isSorted is set if 'sort' keyword is specified after values(...).
+	//
+	// In this case the returned values are sorted in numeric order if all of them are numbers,
+	// and in lexicographic order otherwise.
+	isSorted bool
 }
 
 func (sv *statsValues) String() string {
 	s := "values(" + statsFuncFieldsToString(sv.fields) + ")"
+	if sv.isSorted {
+		s += " sort"
+	}
 	if sv.limit > 0 {
 		s += fmt.Sprintf(" limit %d", sv.limit)
 	}
@@ -123,6 +134,10 @@ func (svp *statsValuesProcessor) updateStatsForRow(sf statsFunc, br *blockResult
 	return stateSizeIncrease
 }
 
+func (svp *statsValuesProcessor) updateStatsForRows(sf statsFunc, br *blockResult, rowIndexes []int) int {
+	return updateStatsForRowsDefault(svp, sf, br, rowIndexes)
+}
+
 func (svp *statsValuesProcessor) updateStatsForRowColumn(c *blockResultColumn, br *blockResult, rowIdx int) int {
 	stateSizeIncrease := 0
 	if c.isConst {
@@ -165,7 +180,15 @@ func (svp *statsValuesProcessor) mergeState(_ *chunkedAllocator, sf statsFunc, s
 	}
 
 	src := sfp.(*statsValuesProcessor)
-	svp.values = append(svp.values, src.values...)
+	srcValues := src.values
+	if limit := sv.limit; limit > 0 {
+		// Do not collect more than limit+1 values, since this is enough for detecting the truncated results.
+		n := limit + 1 - uint64(len(svp.values))
+		if uint64(len(srcValues)) > n {
+			srcValues = srcValues[:n]
+		}
+	}
+	svp.values = append(svp.values, srcValues...)
 }
 
 func (svp *statsValuesProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-chan struct{}) []byte {
@@ -175,13 +198,47 @@ func (svp *statsValuesProcessor) finalizeStats(sf statsFunc, dst []byte, _ <-cha
 		return append(dst, "[]"...)
 	}
 
+	if sv.isSorted {
+		sortValues(items)
+	}
+
 	if limit := sv.limit; limit > 0 && uint64(len(items)) > limit {
-		items = items[:limit]
+		items = append(items[:limit:limit], statsValuesTruncatedMarker)
 	}
 
 	return marshalJSONArray(dst, items)
 }
 
+// sortValues sorts a in numeric order if all the items in a are numbers. Otherwise a is sorted in lexicographic order.
+func sortValues(a []string) {
+	fs := make([]float64, len(a))
+	for i, v := range a {
+		f, ok := tryParseFloat64(v)
+		if !ok {
+			slices.Sort(a)
+			return
+		}
+		fs[i] = f
+	}
+
+	idxs := make([]int, len(a))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	slices.SortStableFunc(idxs, func(x, y int) int {
+		return cmp.Compare(fs[x], fs[y])
+	})
+
+	tmp := append([]string{}, a...)
+	for i, idx := range idxs {
+		a[i] = tmp[idx]
+	}
+}
+
+// statsValuesTruncatedMarker is added to the end of values(...) and uniq_values(...) results
+// if they were truncated because of the 'limit N'.
+const statsValuesTruncatedMarker = "…(truncated)"
+
 func (svp *statsValuesProcessor) limitReached(sv *statsValues) bool {
 	limit := sv.limit
 	return limit > 0 && uint64(len(svp.values)) > limit
@@ -195,6 +252,10 @@ func parseStatsValues(lex *lexer) (*statsValues, error) {
 	sv := &statsValues{
 		fields: fields,
 	}
+	if lex.isKeyword("sort") {
+		lex.nextToken()
+		sv.isSorted = true
+	}
 	if lex.isKeyword("limit") {
 		lex.nextToken()
 		n, ok := tryParseUint64(lex.token)
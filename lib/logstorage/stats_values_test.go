@@ -14,6 +14,8 @@ func TestParseStatsValuesSuccess(t *testing.T) {
 	f(`values(a)`)
 	f(`values(a, b)`)
 	f(`values(a, b) limit 10`)
+	f(`values(a) sort`)
+	f(`values(a, b) sort limit 10`)
 }
 
 func TestParseStatsValuesFailure(t *testing.T) {
@@ -27,4 +29,67 @@ func TestParseStatsValuesFailure(t *testing.T) {
 	f(`values(x) y`)
 	f(`values(a, b) limit`)
 	f(`values(a, b) limit foo`)
+	f(`values(a) sort foo`)
+	f(`values(a) limit 10 sort`)
+}
+
+func TestStatsValuesSort(t *testing.T) {
+	f := func(pipeStr string, rows, rowsExpected [][]Field) {
+		t.Helper()
+		expectPipeResults(t, pipeStr, rows, rowsExpected)
+	}
+
+	// numeric values
+	f("stats values(a) sort as x", [][]Field{
+		{
+			{"a", `10`},
+		},
+		{
+			{"a", `-2.5`},
+		},
+		{
+			{"a", `9`},
+		},
+		{
+			{"a", `10`},
+		},
+	}, [][]Field{
+		{
+			{"x", `["-2.5","9","10","10"]`},
+		},
+	})
+
+	// mixed values
+	f("stats values(a) sort as x", [][]Field{
+		{
+			{"a", `10`},
+		},
+		{
+			{"a", `foo`},
+		},
+		{
+			{"a", `9`},
+		},
+	}, [][]Field{
+		{
+			{"x", `["10","9","foo"]`},
+		},
+	})
+
+	// sort with limit
+	f("stats values(a) sort limit 2 as x", [][]Field{
+		{
+			{"a", `3`},
+		},
+		{
+			{"a", `1`},
+		},
+		{
+			{"a", `2`},
+		},
+	}, [][]Field{
+		{
+			{"x", `["1","2","…(truncated)"]`},
+		},
+	})
 }
@@ -29,6 +29,12 @@ type StorageStats struct {
 	// IsReadOnly indicates whether the storage is read-only.
 	IsReadOnly bool
 
+	// StatsResultCacheRequests is the number of requests to the cache for `stats` pipe results.
+	StatsResultCacheRequests uint64
+
+	// StatsResultCacheMisses is the number of misses for the cache for `stats` pipe results.
+	StatsResultCacheMisses uint64
+
 	// PartitionStats contains partition stats.
 	PartitionStats
 }
@@ -72,6 +78,11 @@ type StorageConfig struct {
 	//
 	// This can be useful for debugging of data ingestion.
 	LogIngestedRows bool
+
+	// StatsResultCacheTTL is the lifetime for the cached results of `stats` pipes.
+	//
+	// The results of `stats` pipes aren't cached if it is zero.
+	StatsResultCacheTTL time.Duration
 }
 
 // Storage is the storage for log entries.
@@ -141,6 +152,9 @@ type Storage struct {
 	//
 	// It reduces the load on persistent storage during querying by _stream:{...} filter.
 	filterStreamCache *cache
+
+	// statsResultCache caches the results of `stats` pipes. It is nil if the caching is disabled.
+	statsResultCache *statsResultCache
 }
 
 type partitionWrapper struct {
@@ -259,6 +273,8 @@ func MustOpenStorage(path string, cfg *StorageConfig) *Storage {
 
 		streamIDCache:     streamIDCache,
 		filterStreamCache: filterStreamCache,
+
+		statsResultCache: newStatsResultCache(cfg.StatsResultCacheTTL),
 	}
 
 	partitionsPath := filepath.Join(path, partitionsDirname)
@@ -481,6 +497,11 @@ func (s *Storage) MustClose() {
 	s.filterStreamCache.MustStop()
 	s.filterStreamCache = nil
 
+	if s.statsResultCache != nil {
+		s.statsResultCache.MustStop()
+		s.statsResultCache = nil
+	}
+
 	// release lock file
 	fs.MustClose(s.flockF)
 	s.flockF = nil
@@ -643,6 +664,11 @@ func (s *Storage) UpdateStats(ss *StorageStats) {
 	}
 	s.partitionsLock.Unlock()
 
+	if c := s.statsResultCache; c != nil {
+		ss.StatsResultCacheRequests += c.c.Requests()
+		ss.StatsResultCacheMisses += c.c.Misses()
+	}
+
 	ss.IsReadOnly = s.IsReadOnly()
 }
 
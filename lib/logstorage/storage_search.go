@@ -110,6 +110,7 @@ func (s *Storage) RunQuery(ctx context.Context, tenantIDs []TenantID, q *Query,
 }
 
 func (s *Storage) runQuery(ctx context.Context, tenantIDs []TenantID, q *Query, writeBlockResultFunc func(workerID uint, br *blockResult)) error {
+	qOrig := q
 	qNew, err := s.initFilterInValues(ctx, tenantIDs, q)
 	if err != nil {
 		return err
@@ -152,16 +153,36 @@ func (s *Storage) runQuery(ctx context.Context, tenantIDs []TenantID, q *Query,
 		workersCount = int(q.opts.concurrency)
 	}
 
+	// Try obtaining the results of the first `stats` pipe from the cache.
+	// If they are found, then execute only the pipes after the `stats` pipe.
+	firstPipeIdx := 0
+	var statsCacheBlocks []statsResultCacheBlock
+	var statsCacheRecorder *statsResultCacheRecorder
+	var statsStopCh <-chan struct{}
+	scq := s.getStatsResultCacheQuery(tenantIDs, qOrig, q)
+	if scq != nil {
+		if blocks, ok := s.statsResultCache.get(scq.key); ok {
+			statsCacheBlocks = blocks
+			firstPipeIdx = scq.pipeIdx + 1
+		}
+	}
+
 	ppMain := newDefaultPipeProcessor(writeBlockResultFunc)
 	pp := ppMain
 	stopCh := ctx.Done()
-	cancels := make([]func(), len(q.pipes))
-	pps := make([]pipeProcessor, len(q.pipes))
+	cancels := make([]func(), len(q.pipes)-firstPipeIdx)
+	pps := make([]pipeProcessor, len(q.pipes)-firstPipeIdx)
 
 	var errPipe error
-	for i := len(q.pipes) - 1; i >= 0; i-- {
+	for i := len(q.pipes) - 1; i >= firstPipeIdx; i-- {
 		p := q.pipes[i]
 		ctxChild, cancel := context.WithCancel(ctx)
+		if scq != nil && statsCacheBlocks == nil && i == scq.pipeIdx {
+			// Record the `stats` pipe results in order to put them into the cache.
+			statsCacheRecorder = newStatsResultCacheRecorder(pp, s.statsResultCache.getMaxEntrySizeBytes())
+			statsStopCh = stopCh
+			pp = statsCacheRecorder
+		}
 		pp = p.newPipeProcessor(workersCount, stopCh, cancel, pp)
 
 		pcp, ok := pp.(*pipeStreamContextProcessor)
@@ -175,19 +196,29 @@ func (s *Storage) runQuery(ctx context.Context, tenantIDs []TenantID, q *Query,
 		stopCh = ctxChild.Done()
 		ctx = ctxChild
 
-		cancels[i] = cancel
-		pps[i] = pp
+		cancels[i-firstPipeIdx] = cancel
+		pps[i-firstPipeIdx] = pp
 	}
 
 	if errPipe == nil {
-		s.search(workersCount, so, stopCh, pp.writeBlock)
+		if statsCacheBlocks != nil {
+			writeStatsResultCacheBlocks(pp, statsCacheBlocks, stopCh)
+		} else {
+			s.search(workersCount, so, stopCh, pp.writeBlock)
+		}
 	}
 
 	var errFlush error
+	isStatsResultComplete := false
 	for i, pp := range pps {
 		if err := pp.flush(); err != nil && errFlush == nil {
 			errFlush = err
 		}
+		if statsCacheRecorder != nil && i == scq.pipeIdx {
+			// The `stats` pipe results are incomplete if the `stats` pipe has been stopped by the query cancellation
+			// or by the next pipe such as `limit`. This must be checked before canceling the next pipe below.
+			isStatsResultComplete = errFlush == nil && !needStop(statsStopCh)
+		}
 		cancel := cancels[i]
 		cancel()
 	}
@@ -199,6 +230,10 @@ func (s *Storage) runQuery(ctx context.Context, tenantIDs []TenantID, q *Query,
 		return errPipe
 	}
 
+	if isStatsResultComplete && errFlush == nil && !statsCacheRecorder.isTooBig {
+		s.statsResultCache.set(scq.key, statsCacheRecorder.blocks, statsCacheRecorder.sizeBytes)
+	}
+
 	return errFlush
 }
 
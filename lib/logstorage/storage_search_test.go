@@ -578,6 +578,30 @@ func TestStorageRunQuery(t *testing.T) {
 			},
 		})
 	})
+	t.Run("stats-min-max-time", func(t *testing.T) {
+		minTime := string(marshalTimestampRFC3339NanoString(nil, baseTimestamp))
+		maxTime := string(marshalTimestampRFC3339NanoString(nil, baseTimestamp+(rowsPerBlock-1)*1e9+blocksPerStream-1))
+		f(t, `* | stats min(_time) min_time, max(_time) max_time`, [][]Field{
+			{
+				{"min_time", minTime},
+				{"max_time", maxTime},
+			},
+		})
+		f(t, `* | stats by (instance) max(_time) max_time | sort by (instance)`, [][]Field{
+			{
+				{"instance", "host-0:234"},
+				{"max_time", maxTime},
+			},
+			{
+				{"instance", "host-1:234"},
+				{"max_time", maxTime},
+			},
+			{
+				{"instance", "host-2:234"},
+				{"max_time", maxTime},
+			},
+		})
+	})
 	t.Run("union=pipe", func(t *testing.T) {
 		f(t, `{instance=~"host-1.+"} | union ({instance=~"host-2.+"}) | count() hits`, [][]Field{
 			{
@@ -934,6 +934,19 @@ func tryParseIPv4Mask(s string) (uint64, bool) {
 	return 1 << (32 - uint8(n)), true
 }
 
+// tryParseIPv6Mask parses '/num' ipv6 mask and returns num
+func tryParseIPv6Mask(s string) (int, bool) {
+	if len(s) == 0 || s[0] != '/' {
+		return 0, false
+	}
+	s = s[1:]
+	n, ok := tryParseUint64(s)
+	if !ok || n > 128 {
+		return 0, false
+	}
+	return int(n), true
+}
+
 // tryParseDuration parses the given duration in nanoseconds and returns the result.
 func tryParseDuration(s string) (int64, bool) {
 	if len(s) == 0 {
@@ -1349,6 +1362,24 @@ func marshalFloat64String(dst []byte, f float64) []byte {
 	return strconv.AppendFloat(dst, f, 'f', -1, 64)
 }
 
+// marshalStatsFloat64String appends the string representation of f calculated by stats functions to dst.
+//
+// Non-integer f is rounded to 15 significant digits in order to drop insignificant digits caused by float64 rounding errors
+// such as 0.1+0.2=0.30000000000000004. Integer f is left as is, since it is exactly representable for reasonable magnitudes.
+func marshalStatsFloat64String(dst []byte, f float64) []byte {
+	if f == math.Trunc(f) || math.IsNaN(f) || math.IsInf(f, 0) {
+		return marshalFloat64String(dst, f)
+	}
+
+	var buf [32]byte
+	b := strconv.AppendFloat(buf[:0], f, 'e', 14, 64)
+	fRounded, err := strconv.ParseFloat(bytesutil.ToUnsafeString(b), 64)
+	if err != nil {
+		logger.Panicf("BUG: cannot parse %q: %s", b, err)
+	}
+	return marshalFloat64String(dst, fRounded)
+}
+
 func marshalIPv4String(dst []byte, n uint32) []byte {
 	dst = marshalUint8String(dst, uint8(n>>24))
 	dst = append(dst, '.')
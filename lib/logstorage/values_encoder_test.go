@@ -669,6 +669,44 @@ func TestMarshalFloat64String(t *testing.T) {
 	f(-1.234567, "-1.234567")
 }
 
+func TestMarshalStatsFloat64String(t *testing.T) {
+	f := func(f float64, resultExpected string) {
+		t.Helper()
+
+		result := marshalStatsFloat64String(nil, f)
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+
+	f(0, "0")
+	f(1234, "1234")
+	f(-12345678, "-12345678")
+	f(1.234, "1.234")
+	f(-1.234567, "-1.234567")
+	f(math.NaN(), "NaN")
+	f(math.Inf(1), "+Inf")
+	f(math.Inf(-1), "-Inf")
+
+	// insignificant digits caused by float64 rounding errors must be dropped
+	f(0.1+0.2, "0.3")
+	f(1234.56+0.0000000000001, "1234.56")
+	f(-1.1*1.1, "-1.21")
+	f(100.0/3, "33.3333333333333")
+	f(2.0/3, "0.666666666666667")
+
+	// integers must be kept as is
+	f(1<<53, "9007199254740992")
+	f(1234567890123456789, "1234567890123456800")
+	f(1e21, "1000000000000000000000")
+
+	// very small and very large non-integer numbers mustn't be formatted in scientific notation
+	f(1.23456789e-12, "0.00000000000123456789")
+	f(1.0/3*1e-20, "0.00000000000000000000333333333333333")
+	f(123456789012.3456789, "123456789012.346")
+	f(-1e11+0.5, "-99999999999.5")
+}
+
 func TestTryParseUint64_Success(t *testing.T) {
 	f := func(s string, resultExpected uint64) {
 		t.Helper()
@@ -900,3 +938,45 @@ func TestTryParseIPv4Mask_Failure(t *testing.T) {
 	// Negative mask
 	f("/-1")
 }
+
+func TestTryParseIPv6Mask_Success(t *testing.T) {
+	f := func(s string, resultExpected int) {
+		t.Helper()
+
+		result, ok := tryParseIPv6Mask(s)
+		if !ok {
+			t.Fatalf("cannot parse %q", s)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %d; want %d", result, resultExpected)
+		}
+	}
+
+	f("/0", 0)
+	f("/24", 24)
+	f("/64", 64)
+	f("/128", 128)
+}
+
+func TestTryParseIPv6Mask_Failure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		_, ok := tryParseIPv6Mask(s)
+		if ok {
+			t.Fatalf("expecting error when parsing %q", s)
+		}
+	}
+
+	// Empty mask
+	f("")
+
+	// Invalid prefix
+	f("foo")
+
+	// Non-numeric mask
+	f("/foo")
+
+	// Too big mask
+	f("/129")
+}
@@ -2,6 +2,9 @@ package prompbmarshal_test
 
 import (
 	"bytes"
+	"encoding/hex"
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
@@ -39,35 +42,77 @@ func TestWriteRequestMarshalProtobuf(t *testing.T) {
 			},
 		},
 	}
+	ts := &wrm.Timeseries[0]
+	if err := ts.AddExemplar([]prompbmarshal.Label{
+		{
+			Name:  "trace_id",
+			Value: "123456",
+		},
+		{
+			Name:  "span_id",
+			Value: "abcdef",
+		},
+	}, 1.5, 8939432420); err != nil {
+		t.Fatalf("cannot add exemplar: %s", err)
+	}
+	if err := ts.AddExemplar(nil, -2.25, 18939432420); err != nil {
+		t.Fatalf("cannot add exemplar: %s", err)
+	}
+	if err := ts.AddExemplar([]prompbmarshal.Label{
+		{
+			Name:  "trace_id",
+			Value: "7890",
+		},
+	}, 0, 0); err != nil {
+		t.Fatalf("cannot add exemplar: %s", err)
+	}
+	if n := wrm.ExemplarsCount(); n != 3 {
+		t.Fatalf("unexpected number of exemplars; got %d; want 3", n)
+	}
+	wrm.Metadata = []prompbmarshal.MetricMetadata{
+		{
+			Type:             prompbmarshal.MetricTypeCounter,
+			MetricFamilyName: "process_cpu_seconds_total",
+			Help:             "Total user and system CPU time spent in seconds.",
+			Unit:             "seconds",
+		},
+		{
+			Type:             prompbmarshal.MetricTypeGauge,
+			MetricFamilyName: "go_goroutines",
+			Help:             "Number of goroutines that currently exist.",
+		},
+		{
+			// metadata with only the metric family name
+			MetricFamilyName: "foo",
+		},
+	}
 	data := wrm.MarshalProtobuf(nil)
 
-	// Verify that the marshaled protobuf is unmarshaled properly
+	// Verify that lib/prompb properly unmarshals labels and samples, while skipping exemplars and metadata.
 	var wr prompb.WriteRequest
 	if err := wr.UnmarshalProtobuf(data); err != nil {
 		t.Fatalf("cannot unmarshal protobuf: %s", err)
 	}
+	if n := len(wr.Timeseries); n != 1 {
+		t.Fatalf("unexpected number of time series; got %d; want 1", n)
+	}
+	if n := len(wr.Timeseries[0].Labels); n != 3 {
+		t.Fatalf("unexpected number of labels; got %d; want 3", n)
+	}
+	if n := len(wr.Timeseries[0].Samples); n != 2 {
+		t.Fatalf("unexpected number of samples; got %d; want 2", n)
+	}
 
-	// Compare the unmarshaled wr with the original wrm.
-	wrm.Reset()
-	for _, ts := range wr.Timeseries {
-		var labels []prompbmarshal.Label
-		for _, label := range ts.Labels {
-			labels = append(labels, prompbmarshal.Label{
-				Name:  label.Name,
-				Value: label.Value,
-			})
-		}
-		var samples []prompbmarshal.Sample
-		for _, sample := range ts.Samples {
-			samples = append(samples, prompbmarshal.Sample{
-				Value:     sample.Value,
-				Timestamp: sample.Timestamp,
-			})
-		}
-		wrm.Timeseries = append(wrm.Timeseries, prompbmarshal.TimeSeries{
-			Labels:  labels,
-			Samples: samples,
-		})
+	// Verify that the marshaled protobuf is unmarshaled properly
+	wrm, err := unmarshalWriteRequest(data)
+	if err != nil {
+		t.Fatalf("cannot unmarshal protobuf: %s", err)
+	}
+	if n := wrm.ExemplarsCount(); n != 3 {
+		t.Fatalf("unexpected number of exemplars after unmarshaling; got %d; want 3", n)
+	}
+	if n := len(wrm.Metadata); n != 3 {
+		t.Fatalf("unexpected number of metadata entries after unmarshaling; got %d; want 3", n)
 	}
 	dataResult := wrm.MarshalProtobuf(nil)
 
@@ -75,3 +120,444 @@ func TestWriteRequestMarshalProtobuf(t *testing.T) {
 		t.Fatalf("unexpected data obtained after marshaling\ngot\n%X\nwant\n%X", dataResult, data)
 	}
 }
+
+func TestWriteRequestMarshalProtobufTo(t *testing.T) {
+	wr := newTestWriteRequest([][]prompbmarshal.Label{
+		{
+			{
+				Name:  "__name__",
+				Value: "foo",
+			},
+		},
+		{
+			{
+				Name:  "__name__",
+				Value: "bar",
+			},
+			{
+				Name:  "job",
+				Value: "baz",
+			},
+		},
+	})
+	dataExpected := wr.MarshalProtobuf(nil)
+
+	// The marshaled wr must be appended to dst
+	prefix := []byte("prefix")
+	data := wr.MarshalProtobufTo(append([]byte{}, prefix...))
+	if !bytes.HasPrefix(data, prefix) {
+		t.Fatalf("missing prefix in the marshaled data: %X", data)
+	}
+	if !bytes.Equal(data[len(prefix):], dataExpected) {
+		t.Fatalf("unexpected data obtained after marshaling\ngot\n%X\nwant\n%X", data[len(prefix):], dataExpected)
+	}
+
+	// Marshaling into the reused buffer mustn't allocate memory
+	allocs := testing.AllocsPerRun(100, func() {
+		data = wr.MarshalProtobufTo(data[:0])
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected memory allocations when marshaling into the reused buffer; got %v; want 0", allocs)
+	}
+	if !bytes.Equal(data, dataExpected) {
+		t.Fatalf("unexpected data obtained after marshaling into the reused buffer\ngot\n%X\nwant\n%X", data, dataExpected)
+	}
+}
+
+func TestTimeSeriesAddExemplarFailure(t *testing.T) {
+	var ts prompbmarshal.TimeSeries
+	labels := []prompbmarshal.Label{
+		{
+			Name:  "trace_id",
+			Value: "123",
+		},
+		{
+			Name:  "",
+			Value: "foo",
+		},
+	}
+	if err := ts.AddExemplar(labels, 1, 2); err == nil {
+		t.Fatalf("expecting non-nil error for exemplar label with empty name")
+	}
+	if len(ts.Exemplars) != 0 {
+		t.Fatalf("unexpected exemplars added: %v", ts.Exemplars)
+	}
+}
+
+func TestWriteRequestMarshalProtobufNativeHistogram(t *testing.T) {
+	f := func(h prompbmarshal.Histogram) {
+		t.Helper()
+
+		wrm := &prompbmarshal.WriteRequest{
+			Timeseries: []prompbmarshal.TimeSeries{
+				{
+					Labels: []prompbmarshal.Label{
+						{
+							Name:  "__name__",
+							Value: "http_request_duration_seconds",
+						},
+					},
+					Histograms: []prompbmarshal.Histogram{h},
+				},
+			},
+		}
+		data := wrm.MarshalProtobuf(nil)
+
+		// Verify that lib/prompb skips histograms.
+		var wr prompb.WriteRequest
+		if err := wr.UnmarshalProtobuf(data); err != nil {
+			t.Fatalf("cannot unmarshal protobuf: %s", err)
+		}
+		if n := len(wr.Timeseries); n != 1 {
+			t.Fatalf("unexpected number of time series; got %d; want 1", n)
+		}
+
+		// Verify that the marshaled protobuf is unmarshaled properly
+		wrm, err := unmarshalWriteRequest(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal protobuf: %s", err)
+		}
+		dataResult := wrm.MarshalProtobuf(nil)
+
+		if !bytes.Equal(dataResult, data) {
+			t.Fatalf("unexpected data obtained after marshaling\ngot\n%X\nwant\n%X", dataResult, data)
+		}
+	}
+
+	// empty histogram
+	f(prompbmarshal.Histogram{})
+
+	// integer histogram
+	f(prompbmarshal.Histogram{
+		Count:         25,
+		Sum:           1234.5,
+		Schema:        -2,
+		ZeroThreshold: 1e-128,
+		ZeroCount:     3,
+		NegativeSpans: []prompbmarshal.BucketSpan{
+			{
+				Offset: -3,
+				Length: 2,
+			},
+		},
+		NegativeDeltas: []int64{2, -1},
+		PositiveSpans: []prompbmarshal.BucketSpan{
+			{
+				Offset: 0,
+				Length: 2,
+			},
+			{
+				Offset: 5,
+				Length: 3,
+			},
+		},
+		PositiveDeltas: []int64{1, 3, -2, 100000, -99990},
+		ResetHint:      prompbmarshal.ResetHintNo,
+		Timestamp:      8939432423,
+	})
+
+	// empty float histogram
+	f(prompbmarshal.Histogram{
+		IsFloat: true,
+	})
+
+	// float histogram
+	f(prompbmarshal.Histogram{
+		IsFloat:        true,
+		CountFloat:     12.5,
+		Sum:            -34.25,
+		Schema:         3,
+		ZeroThreshold:  0.001,
+		ZeroCountFloat: 0.5,
+		NegativeSpans: []prompbmarshal.BucketSpan{
+			{
+				Offset: 1,
+				Length: 1,
+			},
+		},
+		NegativeCounts: []float64{2},
+		PositiveSpans: []prompbmarshal.BucketSpan{
+			{
+				Offset: -10,
+				Length: 3,
+			},
+		},
+		PositiveCounts: []float64{1.5, 0, 8.5},
+		ResetHint:      prompbmarshal.ResetHintGauge,
+		Timestamp:      -1,
+	})
+
+	// histogram with custom buckets
+	f(prompbmarshal.Histogram{
+		Count:  10,
+		Sum:    42.5,
+		Schema: -53,
+		PositiveSpans: []prompbmarshal.BucketSpan{
+			{
+				Offset: 0,
+				Length: 3,
+			},
+		},
+		PositiveDeltas: []int64{2, 3, 0},
+		CustomValues:   []float64{0.1, 0.5, 2.5},
+		Timestamp:      1234,
+	})
+}
+
+func TestHistogramMarshalProtobuf(t *testing.T) {
+	f := func(h prompbmarshal.Histogram, resultExpected string) {
+		t.Helper()
+
+		data := make([]byte, h.Size())
+		n, err := h.MarshalToSizedBuffer(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if n != len(data) {
+			t.Fatalf("unexpected marshaled size; got %d; want %d", n, len(data))
+		}
+		result := hex.EncodeToString(data)
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+
+	// zero integer counts must be marshaled in order to select the integer oneof members
+	f(prompbmarshal.Histogram{}, "08003000")
+
+	// zero float counts must be marshaled in order to select the float oneof members
+	f(prompbmarshal.Histogram{
+		IsFloat: true,
+	}, "110000000000000000390000000000000000")
+
+	// custom values
+	f(prompbmarshal.Histogram{
+		Count:        1,
+		CustomValues: []float64{1},
+	}, "08013000820108000000000000f03f")
+}
+
+func TestWriteRequestMarshaledSize(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	randString := func() string {
+		b := make([]byte, r.Intn(300))
+		for i := range b {
+			b[i] = byte('a' + r.Intn(26))
+		}
+		return string(b)
+	}
+	randLabels := func() []prompbmarshal.Label {
+		labels := make([]prompbmarshal.Label, r.Intn(5))
+		for i := range labels {
+			labels[i] = prompbmarshal.Label{
+				Name:  randString(),
+				Value: randString(),
+			}
+		}
+		return labels
+	}
+	randInt64 := func() int64 {
+		// Cover both small and big values, since they have different varint sizes.
+		return r.Int63n(math.MaxInt64>>uint(r.Intn(63))) - r.Int63n(1000)
+	}
+	randFloat64 := func() float64 {
+		if r.Intn(3) == 0 {
+			return 0
+		}
+		return r.NormFloat64()
+	}
+	randSpans := func() []prompbmarshal.BucketSpan {
+		spans := make([]prompbmarshal.BucketSpan, r.Intn(3))
+		for i := range spans {
+			spans[i] = prompbmarshal.BucketSpan{
+				Offset: int32(r.Intn(100) - 50),
+				Length: uint32(r.Intn(10)),
+			}
+		}
+		return spans
+	}
+	randDeltas := func() []int64 {
+		deltas := make([]int64, r.Intn(5))
+		for i := range deltas {
+			deltas[i] = randInt64()
+		}
+		return deltas
+	}
+	randCounts := func() []float64 {
+		counts := make([]float64, r.Intn(5))
+		for i := range counts {
+			counts[i] = randFloat64()
+		}
+		return counts
+	}
+
+	for i := 0; i < 1000; i++ {
+		var wr prompbmarshal.WriteRequest
+		tss := make([]prompbmarshal.TimeSeries, r.Intn(10))
+		for j := range tss {
+			ts := &tss[j]
+			ts.Labels = randLabels()
+			for k := r.Intn(5); k > 0; k-- {
+				ts.Samples = append(ts.Samples, prompbmarshal.Sample{
+					Value:     randFloat64(),
+					Timestamp: randInt64(),
+				})
+			}
+			for k := r.Intn(3); k > 0; k-- {
+				ts.Exemplars = append(ts.Exemplars, prompbmarshal.Exemplar{
+					Labels:    randLabels(),
+					Value:     randFloat64(),
+					Timestamp: randInt64(),
+				})
+			}
+			for k := r.Intn(3); k > 0; k-- {
+				ts.Histograms = append(ts.Histograms, prompbmarshal.Histogram{
+					IsFloat:        r.Intn(2) == 0,
+					Count:          uint64(randInt64()),
+					CountFloat:     randFloat64(),
+					Sum:            randFloat64(),
+					Schema:         int32(r.Intn(17) - 8),
+					ZeroThreshold:  randFloat64(),
+					ZeroCount:      uint64(randInt64()),
+					ZeroCountFloat: randFloat64(),
+					NegativeSpans:  randSpans(),
+					NegativeDeltas: randDeltas(),
+					NegativeCounts: randCounts(),
+					PositiveSpans:  randSpans(),
+					PositiveDeltas: randDeltas(),
+					PositiveCounts: randCounts(),
+					CustomValues:   randCounts(),
+					ResetHint:      prompbmarshal.ResetHint(r.Intn(4)),
+					Timestamp:      randInt64(),
+				})
+			}
+		}
+		wr.Timeseries = tss
+		for k := r.Intn(3); k > 0; k-- {
+			wr.Metadata = append(wr.Metadata, prompbmarshal.MetricMetadata{
+				Type:             prompbmarshal.MetricType(r.Intn(8)),
+				MetricFamilyName: randString(),
+				Help:             randString(),
+				Unit:             randString(),
+			})
+		}
+
+		size := wr.MarshaledSize()
+		data := wr.MarshalProtobuf(nil)
+		if size != len(data) {
+			t.Fatalf("unexpected MarshaledSize() result at iteration %d; got %d; want %d", i, size, len(data))
+		}
+	}
+}
+
+func TestWriteRequestValidateSuccess(t *testing.T) {
+	f := func(labelss ...[]prompbmarshal.Label) {
+		t.Helper()
+		wr := newTestWriteRequest(labelss)
+		if err := wr.Validate(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	// empty write request
+	f()
+
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+	})
+	f([]prompbmarshal.Label{
+		{Name: "job", Value: ""},
+		{Name: "__name__", Value: "foo:bar.baz"},
+		{Name: "_a1", Value: "x y"},
+		{Name: "Instance_2", Value: "host:1234"},
+	}, []prompbmarshal.Label{
+		{Name: "__name__", Value: "bar"},
+		{Name: "job", Value: "abc"},
+	})
+}
+
+func TestWriteRequestValidateFailure(t *testing.T) {
+	f := func(labelss ...[]prompbmarshal.Label) {
+		t.Helper()
+		wr := newTestWriteRequest(labelss)
+		if err := wr.Validate(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// empty label name
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "", Value: "bar"},
+	})
+
+	// label name with space
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "a b", Value: "bar"},
+	})
+
+	// label name starting with digit
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "1abc", Value: "bar"},
+	})
+
+	// label name with unsupported chars
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "a.b", Value: "bar"},
+	})
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "a-b", Value: "bar"},
+	})
+
+	// duplicate label names
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "job", Value: "bar"},
+		{Name: "job", Value: "baz"},
+	})
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "__name__", Value: "bar"},
+	})
+
+	// empty __name__
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: ""},
+		{Name: "job", Value: "bar"},
+	})
+
+	// missing __name__
+	f([]prompbmarshal.Label{
+		{Name: "job", Value: "bar"},
+	})
+	f([]prompbmarshal.Label{})
+
+	// the invalid series isn't the first one
+	f([]prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+	}, []prompbmarshal.Label{
+		{Name: "__name__", Value: "bar"},
+		{Name: "9", Value: "baz"},
+	})
+}
+
+func newTestWriteRequest(labelss [][]prompbmarshal.Label) *prompbmarshal.WriteRequest {
+	var wr prompbmarshal.WriteRequest
+	for _, labels := range labelss {
+		wr.Timeseries = append(wr.Timeseries, prompbmarshal.TimeSeries{
+			Labels: labels,
+			Samples: []prompbmarshal.Sample{
+				{
+					Value:     1,
+					Timestamp: 1000,
+				},
+			},
+		})
+	}
+	return &wr
+}
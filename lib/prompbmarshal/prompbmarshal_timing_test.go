@@ -2,20 +2,36 @@ package prompbmarshal
 
 import (
 	"fmt"
+	"sync/atomic"
 	"testing"
 )
 
 func BenchmarkWriteRequestMarshalProtobuf(b *testing.B) {
-	b.ReportAllocs()
-	b.SetBytes(int64(len(benchWriteRequest.Timeseries)))
-	b.RunParallel(func(pb *testing.PB) {
-		var data []byte
-		for pb.Next() {
-			data = benchWriteRequest.MarshalProtobuf(data[:0])
-		}
+	b.Run("reuse-dst", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(benchWriteRequest.Timeseries)))
+		b.RunParallel(func(pb *testing.PB) {
+			var data []byte
+			for pb.Next() {
+				data = benchWriteRequest.MarshalProtobufTo(data[:0])
+			}
+		})
+	})
+	b.Run("nil-dst", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(benchWriteRequest.Timeseries)))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				data := benchWriteRequest.MarshalProtobuf(nil)
+				Sink.Add(uint64(len(data)))
+			}
+		})
 	})
 }
 
+// Sink prevents the compiler from optimizing out the benchmarked code.
+var Sink atomic.Uint64
+
 var benchWriteRequest = func() *WriteRequest {
 	var tss []TimeSeries
 	for i := 0; i < 1_000; i++ {
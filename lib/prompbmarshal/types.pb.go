@@ -17,8 +17,79 @@ type Sample struct {
 
 // TimeSeries represents samples and labels for a single time series.
 type TimeSeries struct {
-	Labels  []Label
-	Samples []Sample
+	Labels     []Label
+	Samples    []Sample
+	Exemplars  []Exemplar
+	Histograms []Histogram
+}
+
+// Exemplar is additional information associated with a time series.
+type Exemplar struct {
+	// Optional, can be empty.
+	Labels    []Label
+	Value     float64
+	Timestamp int64
+}
+
+// ResetHint is a hint for the histogram counter reset detection.
+type ResetHint int32
+
+const (
+	// ResetHintUnknown means that the counter reset isn't known.
+	ResetHintUnknown ResetHint = 0
+	// ResetHintYes means that the histogram is a counter reset.
+	ResetHintYes ResetHint = 1
+	// ResetHintNo means that the histogram isn't a counter reset.
+	ResetHintNo ResetHint = 2
+	// ResetHintGauge means that the histogram is a gauge histogram, where counter resets don't apply.
+	ResetHintGauge ResetHint = 3
+)
+
+// Histogram is a Prometheus native histogram with sparse buckets.
+//
+// Integer histograms use Count, ZeroCount, NegativeDeltas and PositiveDeltas,
+// while float histograms use CountFloat, ZeroCountFloat, NegativeCounts and PositiveCounts.
+type Histogram struct {
+	// IsFloat must be set for float histograms.
+	//
+	// It selects the marshaled member of count and zero_count oneofs, so they are marshaled even if they are zero.
+	IsFloat bool
+
+	Count          uint64
+	CountFloat     float64
+	Sum            float64
+	Schema         int32
+	ZeroThreshold  float64
+	ZeroCount      uint64
+	ZeroCountFloat float64
+
+	// Negative buckets.
+	NegativeSpans []BucketSpan
+	// Deltas of counts relative to the previous bucket for integer histograms.
+	NegativeDeltas []int64
+	// Absolute counts for float histograms.
+	NegativeCounts []float64
+
+	// Positive buckets.
+	PositiveSpans []BucketSpan
+	// Deltas of counts relative to the previous bucket for integer histograms.
+	PositiveDeltas []int64
+	// Absolute counts for float histograms.
+	PositiveCounts []float64
+
+	ResetHint ResetHint
+	Timestamp int64
+
+	// Bucket boundaries for histograms with custom buckets (schema -53).
+	CustomValues []float64
+}
+
+// BucketSpan defines the number of consecutive buckets with their offset.
+type BucketSpan struct {
+	// Gap to previous span, or the starting point for the first span.
+	Offset int32
+	// Length of consecutive buckets.
+	Length uint32
 }
 
 type Label struct {
@@ -42,8 +113,188 @@ func (m *Sample) MarshalToSizedBuffer(dst []byte) (int, error) {
 	return len(dst) - i, nil
 }
 
+func (m *Exemplar) MarshalToSizedBuffer(dst []byte) (int, error) {
+	i := len(dst)
+	if m.Timestamp != 0 {
+		i = encodeVarint(dst, i, uint64(m.Timestamp))
+		i--
+		dst[i] = 0x18
+	}
+	if m.Value != 0 {
+		i -= 8
+		binary.LittleEndian.PutUint64(dst[i:], uint64(math.Float64bits(float64(m.Value))))
+		i--
+		dst[i] = 0x11
+	}
+	for j := len(m.Labels) - 1; j >= 0; j-- {
+		size, err := m.Labels[j].MarshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0xa
+	}
+	return len(dst) - i, nil
+}
+
+func (m *BucketSpan) MarshalToSizedBuffer(dst []byte) (int, error) {
+	i := len(dst)
+	if m.Length != 0 {
+		i = encodeVarint(dst, i, uint64(m.Length))
+		i--
+		dst[i] = 0x10
+	}
+	if m.Offset != 0 {
+		i = encodeVarint(dst, i, uint64(uint32(m.Offset<<1)^uint32(m.Offset>>31)))
+		i--
+		dst[i] = 0x8
+	}
+	return len(dst) - i, nil
+}
+
+func (m *Histogram) MarshalToSizedBuffer(dst []byte) (int, error) {
+	i := len(dst)
+	if len(m.CustomValues) > 0 {
+		i = encodePackedDoubles(dst, i, m.CustomValues)
+		i--
+		dst[i] = 0x1
+		i--
+		dst[i] = 0x82
+	}
+	if m.Timestamp != 0 {
+		i = encodeVarint(dst, i, uint64(m.Timestamp))
+		i--
+		dst[i] = 0x78
+	}
+	if m.ResetHint != 0 {
+		i = encodeVarint(dst, i, uint64(m.ResetHint))
+		i--
+		dst[i] = 0x70
+	}
+	if len(m.PositiveCounts) > 0 {
+		i = encodePackedDoubles(dst, i, m.PositiveCounts)
+		i--
+		dst[i] = 0x6a
+	}
+	if len(m.PositiveDeltas) > 0 {
+		i = encodePackedSint64s(dst, i, m.PositiveDeltas)
+		i--
+		dst[i] = 0x62
+	}
+	for j := len(m.PositiveSpans) - 1; j >= 0; j-- {
+		size, err := m.PositiveSpans[j].MarshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0x5a
+	}
+	if len(m.NegativeCounts) > 0 {
+		i = encodePackedDoubles(dst, i, m.NegativeCounts)
+		i--
+		dst[i] = 0x52
+	}
+	if len(m.NegativeDeltas) > 0 {
+		i = encodePackedSint64s(dst, i, m.NegativeDeltas)
+		i--
+		dst[i] = 0x4a
+	}
+	for j := len(m.NegativeSpans) - 1; j >= 0; j-- {
+		size, err := m.NegativeSpans[j].MarshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0x42
+	}
+	if m.IsFloat {
+		i -= 8
+		binary.LittleEndian.PutUint64(dst[i:], uint64(math.Float64bits(float64(m.ZeroCountFloat))))
+		i--
+		dst[i] = 0x39
+	} else {
+		i = encodeVarint(dst, i, m.ZeroCount)
+		i--
+		dst[i] = 0x30
+	}
+	if m.ZeroThreshold != 0 {
+		i -= 8
+		binary.LittleEndian.PutUint64(dst[i:], uint64(math.Float64bits(float64(m.ZeroThreshold))))
+		i--
+		dst[i] = 0x29
+	}
+	if m.Schema != 0 {
+		i = encodeVarint(dst, i, uint64(uint32(m.Schema<<1)^uint32(m.Schema>>31)))
+		i--
+		dst[i] = 0x20
+	}
+	if m.Sum != 0 {
+		i -= 8
+		binary.LittleEndian.PutUint64(dst[i:], uint64(math.Float64bits(float64(m.Sum))))
+		i--
+		dst[i] = 0x19
+	}
+	if m.IsFloat {
+		i -= 8
+		binary.LittleEndian.PutUint64(dst[i:], uint64(math.Float64bits(float64(m.CountFloat))))
+		i--
+		dst[i] = 0x11
+	} else {
+		i = encodeVarint(dst, i, m.Count)
+		i--
+		dst[i] = 0x8
+	}
+	return len(dst) - i, nil
+}
+
+func encodePackedDoubles(dst []byte, offset int, a []float64) int {
+	offset -= 8 * len(a)
+	for j, f := range a {
+		binary.LittleEndian.PutUint64(dst[offset+8*j:], math.Float64bits(f))
+	}
+	return encodeVarint(dst, offset, uint64(8*len(a)))
+}
+
+func encodePackedSint64s(dst []byte, offset int, a []int64) int {
+	end := offset
+	for j := len(a) - 1; j >= 0; j-- {
+		offset = encodeVarint(dst, offset, zigzagEncode64(a[j]))
+	}
+	return encodeVarint(dst, offset, uint64(end-offset))
+}
+
+func zigzagEncode64(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
 func (m *TimeSeries) MarshalToSizedBuffer(dst []byte) (int, error) {
 	i := len(dst)
+	for j := len(m.Histograms) - 1; j >= 0; j-- {
+		size, err := m.Histograms[j].MarshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0x22
+	}
+	for j := len(m.Exemplars) - 1; j >= 0; j-- {
+		size, err := m.Exemplars[j].MarshalToSizedBuffer(dst[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarint(dst, i, uint64(size))
+		i--
+		dst[i] = 0x1a
+	}
 	for j := len(m.Samples) - 1; j >= 0; j-- {
 		size, err := m.Samples[j].MarshalToSizedBuffer(dst[:i])
 		if err != nil {
@@ -99,6 +350,23 @@ func (m *Sample) Size() (n int) {
 	return n
 }
 
+func (m *Exemplar) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	for _, e := range m.Labels {
+		l := e.Size()
+		n += 1 + l + sov(uint64(l))
+	}
+	if m.Value != 0 {
+		n += 9
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sov(uint64(m.Timestamp))
+	}
+	return n
+}
+
 func (m *TimeSeries) Size() (n int) {
 	if m == nil {
 		return 0
@@ -111,6 +379,94 @@ func (m *TimeSeries) Size() (n int) {
 		l := e.Size()
 		n += 1 + l + sov(uint64(l))
 	}
+	for _, e := range m.Exemplars {
+		l := e.Size()
+		n += 1 + l + sov(uint64(l))
+	}
+	for _, e := range m.Histograms {
+		l := e.Size()
+		n += 1 + l + sov(uint64(l))
+	}
+	return n
+}
+
+func (m *Histogram) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	if m.IsFloat {
+		n += 9
+	} else {
+		n += 1 + sov(m.Count)
+	}
+	if m.Sum != 0 {
+		n += 9
+	}
+	if m.Schema != 0 {
+		n += 1 + sov(uint64(uint32(m.Schema<<1)^uint32(m.Schema>>31)))
+	}
+	if m.ZeroThreshold != 0 {
+		n += 9
+	}
+	if m.IsFloat {
+		n += 9
+	} else {
+		n += 1 + sov(m.ZeroCount)
+	}
+	for _, e := range m.NegativeSpans {
+		l := e.Size()
+		n += 1 + l + sov(uint64(l))
+	}
+	if len(m.NegativeDeltas) > 0 {
+		l := sizePackedSint64s(m.NegativeDeltas)
+		n += 1 + l + sov(uint64(l))
+	}
+	if len(m.NegativeCounts) > 0 {
+		l := 8 * len(m.NegativeCounts)
+		n += 1 + l + sov(uint64(l))
+	}
+	for _, e := range m.PositiveSpans {
+		l := e.Size()
+		n += 1 + l + sov(uint64(l))
+	}
+	if len(m.PositiveDeltas) > 0 {
+		l := sizePackedSint64s(m.PositiveDeltas)
+		n += 1 + l + sov(uint64(l))
+	}
+	if len(m.PositiveCounts) > 0 {
+		l := 8 * len(m.PositiveCounts)
+		n += 1 + l + sov(uint64(l))
+	}
+	if m.ResetHint != 0 {
+		n += 1 + sov(uint64(m.ResetHint))
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sov(uint64(m.Timestamp))
+	}
+	if len(m.CustomValues) > 0 {
+		l := 8 * len(m.CustomValues)
+		n += 2 + l + sov(uint64(l))
+	}
+	return n
+}
+
+func sizePackedSint64s(a []int64) (n int) {
+	for _, v := range a {
+		n += sov(zigzagEncode64(v))
+	}
+	return n
+}
+
+func (m *BucketSpan) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	if m.Offset != 0 {
+		n += 1 + sov(uint64(uint32(m.Offset<<1)^uint32(m.Offset>>31)))
+	}
+	if m.Length != 0 {
+		n += 1 + sov(uint64(m.Length))
+	}
 	return n
 }
 
@@ -0,0 +1,404 @@
+package prompbmarshal_test
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/easyproto"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+// unmarshalWriteRequest unmarshals WriteRequest from src for round-trip tests.
+//
+// Unlike lib/prompb, it unmarshals all the fields supported by prompbmarshal.
+// lib/prompb skips the fields unused at data ingestion in order to save CPU and memory.
+func unmarshalWriteRequest(src []byte) (*prompbmarshal.WriteRequest, error) {
+	// message WriteRequest {
+	//    repeated TimeSeries timeseries = 1;
+	//    repeated MetricMetadata metadata = 3;
+	// }
+	wr := &prompbmarshal.WriteRequest{}
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			data, ok := fc.MessageData()
+			if !ok {
+				return nil, fmt.Errorf("cannot read timeseries data")
+			}
+			ts, err := unmarshalTimeSeries(data)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unmarshal timeseries: %w", err)
+			}
+			wr.Timeseries = append(wr.Timeseries, ts)
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return nil, fmt.Errorf("cannot read metadata")
+			}
+			mm, err := unmarshalMetricMetadata(data)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unmarshal metadata: %w", err)
+			}
+			wr.Metadata = append(wr.Metadata, mm)
+		}
+	}
+	return wr, nil
+}
+
+func unmarshalTimeSeries(src []byte) (prompbmarshal.TimeSeries, error) {
+	// message TimeSeries {
+	//   repeated Label labels         = 1;
+	//   repeated Sample samples       = 2;
+	//   repeated Exemplar exemplars   = 3;
+	//   repeated Histogram histograms = 4;
+	// }
+	var ts prompbmarshal.TimeSeries
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return ts, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			ts.Labels, err = appendLabel(ts.Labels, &fc)
+			if err != nil {
+				return ts, err
+			}
+		case 2:
+			data, ok := fc.MessageData()
+			if !ok {
+				return ts, fmt.Errorf("cannot read the sample data")
+			}
+			s, err := unmarshalSample(data)
+			if err != nil {
+				return ts, fmt.Errorf("cannot unmarshal sample: %w", err)
+			}
+			ts.Samples = append(ts.Samples, s)
+		case 3:
+			data, ok := fc.MessageData()
+			if !ok {
+				return ts, fmt.Errorf("cannot read the exemplar data")
+			}
+			e, err := unmarshalExemplar(data)
+			if err != nil {
+				return ts, fmt.Errorf("cannot unmarshal exemplar: %w", err)
+			}
+			ts.Exemplars = append(ts.Exemplars, e)
+		case 4:
+			data, ok := fc.MessageData()
+			if !ok {
+				return ts, fmt.Errorf("cannot read the histogram data")
+			}
+			h, err := unmarshalHistogram(data)
+			if err != nil {
+				return ts, fmt.Errorf("cannot unmarshal histogram: %w", err)
+			}
+			ts.Histograms = append(ts.Histograms, h)
+		}
+	}
+	return ts, nil
+}
+
+func appendLabel(dst []prompbmarshal.Label, fcParent *easyproto.FieldContext) ([]prompbmarshal.Label, error) {
+	// message Label {
+	//   string name  = 1;
+	//   string value = 2;
+	// }
+	src, ok := fcParent.MessageData()
+	if !ok {
+		return dst, fmt.Errorf("cannot read label data")
+	}
+	var fc easyproto.FieldContext
+	var label prompbmarshal.Label
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			label.Name, ok = fc.String()
+			if !ok {
+				return dst, fmt.Errorf("cannot read label name")
+			}
+		case 2:
+			label.Value, ok = fc.String()
+			if !ok {
+				return dst, fmt.Errorf("cannot read label value")
+			}
+		}
+	}
+	return append(dst, label), nil
+}
+
+func unmarshalSample(src []byte) (prompbmarshal.Sample, error) {
+	// message Sample {
+	//   double value    = 1;
+	//   int64 timestamp = 2;
+	// }
+	var s prompbmarshal.Sample
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return s, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		var ok bool
+		switch fc.FieldNum {
+		case 1:
+			s.Value, ok = fc.Double()
+			if !ok {
+				return s, fmt.Errorf("cannot read sample value")
+			}
+		case 2:
+			s.Timestamp, ok = fc.Int64()
+			if !ok {
+				return s, fmt.Errorf("cannot read sample timestamp")
+			}
+		}
+	}
+	return s, nil
+}
+
+func unmarshalExemplar(src []byte) (prompbmarshal.Exemplar, error) {
+	// message Exemplar {
+	//   repeated Label labels = 1;
+	//   double value          = 2;
+	//   int64 timestamp       = 3;
+	// }
+	var e prompbmarshal.Exemplar
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return e, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		var ok bool
+		switch fc.FieldNum {
+		case 1:
+			e.Labels, err = appendLabel(e.Labels, &fc)
+			if err != nil {
+				return e, fmt.Errorf("cannot unmarshal exemplar label: %w", err)
+			}
+		case 2:
+			e.Value, ok = fc.Double()
+			if !ok {
+				return e, fmt.Errorf("cannot read exemplar value")
+			}
+		case 3:
+			e.Timestamp, ok = fc.Int64()
+			if !ok {
+				return e, fmt.Errorf("cannot read exemplar timestamp")
+			}
+		}
+	}
+	return e, nil
+}
+
+func unmarshalHistogram(src []byte) (prompbmarshal.Histogram, error) {
+	// message Histogram {
+	//   oneof count {
+	//     uint64 count_int   = 1;
+	//     double count_float = 2;
+	//   }
+	//   double sum = 3;
+	//   sint32 schema = 4;
+	//   double zero_threshold = 5;
+	//   oneof zero_count {
+	//     uint64 zero_count_int   = 6;
+	//     double zero_count_float = 7;
+	//   }
+	//   repeated BucketSpan negative_spans  = 8;
+	//   repeated sint64 negative_deltas     = 9;
+	//   repeated double negative_counts     = 10;
+	//   repeated BucketSpan positive_spans  = 11;
+	//   repeated sint64 positive_deltas     = 12;
+	//   repeated double positive_counts     = 13;
+	//   ResetHint reset_hint                = 14;
+	//   int64 timestamp                     = 15;
+	//   repeated double custom_values       = 16;
+	// }
+	var h prompbmarshal.Histogram
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return h, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		var ok bool
+		switch fc.FieldNum {
+		case 1:
+			h.Count, ok = fc.Uint64()
+			if !ok {
+				return h, fmt.Errorf("cannot read count")
+			}
+		case 2:
+			h.CountFloat, ok = fc.Double()
+			if !ok {
+				return h, fmt.Errorf("cannot read float count")
+			}
+			h.IsFloat = true
+		case 3:
+			h.Sum, ok = fc.Double()
+			if !ok {
+				return h, fmt.Errorf("cannot read sum")
+			}
+		case 4:
+			h.Schema, ok = fc.Sint32()
+			if !ok {
+				return h, fmt.Errorf("cannot read schema")
+			}
+		case 5:
+			h.ZeroThreshold, ok = fc.Double()
+			if !ok {
+				return h, fmt.Errorf("cannot read zero threshold")
+			}
+		case 6:
+			h.ZeroCount, ok = fc.Uint64()
+			if !ok {
+				return h, fmt.Errorf("cannot read zero count")
+			}
+		case 7:
+			h.ZeroCountFloat, ok = fc.Double()
+			if !ok {
+				return h, fmt.Errorf("cannot read float zero count")
+			}
+			h.IsFloat = true
+		case 8:
+			h.NegativeSpans, err = appendBucketSpan(h.NegativeSpans, &fc)
+			if err != nil {
+				return h, fmt.Errorf("cannot unmarshal negative span: %w", err)
+			}
+		case 9:
+			h.NegativeDeltas, ok = fc.UnpackSint64s(h.NegativeDeltas)
+			if !ok {
+				return h, fmt.Errorf("cannot read negative deltas")
+			}
+		case 10:
+			h.NegativeCounts, ok = fc.UnpackDoubles(h.NegativeCounts)
+			if !ok {
+				return h, fmt.Errorf("cannot read negative counts")
+			}
+		case 11:
+			h.PositiveSpans, err = appendBucketSpan(h.PositiveSpans, &fc)
+			if err != nil {
+				return h, fmt.Errorf("cannot unmarshal positive span: %w", err)
+			}
+		case 12:
+			h.PositiveDeltas, ok = fc.UnpackSint64s(h.PositiveDeltas)
+			if !ok {
+				return h, fmt.Errorf("cannot read positive deltas")
+			}
+		case 13:
+			h.PositiveCounts, ok = fc.UnpackDoubles(h.PositiveCounts)
+			if !ok {
+				return h, fmt.Errorf("cannot read positive counts")
+			}
+		case 14:
+			resetHint, ok := fc.Int32()
+			if !ok {
+				return h, fmt.Errorf("cannot read reset hint")
+			}
+			h.ResetHint = prompbmarshal.ResetHint(resetHint)
+		case 15:
+			h.Timestamp, ok = fc.Int64()
+			if !ok {
+				return h, fmt.Errorf("cannot read timestamp")
+			}
+		case 16:
+			h.CustomValues, ok = fc.UnpackDoubles(h.CustomValues)
+			if !ok {
+				return h, fmt.Errorf("cannot read custom values")
+			}
+		}
+	}
+	return h, nil
+}
+
+func appendBucketSpan(dst []prompbmarshal.BucketSpan, fcParent *easyproto.FieldContext) ([]prompbmarshal.BucketSpan, error) {
+	// message BucketSpan {
+	//   sint32 offset = 1;
+	//   uint32 length = 2;
+	// }
+	src, ok := fcParent.MessageData()
+	if !ok {
+		return dst, fmt.Errorf("cannot read span data")
+	}
+	var fc easyproto.FieldContext
+	var span prompbmarshal.BucketSpan
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		switch fc.FieldNum {
+		case 1:
+			span.Offset, ok = fc.Sint32()
+			if !ok {
+				return dst, fmt.Errorf("cannot read span offset")
+			}
+		case 2:
+			span.Length, ok = fc.Uint32()
+			if !ok {
+				return dst, fmt.Errorf("cannot read span length")
+			}
+		}
+	}
+	return append(dst, span), nil
+}
+
+func unmarshalMetricMetadata(src []byte) (prompbmarshal.MetricMetadata, error) {
+	// message MetricMetadata {
+	//   MetricType type           = 1;
+	//   string metric_family_name = 2;
+	//   string help               = 4;
+	//   string unit               = 5;
+	// }
+	var mm prompbmarshal.MetricMetadata
+	var fc easyproto.FieldContext
+	for len(src) > 0 {
+		var err error
+		src, err = fc.NextField(src)
+		if err != nil {
+			return mm, fmt.Errorf("cannot read the next field: %w", err)
+		}
+		var ok bool
+		switch fc.FieldNum {
+		case 1:
+			typ, ok := fc.Int32()
+			if !ok {
+				return mm, fmt.Errorf("cannot read metric type")
+			}
+			mm.Type = prompbmarshal.MetricType(typ)
+		case 2:
+			mm.MetricFamilyName, ok = fc.String()
+			if !ok {
+				return mm, fmt.Errorf("cannot read metric family name")
+			}
+		case 4:
+			mm.Help, ok = fc.String()
+			if !ok {
+				return mm, fmt.Errorf("cannot read metric help")
+			}
+		case 5:
+			mm.Unit, ok = fc.String()
+			if !ok {
+				return mm, fmt.Errorf("cannot read metric unit")
+			}
+		}
+	}
+	return mm, nil
+}
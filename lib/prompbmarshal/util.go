@@ -7,7 +7,10 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
 )
 
-// MarshalProtobuf marshals wr to dst and returns the result.
+// MarshalProtobuf appends marshaled wr to dst and returns the result.
+//
+// Pass the previously returned result with zero length as dst, e.g. MarshalProtobuf(dst[:0]), in order to avoid memory allocations
+// when marshaling many WriteRequest items. A new buffer is allocated on every call if dst is nil.
 func (wr *WriteRequest) MarshalProtobuf(dst []byte) []byte {
 	size := wr.Size()
 	dstLen := len(dst)
@@ -19,9 +22,110 @@ func (wr *WriteRequest) MarshalProtobuf(dst []byte) []byte {
 	return dst[:dstLen+n]
 }
 
+// MarshalProtobufTo appends marshaled wr to dst and returns the result.
+//
+// It is equivalent to MarshalProtobuf. Reuse the returned buffer as dst[:0] on subsequent calls in order to avoid memory allocations.
+func (wr *WriteRequest) MarshalProtobufTo(dst []byte) []byte {
+	return wr.MarshalProtobuf(dst)
+}
+
+// MarshaledSize returns the size of wr marshaled with MarshalProtobuf.
+//
+// It doesn't allocate memory, so it can be used for splitting time series into batches with the given size limit.
+func (wr *WriteRequest) MarshaledSize() int {
+	return wr.Size()
+}
+
 // Reset resets wr.
 func (wr *WriteRequest) Reset() {
 	wr.Timeseries = ResetTimeSeries(wr.Timeseries)
+	clear(wr.Metadata)
+	wr.Metadata = wr.Metadata[:0]
+}
+
+// ExemplarsCount returns the number of exemplars across all the time series in wr.
+func (wr *WriteRequest) ExemplarsCount() int {
+	n := 0
+	for i := range wr.Timeseries {
+		n += len(wr.Timeseries[i].Exemplars)
+	}
+	return n
+}
+
+// AddExemplar adds an exemplar with the given labels, value and timestamp to ts.
+//
+// labels may be empty. An error is returned if some of labels has an empty name.
+//
+// ts holds references to labels after the call, so labels mustn't be modified while ts is in use.
+func (ts *TimeSeries) AddExemplar(labels []Label, value float64, timestamp int64) error {
+	for _, label := range labels {
+		if label.Name == "" {
+			return fmt.Errorf("exemplar label name cannot be empty; got label with value %q", label.Value)
+		}
+	}
+	ts.Exemplars = append(ts.Exemplars, Exemplar{
+		Labels:    labels,
+		Value:     value,
+		Timestamp: timestamp,
+	})
+	return nil
+}
+
+// Validate verifies whether wr contains time series, which are accepted by Prometheus-compatible remote storage systems.
+//
+// It returns an error if some time series has a label with the name not matching ^[a-zA-Z_][a-zA-Z0-9_]*$ regex,
+// contains duplicate label names or has missing or empty __name__ label.
+//
+// It is recommended calling Validate before MarshalProtobuf if wr contains time series from untrusted sources.
+func (wr *WriteRequest) Validate() error {
+	for i := range wr.Timeseries {
+		if err := validateLabels(wr.Timeseries[i].Labels); err != nil {
+			return fmt.Errorf("invalid time series #%d %s: %w", i, LabelsToString(wr.Timeseries[i].Labels), err)
+		}
+	}
+	return nil
+}
+
+func validateLabels(labels []Label) error {
+	hasMetricName := false
+	for i, label := range labels {
+		if !isValidLabelName(label.Name) {
+			return fmt.Errorf("invalid label name %q; it must match ^[a-zA-Z_][a-zA-Z0-9_]*$ regex", label.Name)
+		}
+		for _, prevLabel := range labels[:i] {
+			if prevLabel.Name == label.Name {
+				return fmt.Errorf("duplicate label name %q", label.Name)
+			}
+		}
+		if label.Name == "__name__" {
+			if label.Value == "" {
+				return fmt.Errorf("__name__ label cannot be empty")
+			}
+			hasMetricName = true
+		}
+	}
+	if !hasMetricName {
+		return fmt.Errorf("missing __name__ label")
+	}
+	return nil
+}
+
+// isValidLabelName returns true if s matches ^[a-zA-Z_][a-zA-Z0-9_]*$ regex.
+func isValidLabelName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			continue
+		}
+		if i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
 }
 
 // ResetTimeSeries clears all the GC references from tss and returns an empty tss ready for further use.
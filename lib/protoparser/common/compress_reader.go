@@ -1,11 +1,20 @@
 package common
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"sync"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/snappy"
 	"github.com/klauspost/compress/zlib"
+	kzstd "github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 )
 
 // GetGzipReader returns new gzip reader from the pool.
@@ -31,6 +40,145 @@ func PutGzipReader(zr *gzip.Reader) {
 
 var gzipReaderPool sync.Pool
 
+// GzipWriter is a gzip writer obtained via GetGzipWriterLevel.
+type GzipWriter struct {
+	*gzip.Writer
+
+	level int
+}
+
+// GetGzipWriterLevel returns new gzip writer with the given compression level from the pool.
+//
+// The level must be in the range [gzip.StatelessCompression ... gzip.BestCompression].
+//
+// Return back the gzip writer when it no longer needed with PutGzipWriter.
+func GetGzipWriterLevel(w io.Writer, level int) (*GzipWriter, error) {
+	if level < gzip.StatelessCompression || level > gzip.BestCompression {
+		return nil, fmt.Errorf("unsupported gzip compression level: %d; it must be in the range [%d ... %d]", level, gzip.StatelessCompression, gzip.BestCompression)
+	}
+	pool := &gzipWriterPools[level-gzip.StatelessCompression]
+	v := pool.Get()
+	if v == nil {
+		zw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+		return &GzipWriter{
+			Writer: zw,
+			level:  level,
+		}, nil
+	}
+	zw := v.(*GzipWriter)
+	zw.Reset(w)
+	return zw, nil
+}
+
+// PutGzipWriter returns back gzip writer obtained via GetGzipWriterLevel.
+//
+// The pending data is flushed to the underlying writer before returning zw to the pool,
+// so the caller may skip zw.Close() call.
+func PutGzipWriter(zw *GzipWriter) {
+	_ = zw.Close()
+	zw.Reset(io.Discard)
+	gzipWriterPools[zw.level-gzip.StatelessCompression].Put(zw)
+}
+
+var gzipWriterPools [gzip.BestCompression - gzip.StatelessCompression + 1]sync.Pool
+
+// ZstdWriter is a zstd writer obtained via GetZstdWriter.
+type ZstdWriter struct {
+	zstd.Writer
+
+	level int
+}
+
+// GetZstdWriter returns new zstd writer with the given compression level from the pool.
+//
+// Return back the zstd writer when it no longer needed with PutZstdWriter.
+func GetZstdWriter(w io.Writer, level int) *ZstdWriter {
+	pool := getZstdWriterPool(level)
+	v := pool.Get()
+	if v == nil {
+		return &ZstdWriter{
+			Writer: zstd.NewWriterLevel(w, level),
+			level:  level,
+		}
+	}
+	zw := v.(*ZstdWriter)
+	zw.Reset(w)
+	return zw
+}
+
+// PutZstdWriter returns back zstd writer obtained via GetZstdWriter.
+//
+// The pending data is flushed to the underlying writer before returning zw to the pool,
+// so the caller may skip zw.Close() call.
+func PutZstdWriter(zw *ZstdWriter) {
+	_ = zw.Close()
+	zw.Reset(io.Discard)
+	getZstdWriterPool(zw.level).Put(zw)
+}
+
+func getZstdWriterPool(level int) *sync.Pool {
+	v, ok := zstdWriterPools.Load(level)
+	if !ok {
+		v, _ = zstdWriterPools.LoadOrStore(level, &sync.Pool{})
+	}
+	return v.(*sync.Pool)
+}
+
+// zstdWriterPools contains *sync.Pool per each compression level, since zstd supports wide range of compression levels.
+var zstdWriterPools sync.Map
+
+// GetBrotliReader returns new brotli reader from the pool.
+//
+// Return back the brotli reader when it no longer needed with PutBrotliReader.
+func GetBrotliReader(r io.Reader) (*BrotliReader, error) {
+	v := brotliReaderPool.Get()
+	if v == nil {
+		return &BrotliReader{
+			zr: brotli.NewReader(r),
+		}, nil
+	}
+	br := v.(*BrotliReader)
+	if err := br.zr.Reset(r); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+// PutBrotliReader returns back brotli reader obtained via GetBrotliReader.
+func PutBrotliReader(br *BrotliReader) {
+	if !br.isEOF {
+		// brotli.Reader.Reset doesn't drop the buffered input if the previous stream wasn't read till the end,
+		// so such a reader cannot be re-used without leaking the previous stream into the next one.
+		return
+	}
+	br.isEOF = false
+	brotliReaderPool.Put(br)
+}
+
+// BrotliReader reads brotli-compressed data.
+//
+// It must be obtained via GetBrotliReader.
+type BrotliReader struct {
+	zr *brotli.Reader
+
+	// isEOF is set when zr has been read till the end, so it has no buffered input and can be re-used.
+	isEOF bool
+}
+
+// Read implements io.Reader interface.
+func (br *BrotliReader) Read(p []byte) (int, error) {
+	n, err := br.zr.Read(p)
+	if err == io.EOF {
+		br.isEOF = true
+	}
+	return n, err
+}
+
+var brotliReaderPool sync.Pool
+
 // GetZlibReader returns zlib reader.
 func GetZlibReader(r io.Reader) (io.ReadCloser, error) {
 	v := zlibReaderPool.Get()
@@ -51,3 +199,242 @@ func PutZlibReader(zr io.ReadCloser) {
 }
 
 var zlibReaderPool sync.Pool
+
+// GetZstdReader returns new zstd reader from the pool.
+//
+// Return back the zstd reader when it no longer needed with PutZstdReader.
+func GetZstdReader(r io.Reader) (*kzstd.Decoder, error) {
+	v := zstdReaderPool.Get()
+	if v == nil {
+		// Disable concurrent decoding, so the reader doesn't start background goroutines.
+		return kzstd.NewReader(r, kzstd.WithDecoderConcurrency(1))
+	}
+	zr := v.(*kzstd.Decoder)
+	if err := zr.Reset(r); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// PutZstdReader returns back zstd reader obtained via GetZstdReader.
+func PutZstdReader(zr *kzstd.Decoder) {
+	// Do not call zr.Close(), since the reader cannot be used after that.
+	_ = zr.Reset(nil)
+	zstdReaderPool.Put(zr)
+}
+
+var zstdReaderPool sync.Pool
+
+// GetLZ4Reader returns new reader for LZ4 frame format from the pool.
+//
+// The frame header is read from r and verified before returning the reader,
+// so malformed input is detected early.
+//
+// Return back the LZ4 reader when it no longer needed with PutLZ4Reader.
+func GetLZ4Reader(r io.Reader) (*lz4.Reader, error) {
+	var zr *lz4.Reader
+	v := lz4ReaderPool.Get()
+	if v == nil {
+		zr = lz4.NewReader(r)
+	} else {
+		zr = v.(*lz4.Reader)
+		zr.Reset(r)
+	}
+
+	// Zero-length read parses the frame header without reading the frame data.
+	if _, err := zr.Read(nil); err != nil {
+		PutLZ4Reader(zr)
+		return nil, fmt.Errorf("cannot read LZ4 frame header: %w; make sure the data is compressed with LZ4 frame format", err)
+	}
+	return zr, nil
+}
+
+// PutLZ4Reader returns back LZ4 reader obtained via GetLZ4Reader.
+func PutLZ4Reader(zr *lz4.Reader) {
+	zr.Reset(nil)
+	lz4ReaderPool.Put(zr)
+}
+
+var lz4ReaderPool sync.Pool
+
+// AutoDecompressReader is a reader obtained via GetAutoDecompressReader.
+type AutoDecompressReader struct {
+	// r is the reader for the detected compression format.
+	r io.Reader
+
+	// br is used for reading the magic bytes at the beginning of the stream without consuming them.
+	br *bufio.Reader
+
+	gzr  *gzip.Reader
+	zlr  io.ReadCloser
+	zstr *kzstd.Decoder
+}
+
+// Read reads the decompressed data to p.
+func (ar *AutoDecompressReader) Read(p []byte) (int, error) {
+	return ar.r.Read(p)
+}
+
+// GetAutoDecompressReader returns a reader from the pool, which decompresses the data read from r.
+//
+// The compression format is detected by the magic bytes at the beginning of r. gzip, zlib and zstd formats are supported.
+// The data is read from r as is if it doesn't start with the magic bytes for the supported formats.
+//
+// Return back the reader when it no longer needed with PutAutoDecompressReader.
+func GetAutoDecompressReader(r io.Reader) (*AutoDecompressReader, error) {
+	v := autoDecompressReaderPool.Get()
+	if v == nil {
+		v = &AutoDecompressReader{
+			br: bufio.NewReader(r),
+		}
+	}
+	ar := v.(*AutoDecompressReader)
+	ar.br.Reset(r)
+
+	// Do not check the error returned from Peek, since it is returned again on the next read from ar.br.
+	prefix, _ := ar.br.Peek(len(zstdMagic))
+
+	var err error
+	switch {
+	case bytes.HasPrefix(prefix, gzipMagic):
+		ar.gzr, err = GetGzipReader(ar.br)
+		ar.r = ar.gzr
+	case bytes.HasPrefix(prefix, zstdMagic):
+		ar.zstr, err = GetZstdReader(ar.br)
+		ar.r = ar.zstr
+	case isZlibHeader(prefix):
+		ar.zlr, err = GetZlibReader(ar.br)
+		ar.r = ar.zlr
+	default:
+		ar.r = ar.br
+	}
+	if err != nil {
+		PutAutoDecompressReader(ar)
+		return nil, err
+	}
+	return ar, nil
+}
+
+// PutAutoDecompressReader returns back the reader obtained via GetAutoDecompressReader.
+func PutAutoDecompressReader(ar *AutoDecompressReader) {
+	if ar.gzr != nil {
+		PutGzipReader(ar.gzr)
+		ar.gzr = nil
+	}
+	if ar.zlr != nil {
+		PutZlibReader(ar.zlr)
+		ar.zlr = nil
+	}
+	if ar.zstr != nil {
+		PutZstdReader(ar.zstr)
+		ar.zstr = nil
+	}
+	ar.r = nil
+	ar.br.Reset(nil)
+	autoDecompressReaderPool.Put(ar)
+}
+
+var autoDecompressReaderPool sync.Pool
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// isZlibHeader returns true if prefix starts with zlib header for deflate compression with 32KiB window and without preset dictionary.
+//
+// See https://www.rfc-editor.org/rfc/rfc1950#section-2.2
+func isZlibHeader(prefix []byte) bool {
+	if len(prefix) < 2 || prefix[0] != 0x78 {
+		return false
+	}
+	if prefix[1]&0x20 != 0 {
+		// Preset dictionary isn't supported.
+		return false
+	}
+	return (uint16(prefix[0])<<8|uint16(prefix[1]))%31 == 0
+}
+
+// GetSnappyReader returns new reader for Snappy framing format from the pool.
+//
+// The stream identifier is read from r and verified before returning the reader,
+// so non-snappy input is detected early.
+//
+// Return back the snappy reader when it no longer needed with PutSnappyReader.
+func GetSnappyReader(r io.Reader) (*snappy.Reader, error) {
+	var hdr [len(snappyStreamIdentifier)]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("cannot read snappy stream identifier: %w", err)
+	}
+	if string(hdr[:]) != snappyStreamIdentifier {
+		return nil, fmt.Errorf("unexpected snappy stream identifier %q; want %q; make sure the data is compressed with Snappy framing format", hdr[:], snappyStreamIdentifier)
+	}
+
+	v := snappyReaderPool.Get()
+	if v == nil {
+		// The stream identifier is already verified above, so instruct the reader to skip it.
+		return s2.NewReader(r, s2.ReaderMaxBlockSize(snappyMaxBlockSize), s2.ReaderIgnoreStreamIdentifier()), nil
+	}
+	zr := v.(*snappy.Reader)
+	zr.Reset(r)
+	return zr, nil
+}
+
+// PutSnappyReader returns back snappy reader obtained via GetSnappyReader.
+func PutSnappyReader(zr *snappy.Reader) {
+	zr.Reset(nil)
+	snappyReaderPool.Put(zr)
+}
+
+var snappyReaderPool sync.Pool
+
+// snappyStreamIdentifier is the stream identifier chunk, which must start every Snappy framing format stream.
+//
+// See https://github.com/google/snappy/blob/main/framing_format.txt
+const snappyStreamIdentifier = "\xff\x06\x00\x00sNaPpY"
+
+// snappyMaxBlockSize is the maximum size of uncompressed data in a single Snappy chunk.
+const snappyMaxBlockSize = 64 * 1024
+
+// LimitedDecompressReader is a reader, which returns an error if the underlying reader returns more than the given number of bytes.
+//
+// It is used for protecting from decompression bombs - small compressed payloads, which expand to huge amounts of data.
+type LimitedDecompressReader struct {
+	r        io.Reader
+	maxBytes int64
+
+	bytesRead int64
+	err       error
+}
+
+// NewLimitedDecompressReader returns a reader, which reads up to maxBytes from r.
+//
+// r is usually a decompressing reader such as the reader returned from GetGzipReader, GetZlibReader, GetZstdReader or GetAutoDecompressReader.
+// The returned reader returns an error if r returns more than maxBytes bytes.
+func NewLimitedDecompressReader(r io.Reader, maxBytes int64) *LimitedDecompressReader {
+	return &LimitedDecompressReader{
+		r:        r,
+		maxBytes: maxBytes,
+	}
+}
+
+// Read reads up to len(p) bytes into p.
+func (lr *LimitedDecompressReader) Read(p []byte) (int, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+
+	// Read one byte more than the remaining limit in order to detect whether the limit is exceeded.
+	if remaining := lr.maxBytes - lr.bytesRead + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := lr.r.Read(p)
+	lr.bytesRead += int64(n)
+	if lr.bytesRead > lr.maxBytes {
+		n -= int(lr.bytesRead - lr.maxBytes)
+		lr.bytesRead = lr.maxBytes
+		lr.err = fmt.Errorf("the decompressed data exceeds %d bytes", lr.maxBytes)
+		return n, lr.err
+	}
+	return n, err
+}
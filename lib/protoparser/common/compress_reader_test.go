@@ -0,0 +1,484 @@
+package common
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zlib"
+	"github.com/pierrec/lz4/v4"
+)
+
+func TestGetGzipWriterLevel_Success(t *testing.T) {
+	f := func(level int, s string) {
+		t.Helper()
+
+		for i := 0; i < 3; i++ {
+			var bb bytes.Buffer
+			zw, err := GetGzipWriterLevel(&bb, level)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, err := zw.Write([]byte(s)); err != nil {
+				t.Fatalf("cannot write data: %s", err)
+			}
+			// PutGzipWriter must flush the pending data, so zw.Close() isn't called here.
+			PutGzipWriter(zw)
+
+			zr, err := GetGzipReader(&bb)
+			if err != nil {
+				t.Fatalf("cannot create gzip reader: %s", err)
+			}
+			result, err := io.ReadAll(zr)
+			PutGzipReader(zr)
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(result) != s {
+				t.Fatalf("unexpected data read; got %q; want %q", result, s)
+			}
+		}
+	}
+
+	for _, level := range []int{gzip.StatelessCompression, gzip.HuffmanOnly, gzip.DefaultCompression, gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression} {
+		f(level, "")
+		f(level, "foo")
+		f(level, string(bytes.Repeat([]byte("foobar baz "), 100_000)))
+	}
+}
+
+func TestGetGzipWriterLevel_Failure(t *testing.T) {
+	f := func(level int) {
+		t.Helper()
+
+		zw, err := GetGzipWriterLevel(io.Discard, level)
+		if err == nil {
+			PutGzipWriter(zw)
+			t.Fatalf("expecting non-nil error for level=%d", level)
+		}
+	}
+
+	f(gzip.StatelessCompression - 1)
+	f(gzip.BestCompression + 1)
+	f(100)
+}
+
+func TestGetZstdWriter(t *testing.T) {
+	f := func(level int, s string) {
+		t.Helper()
+
+		for i := 0; i < 3; i++ {
+			var bb bytes.Buffer
+			zw := GetZstdWriter(&bb, level)
+			if _, err := zw.Write([]byte(s)); err != nil {
+				t.Fatalf("cannot write data: %s", err)
+			}
+			// PutZstdWriter must flush the pending data, so zw.Close() isn't called here.
+			PutZstdWriter(zw)
+
+			result, err := zstd.Decompress(nil, bb.Bytes())
+			if err != nil {
+				t.Fatalf("cannot decompress data: %s", err)
+			}
+			if string(result) != s {
+				t.Fatalf("unexpected data read; got %q; want %q", result, s)
+			}
+		}
+	}
+
+	for _, level := range []int{-5, 1, 3, 10, 19} {
+		f(level, "")
+		f(level, "foo")
+		f(level, string(bytes.Repeat([]byte("foobar baz "), 100_000)))
+	}
+}
+
+func TestGetBrotliReader_Success(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		zw := brotli.NewWriter(&bb)
+		if _, err := zw.Write([]byte(s)); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		data := bb.Bytes()
+
+		// Verify that the reader is properly reset after partially read stream.
+		zr, err := GetBrotliReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var buf [1]byte
+		_, _ = zr.Read(buf[:])
+		PutBrotliReader(zr)
+
+		for i := 0; i < 3; i++ {
+			zr, err := GetBrotliReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			result, err := io.ReadAll(zr)
+			PutBrotliReader(zr)
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(result) != s {
+				t.Fatalf("unexpected data read; got %q; want %q", result, s)
+			}
+		}
+	}
+
+	f("")
+	f("foo")
+	f(string(bytes.Repeat([]byte("foobar baz "), 100_000)))
+}
+
+func TestGetBrotliReader_Failure(t *testing.T) {
+	zr, err := GetBrotliReader(bytes.NewBufferString("plain text data, which isn't compressed"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer PutBrotliReader(zr)
+	if _, err := io.ReadAll(zr); err == nil {
+		t.Fatalf("expecting non-nil error when reading non-brotli data")
+	}
+}
+
+func TestGetSnappyReader_Success(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		zw := snappy.NewBufferedWriter(&bb)
+		if _, err := zw.Write([]byte(s)); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		data := bb.Bytes()
+
+		// Verify that pooled readers are properly reset between calls.
+		for i := 0; i < 3; i++ {
+			zr, err := GetSnappyReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			result, err := io.ReadAll(zr)
+			PutSnappyReader(zr)
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(result) != s {
+				t.Fatalf("unexpected data read; got %q; want %q", result, s)
+			}
+		}
+	}
+
+	f("foo")
+	f(string(bytes.Repeat([]byte("foobar baz "), 100_000)))
+}
+
+func TestGetSnappyReader_Failure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+
+		zr, err := GetSnappyReader(bytes.NewBufferString(data))
+		if err == nil {
+			PutSnappyReader(zr)
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	f("")
+	f("foo")
+	f("plain text data, which isn't compressed")
+	f(string(snappy.Encode(nil, []byte("snappy block format without framing"))))
+}
+
+func TestGetZstdReader(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		data := zstd.CompressLevel(nil, []byte(s), zstd.LevelDefault)
+
+		// Verify that the reader is properly reset after partially read stream.
+		zr, err := GetZstdReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var buf [1]byte
+		_, _ = zr.Read(buf[:])
+		PutZstdReader(zr)
+
+		for i := 0; i < 3; i++ {
+			zr, err := GetZstdReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			result, err := io.ReadAll(zr)
+			PutZstdReader(zr)
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(result) != s {
+				t.Fatalf("unexpected data read; got %q; want %q", result, s)
+			}
+		}
+	}
+
+	f("")
+	f("foo")
+	f(string(bytes.Repeat([]byte("foobar baz "), 100_000)))
+}
+
+func TestGetAutoDecompressReader_Success(t *testing.T) {
+	f := func(data []byte, resultExpected string) {
+		t.Helper()
+
+		for i := 0; i < 3; i++ {
+			ar, err := GetAutoDecompressReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			result, err := io.ReadAll(ar)
+			PutAutoDecompressReader(ar)
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(result) != resultExpected {
+				t.Fatalf("unexpected data read; got %q; want %q", result, resultExpected)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "foo", string(bytes.Repeat([]byte("foobar baz "), 100_000))} {
+		// uncompressed
+		f([]byte(s), s)
+
+		// gzip
+		var bb bytes.Buffer
+		zw, err := GetGzipWriterLevel(&bb, gzip.DefaultCompression)
+		if err != nil {
+			t.Fatalf("cannot create gzip writer: %s", err)
+		}
+		if _, err := zw.Write([]byte(s)); err != nil {
+			t.Fatalf("cannot write gzip data: %s", err)
+		}
+		PutGzipWriter(zw)
+		f(bb.Bytes(), s)
+
+		// zlib
+		for _, level := range []int{zlib.NoCompression, zlib.BestSpeed, zlib.DefaultCompression, zlib.BestCompression} {
+			var bb bytes.Buffer
+			zlw, err := zlib.NewWriterLevel(&bb, level)
+			if err != nil {
+				t.Fatalf("cannot create zlib writer: %s", err)
+			}
+			if _, err := zlw.Write([]byte(s)); err != nil {
+				t.Fatalf("cannot write zlib data: %s", err)
+			}
+			if err := zlw.Close(); err != nil {
+				t.Fatalf("cannot close zlib writer: %s", err)
+			}
+			f(bb.Bytes(), s)
+		}
+
+		// zstd
+		f(zstd.CompressLevel(nil, []byte(s), zstd.LevelDefault), s)
+	}
+
+	// uncompressed data shorter than the magic bytes
+	f([]byte{0x1f}, "\x1f")
+	f([]byte{0x28, 0xb5}, "\x28\xb5")
+	f([]byte("x"), "x")
+
+	// uncompressed data, which starts with 'x'
+	f([]byte("xyz"), "xyz")
+}
+
+func TestGetAutoDecompressReader_Failure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		ar, err := GetAutoDecompressReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		_, err = io.ReadAll(ar)
+		PutAutoDecompressReader(ar)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// invalid gzip
+	f([]byte("\x1f\x8bfoobar"))
+
+	// invalid zlib
+	f([]byte("\x78\x9cfoobar"))
+
+	// invalid zstd
+	f([]byte("\x28\xb5\x2f\xfdfoobar"))
+}
+
+func TestGetLZ4Reader_Success(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+
+		var bb bytes.Buffer
+		zw := lz4.NewWriter(&bb)
+		if _, err := zw.Write([]byte(s)); err != nil {
+			t.Fatalf("cannot write data: %s", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("cannot close writer: %s", err)
+		}
+		data := bb.Bytes()
+
+		// Verify that the reader is properly reset after partially read stream.
+		zr, err := GetLZ4Reader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var buf [1]byte
+		_, _ = zr.Read(buf[:])
+		PutLZ4Reader(zr)
+
+		for i := 0; i < 3; i++ {
+			zr, err := GetLZ4Reader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			result, err := io.ReadAll(zr)
+			PutLZ4Reader(zr)
+			if err != nil {
+				t.Fatalf("cannot read data: %s", err)
+			}
+			if string(result) != s {
+				t.Fatalf("unexpected data read; got %q; want %q", result, s)
+			}
+		}
+	}
+
+	f("")
+	f("foo")
+	f(string(bytes.Repeat([]byte("foobar baz "), 100_000)))
+}
+
+func TestGetLZ4Reader_Failure(t *testing.T) {
+	f := func(data []byte) {
+		t.Helper()
+
+		zr, err := GetLZ4Reader(bytes.NewReader(data))
+		if err == nil {
+			PutLZ4Reader(zr)
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// empty data
+	f(nil)
+
+	// missing magic number
+	f([]byte("foobar"))
+
+	// truncated frame header
+	f([]byte("\x04\x22\x4d\x18"))
+
+	// invalid frame header checksum
+	f([]byte("\x04\x22\x4d\x18\x64\x40\x00"))
+}
+
+func TestLimitedDecompressReader(t *testing.T) {
+	// Create high-ratio payloads, which expand to 4MiB.
+	// The fastest compression levels are used, since they provide the best compression ratio for zero bytes with deflate.
+	const decompressedSize = 4 * 1024 * 1024
+	data := make([]byte, decompressedSize)
+
+	var gzipData bytes.Buffer
+	zw, err := GetGzipWriterLevel(&gzipData, gzip.BestSpeed)
+	if err != nil {
+		t.Fatalf("cannot create gzip writer: %s", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("cannot write gzip data: %s", err)
+	}
+	PutGzipWriter(zw)
+
+	var zlibData bytes.Buffer
+	zlw, err := zlib.NewWriterLevel(&zlibData, zlib.BestSpeed)
+	if err != nil {
+		t.Fatalf("cannot create zlib writer: %s", err)
+	}
+	if _, err := zlw.Write(data); err != nil {
+		t.Fatalf("cannot write zlib data: %s", err)
+	}
+	if err := zlw.Close(); err != nil {
+		t.Fatalf("cannot close zlib writer: %s", err)
+	}
+
+	zstdData := zstd.CompressLevel(nil, data, zstd.LevelDefault)
+
+	payloads := map[string][]byte{
+		"gzip": gzipData.Bytes(),
+		"zlib": zlibData.Bytes(),
+		"zstd": zstdData,
+	}
+
+	f := func(maxBytes int64, isErrorExpected bool) {
+		t.Helper()
+
+		for name, payload := range payloads {
+			if len(payload) > decompressedSize/500 {
+				t.Fatalf("too big %s payload size: %d bytes", name, len(payload))
+			}
+			ar, err := GetAutoDecompressReader(bytes.NewReader(payload))
+			if err != nil {
+				t.Fatalf("cannot create %s reader: %s", name, err)
+			}
+			lr := NewLimitedDecompressReader(ar, maxBytes)
+			n, err := io.Copy(io.Discard, lr)
+			PutAutoDecompressReader(ar)
+			if isErrorExpected {
+				if err == nil {
+					t.Fatalf("expecting non-nil error for %s payload with maxBytes=%d", name, maxBytes)
+				}
+				if n != maxBytes {
+					t.Fatalf("unexpected number of bytes read from %s payload; got %d; want %d", name, n, maxBytes)
+				}
+				// The error must be returned on subsequent reads
+				var buf [1]byte
+				if _, err := lr.Read(buf[:]); err == nil {
+					t.Fatalf("expecting non-nil error on subsequent read for %s payload", name)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error for %s payload with maxBytes=%d: %s", name, maxBytes, err)
+				}
+				if n != decompressedSize {
+					t.Fatalf("unexpected number of bytes read from %s payload; got %d; want %d", name, n, decompressedSize)
+				}
+			}
+		}
+	}
+
+	// the limit is exceeded
+	f(0, true)
+	f(1, true)
+	f(1024*1024, true)
+	f(decompressedSize-1, true)
+
+	// the limit isn't exceeded
+	f(decompressedSize, false)
+	f(decompressedSize+1, false)
+	f(100*decompressedSize, false)
+}
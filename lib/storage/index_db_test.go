@@ -942,6 +942,38 @@ func testIndexDBCheckTSIDByName(db *indexDB, mns []MetricName, tsids []TSID, isC
 			return fmt.Errorf("unexpected tsid found for regexp negative filter\ntsid=%+v\ntsidsFound=%+v\ntfs=%s\nmn=%s", tsid, tsidsFound, tfs, mn)
 		}
 
+		// Search with set filters.
+		tfs.Reset()
+		if err := tfs.AddSet(nil, []string{"foobar", string(mn.MetricGroup), "foobaz"}, false); err != nil {
+			return fmt.Errorf("cannot create set tag filter for MetricGroup: %w", err)
+		}
+		for j := 0; j < len(mn.Tags); j++ {
+			t := &mn.Tags[j]
+			if err := tfs.AddSet(t.Key, []string{"aaa", string(t.Value), "a.+"}, false); err != nil {
+				return fmt.Errorf("cannot create set tag filter for tag: %w", err)
+			}
+		}
+		if err := tfs.AddSet(nil, []string{"foobar", "foobaz"}, true); err != nil {
+			return fmt.Errorf("cannot add negative set filter: %w", err)
+		}
+		tsidsFound, err = searchTSIDsInTest(db, []*TagFilters{tfs}, tr)
+		if err != nil {
+			return fmt.Errorf("cannot search by set tag filter: %w", err)
+		}
+		if !testHasTSID(tsidsFound, tsid) {
+			return fmt.Errorf("tsids is missing in set tsidsFound\ntsid=%+v\ntsidsFound=%+v\ntfs=%s\nmn=%s", tsid, tsidsFound, tfs, mn)
+		}
+		if err := tfs.AddSet(nil, []string{"foobar", string(mn.MetricGroup)}, true); err != nil {
+			return fmt.Errorf("cannot add negative set filter for zeroing search results: %w", err)
+		}
+		tsidsFound, err = searchTSIDsInTest(db, []*TagFilters{tfs}, tr)
+		if err != nil {
+			return fmt.Errorf("cannot search by set tag filter with full negative: %w", err)
+		}
+		if testHasTSID(tsidsFound, tsid) {
+			return fmt.Errorf("unexpected tsid found for negative set filter\ntsid=%+v\ntsidsFound=%+v\ntfs=%s\nmn=%s", tsid, tsidsFound, tfs, mn)
+		}
+
 		// Search with filter matching zero results.
 		tfs.Reset()
 		if err := tfs.Add([]byte("non-existing-key"), []byte("foobar"), false, false); err != nil {
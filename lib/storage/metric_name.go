@@ -10,6 +10,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/slicesutil"
 )
@@ -69,6 +70,15 @@ func marshalTagValueNoTrailingTagSeparator(dst []byte, src string) []byte {
 	return dst[:len(dst)-1]
 }
 
+func unmarshalTagValueNoTrailingTagSeparator(dst []byte, src string) []byte {
+	b := append([]byte(src), tagSeparatorChar)
+	_, dst, err := unmarshalTagValue(dst, b)
+	if err != nil {
+		logger.Panicf("BUG: cannot unmarshal tag value %q: %s", src, err)
+	}
+	return dst
+}
+
 func marshalTagValue(dst, src []byte) []byte {
 	n1 := bytes.IndexByte(src, escapeChar)
 	n2 := bytes.IndexByte(src, tagSeparatorChar)
@@ -224,6 +234,16 @@ func (mn *MetricName) AddTagBytes(key, value []byte) {
 	tag.Value = append(tag.Value[:0], value...)
 }
 
+// SetTagsFromMap resets mn and sets its MetricGroup and tags from the given tags map.
+//
+// The MetricGroup is set from the `__name__` key. Tags are sorted on marshaling, so the map iteration order doesn't matter.
+func (mn *MetricName) SetTagsFromMap(tags map[string]string) {
+	mn.Reset()
+	for key, value := range tags {
+		mn.AddTag(key, value)
+	}
+}
+
 func (mn *MetricName) addNextTag() *Tag {
 	if len(mn.Tags) < cap(mn.Tags) {
 		mn.Tags = mn.Tags[:len(mn.Tags)+1]
@@ -498,13 +518,14 @@ func MarshalMetricNameRaw(dst []byte, labels []prompbmarshal.Label) []byte {
 	return dst
 }
 
-// marshalRaw marshals mn to dst and returns the result.
+// MarshalRaw marshals mn to dst and returns the result.
 //
+// Tags are sorted before marshaling, so they may be added to mn in arbitrary order.
 // The results may be unmarshaled with MetricName.UnmarshalRaw.
 //
-// This function is for testing purposes. MarshalMetricNameRaw must be used
-// in prod instead.
-func (mn *MetricName) marshalRaw(dst []byte) []byte {
+// This function is for testing purposes and for building test helpers.
+// MarshalMetricNameRaw must be used in prod instead.
+func (mn *MetricName) MarshalRaw(dst []byte) []byte {
 	dst = marshalBytesFast(dst, nil)
 	dst = marshalBytesFast(dst, mn.MetricGroup)
 
@@ -138,7 +138,7 @@ func TestMetricNameMarshalUnmarshalRaw(t *testing.T) {
 				value := fmt.Sprintf("\x02\x00\x01value_%d_%d", i, j)
 				mn.AddTag(key, value)
 			}
-			data := mn.marshalRaw(nil)
+			data := mn.MarshalRaw(nil)
 			var mn1 MetricName
 			if err := mn1.UnmarshalRaw(data); err != nil {
 				t.Fatalf("cannot unmarshal mn %s: %s", &mn, err)
@@ -170,6 +170,69 @@ func TestMetricNameMarshalUnmarshalRaw(t *testing.T) {
 	}
 }
 
+func TestMetricNameSetTagsFromMap(t *testing.T) {
+	f := func(tags map[string]string, mnExpected *MetricName) {
+		t.Helper()
+
+		var mn MetricName
+		mn.AddTag("foo", "bar")
+		mn.SetTagsFromMap(tags)
+
+		data := mn.MarshalRaw(nil)
+		dataExpected := mnExpected.MarshalRaw(nil)
+		if string(data) != string(dataExpected) {
+			t.Fatalf("unexpected MarshalRaw result;\ngot\n%X\nwant\n%X", data, dataExpected)
+		}
+
+		var mn1 MetricName
+		if err := mn1.UnmarshalRaw(data); err != nil {
+			t.Fatalf("cannot unmarshal mn %s: %s", &mn, err)
+		}
+		if mn1.String() != mnExpected.String() {
+			t.Fatalf("unexpected mn unmarshaled;\ngot\n%s\nwant\n%s", &mn1, mnExpected)
+		}
+	}
+
+	// empty tags
+	f(nil, &MetricName{})
+
+	// only metric name
+	f(map[string]string{
+		"__name__": "up",
+	}, &MetricName{
+		MetricGroup: []byte("up"),
+	})
+
+	// multiple tags in the order, which differs from the canonical order
+	f(map[string]string{
+		"__name__": "http_requests_total",
+		"zone":     "us-east",
+		"instance": "host:8080",
+		"job":      "api",
+		"code":     "200",
+	}, &MetricName{
+		MetricGroup: []byte("http_requests_total"),
+		Tags: []Tag{
+			{
+				Key:   []byte("code"),
+				Value: []byte("200"),
+			},
+			{
+				Key:   []byte("job"),
+				Value: []byte("api"),
+			},
+			{
+				Key:   []byte("instance"),
+				Value: []byte("host:8080"),
+			},
+			{
+				Key:   []byte("zone"),
+				Value: []byte("us-east"),
+			},
+		},
+	})
+}
+
 func TestMetricNameCopyFrom(t *testing.T) {
 	var from MetricName
 	from.MetricGroup = []byte("group")
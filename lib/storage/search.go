@@ -1,9 +1,11 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
@@ -21,21 +23,33 @@ import (
 type BlockRef struct {
 	p  *part
 	bh blockHeader
+
+	// clampTR is the time range for clamping the block samples at MustReadBlock if needClamp is set.
+	//
+	// It is set by Search.NextMetricBlock for blocks partially overlapping the search time range if Search.SetClampTimeRange is enabled.
+	clampTR   TimeRange
+	needClamp bool
 }
 
 func (br *BlockRef) reset() {
 	br.p = nil
 	br.bh = blockHeader{}
+	br.clampTR = TimeRange{}
+	br.needClamp = false
 }
 
 func (br *BlockRef) init(p *part, bh *blockHeader) {
 	br.p = p
 	br.bh = *bh
+	br.clampTR = TimeRange{}
+	br.needClamp = false
 }
 
 // Init initializes br from pr and data
 func (br *BlockRef) Init(pr PartRef, data []byte) error {
 	br.p = pr.p
+	br.clampTR = TimeRange{}
+	br.needClamp = false
 	tail, err := br.bh.Unmarshal(data)
 	if err != nil {
 		return err
@@ -69,7 +83,23 @@ type PartRef struct {
 }
 
 // MustReadBlock reads block from br to dst.
+//
+// If br is obtained from Search with enabled SetClampTimeRange, then dst contains only samples on the search time range.
+// Such blocks are returned in unmarshaled form.
 func (br *BlockRef) MustReadBlock(dst *Block) {
+	br.readBlock(dst)
+	if !br.needClamp {
+		return
+	}
+	if err := dst.UnmarshalData(); err != nil {
+		logger.Panicf("FATAL: cannot unmarshal block data from part %q: %s", br.p.path, err)
+	}
+	if !clampBlockToTimeRange(dst, br.clampTR) {
+		logger.Panicf("BUG: the block must contain samples on the time range %s, since it has been checked at Search.NextMetricBlock", &br.clampTR)
+	}
+}
+
+func (br *BlockRef) readBlock(dst *Block) {
 	dst.Reset()
 	dst.bh = br.bh
 
@@ -111,6 +141,26 @@ type Search struct {
 	// deadline in unix timestamp seconds for the current search.
 	deadline uint64
 
+	// ctx is used for canceling the current search.
+	ctx context.Context
+
+	// ctxDone is ctx.Done(). It is cached in order to avoid calling ctx.Done() on every NextMetricBlock() iteration.
+	ctxDone <-chan struct{}
+
+	// clampTimeRange is set if SetClampTimeRange is enabled.
+	clampTimeRange bool
+
+	// clampCheckBlock is used for checking whether the blocks partially overlapping tr contain samples on tr if clampTimeRange is set.
+	clampCheckBlock Block
+
+	// maxSeries is the maximum number of time series to return from the search.
+	//
+	// Zero means no limit.
+	maxSeries int
+
+	// seriesCount is the number of time series returned from the search so far.
+	seriesCount int
+
 	err error
 
 	needClosing bool
@@ -118,6 +168,37 @@ type Search struct {
 	loops int
 
 	prevMetricID uint64
+
+	// samplesBlock, samplesMetricName, samplesTimestamps and samplesValues are used by NextSamples.
+	samplesBlock      Block
+	samplesMetricName MetricName
+	samplesTimestamps []int64
+	samplesValues     []float64
+
+	// samplesMetricID is the MetricID for samplesMetricName.
+	//
+	// It is used for avoiding unmarshaling of the same metric name for subsequent blocks of the same time series.
+	samplesMetricID uint64
+
+	// stats contains read statistics for the search.
+	//
+	// It isn't cleared by reset(), so it remains available after MustClose.
+	stats SearchStats
+}
+
+// SearchStats contains read statistics for Search.
+type SearchStats struct {
+	// BlocksRead is the number of blocks returned by Search.NextMetricBlock.
+	BlocksRead uint64
+
+	// RowsRead is the number of rows in the blocks returned by Search.NextMetricBlock.
+	RowsRead uint64
+
+	// CompressedBytesRead is the number of compressed bytes in the blocks returned by Search.NextMetricBlock.
+	//
+	// It is calculated from block headers, so it doesn't depend on whether the blocks are actually read via BlockRef.MustReadBlock.
+	// The size of the decompressed data may be much bigger.
+	CompressedBytesRead uint64
 }
 
 func (s *Search) reset() {
@@ -130,10 +211,22 @@ func (s *Search) reset() {
 	s.tr = TimeRange{}
 	s.tfss = nil
 	s.deadline = 0
+	s.ctx = nil
+	s.ctxDone = nil
+	s.clampTimeRange = false
+	s.clampCheckBlock.Reset()
+	s.maxSeries = 0
+	s.seriesCount = 0
 	s.err = nil
 	s.needClosing = false
 	s.loops = 0
 	s.prevMetricID = 0
+
+	s.samplesBlock.Reset()
+	s.samplesMetricName.Reset()
+	s.samplesTimestamps = s.samplesTimestamps[:0]
+	s.samplesValues = s.samplesValues[:0]
+	s.samplesMetricID = 0
 }
 
 // Init initializes s from the given storage, tfss and tr.
@@ -142,6 +235,14 @@ func (s *Search) reset() {
 //
 // Init returns the upper bound on the number of found time series.
 func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
+	return s.InitWithContext(context.Background(), qt, storage, tfss, tr, maxMetrics, deadline)
+}
+
+// InitWithContext is like Init, but allows canceling the search via ctx.
+//
+// NextMetricBlock returns false after ctx is canceled, while Error returns the ctx error.
+// MustClose must be called when the search is done, even if ctx is canceled.
+func (s *Search) InitWithContext(ctx context.Context, qt *querytracer.Tracer, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
 	qt = qt.NewChild("init series search: filters=%s, timeRange=%s", tfss, &tr)
 	defer qt.Done()
 
@@ -154,15 +255,21 @@ func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilte
 	retentionDeadline := int64(fasttime.UnixTimestamp()*1e3) - storage.retentionMsecs
 
 	s.reset()
+	s.stats = SearchStats{}
 	s.idb = storage.idb()
 	s.retentionDeadline = retentionDeadline
 	s.tr = tr
 	s.tfss = tfss
 	s.deadline = deadline
+	s.ctx = ctx
+	s.ctxDone = ctx.Done()
 	s.needClosing = true
 
 	var tsids []TSID
 	metricIDs, err := s.idb.searchMetricIDs(qt, tfss, indexTR, maxMetrics, deadline)
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err == nil {
 		tsids, err = s.idb.getTSIDsFromMetricIDs(qt, metricIDs, deadline)
 		if err == nil {
@@ -181,6 +288,30 @@ func (s *Search) Init(qt *querytracer.Tracer, storage *Storage, tfss []*TagFilte
 	return len(tsids)
 }
 
+// SetMaxSeries limits the number of time series returned from s to maxSeries.
+//
+// Zero maxSeries means no limit. SetMaxSeries must be called after Init.
+func (s *Search) SetMaxSeries(maxSeries int) {
+	s.maxSeries = maxSeries
+}
+
+// SetClampTimeRange enables clamping of the blocks read via BlockRef.MustReadBlock to the time range passed to Init.
+//
+// This allows avoiding filtering of the samples outside the time range at the caller side.
+// Blocks partially overlapping the time range are decoded and clamped at BlockRef.MustReadBlock in this case,
+// while blocks without samples on the time range are skipped at NextMetricBlock.
+// SetClampTimeRange must be called after Init.
+func (s *Search) SetClampTimeRange(clamp bool) {
+	s.clampTimeRange = clamp
+}
+
+// Stats returns read statistics for s.
+//
+// The statistics remains available after MustClose until the next Init call.
+func (s *Search) Stats() SearchStats {
+	return s.stats
+}
+
 // MustClose closes the Search.
 func (s *Search) MustClose() {
 	if !s.needClosing {
@@ -204,6 +335,12 @@ func (s *Search) NextMetricBlock() bool {
 		return false
 	}
 	for s.ts.NextBlock() {
+		select {
+		case <-s.ctxDone:
+			s.err = s.ctx.Err()
+			return false
+		default:
+		}
 		if s.loops&paceLimiterSlowIterationsMask == 0 {
 			if err := checkSearchDeadlineAndPace(s.deadline); err != nil {
 				s.err = err
@@ -211,6 +348,17 @@ func (s *Search) NextMetricBlock() bool {
 			}
 		}
 		s.loops++
+		if s.clampTimeRange {
+			ok, err := s.initBlockClamp()
+			if err != nil {
+				s.err = err
+				return false
+			}
+			if !ok {
+				// Skip the block without samples on the search time range.
+				continue
+			}
+		}
 		tsid := &s.ts.BlockRef.bh.TSID
 		if tsid.MetricID != s.prevMetricID {
 			if s.ts.BlockRef.bh.MaxTimestamp < s.retentionDeadline {
@@ -224,9 +372,19 @@ func (s *Search) NextMetricBlock() bool {
 				// It should be automatically fixed. See indexDB.searchMetricNameWithCache for details.
 				continue
 			}
+			if s.maxSeries > 0 && s.seriesCount >= s.maxSeries {
+				// The limit on the number of returned time series is reached.
+				s.err = io.EOF
+				return false
+			}
+			s.seriesCount++
 			s.prevMetricID = tsid.MetricID
 		}
 		s.MetricBlockRef.BlockRef = s.ts.BlockRef
+		bh := &s.ts.BlockRef.bh
+		s.stats.BlocksRead++
+		s.stats.RowsRead += uint64(bh.RowsCount)
+		s.stats.CompressedBytesRead += uint64(bh.TimestampsBlockSize) + uint64(bh.ValuesBlockSize)
 		return true
 	}
 	if err := s.ts.Error(); err != nil {
@@ -238,21 +396,127 @@ func (s *Search) NextMetricBlock() bool {
 	return false
 }
 
+// initBlockClamp marks the current block for clamping to s.tr at BlockRef.MustReadBlock if it partially overlaps s.tr.
+//
+// It returns false if the block has no samples on s.tr.
+func (s *Search) initBlockClamp() (bool, error) {
+	br := s.ts.BlockRef
+	br.clampTR = TimeRange{}
+	br.needClamp = false
+	tr := s.tr
+	if br.bh.MinTimestamp >= tr.MinTimestamp && br.bh.MaxTimestamp <= tr.MaxTimestamp {
+		// Fast path - the block is fully covered by the time range, so it doesn't need clamping.
+		return true, nil
+	}
+
+	// Slow path - decode the block in order to check whether it has samples on the time range.
+	// The decoded block isn't shared with br, since br may be read after the next NextMetricBlock call.
+	b := &s.clampCheckBlock
+	br.readBlock(b)
+	if err := b.UnmarshalData(); err != nil {
+		return false, fmt.Errorf("cannot unmarshal block data: %w", err)
+	}
+	if timestamps, _ := b.filterTimestamps(tr); len(timestamps) == 0 {
+		return false, nil
+	}
+	br.clampTR = tr
+	br.needClamp = true
+	return true, nil
+}
+
+// clampBlockToTimeRange drops samples outside tr from the unmarshaled b.
+//
+// It returns false if b has no samples on tr.
+func clampBlockToTimeRange(b *Block, tr TimeRange) bool {
+	timestamps, values := b.filterTimestamps(tr)
+	if len(timestamps) == 0 {
+		return false
+	}
+	b.timestamps = b.timestamps[:copy(b.timestamps, timestamps)]
+	b.values = b.values[:copy(b.values, values)]
+	b.nextIdx = 0
+	b.bh.RowsCount = uint32(len(b.timestamps))
+	b.fixupTimestamps()
+	return true
+}
+
+// NextSamples proceeds to the next block and returns the decoded samples for it.
+//
+// It returns the metric name for the block and the timestamps with values for samples on the time range passed to Init.
+// Blocks without samples on this time range are skipped. Samples for the same time series may be returned
+// over multiple NextSamples calls. The returned results are valid until the next call to NextSamples, NextMetricBlock or MustClose.
+//
+// false is returned when there are no more samples or on error. Call Error in order to check for errors.
+//
+// Use NextMetricBlock if the raw blocks must be processed without decoding.
+func (s *Search) NextSamples() (*MetricName, []int64, []float64, bool) {
+	for s.NextMetricBlock() {
+		mbr := &s.MetricBlockRef
+		b := &s.samplesBlock
+		mbr.BlockRef.MustReadBlock(b)
+		if err := b.UnmarshalData(); err != nil {
+			s.err = fmt.Errorf("cannot unmarshal block data: %w", err)
+			return nil, nil, nil, false
+		}
+		s.samplesTimestamps, s.samplesValues = b.AppendRowsWithTimeRangeFilter(s.samplesTimestamps[:0], s.samplesValues[:0], s.tr)
+		if len(s.samplesTimestamps) == 0 {
+			continue
+		}
+
+		metricID := mbr.BlockRef.bh.TSID.MetricID
+		if metricID != s.samplesMetricID {
+			if err := s.samplesMetricName.Unmarshal(mbr.MetricName); err != nil {
+				s.err = fmt.Errorf("cannot unmarshal metricName %q: %w", mbr.MetricName, err)
+				return nil, nil, nil, false
+			}
+			s.samplesMetricID = metricID
+		}
+		return &s.samplesMetricName, s.samplesTimestamps, s.samplesValues, true
+	}
+	return nil, nil, nil, false
+}
+
 // SearchQuery is used for sending search queries from vmselect to vmstorage.
 type SearchQuery struct {
 	// The time range for searching time series
 	MinTimestamp int64
 	MaxTimestamp int64
 
+	// RelativeDuration is an optional duration in milliseconds for searching time series on the [now-RelativeDuration ... now] time range.
+	//
+	// The time range is resolved at GetTimeRange call, so the query remains valid as the wall clock advances.
+	// MinTimestamp and MaxTimestamp are used if RelativeDuration is zero.
+	RelativeDuration int64
+
 	// Tag filters for the search query
 	TagFilterss [][]TagFilter
 
 	// The maximum number of time series the search query can return.
 	MaxMetrics int
+
+	// MaxSeries is the hard limit on the number of time series returned by the search query.
+	//
+	// Unlike MaxMetrics, which results in an error when exceeded, the search stops
+	// after returning MaxSeries time series. Zero means no limit.
+	MaxSeries int
 }
 
 // GetTimeRange returns time range for the given sq.
+//
+// If sq.RelativeDuration is set, then the time range is resolved against the current time.
 func (sq *SearchQuery) GetTimeRange() TimeRange {
+	now := int64(fasttime.UnixTimestamp() * 1e3)
+	return sq.getTimeRangeAt(now)
+}
+
+// getTimeRangeAt returns time range for the given sq, resolving sq.RelativeDuration against the given now timestamp in milliseconds.
+func (sq *SearchQuery) getTimeRangeAt(now int64) TimeRange {
+	if sq.RelativeDuration > 0 {
+		return TimeRange{
+			MinTimestamp: now - sq.RelativeDuration,
+			MaxTimestamp: now,
+		}
+	}
 	return TimeRange{
 		MinTimestamp: sq.MinTimestamp,
 		MaxTimestamp: sq.MaxTimestamp,
@@ -324,6 +588,11 @@ func (tf *TagFilter) Marshal(dst []byte) []byte {
 	return dst
 }
 
+// minMarshaledTagFilterSize is the minimum size of TagFilter marshaled with TagFilter.Marshal.
+//
+// It consists of a single-byte length for empty Key, a single-byte length for empty Value and IsNegative+IsRegexp byte.
+const minMarshaledTagFilterSize = 3
+
 // Unmarshal unmarshals tf from src and returns the tail.
 func (tf *TagFilter) Unmarshal(src []byte) ([]byte, error) {
 	k, nSize := encoding.UnmarshalBytes(src)
@@ -371,9 +640,19 @@ func (sq *SearchQuery) String() string {
 	for i, tfs := range sq.TagFilterss {
 		a[i] = tagFiltersToString(tfs)
 	}
-	start := TimestampToHumanReadableFormat(sq.MinTimestamp)
-	end := TimestampToHumanReadableFormat(sq.MaxTimestamp)
-	return fmt.Sprintf("filters=%s, timeRange=[%s..%s]", a, start, end)
+	var timeRange string
+	if sq.RelativeDuration > 0 {
+		d := time.Duration(sq.RelativeDuration) * time.Millisecond
+		timeRange = fmt.Sprintf("[now-%s..now]", d)
+	} else {
+		start := TimestampToHumanReadableFormat(sq.MinTimestamp)
+		end := TimestampToHumanReadableFormat(sq.MaxTimestamp)
+		timeRange = fmt.Sprintf("[%s..%s]", start, end)
+	}
+	if sq.MaxSeries > 0 {
+		return fmt.Sprintf("filters=%s, timeRange=%s, maxSeries=%d", a, timeRange, sq.MaxSeries)
+	}
+	return fmt.Sprintf("filters=%s, timeRange=%s", a, timeRange)
 }
 
 func tagFiltersToString(tfs []TagFilter) string {
@@ -395,10 +674,14 @@ func (sq *SearchQuery) Marshal(dst []byte) []byte {
 			dst = tagFilters[i].Marshal(dst)
 		}
 	}
+	dst = encoding.MarshalVarInt64(dst, int64(sq.MaxSeries))
+	dst = encoding.MarshalVarInt64(dst, sq.RelativeDuration)
 	return dst
 }
 
 // Unmarshal unmarshals sq from src and returns the tail.
+//
+// The optional fields missing at the end of src are set to zero.
 func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 	minTs, nSize := encoding.UnmarshalVarInt64(src)
 	if nSize <= 0 {
@@ -419,6 +702,10 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 		return src, fmt.Errorf("cannot unmarshal the count of TagFilterss from uvarint")
 	}
 	src = src[nSize:]
+	if tfssCount > uint64(len(src)) {
+		// Every TagFilters occupies at least a single byte for its length.
+		return src, fmt.Errorf("too big count of TagFilterss: %d; it cannot exceed the remaining src length %d", tfssCount, len(src))
+	}
 	sq.TagFilterss = slicesutil.SetLength(sq.TagFilterss, int(tfssCount))
 
 	for i := 0; i < int(tfssCount); i++ {
@@ -427,6 +714,10 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 			return src, fmt.Errorf("cannot unmarshal the count of TagFilters from uvarint")
 		}
 		src = src[nSize:]
+		if tfsCount > uint64(len(src)/minMarshaledTagFilterSize) {
+			return src, fmt.Errorf("too big count of TagFilters: %d; it cannot exceed %d for the remaining src length %d",
+				tfsCount, len(src)/minMarshaledTagFilterSize, len(src))
+		}
 
 		tagFilters := sq.TagFilterss[i]
 		tagFilters = slicesutil.SetLength(tagFilters, int(tfsCount))
@@ -440,6 +731,31 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 		sq.TagFilterss[i] = tagFilters
 	}
 
+	sq.MaxSeries = 0
+	if len(src) > 0 {
+		// MaxSeries is optional, since it is missing in SearchQuery marshaled by older versions.
+		maxSeries, nSize := encoding.UnmarshalVarInt64(src)
+		if nSize <= 0 {
+			return src, fmt.Errorf("cannot unmarshal MaxSeries from varint")
+		}
+		src = src[nSize:]
+		sq.MaxSeries = int(maxSeries)
+	}
+
+	sq.RelativeDuration = 0
+	if len(src) > 0 {
+		// RelativeDuration is optional, since it is missing in SearchQuery marshaled by older versions.
+		relativeDuration, nSize := encoding.UnmarshalVarInt64(src)
+		if nSize <= 0 {
+			return src, fmt.Errorf("cannot unmarshal RelativeDuration from varint")
+		}
+		src = src[nSize:]
+		if relativeDuration < 0 {
+			return src, fmt.Errorf("RelativeDuration cannot be negative; got %d", relativeDuration)
+		}
+		sq.RelativeDuration = relativeDuration
+	}
+
 	return src, nil
 }
 
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/querytracer"
+)
+
+// SearchBatch runs independent searches for every tfss from tfsss concurrently and calls f for every found MetricBlockRef.
+//
+// Up to concurrency searches are executed in parallel. cgroup.AvailableCPUs() searches are executed in parallel if concurrency <= 0.
+// All the searches share tr, maxMetrics and deadline.
+//
+// f is called with the index of tfss in tfsss, which matches the given mbr. f may be called from concurrently running goroutines,
+// so it must merge the results in a thread-safe manner. mbr is valid only during f call.
+//
+// The first error returned from f or from any search stops the remaining searches and is returned from SearchBatch.
+func SearchBatch(qt *querytracer.Tracer, storage *Storage, tfsss [][]*TagFilters, tr TimeRange, maxMetrics, concurrency int, deadline uint64, f func(idx int, mbr *MetricBlockRef) error) error {
+	if concurrency <= 0 {
+		concurrency = cgroup.AvailableCPUs()
+	}
+	if concurrency > len(tfsss) {
+		concurrency = len(tfsss)
+	}
+
+	qt = qt.NewChild("batch search for %d queries with concurrency=%d", len(tfsss), concurrency)
+	defer qt.Done()
+
+	// Create child tracers in the current goroutine, since querytracer.Tracer.NewChild cannot be called concurrently.
+	qts := make([]*querytracer.Tracer, len(tfsss))
+	for i := range tfsss {
+		qts[i] = qt.NewChild("query #%d", i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var firstErr error
+	var firstErrOnce sync.Once
+	setError := func(err error) {
+		firstErrOnce.Do(func() {
+			firstErr = err
+			// Stop the remaining searches.
+			cancel()
+		})
+	}
+
+	workCh := make(chan int, len(tfsss))
+	for i := range tfsss {
+		workCh <- i
+	}
+	close(workCh)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var s Search
+			for idx := range workCh {
+				err := runSearchBatchQuery(ctx, qts[idx], &s, storage, tfsss[idx], tr, maxMetrics, deadline, idx, f)
+				qts[idx].Done()
+				if err != nil {
+					setError(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func runSearchBatchQuery(ctx context.Context, qt *querytracer.Tracer, s *Search, storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, idx int, f func(idx int, mbr *MetricBlockRef) error) error {
+	if ctx.Err() != nil {
+		// Another search has been already failed. Its error is returned from SearchBatch.
+		return nil
+	}
+
+	s.InitWithContext(ctx, qt, storage, tfss, tr, maxMetrics, deadline)
+	defer s.MustClose()
+
+	for s.NextMetricBlock() {
+		if err := f(idx, &s.MetricBlockRef); err != nil {
+			return err
+		}
+	}
+	return s.Error()
+}
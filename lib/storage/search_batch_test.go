@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+)
+
+func TestSearchBatch(t *testing.T) {
+	defer fs.MustRemoveAll(t.Name())
+
+	st := MustOpenStorage(t.Name(), OpenOptions{})
+	defer st.MustClose()
+
+	const metricGroupsCount = 10
+	const rowsPerMetricGroup = 100
+
+	startTimestamp := timestampFromTime(time.Now()) - 3600*1000
+	var mrs []MetricRow
+	var mn MetricName
+	for i := 0; i < metricGroupsCount; i++ {
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		metricNameRaw := mn.MarshalRaw(nil)
+		for j := 0; j < rowsPerMetricGroup; j++ {
+			mrs = append(mrs, MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     startTimestamp + int64(j)*1000,
+				Value:         float64(j),
+			})
+		}
+	}
+	st.AddRows(mrs, defaultPrecisionBits)
+	st.DebugFlush()
+
+	tr := TimeRange{
+		MinTimestamp: startTimestamp,
+		MaxTimestamp: startTimestamp + rowsPerMetricGroup*1000,
+	}
+	newTagFilters := func(metricGroupRe string) []*TagFilters {
+		t.Helper()
+
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(metricGroupRe), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		return []*TagFilters{tfs}
+	}
+
+	f := func(tfsss [][]*TagFilters, concurrency int, resultsExpected []string) {
+		t.Helper()
+
+		var resultsLock sync.Mutex
+		results := make([]map[string]int, len(tfsss))
+		for i := range results {
+			results[i] = make(map[string]int)
+		}
+		err := SearchBatch(nil, st, tfsss, tr, 1e5, concurrency, noDeadline, func(idx int, mbr *MetricBlockRef) error {
+			var mn MetricName
+			if err := mn.Unmarshal(mbr.MetricName); err != nil {
+				return err
+			}
+			resultsLock.Lock()
+			results[idx][string(mn.MetricGroup)] += mbr.BlockRef.RowsCount()
+			resultsLock.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		for i, m := range results {
+			var a []string
+			for metricGroup, rowsCount := range m {
+				if rowsCount != rowsPerMetricGroup {
+					t.Fatalf("unexpected number of rows for %q at query #%d; got %d; want %d", metricGroup, i, rowsCount, rowsPerMetricGroup)
+				}
+				a = append(a, metricGroup)
+			}
+			sort.Strings(a)
+			result := strings.Join(a, ",")
+			if result != resultsExpected[i] {
+				t.Fatalf("unexpected result for query #%d; got %q; want %q", i, result, resultsExpected[i])
+			}
+		}
+	}
+
+	// zero queries
+	f(nil, 0, nil)
+
+	// a single query
+	f([][]*TagFilters{
+		newTagFilters("metric_1"),
+	}, 0, []string{"metric_1"})
+
+	// multiple queries with various concurrency
+	tfsss := [][]*TagFilters{
+		newTagFilters("metric_1"),
+		newTagFilters("metric_[23]"),
+		newTagFilters("missing_metric"),
+		newTagFilters("metric_[1-4]"),
+	}
+	resultsExpected := []string{
+		"metric_1",
+		"metric_2,metric_3",
+		"",
+		"metric_1,metric_2,metric_3,metric_4",
+	}
+	f(tfsss, 1, resultsExpected)
+	f(tfsss, 2, resultsExpected)
+	f(tfsss, 0, resultsExpected)
+	f(tfsss, 100, resultsExpected)
+}
+
+func TestSearchBatchError(t *testing.T) {
+	defer fs.MustRemoveAll(t.Name())
+
+	st := MustOpenStorage(t.Name(), OpenOptions{})
+	defer st.MustClose()
+
+	timestamp := timestampFromTime(time.Now())
+	var mn MetricName
+	mn.MetricGroup = []byte("metric")
+	mrs := []MetricRow{
+		{
+			MetricNameRaw: mn.MarshalRaw(nil),
+			Timestamp:     timestamp,
+			Value:         123,
+		},
+	}
+	st.AddRows(mrs, defaultPrecisionBits)
+	st.DebugFlush()
+
+	tr := TimeRange{
+		MinTimestamp: timestamp - 1000,
+		MaxTimestamp: timestamp + 1000,
+	}
+
+	tfsss := make([][]*TagFilters, 10)
+	for i := range tfsss {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric"), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		tfsss[i] = []*TagFilters{tfs}
+	}
+
+	errExpected := fmt.Errorf("error for query #3")
+	err := SearchBatch(nil, st, tfsss, tr, 1e5, 2, noDeadline, func(idx int, _ *MetricBlockRef) error {
+		if idx == 3 {
+			return errExpected
+		}
+		return nil
+	})
+	if err != errExpected {
+		t.Fatalf("unexpected error; got %v; want %v", err, errExpected)
+	}
+}
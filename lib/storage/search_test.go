@@ -2,7 +2,10 @@ package storage
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
@@ -11,6 +14,9 @@ import (
 	"testing"
 	"testing/quick"
 	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 )
 
 func TestSearchQueryMarshalUnmarshal(t *testing.T) {
@@ -29,6 +35,8 @@ func TestSearchQueryMarshalUnmarshal(t *testing.T) {
 			// Skip nil sq1.
 			continue
 		}
+		// Negative RelativeDuration is rejected by Unmarshal.
+		sq1.RelativeDuration &= math.MaxInt64
 		buf = sq1.Marshal(buf[:0])
 
 		tail, err := sq2.Unmarshal(buf)
@@ -44,6 +52,12 @@ func TestSearchQueryMarshalUnmarshal(t *testing.T) {
 		if sq1.MaxTimestamp != sq2.MaxTimestamp {
 			t.Fatalf("unexpected MaxTimestamp; got %d; want %d", sq2.MaxTimestamp, sq1.MaxTimestamp)
 		}
+		if sq1.RelativeDuration != sq2.RelativeDuration {
+			t.Fatalf("unexpected RelativeDuration; got %d; want %d", sq2.RelativeDuration, sq1.RelativeDuration)
+		}
+		if sq1.MaxSeries != sq2.MaxSeries {
+			t.Fatalf("unexpected MaxSeries; got %d; want %d", sq2.MaxSeries, sq1.MaxSeries)
+		}
 		if len(sq1.TagFilterss) != len(sq2.TagFilterss) {
 			t.Fatalf("unexpected TagFilterss len; got %d; want %d", len(sq2.TagFilterss), len(sq1.TagFilterss))
 		}
@@ -70,6 +84,252 @@ func TestSearchQueryMarshalUnmarshal(t *testing.T) {
 	}
 }
 
+func TestSearchQueryUnmarshalFailure(t *testing.T) {
+	f := func(src []byte) {
+		t.Helper()
+
+		var sq SearchQuery
+		if _, err := sq.Unmarshal(src); err == nil {
+			t.Fatalf("expecting non-nil error when unmarshaling %X", src)
+		}
+	}
+
+	sq := &SearchQuery{
+		MinTimestamp: 123,
+		MaxTimestamp: 456,
+		TagFilterss: [][]TagFilter{
+			{
+				{
+					Key:   []byte("job"),
+					Value: []byte("foo.+"),
+
+					IsRegexp: true,
+				},
+				{
+					Value: []byte("metric_name"),
+				},
+			},
+		},
+		MaxSeries:        1000,
+		RelativeDuration: 300e3,
+	}
+	data := sq.Marshal(nil)
+
+	// truncated data
+	//
+	// Data without the optional MaxSeries and RelativeDuration is valid. See TestSearchQueryUnmarshalWithoutOptionalFields.
+	relativeDurationOffset := len(data) - len(encoding.MarshalVarInt64(nil, sq.RelativeDuration))
+	maxSeriesOffset := relativeDurationOffset - len(encoding.MarshalVarInt64(nil, int64(sq.MaxSeries)))
+	for i := 0; i < len(data); i++ {
+		if i == relativeDurationOffset || i == maxSeriesOffset {
+			continue
+		}
+		f(data[:i])
+	}
+
+	marshalHeader := func(tfssCount uint64) []byte {
+		var dst []byte
+		dst = encoding.MarshalVarInt64(dst, 123)
+		dst = encoding.MarshalVarInt64(dst, 456)
+		return encoding.MarshalVarUint64(dst, tfssCount)
+	}
+
+	// too big count of TagFilterss
+	f(marshalHeader(1 << 40))
+	f(marshalHeader(1<<64 - 1))
+
+	// negative RelativeDuration
+	sqNegative := *sq
+	sqNegative.RelativeDuration = -1000
+	f(sqNegative.Marshal(nil))
+
+	// too big count of TagFilters
+	f(encoding.MarshalVarUint64(marshalHeader(1), 1<<40))
+	f(encoding.MarshalVarUint64(marshalHeader(1), 1<<64-1))
+
+	// too big TagFilter.Key length
+	b := encoding.MarshalVarUint64(marshalHeader(1), 1)
+	b = encoding.MarshalVarUint64(b, 1<<64-1)
+	b = append(b, "foobar"...)
+	f(b)
+
+	// invalid IsNegative+IsRegexp byte
+	b = encoding.MarshalVarUint64(marshalHeader(1), 1)
+	b = encoding.MarshalBytes(b, []byte("key"))
+	b = encoding.MarshalBytes(b, []byte("value"))
+	b = append(b, 4)
+	b = encoding.MarshalVarInt64(b, 0)
+	f(b)
+}
+
+func TestSearchQueryUnmarshalWithoutOptionalFields(t *testing.T) {
+	f := func(data []byte, sqExpected *SearchQuery) {
+		t.Helper()
+
+		// Pre-fill sq with non-zero optional fields in order to verify they are reset.
+		sq := &SearchQuery{
+			MaxSeries:        123,
+			RelativeDuration: 456,
+		}
+		tail, err := sq.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(tail) > 0 {
+			t.Fatalf("unexpected tail left after SearchQuery unmarshaling; tail (len=%d): %q", len(tail), tail)
+		}
+		if sq.MinTimestamp != sqExpected.MinTimestamp {
+			t.Fatalf("unexpected MinTimestamp; got %d; want %d", sq.MinTimestamp, sqExpected.MinTimestamp)
+		}
+		if sq.MaxTimestamp != sqExpected.MaxTimestamp {
+			t.Fatalf("unexpected MaxTimestamp; got %d; want %d", sq.MaxTimestamp, sqExpected.MaxTimestamp)
+		}
+		if sq.MaxSeries != sqExpected.MaxSeries {
+			t.Fatalf("unexpected MaxSeries; got %d; want %d", sq.MaxSeries, sqExpected.MaxSeries)
+		}
+		if sq.RelativeDuration != sqExpected.RelativeDuration {
+			t.Fatalf("unexpected RelativeDuration; got %d; want %d", sq.RelativeDuration, sqExpected.RelativeDuration)
+		}
+		if s, sExpected := sq.String(), sqExpected.String(); s != sExpected {
+			t.Fatalf("unexpected SearchQuery\ngot\n%s\nwant\n%s", s, sExpected)
+		}
+	}
+
+	tf := TagFilter{
+		Key:   []byte("job"),
+		Value: []byte("foo"),
+	}
+	sqExpected := &SearchQuery{
+		MinTimestamp: 123,
+		MaxTimestamp: 456,
+		TagFilterss:  [][]TagFilter{{tf}},
+	}
+	marshalTagFilterss := func() []byte {
+		var dst []byte
+		dst = encoding.MarshalVarInt64(dst, sqExpected.MinTimestamp)
+		dst = encoding.MarshalVarInt64(dst, sqExpected.MaxTimestamp)
+		dst = encoding.MarshalVarUint64(dst, 1)
+		dst = encoding.MarshalVarUint64(dst, 1)
+		return tf.Marshal(dst)
+	}
+
+	// SearchQuery marshaled by older versions without MaxSeries and RelativeDuration
+	f(marshalTagFilterss(), sqExpected)
+
+	// missing RelativeDuration
+	sqExpected.MaxSeries = 1000
+	data := marshalTagFilterss()
+	data = encoding.MarshalVarInt64(data, 1000)
+	f(data, sqExpected)
+}
+
+func FuzzSearchQueryUnmarshal(f *testing.F) {
+	sqs := []*SearchQuery{
+		{},
+		{
+			MinTimestamp:     -1,
+			MaxTimestamp:     1 << 62,
+			RelativeDuration: 3600 * 1000,
+			TagFilterss: [][]TagFilter{
+				{
+					{
+						Key:   []byte("job"),
+						Value: []byte("foo.+"),
+
+						IsNegative: true,
+						IsRegexp:   true,
+					},
+				},
+				{
+					{
+						Value: []byte("metric_name"),
+					},
+				},
+			},
+			MaxSeries: 1000,
+		},
+	}
+	for _, sq := range sqs {
+		data := sq.Marshal(nil)
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+
+	f.Fuzz(func(t *testing.T, src []byte) {
+		var sq SearchQuery
+		tail, err := sq.Unmarshal(src)
+		if err != nil {
+			return
+		}
+		if len(tail) > len(src) {
+			t.Fatalf("unexpected tail len; got %d; mustn't exceed %d", len(tail), len(src))
+		}
+
+		// Successfully unmarshaled query must be marshaled and unmarshaled again without errors.
+		data := sq.Marshal(nil)
+		var sq2 SearchQuery
+		tail, err = sq2.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("cannot unmarshal marshaled SearchQuery %s: %s", &sq, err)
+		}
+		if len(tail) > 0 {
+			t.Fatalf("unexpected tail left after SearchQuery unmarshaling; tail (len=%d): %X", len(tail), tail)
+		}
+		if !reflect.DeepEqual(normalizeSearchQuery(&sq), normalizeSearchQuery(&sq2)) {
+			t.Fatalf("unexpected SearchQuery after marshal+unmarshal; got\n%s\nwant\n%s", &sq2, &sq)
+		}
+	})
+}
+
+// normalizeSearchQuery returns sq with nil slices substituted with empty ones, so it can be compared with reflect.DeepEqual.
+func normalizeSearchQuery(sq *SearchQuery) *SearchQuery {
+	var sqCopy SearchQuery
+	sqCopy.MinTimestamp = sq.MinTimestamp
+	sqCopy.MaxTimestamp = sq.MaxTimestamp
+	sqCopy.RelativeDuration = sq.RelativeDuration
+	sqCopy.MaxSeries = sq.MaxSeries
+	for _, tfs := range sq.TagFilterss {
+		var tfsCopy []TagFilter
+		for _, tf := range tfs {
+			tfsCopy = append(tfsCopy, TagFilter{
+				Key:        append([]byte{}, tf.Key...),
+				Value:      append([]byte{}, tf.Value...),
+				IsNegative: tf.IsNegative,
+				IsRegexp:   tf.IsRegexp,
+			})
+		}
+		sqCopy.TagFilterss = append(sqCopy.TagFilterss, tfsCopy)
+	}
+	return &sqCopy
+}
+
+func TestSearchQueryGetTimeRange(t *testing.T) {
+	sq := &SearchQuery{
+		MinTimestamp: 1000,
+		MaxTimestamp: 2000,
+	}
+	tr := sq.GetTimeRange()
+	if tr.MinTimestamp != 1000 || tr.MaxTimestamp != 2000 {
+		t.Fatalf("unexpected time range for absolute query; got %s; want [1000..2000]", &tr)
+	}
+
+	// RelativeDuration must take precedence over the absolute time range.
+	sq.RelativeDuration = 5 * 60 * 1000
+	const now = 1_700_000_000_000
+	tr = sq.getTimeRangeAt(now)
+	if tr.MinTimestamp != now-sq.RelativeDuration || tr.MaxTimestamp != now {
+		t.Fatalf("unexpected time range for relative query; got %s; want [%d..%d]", &tr, now-sq.RelativeDuration, now)
+	}
+
+	// The time range must follow the current time.
+	tr = sq.getTimeRangeAt(now + 1000)
+	if tr.MinTimestamp != now+1000-sq.RelativeDuration || tr.MaxTimestamp != now+1000 {
+		t.Fatalf("unexpected time range for relative query; got %s; want [%d..%d]", &tr, now+1000-sq.RelativeDuration, now+1000)
+	}
+}
+
 func TestSearch(t *testing.T) {
 	path := "TestSearch"
 	st := MustOpenStorage(path, OpenOptions{})
@@ -98,7 +358,7 @@ func TestSearch(t *testing.T) {
 		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i%metricGroupsCount))
 
 		mr := &mrs[i]
-		mr.MetricNameRaw = mn.marshalRaw(nil)
+		mr.MetricNameRaw = mn.MarshalRaw(nil)
 		mr.Timestamp = startTimestamp + int64(i)
 		mr.Value = float64(i)
 
@@ -149,6 +409,239 @@ func TestSearch(t *testing.T) {
 			t.Fatalf("unexpected error: %s", firstError)
 		}
 	})
+
+	t.Run("contextCanceled", func(t *testing.T) {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var s Search
+		s.InitWithContext(ctx, nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		if !s.NextMetricBlock() {
+			t.Fatalf("expecting at least a single block before ctx cancelation; err: %v", s.Error())
+		}
+		cancel()
+		if s.NextMetricBlock() {
+			t.Fatalf("expecting NextMetricBlock to return false after ctx cancelation")
+		}
+		if err := s.Error(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error; got %v; want %v", err, context.Canceled)
+		}
+		s.MustClose()
+
+		// Verify that the search doesn't return blocks when ctx is canceled before the search is started.
+		s.InitWithContext(ctx, nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		if s.NextMetricBlock() {
+			t.Fatalf("expecting NextMetricBlock to return false for canceled ctx")
+		}
+		if err := s.Error(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("unexpected error; got %v; want %v", err, context.Canceled)
+		}
+		s.MustClose()
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+
+		var s Search
+		s.Init(nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		var blocksRead, rowsRead, compressedBytesRead uint64
+		var b Block
+		for s.NextMetricBlock() {
+			s.MetricBlockRef.BlockRef.MustReadBlock(&b)
+			blocksRead++
+			rowsRead += uint64(b.RowsCount())
+			compressedBytesRead += uint64(len(b.timestampsData) + len(b.valuesData))
+		}
+		if err := s.Error(); err != nil {
+			t.Fatalf("search error: %s", err)
+		}
+		s.MustClose()
+
+		// Stats must remain available after MustClose.
+		stats := s.Stats()
+		if blocksRead == 0 {
+			t.Fatalf("expecting non-zero blocks read")
+		}
+		if stats.BlocksRead != blocksRead {
+			t.Fatalf("unexpected BlocksRead; got %d; want %d", stats.BlocksRead, blocksRead)
+		}
+		if stats.RowsRead != rowsRead {
+			t.Fatalf("unexpected RowsRead; got %d; want %d", stats.RowsRead, rowsRead)
+		}
+		if stats.CompressedBytesRead != compressedBytesRead {
+			t.Fatalf("unexpected CompressedBytesRead; got %d; want %d", stats.CompressedBytesRead, compressedBytesRead)
+		}
+	})
+
+	t.Run("nextSamples", func(t *testing.T) {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+
+		var s Search
+		s.Init(nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		var got []MetricRow
+		for {
+			mn, timestamps, values, ok := s.NextSamples()
+			if !ok {
+				break
+			}
+			if len(timestamps) == 0 {
+				t.Fatalf("unexpected empty samples for %s", mn)
+			}
+			if len(timestamps) != len(values) {
+				t.Fatalf("timestamps and values count mismatch for %s; got %d vs %d", mn, len(timestamps), len(values))
+			}
+			metricNameRaw := mn.MarshalRaw(nil)
+			for i, timestamp := range timestamps {
+				got = append(got, MetricRow{
+					MetricNameRaw: metricNameRaw,
+					Timestamp:     timestamp,
+					Value:         values[i],
+				})
+			}
+		}
+		if err := s.Error(); err != nil {
+			t.Fatalf("search error: %s", err)
+		}
+		s.MustClose()
+
+		var want []MetricRow
+		for _, mr := range mrs {
+			if mr.Timestamp >= tr.MinTimestamp && mr.Timestamp <= tr.MaxTimestamp {
+				want = append(want, mr)
+			}
+		}
+		testSortMetricRows(got)
+		testSortMetricRows(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("unexpected rows found;\ngot\n%s\nwant\n%s", mrsToString(got), mrsToString(want))
+		}
+	})
+
+	t.Run("clampTimeRange", func(t *testing.T) {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		f := func(deferRead bool) {
+			t.Helper()
+
+			var s Search
+			s.Init(nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+			s.SetClampTimeRange(true)
+
+			// Collect copies of BlockRef and read them after the search like netstorage.ProcessSearchQuery does
+			// if deferRead is set.
+			var metricNames [][]byte
+			var brs []BlockRef
+			var got []MetricRow
+			var mn MetricName
+			var b Block
+			clampedBlocks := 0
+			readBlock := func(metricName []byte, br *BlockRef) {
+				t.Helper()
+				br.MustReadBlock(&b)
+				if err := b.UnmarshalData(); err != nil {
+					t.Fatalf("cannot unmarshal block data: %s", err)
+				}
+				if b.RowsCount() != len(b.timestamps) {
+					t.Fatalf("unexpected RowsCount; got %d; want %d", b.RowsCount(), len(b.timestamps))
+				}
+				if b.RowsCount() < br.RowsCount() {
+					clampedBlocks++
+				}
+				if err := mn.Unmarshal(metricName); err != nil {
+					t.Fatalf("cannot unmarshal MetricName: %s", err)
+				}
+				metricNameRaw := mn.MarshalRaw(nil)
+				values := decimal.AppendDecimalToFloat(nil, b.values, b.bh.Scale)
+				for i, timestamp := range b.timestamps {
+					if timestamp < tr.MinTimestamp || timestamp > tr.MaxTimestamp {
+						t.Fatalf("unexpected timestamp %d outside the time range %s", timestamp, &tr)
+					}
+					got = append(got, MetricRow{
+						MetricNameRaw: metricNameRaw,
+						Timestamp:     timestamp,
+						Value:         values[i],
+					})
+				}
+			}
+			for s.NextMetricBlock() {
+				mbr := &s.MetricBlockRef
+				if !deferRead {
+					readBlock(mbr.MetricName, mbr.BlockRef)
+					continue
+				}
+				metricNames = append(metricNames, append([]byte{}, mbr.MetricName...))
+				brs = append(brs, *mbr.BlockRef)
+			}
+			if err := s.Error(); err != nil {
+				t.Fatalf("search error: %s", err)
+			}
+			for i := range brs {
+				readBlock(metricNames[i], &brs[i])
+			}
+			s.MustClose()
+
+			// The blocks partially overlapping the time range must be clamped.
+			if clampedBlocks == 0 {
+				t.Fatalf("expecting non-zero number of clamped blocks")
+			}
+
+			var want []MetricRow
+			for _, mr := range mrs {
+				if mr.Timestamp >= tr.MinTimestamp && mr.Timestamp <= tr.MaxTimestamp {
+					want = append(want, mr)
+				}
+			}
+			testSortMetricRows(got)
+			testSortMetricRows(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("unexpected rows found for deferRead=%v;\ngot\n%s\nwant\n%s", deferRead, mrsToString(got), mrsToString(want))
+			}
+		}
+
+		f(false)
+		f(true)
+	})
+
+	t.Run("maxSeries", func(t *testing.T) {
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		f := func(maxSeries, seriesCountExpected int) {
+			t.Helper()
+
+			var s Search
+			s.Init(nil, st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+			s.SetMaxSeries(maxSeries)
+			metricNames := make(map[string]struct{})
+			for s.NextMetricBlock() {
+				metricNames[string(s.MetricBlockRef.MetricName)] = struct{}{}
+			}
+			if err := s.Error(); err != nil {
+				t.Fatalf("search error: %s", err)
+			}
+			s.MustClose()
+			if len(metricNames) != seriesCountExpected {
+				t.Fatalf("unexpected number of series returned for maxSeries=%d; got %d; want %d", maxSeries, len(metricNames), seriesCountExpected)
+			}
+		}
+
+		f(1, 1)
+		f(10, 10)
+		f(0, metricGroupsCount)
+		f(metricGroupsCount+1, metricGroupsCount)
+	})
 }
 
 func testSearchInternal(s *Storage, tr TimeRange, mrs []MetricRow) error {
@@ -221,7 +714,7 @@ func testAssertSearchResult(st *Storage, tr TimeRange, tfs *TagFilters, want []M
 		if err := mn.Unmarshal(mb.MetricName); err != nil {
 			return fmt.Errorf("cannot unmarshal MetricName: %w", err)
 		}
-		metricNameRaw := mn.marshalRaw(nil)
+		metricNameRaw := mn.MarshalRaw(nil)
 		for i, timestamp := range rb.Timestamps {
 			mr := MetricRow{
 				MetricNameRaw: metricNameRaw,
@@ -68,6 +68,11 @@ type Storage struct {
 	cachePath      string
 	retentionMsecs int64
 
+	// onPartitionDropped is an optional callback, which is called for partitions dropped because of the retention.
+	//
+	// See OpenOptions.OnPartitionDropped.
+	onPartitionDropped func(tr TimeRange)
+
 	// lock file for exclusive access to the storage on the given path.
 	flockF *os.File
 
@@ -173,6 +178,14 @@ type OpenOptions struct {
 	MaxHourlySeries    int
 	MaxDailySeries     int
 	DisablePerDayIndex bool
+
+	// OnPartitionDropped is an optional callback, which is called with the time range of every partition dropped because of Retention.
+	//
+	// It allows invalidating caches tied to the dropped time range. New searches do not see the data for the dropped partition
+	// by the time the callback is called, while the partition files are removed after all the already started searches are done.
+	//
+	// The callback is called from a background goroutine without holding storage locks, so it may safely call Storage methods.
+	OnPartitionDropped func(tr TimeRange)
 }
 
 // MustOpenStorage opens storage on the given path with the given retentionMsecs.
@@ -190,6 +203,8 @@ func MustOpenStorage(path string, opts OpenOptions) *Storage {
 		cachePath:      filepath.Join(path, cacheDirname),
 		retentionMsecs: retention.Milliseconds(),
 		stopCh:         make(chan struct{}),
+
+		onPartitionDropped: opts.OnPartitionDropped,
 	}
 	fs.MustMkdirIfNotExist(path)
 
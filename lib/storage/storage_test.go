@@ -597,7 +597,7 @@ func testStorageRandTimestamps(s *Storage) error {
 		}
 		for j := 0; j < rowsPerAdd; j++ {
 			mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", rng.Intn(100)))
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			timestamp := currentTime - int64((rng.Float64()-0.2)*float64(2*s.retentionMsecs))
 			value := rng.NormFloat64() * 1e11
 
@@ -711,7 +711,7 @@ func testStorageDeleteSeries(s *Storage, workerNum int) error {
 			lnsAll[string(mn.Tags[i].Key)] = true
 		}
 		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d_%d", i, workerNum))
-		metricNameRaw := mn.marshalRaw(nil)
+		metricNameRaw := mn.MarshalRaw(nil)
 
 		for j := 0; j < rowsPerMetric; j++ {
 			timestamp := rng.Int63n(1e10)
@@ -874,7 +874,7 @@ func TestStorageDeleteSeries_CachesAreUpdatedOrReset(t *testing.T) {
 	}
 	mn := MetricName{MetricGroup: []byte("metric")}
 	mr := MetricRow{
-		MetricNameRaw: mn.marshalRaw(nil),
+		MetricNameRaw: mn.MarshalRaw(nil),
 		Timestamp:     tr.MaxTimestamp,
 		Value:         123,
 	}
@@ -1005,7 +1005,7 @@ func testStorageRegisterMetricNames(s *Storage) error {
 		now := timestampFromTime(time.Now())
 		for j := 0; j < metricsPerAdd; j++ {
 			mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", j))
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 
 			mr := MetricRow{
 				MetricNameRaw: metricNameRaw,
@@ -1169,7 +1169,7 @@ func testGenerateMetricRowsWithPrefix(rng *rand.Rand, rows uint64, prefix string
 	}
 	for i := 0; i < int(rows); i++ {
 		mn.MetricGroup = []byte(fmt.Sprintf("%s_%d", prefix, i))
-		metricNameRaw := mn.marshalRaw(nil)
+		metricNameRaw := mn.MarshalRaw(nil)
 		timestamp := rng.Int63n(tr.MaxTimestamp-tr.MinTimestamp) + tr.MinTimestamp
 		value := rng.NormFloat64() * 1e6
 
@@ -1840,6 +1840,59 @@ func TestStorageSearchMetricNames_TooManyTimeseries(t *testing.T) {
 	})
 }
 
+func TestStorageOnPartitionDropped(t *testing.T) {
+	defer fs.MustRemoveAll(t.Name())
+
+	var s *Storage
+	var droppedTRs []TimeRange
+	s = MustOpenStorage(t.Name(), OpenOptions{
+		OnPartitionDropped: func(tr TimeRange) {
+			// The callback must be called without holding table locks,
+			// so it must be possible to obtain the partitions from the callback.
+			ptws := s.tb.GetPartitions(nil)
+			for _, ptw := range ptws {
+				if ptw.pt.tr == tr {
+					t.Errorf("the dropped partition %s must be removed from the table before calling the callback", &tr)
+				}
+			}
+			s.tb.PutPartitions(ptws)
+
+			droppedTRs = append(droppedTRs, tr)
+		},
+	})
+	defer s.MustClose()
+
+	rng := rand.New(rand.NewSource(1))
+	now := time.Now().UTC()
+	oldTimestamp := now.AddDate(0, -3, 0).UnixMilli()
+	newTimestamp := now.UnixMilli()
+	s.AddRows(testGenerateMetricRows(rng, 10, oldTimestamp, oldTimestamp+1000), defaultPrecisionBits)
+	s.AddRows(testGenerateMetricRows(rng, 10, newTimestamp, newTimestamp+1000), defaultPrecisionBits)
+	s.DebugFlush()
+
+	// There are no partitions outside the retention
+	s.tb.dropPartitionsOutsideRetention(oldTimestamp)
+	if len(droppedTRs) != 0 {
+		t.Fatalf("unexpected dropped partitions: %v", droppedTRs)
+	}
+
+	// Drop the partition with old samples
+	s.tb.dropPartitionsOutsideRetention(newTimestamp)
+	if len(droppedTRs) != 1 {
+		t.Fatalf("unexpected number of dropped partitions; got %d; want 1", len(droppedTRs))
+	}
+	tr := droppedTRs[0]
+	if oldTimestamp < tr.MinTimestamp || oldTimestamp > tr.MaxTimestamp {
+		t.Fatalf("unexpected time range for the dropped partition; got %s; want the range containing %d", &tr, oldTimestamp)
+	}
+
+	ptws := s.tb.GetPartitions(nil)
+	if len(ptws) != 1 {
+		t.Fatalf("unexpected number of partitions left; got %d; want 1", len(ptws))
+	}
+	s.tb.PutPartitions(ptws)
+}
+
 func TestStorageDate(t *testing.T) {
 	defer testRemoveAll(t)
 
@@ -2063,7 +2116,7 @@ func TestStorageGetTSDBStatusWithoutPerDayIndex(t *testing.T) {
 			mn := &MetricName{
 				MetricGroup: []byte(name),
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			opts.mrs = append(opts.mrs, MetricRow{
 				MetricNameRaw: metricNameRaw,
 				Timestamp:     rng.Int63n(tr.MaxTimestamp-tr.MinTimestamp) + tr.MinTimestamp,
@@ -2113,7 +2166,7 @@ func TestStorageSearchMetricNamesWithoutPerDayIndex(t *testing.T) {
 			mn := &MetricName{
 				MetricGroup: []byte(name),
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			want = append(want, string(name))
 			opts.mrs = append(opts.mrs, MetricRow{
 				MetricNameRaw: metricNameRaw,
@@ -2176,7 +2229,7 @@ func TestStorageSearchLabelNamesWithoutPerDayIndex(t *testing.T) {
 					{[]byte(labelName), []byte("webservice")},
 				},
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			want = append(want, labelName)
 			opts.mrs = append(opts.mrs, MetricRow{
 				MetricNameRaw: metricNameRaw,
@@ -2231,7 +2284,7 @@ func TestStorageSearchLabelValuesWithoutPerDayIndex(t *testing.T) {
 					{[]byte(labelName), []byte(labelValue)},
 				},
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			want = append(want, labelValue)
 			opts.mrs = append(opts.mrs, MetricRow{
 				MetricNameRaw: metricNameRaw,
@@ -2281,7 +2334,7 @@ func TestStorageSearchTagValueSuffixesWithoutPerDayIndex(t *testing.T) {
 			mn := &MetricName{
 				MetricGroup: []byte(metricName),
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			opts.mrs = append(opts.mrs, MetricRow{
 				MetricNameRaw: metricNameRaw,
 				Timestamp:     rng.Int63n(tr.MaxTimestamp-tr.MinTimestamp) + tr.MinTimestamp,
@@ -2331,7 +2384,7 @@ func TestStorageSearchGraphitePathsWithoutPerDayIndex(t *testing.T) {
 			mn := &MetricName{
 				MetricGroup: []byte(metricName),
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			opts.mrs = append(opts.mrs, MetricRow{
 				MetricNameRaw: metricNameRaw,
 				Timestamp:     rng.Int63n(tr.MaxTimestamp-tr.MinTimestamp) + tr.MinTimestamp,
@@ -2382,7 +2435,7 @@ func TestStorageQueryWithoutPerDayIndex(t *testing.T) {
 			mn := &MetricName{
 				MetricGroup: []byte(name),
 			}
-			metricNameRaw := mn.marshalRaw(nil)
+			metricNameRaw := mn.MarshalRaw(nil)
 			mr := MetricRow{
 				MetricNameRaw: metricNameRaw,
 				Timestamp:     rng.Int63n(tr.MaxTimestamp-tr.MinTimestamp) + tr.MinTimestamp,
@@ -2421,7 +2474,7 @@ func TestStorageAddRows_SamplesWithZeroDate(t *testing.T) {
 		defer s.MustClose()
 
 		mn := MetricName{MetricGroup: []byte("metric")}
-		mr := MetricRow{MetricNameRaw: mn.marshalRaw(nil)}
+		mr := MetricRow{MetricNameRaw: mn.MarshalRaw(nil)}
 		for range 10 {
 			mr.Timestamp = rand.Int63n(msecPerDay)
 			mr.Value = float64(rand.Intn(1000))
@@ -2839,7 +2892,7 @@ func testGenerateMetricRowBatches(opts *batchOptions) ([][]MetricRow, *counts) {
 				MaxTimestamp: endTime.Add(days * 24 * time.Hour).UnixMilli(),
 			}
 			rows = append(rows, MetricRow{
-				MetricNameRaw: mn.marshalRaw(nil),
+				MetricNameRaw: mn.MarshalRaw(nil),
 				Timestamp:     rng.Int63n(tr.MaxTimestamp-tr.MinTimestamp) + tr.MinTimestamp,
 				Value:         rng.NormFloat64() * 1e6,
 			})
@@ -407,31 +407,50 @@ func (tb *table) retentionWatcher() {
 		}
 
 		minTimestamp := int64(fasttime.UnixTimestamp()*1000) - tb.s.retentionMsecs
-		var ptwsDrop []*partitionWrapper
-		tb.ptwsLock.Lock()
-		dst := tb.ptws[:0]
-		for _, ptw := range tb.ptws {
-			if ptw.pt.tr.MaxTimestamp < minTimestamp {
-				ptwsDrop = append(ptwsDrop, ptw)
-			} else {
-				dst = append(dst, ptw)
-			}
-		}
-		tb.ptws = dst
-		tb.ptwsLock.Unlock()
+		tb.dropPartitionsOutsideRetention(minTimestamp)
+	}
+}
 
-		if len(ptwsDrop) == 0 {
-			continue
+// dropPartitionsOutsideRetention drops partitions with data older than minTimestamp.
+//
+// Storage.onPartitionDropped is called for every dropped partition after releasing tb.ptwsLock,
+// so the callback may use tb without the risk of deadlock.
+func (tb *table) dropPartitionsOutsideRetention(minTimestamp int64) {
+	var ptwsDrop []*partitionWrapper
+	tb.ptwsLock.Lock()
+	dst := tb.ptws[:0]
+	for _, ptw := range tb.ptws {
+		if ptw.pt.tr.MaxTimestamp < minTimestamp {
+			ptwsDrop = append(ptwsDrop, ptw)
+		} else {
+			dst = append(dst, ptw)
 		}
+	}
+	tb.ptws = dst
+	tb.ptwsLock.Unlock()
 
-		// There are partitions to drop. Drop them.
+	if len(ptwsDrop) == 0 {
+		return
+	}
 
-		// Remove table references from partitions, so they will be eventually
-		// closed and dropped after all the pending searches are done.
-		for _, ptw := range ptwsDrop {
-			ptw.scheduleToDrop()
-			ptw.decRef()
-		}
+	// There are partitions to drop. Drop them.
+
+	// Remove table references from partitions, so they will be eventually
+	// closed and dropped after all the pending searches are done.
+	//
+	// Save the time ranges for the dropped partitions before that, since ptw.pt may be reset by ptw.decRef().
+	trs := make([]TimeRange, len(ptwsDrop))
+	for i, ptw := range ptwsDrop {
+		trs[i] = ptw.pt.tr
+		ptw.scheduleToDrop()
+		ptw.decRef()
+	}
+
+	if tb.s.onPartitionDropped == nil {
+		return
+	}
+	for _, tr := range trs {
+		tb.s.onPartitionDropped(tr)
 	}
 }
 
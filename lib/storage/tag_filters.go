@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"regexp/syntax"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -69,7 +70,8 @@ func convertToCompositeTagFilters(tfs *TagFilters) []*TagFilters {
 				// and generate composite filters for each of them.
 				names = names[:0] // override the previous filters on metric name
 				for _, orSuffix := range tf.orSuffixes {
-					names = append(names, []byte(orSuffix))
+					// orSuffixes contain escaped values, while names must contain unescaped values.
+					names = append(names, unmarshalTagValueNoTrailingTagSeparator(nil, orSuffix))
 				}
 				namePrefix = tf.regexpPrefix
 			}
@@ -86,8 +88,9 @@ func convertToCompositeTagFilters(tfs *TagFilters) []*TagFilters {
 	}
 
 	// Create composite filters for the found names.
-	var compositeKey, nameWithPrefix []byte
+	var compositeKey, nameWithPrefix, nameEscaped []byte
 	for _, name := range names {
+		nameEscaped = marshalTagValueNoTrailingTagSeparator(nameEscaped[:0], bytesutil.ToUnsafeString(name))
 		compositeFilters := 0
 		tfsNew := make([]tagFilter, 0, len(tfs.tfs))
 		for _, tf := range tfs.tfs {
@@ -100,7 +103,7 @@ func convertToCompositeTagFilters(tfs *TagFilters) []*TagFilters {
 				if tf.isRegexp {
 					matchName := false
 					for _, orSuffix := range tf.orSuffixes {
-						if orSuffix == string(name) {
+						if orSuffix == string(nameEscaped) {
 							matchName = true
 							break
 						}
@@ -225,6 +228,39 @@ func (tfs *TagFilters) Add(key, value []byte, isNegative, isRegexp bool) error {
 	return nil
 }
 
+// AddSet adds the filter matching key values from the given set to tfs.
+//
+// The filter is equivalent to {key=~"value1|...|valueN"} regexp filter, but it is matched in O(1) time.
+// If isNegative is true, then the filter matches all the values except the given ones.
+//
+// MetricGroup must be encoded with nil key.
+func (tfs *TagFilters) AddSet(key []byte, values []string, isNegative bool) error {
+	if len(values) == 0 {
+		return fmt.Errorf("the set of values for the tag %q cannot be empty", key)
+	}
+	if len(values) == 1 {
+		return tfs.Add(key, []byte(values[0]), isNegative, false)
+	}
+	for _, v := range values {
+		if len(v) == 0 {
+			// Empty value must match time series without the given key.
+			// Fall back to regexp filter, which properly handles this case.
+			return tfs.Add(key, []byte(getSetRegexp(values)), isNegative, true)
+		}
+	}
+	tf := tfs.addTagFilter()
+	tf.InitFromSet(tfs.commonPrefix, key, values, isNegative)
+	return nil
+}
+
+func getSetRegexp(values []string) string {
+	a := make([]string, len(values))
+	for i, v := range values {
+		a[i] = regexp.QuoteMeta(v)
+	}
+	return strings.Join(a, "|")
+}
+
 func (tfs *TagFilters) addTagFilter() *tagFilter {
 	if cap(tfs.tfs) > len(tfs.tfs) {
 		tfs.tfs = tfs.tfs[:len(tfs.tfs)+1]
@@ -392,6 +428,46 @@ func (tf *tagFilter) InitFromGraphiteQuery(commonPrefix, query []byte, paths []s
 	tf.reSuffixMatch, tf.matchCost = newMatchFuncForOrSuffixes(orSuffixes)
 }
 
+// InitFromSet initializes tf from the given set of non-empty values.
+//
+// The initialized tf is equivalent to {key=~"value1|...|valueN"} regexp filter.
+func (tf *tagFilter) InitFromSet(commonPrefix, key []byte, values []string, isNegative bool) {
+	// Sort values and remove duplicates for faster seek later.
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	values = slices.Compact(values)
+
+	prefix, suffixes := getCommonPrefix(values)
+
+	// orSuffixes must contain escaped values in the same way as for regexp filters,
+	// since they are matched against escaped tag values.
+	orSuffixes := make([]string, len(suffixes))
+	m := make(map[string]struct{}, len(suffixes))
+	var buf []byte
+	for i, suffix := range suffixes {
+		buf = marshalTagValueNoTrailingTagSeparator(buf[:0], suffix)
+		orSuffixes[i] = string(buf)
+		m[orSuffixes[i]] = struct{}{}
+	}
+
+	tf.key = append(tf.key[:0], key...)
+	tf.value = append(tf.value[:0], getSetRegexp(values)...)
+	tf.isNegative = isNegative
+	tf.isRegexp = true // this is needed for tagFilter.matchSuffix
+	tf.regexpPrefix = prefix
+	tf.prefix = append(tf.prefix[:0], commonPrefix...)
+	tf.prefix = marshalTagValue(tf.prefix, key)
+	tf.prefix = marshalTagValueNoTrailingTagSeparator(tf.prefix, prefix)
+	tf.orSuffixes = append(tf.orSuffixes[:0], orSuffixes...)
+	tf.reSuffixMatch = func(b []byte) bool {
+		_, ok := m[string(b)]
+		return ok
+	}
+	tf.matchCost = literalMatchCost
+	tf.isEmptyMatch = false
+	tf.graphiteReverseSuffix = tf.graphiteReverseSuffix[:0]
+}
+
 func getCommonPrefix(ss []string) (string, []string) {
 	if len(ss) == 0 {
 		return "", nil
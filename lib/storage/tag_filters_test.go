@@ -2,6 +2,7 @@ package storage
 
 import (
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -1201,6 +1202,80 @@ func TestSimplifyRegexp(t *testing.T) {
 	f("(foo|bar$)x*", "", "(?-m:(?:foo|bar$)x*)")
 }
 
+func TestTagFiltersAddRegexpPrefix(t *testing.T) {
+	key := []byte("instance")
+	values := []string{"", "abc", "barfoo", "fo", "foo", "foobar", "foobarx", "fooxbar", "fooxyz", "xfoobar"}
+
+	// Prepare sorted index keys for the tag values in the same way as they are stored in the indexdb.
+	commonPrefix := marshalCommonPrefix(nil, nsPrefixTagToMetricIDs)
+	var indexKeys []string
+	for _, v := range values {
+		b := append([]byte{}, commonPrefix...)
+		b = marshalTagValue(b, key)
+		b = marshalTagValue(b, []byte(v))
+		indexKeys = append(indexKeys, string(b))
+	}
+	sort.Strings(indexKeys)
+
+	f := func(re, regexpPrefixExpected string, scannedExpected, matchesExpected []string) {
+		t.Helper()
+
+		tfs := NewTagFilters()
+		if err := tfs.Add(key, []byte(re), false, true); err != nil {
+			t.Fatalf("cannot add regexp filter %q: %s", re, err)
+		}
+		if len(tfs.tfs) != 1 {
+			t.Fatalf("unexpected number of tag filters; got %d; want 1", len(tfs.tfs))
+		}
+		tf := &tfs.tfs[0]
+		if tf.regexpPrefix != regexpPrefixExpected {
+			t.Fatalf("unexpected regexpPrefix for %q; got %q; want %q", re, tf.regexpPrefix, regexpPrefixExpected)
+		}
+
+		// The index scan starts at tf.prefix and stops at the first key without tf.prefix.
+		// See indexSearch.getMetricIDsForTagFilterSlow.
+		var scanned, matches []string
+		n := sort.SearchStrings(indexKeys, string(tf.prefix))
+		for _, k := range indexKeys[n:] {
+			if !strings.HasPrefix(k, string(tf.prefix)) {
+				break
+			}
+			tail, _, err := unmarshalTagValue(nil, []byte(k[len(commonPrefix):]))
+			if err != nil {
+				t.Fatalf("cannot unmarshal key: %s", err)
+			}
+			_, v, err := unmarshalTagValue(nil, tail)
+			if err != nil {
+				t.Fatalf("cannot unmarshal value: %s", err)
+			}
+			scanned = append(scanned, string(v))
+
+			ok, err := tf.match([]byte(k))
+			if err != nil {
+				t.Fatalf("unexpected error when matching %q against %q: %s", v, re, err)
+			}
+			if ok {
+				matches = append(matches, string(v))
+			}
+		}
+		if !reflect.DeepEqual(scanned, scannedExpected) {
+			t.Fatalf("unexpected scanned values for %q; got %q; want %q", re, scanned, scannedExpected)
+		}
+		if !reflect.DeepEqual(matches, matchesExpected) {
+			t.Fatalf("unexpected matching values for %q; got %q; want %q", re, matches, matchesExpected)
+		}
+	}
+
+	// The literal prefix narrows down the scan to values starting with "foo".
+	f("foo.*bar", "foo", []string{"foo", "foobar", "foobarx", "fooxbar", "fooxyz"}, []string{"foobar", "fooxbar"})
+	f("foo.+", "foo", []string{"foo", "foobar", "foobarx", "fooxbar", "fooxyz"}, []string{"foobar", "foobarx", "fooxbar", "fooxyz"})
+	f("foob(ar|az)x?", "fooba", []string{"foobar", "foobarx"}, []string{"foobar", "foobarx"})
+
+	// Regexps without literal prefix must scan all the values.
+	f(".*foo.*", "", values, []string{"barfoo", "foo", "foobar", "foobarx", "fooxbar", "fooxyz", "xfoobar"})
+	f("(?i)foo.*", "", values, []string{"foo", "foobar", "foobarx", "fooxbar", "fooxyz"})
+}
+
 func TestTagFiltersString(t *testing.T) {
 	tfs := NewTagFilters()
 	mustAdd := func(key, value string, isNegative, isRegexp bool) {
@@ -1289,3 +1364,78 @@ func TestTagFiltersAddEmpty(t *testing.T) {
 		t.Fatalf("missing added filter")
 	}
 }
+
+func TestTagFiltersAddSet(t *testing.T) {
+	commonPrefix := []byte("prefix")
+	key := []byte("key")
+
+	f := func(values []string, isNegative bool, valueExpected string, matches, mismatches []string) {
+		t.Helper()
+
+		tfs := NewTagFilters()
+		tfs.commonPrefix = commonPrefix
+		if err := tfs.AddSet(key, values, isNegative); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(tfs.tfs) != 1 {
+			t.Fatalf("unexpected number of tag filters; got %d; want 1", len(tfs.tfs))
+		}
+		tf := &tfs.tfs[0]
+		if string(tf.value) != valueExpected {
+			t.Fatalf("unexpected tf.value; got %q; want %q", tf.value, valueExpected)
+		}
+		if tf.isNegative != isNegative {
+			t.Fatalf("unexpected tf.isNegative; got %v; want %v", tf.isNegative, isNegative)
+		}
+
+		// Verify that tf matches the same values as the equivalent regexp filter.
+		var tfRe tagFilter
+		if err := tfRe.Init(commonPrefix, key, tf.value, isNegative, true); err != nil {
+			t.Fatalf("cannot initialize regexp filter: %s", err)
+		}
+		check := func(value string, resultExpected bool) {
+			t.Helper()
+			b := append([]byte{}, commonPrefix...)
+			b = marshalTagValue(b, key)
+			b = marshalTagValue(b, []byte(value))
+			ok, err := tf.match(b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if ok != resultExpected {
+				t.Fatalf("unexpected match result for %s on %q; got %v; want %v", tf, value, ok, resultExpected)
+			}
+			okRe, err := tfRe.match(b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if okRe != ok {
+				t.Fatalf("unexpected match result for %q; got %v; regexp filter %s returns %v", value, ok, &tfRe, okRe)
+			}
+		}
+		for _, v := range matches {
+			check(v, true)
+		}
+		for _, v := range mismatches {
+			check(v, false)
+		}
+	}
+
+	f([]string{"foo"}, false, "foo", []string{"foo"}, []string{"", "fo", "foobar", "bar"})
+	f([]string{"foo"}, true, "foo", []string{"", "fo", "foobar", "bar"}, []string{"foo"})
+	f([]string{"foo", "bar", "baz"}, false, "bar|baz|foo", []string{"foo", "bar", "baz"}, []string{"", "ba", "fo", "foobar", "barz", "x"})
+	f([]string{"foo", "bar", "baz"}, true, "bar|baz|foo", []string{"", "ba", "fo", "foobar", "barz", "x"}, []string{"foo", "bar", "baz"})
+	f([]string{"foo1", "foo2", "foo1", "foo34"}, false, "foo1|foo2|foo34", []string{"foo1", "foo2", "foo34"}, []string{"foo", "foo3", "foo12", "bar"})
+	f([]string{"foo\x00", "foo\x01\x02", "\x02"}, false, "\x02|foo\x00|foo\x01\x02", []string{"foo\x00", "foo\x01\x02", "\x02"}, []string{"foo", "foo\x01", "\x00"})
+	f([]string{"a.b", "a*b", "(x)"}, false, `\(x\)|a\*b|a\.b`, []string{"a.b", "a*b", "(x)"}, []string{"axb", "ab", "x", "aab"})
+
+	// A set with an empty value must match time series without the given key.
+	f([]string{"foo", ""}, false, "foo|", []string{"", "foo"}, []string{"bar", "fooo"})
+}
+
+func TestTagFiltersAddSetFailure(t *testing.T) {
+	tfs := NewTagFilters()
+	if err := tfs.AddSet([]byte("key"), nil, false); err == nil {
+		t.Fatalf("expecting non-nil error for empty set")
+	}
+}